@@ -1,23 +1,39 @@
 package main
 
 import (
+	"database/sql"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
+	"path/filepath"
 	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/Eggbertx/territories-game/pkg/actions"
 	"github.com/Eggbertx/territories-game/pkg/config"
 	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
+	"github.com/Eggbertx/territories-game/pkg/replay"
+	"github.com/Eggbertx/territories-game/pkg/server"
 	"github.com/Eggbertx/territories-game/pkg/svgmap"
 	_ "github.com/mattn/go-sqlite3"
 	"golang.org/x/term"
 )
 
+const (
+	serverReadHeaderTimeout = 10 * time.Second
+	serverReadTimeout       = 30 * time.Second
+	// serverWriteTimeout is longer since actions update the map before responding
+	serverWriteTimeout = 2 * time.Minute
+)
+
 var (
-	validActionTypes  = slog.AnyValue([]string{"join", "color", "raise", "move", "attack", "help", "-h"})
+	validActionTypes  = slog.AnyValue([]string{"join", "color", "raise", "move", "attack", "deploy", "propose", "accept", "break", "cede", "leave", "remove", "pick", "scout", "plan", "serve", "replay", "timelapse", "help", "-h"})
 	logger            *slog.Logger
 	runningInTerminal = term.IsTerminal(int(os.Stdin.Fd()))
 )
@@ -25,6 +41,9 @@ var (
 type Config struct {
 	config.Config
 	LogFile string `json:"logFile"`
+
+	// Games are additional games stored in the same database. Each must have a unique gameID
+	Games []config.Config `json:"games"`
 }
 
 // resolveArgs is used for debugging purposes to allow passing arguments through environment variables
@@ -50,6 +69,210 @@ func resolveArgs() []string {
 	return args
 }
 
+// openGames opens the configured database and returns a handle for each configured game, starting with the default
+// game. The returned database should be closed when the games are no longer needed
+func openGames() (*sql.DB, []*game.Game, error) {
+	configs, err := config.GetGameConfigs()
+	if err != nil {
+		return nil, nil, err
+	}
+	tdb, err := db.Open(configs[0].DBFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to initialize database: %w", err)
+	}
+	games := make([]*game.Game, 0, len(configs))
+	for _, cfg := range configs {
+		g, err := game.New(cfg, tdb)
+		if err != nil {
+			tdb.Close()
+			return nil, nil, fmt.Errorf("unable to initialize game %d: %w", cfg.GameID, err)
+		}
+		games = append(games, g)
+	}
+	return tdb, games, nil
+}
+
+// findGame returns the game with the given ID, or the default game if gameID is 0
+func findGame(games []*game.Game, gameID int64) (*game.Game, error) {
+	if gameID == 0 {
+		return games[0], nil
+	}
+	for _, g := range games {
+		if g.ID() == gameID {
+			return g, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %d", config.ErrUnknownGame, gameID)
+}
+
+// openGame opens the configured database and returns a handle for the game with the given ID (or the default game if
+// gameID is 0). The game's database should be closed when the game is no longer needed
+func openGame(gameID int64) (*game.Game, error) {
+	tdb, games, err := openGames()
+	if err != nil {
+		return nil, err
+	}
+	g, err := findGame(games, gameID)
+	if err != nil {
+		tdb.Close()
+		return nil, err
+	}
+	return g, nil
+}
+
+// closeDB closes the database, logging any error
+func closeDB(tdb *sql.DB) {
+	if err := tdb.Close(); err != nil {
+		logger.Error("Unable to close database", "error", err)
+	}
+}
+
+// serve runs the HTTP JSON API server until it fails
+func serve(addr string) error {
+	tdb, games, err := openGames()
+	if err != nil {
+		return err
+	}
+	defer closeDB(tdb)
+
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           server.New(true, games...),
+		ReadHeaderTimeout: serverReadHeaderTimeout,
+		ReadTimeout:       serverReadTimeout,
+		WriteTimeout:      serverWriteTimeout,
+	}
+	logger.Info("Starting server", "address", addr)
+	return srv.ListenAndServe()
+}
+
+// parseDeployments parses a comma separated list of territory:armies pairs, for example "CA:2,NV:1"
+func parseDeployments(str string) (map[string]int, error) {
+	deployments := make(map[string]int)
+	for _, pair := range strings.Split(str, ",") {
+		territory, armiesStr, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok || territory == "" {
+			return nil, fmt.Errorf("invalid deployment %q, expected territory:armies", pair)
+		}
+		armies, err := strconv.Atoi(armiesStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number of armies in deployment %q: %w", pair, err)
+		}
+		deployments[territory] = armies
+	}
+	return deployments, nil
+}
+
+// parsePlanSteps parses plan steps in the format "raise:TX,move:TX:OK:4,attack:OK:KS". The number of armies of a move
+// can be left out to move all of them
+func parsePlanSteps(str string) ([]actions.PlanStep, error) {
+	var steps []actions.PlanStep
+	for _, stepStr := range strings.Split(str, ",") {
+		fields := strings.Split(strings.TrimSpace(stepStr), ":")
+		step := actions.PlanStep{Type: fields[0]}
+		switch {
+		case step.Type == "raise" && len(fields) == 2:
+			step.Territory = fields[1]
+		case step.Type == "move" && (len(fields) == 3 || len(fields) == 4):
+			step.Source, step.Destination = fields[1], fields[2]
+			if len(fields) == 4 {
+				armies, err := strconv.Atoi(fields[3])
+				if err != nil {
+					return nil, fmt.Errorf("invalid number of armies in step %q: %w", stepStr, err)
+				}
+				step.Armies = armies
+			}
+		case step.Type == "attack" && len(fields) == 3:
+			step.AttackingTerritory, step.DefendingTerritory = fields[1], fields[2]
+		default:
+			return nil, fmt.Errorf("invalid step %q, expected raise:territory, move:source:destination[:armies], or attack:attacking:defending", stepStr)
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+// turnFilename returns the filename with "-turn-N" added before the extension
+func turnFilename(filename string, turn int) string {
+	ext := filepath.Ext(filename)
+	return fmt.Sprintf("%s-turn-%d%s", strings.TrimSuffix(filename, ext), turn, ext)
+}
+
+// replayGame verifies or repairs the database using the action log if verify or repair are true, and otherwise
+// renders the map as it was at the end of the given turn
+func replayGame(gameID int64, turn int, verify, repair bool, svgOut, pngOut string) error {
+	g, err := openGame(gameID)
+	if err != nil {
+		return err
+	}
+	defer closeDB(g.DB())
+	cfg := g.Config()
+
+	if verify || repair {
+		var discrepancies []replay.Discrepancy
+		if repair {
+			discrepancies, err = replay.Repair(g.DB(), g.ID())
+		} else {
+			discrepancies, err = replay.Verify(g.DB(), g.ID())
+		}
+		if err != nil {
+			return err
+		}
+		for _, discrepancy := range discrepancies {
+			logger.Warn("Database differs from the action log", "discrepancy", discrepancy.String())
+		}
+		if len(discrepancies) == 0 {
+			logger.Info("Database is consistent with the action log")
+		} else if repair {
+			logger.Info("Rebuilt nations and holdings from the action log", "discrepancies", len(discrepancies))
+		} else {
+			return fmt.Errorf("found %d discrepancies between the database and the action log", len(discrepancies))
+		}
+		return nil
+	}
+
+	state, err := replay.Rebuild(g.DB(), g.ID(), turn)
+	if err != nil {
+		return err
+	}
+	memDB, err := state.OpenMemoryDB()
+	if err != nil {
+		return err
+	}
+	defer memDB.Close()
+
+	if svgOut == "" {
+		svgOut = turnFilename(cfg.SVGOutFile, state.Turn)
+	}
+	if pngOut == "" {
+		pngOut = turnFilename(cfg.PNGOutFile, state.Turn)
+	}
+	if err = svgmap.RenderMap(memDB, cfg, svgOut, pngOut); err != nil {
+		return err
+	}
+	logger.Info("Rendered map", "turn", state.Turn, "actions", state.Actions, "svg", svgOut, "png", pngOut)
+	return nil
+}
+
+// timelapse renders an animated GIF of the game from the action log
+func timelapse(gameID int64, out string, opts svgmap.TimelapseOptions) error {
+	g, err := openGame(gameID)
+	if err != nil {
+		return err
+	}
+	defer closeDB(g.DB())
+	cfg := g.Config()
+
+	if out == "" {
+		out = strings.TrimSuffix(cfg.PNGOutFile, filepath.Ext(cfg.PNGOutFile)) + "-timelapse.gif"
+	}
+	if err = svgmap.RenderTimelapse(g, out, opts); err != nil {
+		return err
+	}
+	logger.Info("Rendered timelapse", "file", out)
+	return nil
+}
+
 func main() {
 	jsonOutput := !runningInTerminal
 	if !jsonOutput {
@@ -96,6 +319,14 @@ func main() {
 		logger.Error("Unable to set config", "error", err)
 		os.Exit(1)
 	}
+	for g := range cfg.Games {
+		cfg.Games[g].LogInfo = cfg.LogInfo
+		cfg.Games[g].LogError = cfg.LogError
+		if err = config.AddGameConfig(&cfg.Games[g]); err != nil {
+			logger.Error("Unable to add game config", "gameID", cfg.Games[g].GameID, "error", err)
+			os.Exit(1)
+		}
+	}
 
 	if len(args) == 0 {
 		logger.Error("No action specified", "validActions", validActionTypes)
@@ -123,16 +354,18 @@ func main() {
 
 	var user string
 	var armies int
-	var action actions.Action
+	var gameID int64
+	var action actions.GameAction
 	switch actionType {
 	case "join":
 		var nation string
 		var territory string
 		flagSet := flag.NewFlagSet("", flag.ExitOnError)
 		flagSet.StringVar(&user, "user", "", "the user that is joining the game")
+		flagSet.Int64Var(&gameID, "game", 0, "the ID of the game the action is done in (default: the default game)")
 		flagSet.BoolVar(&jsonOutput, "json", false, "log output in JSON format")
 		flagSet.StringVar(&nation, "nation", "", "the name of the nation the user is joining")
-		flagSet.StringVar(&territory, "territory", "", "the territory the user is joining")
+		flagSet.StringVar(&territory, "territory", "", "the territory the user is joining, if the game's setup mode is claim")
 		flagSet.Parse(args[1:])
 		action = &actions.JoinAction{
 			User:      user,
@@ -143,6 +376,7 @@ func main() {
 		var color string
 		flagSet := flag.NewFlagSet("", flag.ExitOnError)
 		flagSet.StringVar(&user, "user", "", "the user that is changing their color")
+		flagSet.Int64Var(&gameID, "game", 0, "the ID of the game the action is done in (default: the default game)")
 		flagSet.BoolVar(&jsonOutput, "json", false, "log output in JSON format")
 		flagSet.StringVar(&color, "color", "", "the new color for the user")
 		flagSet.Parse(args[1:])
@@ -154,6 +388,7 @@ func main() {
 		var territory string
 		flagSet := flag.NewFlagSet("", flag.ExitOnError)
 		flagSet.StringVar(&user, "user", "", "the user that is raising armies")
+		flagSet.Int64Var(&gameID, "game", 0, "the ID of the game the action is done in (default: the default game)")
 		flagSet.BoolVar(&jsonOutput, "json", false, "log output in JSON format")
 		flagSet.StringVar(&territory, "territory", "", "the territory where the user is raising the army size")
 		flagSet.Parse(args[1:])
@@ -166,6 +401,7 @@ func main() {
 		var destinationTerritory string
 		flagSet := flag.NewFlagSet("", flag.ExitOnError)
 		flagSet.StringVar(&user, "user", "", "the user that is moving armies")
+		flagSet.Int64Var(&gameID, "game", 0, "the ID of the game the action is done in (default: the default game)")
 		flagSet.BoolVar(&jsonOutput, "json", false, "log output in JSON format")
 		flagSet.IntVar(&armies, "armies", 0, "the number of armies to move")
 		flagSet.StringVar(&sourceTerritory, "source", "", "the territory from which the user is moving armies")
@@ -182,6 +418,7 @@ func main() {
 		var defendingTerritory string
 		flagSet := flag.NewFlagSet("", flag.ExitOnError)
 		flagSet.StringVar(&user, "user", "", "the user that is attacking")
+		flagSet.Int64Var(&gameID, "game", 0, "the ID of the game the action is done in (default: the default game)")
 		flagSet.BoolVar(&jsonOutput, "json", false, "log output in JSON format")
 		flagSet.StringVar(&attackingTerritory, "attacking", "", "the territory from which the user is attacking")
 		flagSet.StringVar(&defendingTerritory, "defending", "", "the territory that is being attacked")
@@ -191,6 +428,189 @@ func main() {
 			AttackingTerritory: attackingTerritory,
 			DefendingTerritory: defendingTerritory,
 		}
+	case "deploy":
+		var deployments string
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&user, "user", "", "the user that is deploying reinforcements")
+		flagSet.Int64Var(&gameID, "game", 0, "the ID of the game the action is done in (default: the default game)")
+		flagSet.BoolVar(&jsonOutput, "json", false, "log output in JSON format")
+		flagSet.StringVar(&deployments, "armies", "", "comma separated territory:armies pairs, for example CA:2,NV:1")
+		flagSet.Parse(args[1:])
+		deployAction := &actions.DeployAction{User: user}
+		if deployments != "" {
+			if deployAction.Armies, err = parseDeployments(deployments); err != nil {
+				logger.Error("Unable to parse deployments", "error", err)
+				os.Exit(1)
+			}
+		}
+		action = deployAction
+	case "propose":
+		var recipient, treaty string
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&user, "user", "", "the user that is proposing the treaty")
+		flagSet.Int64Var(&gameID, "game", 0, "the ID of the game the action is done in (default: the default game)")
+		flagSet.BoolVar(&jsonOutput, "json", false, "log output in JSON format")
+		flagSet.StringVar(&recipient, "to", "", "the player or country name of the nation the treaty is proposed to")
+		flagSet.StringVar(&treaty, "treaty", "alliance", "the type of treaty, alliance or non_aggression")
+		flagSet.Parse(args[1:])
+		action = &actions.ProposeAction{
+			User:      user,
+			Recipient: recipient,
+			Treaty:    treaty,
+		}
+	case "accept":
+		var proposer, territory string
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&user, "user", "", "the user that is accepting the treaty")
+		flagSet.Int64Var(&gameID, "game", 0, "the ID of the game the action is done in (default: the default game)")
+		flagSet.BoolVar(&jsonOutput, "json", false, "log output in JSON format")
+		flagSet.StringVar(&proposer, "from", "", "the player or country name of the nation that proposed the treaty or offered the territory")
+		flagSet.StringVar(&territory, "territory", "", "the territory offered with cede, if accepting a territory instead of a treaty")
+		flagSet.Parse(args[1:])
+		action = &actions.AcceptAction{
+			User:      user,
+			Proposer:  proposer,
+			Territory: territory,
+		}
+	case "break":
+		var with string
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&user, "user", "", "the user that is breaking the treaty")
+		flagSet.Int64Var(&gameID, "game", 0, "the ID of the game the action is done in (default: the default game)")
+		flagSet.BoolVar(&jsonOutput, "json", false, "log output in JSON format")
+		flagSet.StringVar(&with, "with", "", "the player or country name of the other nation in the treaty")
+		flagSet.Parse(args[1:])
+		action = &actions.BreakAction{
+			User: user,
+			With: with,
+		}
+	case "cede":
+		var territory, recipient string
+		var withArmies bool
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&user, "user", "", "the user that is offering the territory")
+		flagSet.Int64Var(&gameID, "game", 0, "the ID of the game the action is done in (default: the default game)")
+		flagSet.BoolVar(&jsonOutput, "json", false, "log output in JSON format")
+		flagSet.StringVar(&territory, "territory", "", "the territory being offered")
+		flagSet.StringVar(&recipient, "to", "", "the player or country name of the nation the territory is offered to")
+		flagSet.BoolVar(&withArmies, "with-armies", false, "give the armies in the territory along with it")
+		flagSet.Parse(args[1:])
+		action = &actions.CedeAction{
+			User:       user,
+			Territory:  territory,
+			Recipient:  recipient,
+			WithArmies: withArmies,
+		}
+	case "leave":
+		var heir string
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&user, "user", "", "the user that is leaving the game")
+		flagSet.Int64Var(&gameID, "game", 0, "the ID of the game the action is done in (default: the default game)")
+		flagSet.BoolVar(&jsonOutput, "json", false, "log output in JSON format")
+		flagSet.StringVar(&heir, "heir", "", "the player or country name of the nation that gets the territories, if the leave policy is heir")
+		flagSet.Parse(args[1:])
+		action = &actions.LeaveAction{
+			User: user,
+			Heir: heir,
+		}
+	case "remove":
+		var player, heir string
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&player, "player", "", "the player whose nation is being removed from the game")
+		flagSet.Int64Var(&gameID, "game", 0, "the ID of the game the action is done in (default: the default game)")
+		flagSet.BoolVar(&jsonOutput, "json", false, "log output in JSON format")
+		flagSet.StringVar(&heir, "heir", "", "the player or country name of the nation that gets the territories, if the leave policy is heir")
+		flagSet.Parse(args[1:])
+		action = &actions.RemoveAction{
+			Player: player,
+			Heir:   heir,
+		}
+	case "pick":
+		var territory string
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&user, "user", "", "the user that is picking the territory")
+		flagSet.Int64Var(&gameID, "game", 0, "the ID of the game the action is done in (default: the default game)")
+		flagSet.BoolVar(&jsonOutput, "json", false, "log output in JSON format")
+		flagSet.StringVar(&territory, "territory", "", "the territory being picked")
+		flagSet.Parse(args[1:])
+		action = &actions.PickAction{
+			User:      user,
+			Territory: territory,
+		}
+	case "scout":
+		var territory string
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&user, "user", "", "the user that is scouting the territory")
+		flagSet.Int64Var(&gameID, "game", 0, "the ID of the game the action is done in (default: the default game)")
+		flagSet.BoolVar(&jsonOutput, "json", false, "log output in JSON format")
+		flagSet.StringVar(&territory, "territory", "", "the territory being scouted")
+		flagSet.Parse(args[1:])
+		action = &actions.ScoutAction{
+			User:      user,
+			Territory: territory,
+		}
+	case "plan":
+		var steps string
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&user, "user", "", "the user that is doing the plan")
+		flagSet.Int64Var(&gameID, "game", 0, "the ID of the game the action is done in (default: the default game)")
+		flagSet.BoolVar(&jsonOutput, "json", false, "log output in JSON format")
+		flagSet.StringVar(&steps, "steps", "", "comma separated steps, for example raise:TX,move:TX:OK:4,attack:OK:KS")
+		flagSet.Parse(args[1:])
+		planAction := &actions.PlanAction{User: user}
+		if steps != "" {
+			if planAction.Steps, err = parsePlanSteps(steps); err != nil {
+				logger.Error("Unable to parse plan steps", "error", err)
+				os.Exit(1)
+			}
+		}
+		action = planAction
+	case "serve":
+		var addr string
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&addr, "addr", ":8080", "the address the server will listen on")
+		flagSet.BoolVar(&jsonOutput, "json", false, "log output in JSON format")
+		flagSet.Parse(args[1:])
+		if err = serve(addr); err != nil {
+			logger.Error("Server stopped", "error", err)
+			os.Exit(1)
+		}
+		return
+	case "replay":
+		var turn int
+		var verify, repair bool
+		var svgOut, pngOut string
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.IntVar(&turn, "turn", 0, "the turn to render the map at the end of (default: the current turn)")
+		flagSet.BoolVar(&verify, "verify", false, "check that the database matches the state rebuilt from the action log")
+		flagSet.BoolVar(&repair, "repair", false, "replace the nations and holdings with the state rebuilt from the action log")
+		flagSet.StringVar(&svgOut, "svg", "", "the SVG file to write (default: the configured SVG file with -turn-N added)")
+		flagSet.StringVar(&pngOut, "png", "", "the PNG file to write (default: the configured PNG file with -turn-N added)")
+		flagSet.BoolVar(&jsonOutput, "json", false, "log output in JSON format")
+		flagSet.Int64Var(&gameID, "game", 0, "the ID of the game to replay (default: the default game)")
+		flagSet.Parse(args[1:])
+		if err = replayGame(gameID, turn, verify, repair, svgOut, pngOut); err != nil {
+			logger.Error("Unable to replay game", "error", err)
+			os.Exit(1)
+		}
+		return
+	case "timelapse":
+		var out string
+		var opts svgmap.TimelapseOptions
+		flagSet := flag.NewFlagSet("", flag.ExitOnError)
+		flagSet.StringVar(&out, "out", "", "the GIF file to write (default: the configured PNG file with -timelapse.gif as the extension)")
+		flagSet.BoolVar(&opts.PerAction, "per-action", false, "render a frame after each action instead of at the end of each turn")
+		flagSet.DurationVar(&opts.FrameDelay, "delay", time.Second, "how long each frame is shown")
+		flagSet.DurationVar(&opts.LastFrameDelay, "last-delay", 3*time.Second, "how long the last frame is shown before the animation loops")
+		flagSet.Float64Var(&opts.Scale, "scale", 0.5, "the size of the frames relative to the map's size")
+		flagSet.BoolVar(&jsonOutput, "json", false, "log output in JSON format")
+		flagSet.Int64Var(&gameID, "game", 0, "the ID of the game to render (default: the default game)")
+		flagSet.Parse(args[1:])
+		if err = timelapse(gameID, out, opts); err != nil {
+			logger.Error("Unable to render timelapse", "error", err)
+			os.Exit(1)
+		}
+		return
 	case "help", "-h":
 		logger.Info(fmt.Sprintf("usage: %s <action> [args...]", os.Args[0]), "validActions", validActionTypes)
 		os.Exit(0)
@@ -203,20 +623,17 @@ func main() {
 		os.Exit(1)
 	}
 
-	db, err := db.GetDB()
+	g, err := openGame(gameID)
 	if err != nil {
-		logger.Error("Unable to initialize database", "error", err)
+		logger.Error("Unable to open game", "gameID", gameID, "error", err)
+		os.Exit(1)
 	}
+	defer closeDB(g.DB())
+	action.SetGame(gameID)
 
-	defer func() {
-		if err := db.Close(); err != nil {
-			logger.Error("Unable to close database", "error", err)
-		}
-	}()
-
-	actionResult, err := action.DoAction(db)
+	actionResult, err := action.Do(g)
 	if err != nil {
-		// assume that any error returned from DoAction is already logged
+		// assume that any error returned from Do is already logged
 		os.Exit(1)
 	}
 
@@ -237,11 +654,18 @@ func main() {
 	case *actions.AttackActionResult:
 		action := *result.Action
 		logger.Info(resultMsg, "attacking", action.AttackingTerritory, "defending", action.DefendingTerritory)
+	case *actions.DeployActionResult:
+		logger.Info(resultMsg, "remaining", result.Remaining)
+	case *actions.PlanActionResult:
+		logger.Info(resultMsg, "steps", len(result.Results))
 	default:
 		logger.Error("Unknown action result", "actionType", actionResult.ActionType())
 	}
+	if victory := actions.GameOver(actionResult); victory != nil {
+		logger.Info(victory.String(), "winner", victory.Winner, "condition", victory.Condition)
+	}
 
-	if err = svgmap.ApplyDBEvents(); err != nil {
+	if err = svgmap.ApplyEvents(g); err != nil {
 		logger.Error("Unable to apply database events to map", "error", err)
 		os.Exit(1)
 	}
@@ -8,6 +8,7 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.44
 	github.com/mazznoer/csscolorparser v0.1.8
 	github.com/stretchr/testify v1.11.1
+	golang.org/x/image v0.25.0
 	golang.org/x/term v0.42.0
 )
 
@@ -4,27 +4,55 @@ import (
 	"database/sql"
 
 	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
 )
 
 var (
 	ErrInvalidAction            error = &ActionError{msg: `action must be join, move, or attack`}
 	ErrNoTargetTerritory        error = &ActionError{msg: "missing target territory name or abbreviation"}
 	ErrTerritoryAlreadyOccupied error = &ActionError{msg: "the territory is already occupied"}
-	testInt                     int   // for testing purposes, to avoid random number generation in tests
-	useTestInt                  bool
+
+	randomSourceOverride db.RandomSource
 )
 
 const (
 	noActionString = "no action performed"
 )
 
-// Action is the interface that all in-game actions must implement
+// Action is the interface that all in-game actions must implement. Do does the action in the given game, ignoring the
+// game the action refers to. DoAction is kept for compatibility and does the action in the game the action refers to
+// (see GameRef), or the game of the active configuration, using the given database. Do should be used instead.
 type Action interface {
 	DoAction(db *sql.DB) (ActionResult, error)
+	Do(g *game.Game) (ActionResult, error)
+}
+
+// GameAction is implemented by actions that can be done in any game in the database, which all built-in actions do by
+// embedding GameRef
+type GameAction interface {
+	Action
+	Game() int64
+	SetGame(gameID int64)
+}
+
+// GameRef identifies the game an action is done in. The zero value refers to the default game (the game of the active
+// configuration)
+type GameRef struct {
+	GameID int64 `json:"game,omitempty"`
+}
+
+// Game returns the ID of the game the action is done in, or 0 for the default game
+func (gr *GameRef) Game() int64 {
+	return gr.GameID
 }
 
-// ActionResult is the interface returned by a successful DoAction call. A successful DoAction call
-// does not guarantee that the action done was successful (e.g., an attack may fail).
+// SetGame sets the ID of the game the action is done in
+func (gr *GameRef) SetGame(gameID int64) {
+	gr.GameID = gameID
+}
+
+// ActionResult is the interface returned by a successful Do or DoAction call. A successful call does not guarantee that
+// the action done was successful (e.g., an attack may fail).
 type ActionResult interface {
 	ActionType() string
 	User() string
@@ -32,8 +60,19 @@ type ActionResult interface {
 }
 
 type actionResultBase[a Action] struct {
-	Action *a
+	Action *a `json:"action"`
 	user   string
+
+	// Victory announces the winner of the game if the action ended it
+	Victory *VictoryResult `json:"victory,omitempty"`
+}
+
+func (arb *actionResultBase[a]) victory() *VictoryResult {
+	return arb.Victory
+}
+
+func (arb *actionResultBase[a]) setVictory(victory *VictoryResult) {
+	arb.Victory = victory
 }
 
 func (arb *actionResultBase[a]) User() string {
@@ -2,12 +2,19 @@ package actions
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/Eggbertx/durationutil"
+	"github.com/Eggbertx/territories-game/pkg/actions/turns"
 	"github.com/Eggbertx/territories-game/pkg/config"
 	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -499,8 +506,7 @@ var (
 			},
 			beforeEachEvent: func(t *testing.T, d *sql.DB, i int) error {
 				if i > 1 {
-					useTestInt = true
-					testInt = 19
+					SetRandomSource(fixedRandomSource(19))
 				}
 				return nil
 			},
@@ -517,6 +523,2013 @@ var (
 				assert.Zero(t, nation2Count, "expected Test User 2 to be eliminated")
 			},
 		},
+		{
+			desc: "surviving defender counterattacks",
+			events: []Action{
+				&JoinAction{
+					User:      "Test User",
+					Nation:    "Nation 1",
+					Territory: "CA",
+				},
+				&JoinAction{
+					User:      "Test User 2",
+					Nation:    "Nation 2",
+					Territory: "NV",
+				},
+				&AttackAction{
+					User:               "Test User",
+					AttackingTerritory: "CA",
+					DefendingTerritory: "NV",
+				},
+			},
+			doCounterattack: true,
+			beforeEachEvent: func(t *testing.T, d *sql.DB, i int) error {
+				if i > 1 {
+					SetRandomSource(fixedRandomSource(11))
+				}
+				return nil
+			},
+			doValidateQueries: func(t *testing.T, d *sql.DB, _ error) {
+				var attackingArmySize, defendingArmySize int
+				assert.NoError(t, d.QueryRow("SELECT army_size FROM holdings WHERE territory = 'CA'").Scan(&attackingArmySize))
+				assert.NoError(t, d.QueryRow("SELECT army_size FROM holdings WHERE territory = 'NV'").Scan(&defendingArmySize))
+				assert.Equal(t, 3, attackingArmySize)
+				assert.Equal(t, 1, defendingArmySize)
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				aar := results[2].(*AttackActionResult)
+				assert.Equal(t, 11, aar.DieRoll)
+				assert.Equal(t, 1, aar.Losses)
+				assert.True(t, aar.Counterattacked)
+				assert.Equal(t, 11, aar.CounterDieRoll)
+				assert.Equal(t, -1, aar.CounterLosses)
+				assert.Zero(t, aar.AttackerLosses())
+				assert.Equal(t, 2, aar.DefenderLosses())
+				assert.Equal(t,
+					"Test User attacked Nevada from California, attack succeeded (rolled 11) and 1 defending armies were lost; "+
+						"Nevada counterattacked California, counterattack failed (rolled 11) and 1 defending armies were lost",
+					aar.String())
+			},
+		},
+		{
+			desc: "destroyed defender can't counterattack",
+			events: []Action{
+				&JoinAction{
+					User:      "Test User",
+					Nation:    "Nation 1",
+					Territory: "CA",
+				},
+				&JoinAction{
+					User:      "Test User 2",
+					Nation:    "Nation 2",
+					Territory: "NV",
+				},
+				&AttackAction{
+					User:               "Test User",
+					AttackingTerritory: "CA",
+					DefendingTerritory: "NV",
+				},
+			},
+			doCounterattack: true,
+			beforeEachEvent: func(t *testing.T, d *sql.DB, i int) error {
+				if i > 1 {
+					SetRandomSource(fixedRandomSource(20))
+				}
+				return nil
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				aar := results[2].(*AttackActionResult)
+				assert.Equal(t, 3, aar.Losses)
+				assert.False(t, aar.Counterattacked)
+				if assert.NotNil(t, aar.NationRemoved) {
+					assert.Equal(t, "Nation 2", aar.NationRemoved.CountryName)
+				}
+			},
+		},
+	}
+	deployTestCases = []actionsTestCase{
+		{
+			desc: "valid deploy event",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&DeployAction{User: "Test User", Armies: map[string]int{"california": 1}},
+			},
+			doTurnChecking:        true,
+			doReinforcements:      true,
+			minimumPlayersToStart: 2,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				var armies int
+				assert.NoError(t, d.QueryRow("SELECT army_size FROM holdings WHERE territory = 'CA'").Scan(&armies))
+				assert.Equal(t, 4, armies)
+
+				nations, err := db.GetNations(d, config.DefaultGameID)
+				assert.NoError(t, err)
+				reinforcements := make(map[string]int)
+				for _, nation := range nations {
+					reinforcements[nation.Player] = nation.Reinforcements
+				}
+				assert.Equal(t, map[string]int{"Test User": 0, "Test User 2": 1}, reinforcements,
+					"expected each nation to be granted 1 army when the first turn ended")
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				dar := results[2].(*DeployActionResult)
+				assert.Equal(t, 0, dar.Remaining)
+				assert.Equal(t, map[string]int{"California": 1}, (*dar.Action).Armies)
+				assert.Equal(t, "Test User deployed 1 armies to California (1)", dar.String())
+			},
+		},
+		{
+			desc: "deploy more armies than granted",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&DeployAction{User: "Test User", Armies: map[string]int{"CA": 2}},
+			},
+			expectError:           true,
+			doTurnChecking:        true,
+			doReinforcements:      true,
+			minimumPlayersToStart: 2,
+		},
+		{
+			desc: "deploy to another player's territory",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&DeployAction{User: "Test User", Armies: map[string]int{"NV": 1}},
+			},
+			expectError:           true,
+			doTurnChecking:        true,
+			doReinforcements:      true,
+			minimumPlayersToStart: 2,
+		},
+		{
+			desc: "deploy without reinforcements enabled",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&DeployAction{User: "Test User", Armies: map[string]int{"CA": 1}},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, _ *sql.DB, err error) {
+				assert.ErrorIs(t, err, ErrReinforcementsDisabled)
+			},
+		},
+	}
+	diplomacyTestCases = []actionsTestCase{
+		{
+			desc: "allied nations can't attack each other",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&ProposeAction{User: "Test User", Recipient: "Nation 2"},
+				&AcceptAction{User: "Test User 2", Proposer: "Test User"},
+				&AttackAction{User: "Test User 2", AttackingTerritory: "NV", DefendingTerritory: "CA"},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				var actionErr *ActionError
+				assert.ErrorAs(t, err, &actionErr)
+				assert.EqualError(t, err, "cannot attack California: Test User 2 has an alliance with Test User")
+				treaties, err := db.GetTreaties(d, config.DefaultGameID)
+				assert.NoError(t, err)
+				if assert.Len(t, treaties, 1) {
+					assert.Equal(t, db.TreatyAlliance, treaties[0].Type)
+					assert.Equal(t, 1, treaties[0].AcceptedTurn)
+				}
+			},
+		},
+		{
+			desc: "valid non-aggression pact",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&ProposeAction{User: "Test User", Recipient: "Test User 2", Treaty: "Non-Aggression"},
+				&AcceptAction{User: "Test User 2", Proposer: "Nation 1"},
+			},
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				_, err = (&AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "NV"}).DoAction(d)
+				assert.ErrorContains(t, err, "has a non-aggression pact with")
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				assert.Equal(t, "Test User proposed a non-aggression pact to Test User 2", results[2].String())
+				assert.Equal(t, "Test User 2 accepted a non-aggression pact proposed by Test User", results[3].String())
+			},
+		},
+		{
+			desc: "pending treaty doesn't prevent attacks",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&ProposeAction{User: "Test User", Recipient: "Test User 2"},
+				&AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "NV"},
+			},
+			minimumPlayersToStart: 1,
+		},
+		{
+			desc: "propose treaty to own nation",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&ProposeAction{User: "Test User", Recipient: "Nation 1"},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, _ *sql.DB, err error) {
+				assert.ErrorIs(t, err, ErrTreatyWithSelf)
+			},
+		},
+		{
+			desc: "propose invalid treaty type",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&ProposeAction{User: "Test User", Recipient: "Test User 2", Treaty: "trade"},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+		},
+		{
+			desc: "propose treaty when one is already pending",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&ProposeAction{User: "Test User", Recipient: "Test User 2"},
+				&ProposeAction{User: "Test User 2", Recipient: "Test User", Treaty: "non_aggression"},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+		},
+		{
+			desc: "proposer can't accept their own proposal",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&ProposeAction{User: "Test User", Recipient: "Test User 2"},
+				&AcceptAction{User: "Test User", Proposer: "Test User 2"},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+		},
+		{
+			desc: "broken treaty applies until the turn ends",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&ProposeAction{User: "Test User", Recipient: "Test User 2"},
+				&AcceptAction{User: "Test User 2", Proposer: "Test User"},
+				&BreakAction{User: "Test User", With: "Test User 2"},
+				&AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "NV"},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				assert.ErrorContains(t, err, "has an alliance with")
+				records, err := db.GetActionRecords(d, db.ActionRecordFilter{GameID: config.DefaultGameID})
+				assert.NoError(t, err)
+				if assert.Len(t, records, 5) {
+					assert.Equal(t, "break", records[4].ActionType)
+					assert.False(t, records[4].TurnAction)
+				}
+			},
+		},
+		{
+			desc: "broken treaty stops applying after the delay",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&ProposeAction{User: "Test User", Recipient: "Test User 2"},
+				&AcceptAction{User: "Test User 2", Proposer: "Test User"},
+				&BreakAction{User: "Test User 2", With: "Nation 1"},
+				&AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "NV"},
+			},
+			treatyBreakDelay:      1,
+			minimumPlayersToStart: 1,
+			beforeEachEvent: func(t *testing.T, d *sql.DB, e int) error {
+				if e != 5 {
+					return nil
+				}
+				// end two turns, the turn the treaty was broken in and the delay
+				for range 2 {
+					_, err := (&AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "NV"}).DoAction(d)
+					assert.ErrorContains(t, err, "has an alliance with")
+					if _, err = d.Exec("INSERT INTO actions (action_type, is_new_turn, turn_action) VALUES ('end_turn', 1, 0)"); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				treaties, err := db.GetTreaties(d, config.DefaultGameID)
+				assert.NoError(t, err)
+				assert.Empty(t, treaties)
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				bar := results[4].(*BreakActionResult)
+				assert.False(t, bar.Cancelled)
+				assert.Equal(t, 3, bar.Treaty.EndsTurn)
+				assert.Equal(t, "Test User 2 broke an alliance with Test User, it ends at the start of turn 3", bar.String())
+			},
+		},
+		{
+			desc: "break a pending treaty",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&ProposeAction{User: "Test User", Recipient: "Test User 2"},
+				&BreakAction{User: "Test User 2", With: "Test User"},
+				&ProposeAction{User: "Test User 2", Recipient: "Test User"},
+			},
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				treaties, err := db.GetTreaties(d, config.DefaultGameID)
+				assert.NoError(t, err)
+				if assert.Len(t, treaties, 1) {
+					assert.Equal(t, "Test User 2", treaties[0].Proposer)
+				}
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				bar := results[3].(*BreakActionResult)
+				assert.True(t, bar.Cancelled)
+				assert.Equal(t, "Test User 2 cancelled an alliance proposed between Test User and Test User 2", bar.String())
+			},
+		},
+		{
+			desc: "break a treaty that doesn't exist",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&BreakAction{User: "Test User", With: "Test User 2"},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+		},
+		{
+			desc: "move through allied territory",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&ProposeAction{User: "Test User", Recipient: "Test User 2"},
+				&AcceptAction{User: "Test User 2", Proposer: "Test User"},
+				&MoveAction{User: "Test User", Source: "CA", Destination: "UT", Armies: 2},
+			},
+			alliesCanMoveThrough:  true,
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				var armies int
+				assert.NoError(t, d.QueryRow("SELECT army_size FROM v_nation_holdings WHERE territory = 'UT' AND player = 'Test User'").Scan(&armies))
+				assert.Equal(t, 2, armies)
+			},
+		},
+		{
+			desc: "move through non-aggression pact territory",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&ProposeAction{User: "Test User", Recipient: "Test User 2", Treaty: "non_aggression"},
+				&AcceptAction{User: "Test User 2", Proposer: "Test User"},
+				&MoveAction{User: "Test User", Source: "CA", Destination: "UT"},
+			},
+			expectError:           true,
+			alliesCanMoveThrough:  true,
+			minimumPlayersToStart: 1,
+		},
+		{
+			desc: "move through allied territory when not allowed",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&ProposeAction{User: "Test User", Recipient: "Test User 2"},
+				&AcceptAction{User: "Test User 2", Proposer: "Test User"},
+				&MoveAction{User: "Test User", Source: "CA", Destination: "UT"},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+		},
+	}
+	cedeTestCases = []actionsTestCase{
+		{
+			desc: "cede territory with armies",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&MoveAction{User: "Test User", Source: "CA", Destination: "OR", Armies: 2},
+				&CedeAction{User: "Test User", Territory: "oregon", Recipient: "Nation 2", WithArmies: true},
+				&AcceptAction{User: "Test User 2", Proposer: "Test User", Territory: "OR"},
+			},
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				var armies int
+				assert.NoError(t, d.QueryRow("SELECT army_size FROM v_nation_holdings WHERE territory = 'OR' AND player = 'Test User 2'").Scan(&armies))
+				assert.Equal(t, 2, armies)
+				cessions, err := db.GetCessions(d, config.DefaultGameID)
+				assert.NoError(t, err)
+				assert.Empty(t, cessions)
+
+				records, err := db.GetActionRecords(d, db.ActionRecordFilter{GameID: config.DefaultGameID, ActionType: "accept"})
+				assert.NoError(t, err)
+				if assert.Len(t, records, 1) && assert.NotNil(t, records[0].Changes) {
+					assert.Equal(t, "Test User 2", records[0].Changes.Holdings["OR"].Player)
+				}
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				assert.Equal(t, "Test User offered Oregon to Test User 2 along with its armies", results[3].String())
+				acr := results[4].(*AcceptCessionActionResult)
+				assert.Nil(t, acr.NationRemoved)
+				assert.Equal(t, "Test User 2 accepted Oregon from Test User with 2 armies", acr.String())
+			},
+		},
+		{
+			desc: "cede last territory without armies",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&CedeAction{User: "Test User", Territory: "CA", Recipient: "Test User 2"},
+				&AcceptAction{User: "Test User 2", Proposer: "Nation 1", Territory: "California"},
+			},
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				var armies int
+				assert.NoError(t, d.QueryRow("SELECT army_size FROM v_nation_holdings WHERE territory = 'CA' AND player = 'Test User 2'").Scan(&armies))
+				assert.Equal(t, 1, armies)
+				nations, err := db.GetNations(d, config.DefaultGameID)
+				assert.NoError(t, err)
+				if assert.Len(t, nations, 1) {
+					assert.Equal(t, "Test User 2", nations[0].Player)
+				}
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				acr := results[3].(*AcceptCessionActionResult)
+				if assert.NotNil(t, acr.NationRemoved) {
+					assert.Equal(t, "Test User", acr.NationRemoved.Player)
+				}
+				assert.Equal(t, "Test User 2 accepted California from Test User with 1 armies; Nation 1 has no territories left and has been removed from the game", acr.String())
+			},
+		},
+		{
+			desc: "cede territory held by another nation",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&CedeAction{User: "Test User", Territory: "NV", Recipient: "Test User 2"},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+		},
+		{
+			desc: "cede territory to own nation",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&CedeAction{User: "Test User", Territory: "CA", Recipient: "Test User"},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, _ *sql.DB, err error) {
+				assert.ErrorIs(t, err, ErrCedeToSelf)
+			},
+		},
+		{
+			desc: "accept territory that wasn't offered",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&CedeAction{User: "Test User", Territory: "CA", Recipient: "Test User 2"},
+				&AcceptAction{User: "Test User", Proposer: "Test User 2", Territory: "CA"},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+		},
+		{
+			desc: "accept territory the giver no longer holds",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&MoveAction{User: "Test User", Source: "CA", Destination: "OR", Armies: 1},
+				&CedeAction{User: "Test User", Territory: "OR", Recipient: "Test User 2"},
+				&MoveAction{User: "Test User", Source: "OR", Destination: "CA"},
+				&AcceptAction{User: "Test User 2", Proposer: "Test User", Territory: "OR"},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				assert.ErrorContains(t, err, "has no offer of Oregon")
+				cessions, err := db.GetCessions(d, config.DefaultGameID)
+				assert.NoError(t, err)
+				assert.Empty(t, cessions)
+			},
+		},
+	}
+	leaveTestCases = []actionsTestCase{
+		{
+			desc: "leave and disband armies",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&LeaveAction{User: "Test User"},
+			},
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				holdings, err := db.GetHoldings(d, config.DefaultGameID)
+				assert.NoError(t, err)
+				if assert.Len(t, holdings, 1) {
+					assert.Equal(t, "NV", holdings[0].Territory)
+				}
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				assert.Equal(t, "Nation 1 left the game; its armies in California were disbanded", results[2].String())
+			},
+		},
+		{
+			desc: "leave territories to the neutral nation",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&LeaveAction{User: "Test User"},
+			},
+			leavePolicy:           config.LeavePolicyNeutral,
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				var armies int
+				var country string
+				assert.NoError(t, d.QueryRow("SELECT army_size, country_name FROM v_nation_holdings WHERE territory = 'CA' AND player = ?",
+					db.NeutralPlayer).Scan(&armies, &country))
+				assert.Equal(t, 3, armies)
+				assert.Equal(t, "Neutral", country)
+
+				cfg, err := config.GetConfig()
+				assert.NoError(t, err)
+				cfg.MinimumNationsToStart = 2
+				enough, players, err := db.EnoughPlayersToStart(d, nil, cfg)
+				assert.NoError(t, err)
+				assert.False(t, enough)
+				assert.Equal(t, 1, players, "expected the neutral nation to not be counted as a player")
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				assert.Equal(t, "Nation 1 left the game; its territories (California) became neutral", results[2].String())
+			},
+		},
+		{
+			desc: "leave territories to an heir",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&LeaveAction{User: "Test User", Heir: "Nation 2"},
+			},
+			leavePolicy:           config.LeavePolicyHeir,
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				var armies int
+				assert.NoError(t, d.QueryRow("SELECT army_size FROM v_nation_holdings WHERE territory = 'CA' AND player = 'Test User 2'").Scan(&armies))
+				assert.Equal(t, 3, armies)
+				nations, err := db.GetNations(d, config.DefaultGameID)
+				assert.NoError(t, err)
+				assert.Len(t, nations, 1)
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				assert.Equal(t, "Nation 1 left the game; its territories (California) were given to Test User 2", results[2].String())
+			},
+		},
+		{
+			desc: "leave without a required heir",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&LeaveAction{User: "Test User"},
+			},
+			expectError:           true,
+			leavePolicy:           config.LeavePolicyHeir,
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, _ *sql.DB, err error) {
+				assert.ErrorIs(t, err, ErrHeirRequired)
+			},
+		},
+		{
+			desc: "leave with an heir when not allowed",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&LeaveAction{User: "Test User", Heir: "Test User 2"},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, _ *sql.DB, err error) {
+				assert.ErrorIs(t, err, ErrHeirNotAllowed)
+			},
+		},
+		{
+			desc: "remove a player that is holding up the turn",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&RaiseAction{User: "Test User", Territory: "CA"},
+				&RemoveAction{Player: "Test User 2"},
+			},
+			doTurnChecking:        true,
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				turn, err := db.GetCurrentTurn(d, config.DefaultGameID)
+				assert.NoError(t, err)
+				assert.Equal(t, 3, turn, "expected the turn to end when the only player with actions left was removed")
+				records, err := db.GetActionRecords(d, db.ActionRecordFilter{GameID: config.DefaultGameID, ActionType: "remove"})
+				assert.NoError(t, err)
+				if assert.Len(t, records, 1) {
+					assert.Equal(t, "Test User 2", records[0].Player)
+				}
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				assert.Equal(t, "Nation 2 was removed from the game; its armies in Nevada were disbanded", results[3].String())
+			},
+		},
+		{
+			desc: "join as the neutral nation",
+			events: []Action{
+				&JoinAction{User: db.NeutralPlayer, Nation: "Nation 1", Territory: "CA"},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, _ *sql.DB, err error) {
+				assert.ErrorIs(t, err, db.ErrReservedPlayer)
+			},
+		},
+	}
+	neutralTestCases = []actionsTestCase{
+		{
+			desc: "join a neutral territory",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "NV"},
+			},
+			expectError:           true,
+			neutralTerritories:    []config.NeutralTerritory{{Territory: "NV", Armies: 2}},
+			minimumPlayersToStart: 1,
+		},
+		{
+			desc: "attack a neutral territory",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "NV"},
+			},
+			neutralTerritories:    []config.NeutralTerritory{{Territory: "NV", Armies: 1}},
+			minimumPlayersToStart: 1,
+			beforeEachEvent: func(t *testing.T, d *sql.DB, i int) error {
+				if i > 0 {
+					SetRandomSource(fixedRandomSource(20))
+				}
+				return nil
+			},
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				holdings, err := db.GetHoldings(d, config.DefaultGameID)
+				assert.NoError(t, err)
+				if assert.Len(t, holdings, 1) {
+					assert.Equal(t, "CA", holdings[0].Territory)
+				}
+				var nations int
+				assert.NoError(t, d.QueryRow("SELECT COUNT(*) FROM nations WHERE player = ?", db.NeutralPlayer).Scan(&nations))
+				assert.Zero(t, nations, "expected the neutral nation to be removed when it has no territories left")
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				assert.Equal(t, "Test User attacked Nevada from California, attack succeeded (rolled 20) and all defending armies were lost, Neutral has been removed from the game",
+					results[1].String())
+			},
+		},
+		{
+			desc: "neutral nation doesn't count towards the minimum nations",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "NV"},
+			},
+			expectError:           true,
+			neutralTerritories:    []config.NeutralTerritory{{Territory: "NV", Armies: 1}},
+			minimumPlayersToStart: 2,
+		},
+		{
+			desc: "neutral nation doesn't hold up the turn",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&RaiseAction{User: "Test User", Territory: "CA"},
+			},
+			doTurnChecking:        true,
+			neutralTerritories:    []config.NeutralTerritory{{Territory: "NV", MinArmies: 1, MaxArmies: 3}, {Territory: "UT", Armies: 2}},
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				turn, err := db.GetCurrentTurn(d, config.DefaultGameID)
+				assert.NoError(t, err)
+				assert.Equal(t, 2, turn, "expected the turn to end when the only player is done")
+			},
+		},
+	}
+	setupTestCases = []actionsTestCase{
+		{
+			desc: "deal territories at random",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2"},
+			},
+			setupMode:             config.SetupModeRandom,
+			startingArmies:        5,
+			minimumPlayersToStart: 2,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				holdings, err := db.GetHoldings(d, config.DefaultGameID)
+				assert.NoError(t, err)
+				assert.Len(t, holdings, 5)
+				held := map[string]int{}
+				for _, holding := range holdings {
+					assert.Equal(t, 1, holding.ArmySize)
+					held[holding.Player]++
+				}
+				assert.ElementsMatch(t, []int{3, 2}, []int{held["Test User"], held["Test User 2"]})
+
+				for player, territories := range held {
+					var reinforcements int
+					assert.NoError(t, d.QueryRow("SELECT reinforcements FROM nations WHERE player = ?", player).Scan(&reinforcements))
+					assert.Equal(t, 5-territories, reinforcements)
+				}
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				assert.Equal(t, "Nation 1 founded by Test User", results[0].String())
+				assert.Contains(t, results[1].String(), "Nation 2 founded by Test User 2; all territories have been claimed")
+			},
+		},
+		{
+			desc: "choose a territory when territories are dealt",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+			},
+			expectError:           true,
+			setupMode:             config.SetupModeRandom,
+			minimumPlayersToStart: 2,
+			doValidateQueries: func(t *testing.T, _ *sql.DB, err error) {
+				assert.ErrorIs(t, err, ErrTerritoryNotAllowed)
+			},
+		},
+		{
+			desc: "join after territories are dealt",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2"},
+				&JoinAction{User: "Test User 3", Nation: "Nation 3"},
+			},
+			expectError:           true,
+			setupMode:             config.SetupModeRandom,
+			minimumPlayersToStart: 2,
+			doValidateQueries: func(t *testing.T, _ *sql.DB, err error) {
+				assert.ErrorIs(t, err, ErrSetupStarted)
+			},
+		},
+		{
+			desc: "join after territories are dealt and a nation left",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2"},
+				&LeaveAction{User: "Test User 2"},
+				&JoinAction{User: "Test User 3", Nation: "Nation 3"},
+			},
+			expectError:           true,
+			setupMode:             config.SetupModeRandom,
+			startingArmies:        40,
+			minimumPlayersToStart: 2,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				assert.ErrorIs(t, err, ErrSetupStarted)
+				var reinforcements int
+				assert.NoError(t, d.QueryRow("SELECT reinforcements FROM nations WHERE player = ?", "Test User").Scan(&reinforcements))
+				assert.Equal(t, 37, reinforcements, "expected the starting armies to only be given once")
+			},
+		},
+		{
+			desc: "leave during the draft",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2"},
+				&JoinAction{User: "Test User 3", Nation: "Nation 3"},
+				&PickAction{User: "Test User", Territory: "CA"},
+				&LeaveAction{User: "Test User 2"},
+			},
+			expectError:           true,
+			setupMode:             config.SetupModeDraft,
+			minimumPlayersToStart: 3,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				assert.ErrorIs(t, err, ErrDraftInProgress)
+				_, err = (&PickAction{User: "Test User 2", Territory: "NV"}).DoAction(d)
+				assert.NoError(t, err, "expected Test User 2 to still pick next")
+			},
+		},
+		{
+			desc: "draft territories and deploy starting armies",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2"},
+				&PickAction{User: "Test User", Territory: "CA"},
+				&PickAction{User: "Test User 2", Territory: "NV"},
+				&PickAction{User: "Test User", Territory: "OR"},
+				&PickAction{User: "Test User 2", Territory: "AZ"},
+				&PickAction{User: "Test User", Territory: "UT"},
+				&DeployAction{User: "Test User", Armies: map[string]int{"CA": 2}},
+			},
+			setupMode:             config.SetupModeDraft,
+			startingArmies:        6,
+			minimumPlayersToStart: 2,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				var armies int
+				assert.NoError(t, d.QueryRow("SELECT army_size FROM v_nation_holdings WHERE territory = 'CA' AND player = ?",
+					"Test User").Scan(&armies))
+				assert.Equal(t, 3, armies)
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				assert.Equal(t, "Nation 2 founded by Test User 2; the draft has started, Test User picks first", results[1].String())
+				assert.Equal(t, "Test User picked California; Test User 2 picks next", results[2].String())
+				assert.Equal(t, "Test User picked Utah; all territories have been claimed, starting armies left to deploy: Test User (3), Test User 2 (4)",
+					results[6].String())
+				assert.Equal(t, 1, results[7].(*DeployActionResult).Remaining)
+			},
+		},
+		{
+			desc: "pick out of turn",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2"},
+				&PickAction{User: "Test User 2", Territory: "CA"},
+			},
+			expectError:           true,
+			setupMode:             config.SetupModeDraft,
+			minimumPlayersToStart: 2,
+			doValidateQueries: func(t *testing.T, _ *sql.DB, err error) {
+				assert.EqualError(t, err, "it is Test User's turn to pick a territory")
+			},
+		},
+		{
+			desc: "pick before enough nations have joined",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1"},
+				&PickAction{User: "Test User", Territory: "CA"},
+			},
+			expectError:           true,
+			setupMode:             config.SetupModeDraft,
+			minimumPlayersToStart: 2,
+		},
+		{
+			desc: "attack during the draft",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2"},
+				&PickAction{User: "Test User", Territory: "CA"},
+				&PickAction{User: "Test User 2", Territory: "NV"},
+				&AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "NV"},
+			},
+			expectError:           true,
+			setupMode:             config.SetupModeDraft,
+			minimumPlayersToStart: 2,
+			doValidateQueries: func(t *testing.T, _ *sql.DB, err error) {
+				assert.ErrorIs(t, err, ErrSetupNotDone)
+			},
+		},
+		{
+			desc: "pick in a game that doesn't draft",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&PickAction{User: "Test User", Territory: "NV"},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, _ *sql.DB, err error) {
+				assert.ErrorIs(t, err, ErrNotDrafting)
+			},
+		},
+	}
+	capitalTestCases = []actionsTestCase{
+		{
+			desc: "join territory is the nation's capital",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+			},
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				nations, err := db.GetNations(d, config.DefaultGameID)
+				assert.NoError(t, err)
+				if assert.Len(t, nations, 1) {
+					assert.Equal(t, "CA", nations[0].Capital)
+				}
+			},
+		},
+		{
+			desc: "first dealt territory is the nation's capital",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2"},
+			},
+			setupMode: config.SetupModeRandom,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				nations, err := db.GetNations(d, config.DefaultGameID)
+				assert.NoError(t, err)
+				for _, nation := range nations {
+					var first string
+					assert.NoError(t, d.QueryRow("SELECT territory FROM v_nation_holdings WHERE player = ? ORDER BY id LIMIT 1",
+						nation.Player).Scan(&first))
+					assert.Equal(t, first, nation.Capital)
+				}
+			},
+		},
+		{
+			desc: "capital defense bonus",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "NV"},
+			},
+			capitalDefenseBonus: 2,
+			beforeEachEvent: func(t *testing.T, d *sql.DB, i int) error {
+				if i > 1 {
+					// would succeed without the bonus
+					SetRandomSource(fixedRandomSource(11))
+				}
+				return nil
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				aar := results[2].(*AttackActionResult)
+				assert.Equal(t, -2, aar.Losses)
+				assert.Nil(t, aar.CapitalFall)
+			},
+		},
+		{
+			desc: "capital loss without a policy",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&MoveAction{User: "Test User 2", Source: "NV", Destination: "UT", Armies: 2},
+				&AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "NV"},
+				&MoveAction{User: "Test User 2", Source: "UT", Destination: "NV", Armies: 1},
+				&AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "NV"},
+			},
+			capitalDefenseBonus: 2,
+			beforeEachEvent: func(t *testing.T, d *sql.DB, i int) error {
+				if i > 2 {
+					SetRandomSource(fixedRandomSource(20))
+				}
+				return nil
+			},
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				var armies int
+				assert.NoError(t, d.QueryRow("SELECT army_size FROM holdings WHERE territory = 'UT'").Scan(&armies))
+				assert.Equal(t, 1, armies)
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				aar := results[3].(*AttackActionResult)
+				assert.Equal(t,
+					"Test User attacked Nevada from California, attack succeeded (rolled 20) and 1 defending armies were lost; "+
+						"Nation 2 lost its capital Nevada",
+					aar.String())
+				assert.Nil(t, aar.NationRemoved)
+
+				// the capital is retaken and has its bonus again
+				aar = results[5].(*AttackActionResult)
+				assert.NotNil(t, aar.CapitalFall)
+			},
+		},
+		{
+			desc: "capital loss eliminates nation",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&MoveAction{User: "Test User 2", Source: "NV", Destination: "UT", Armies: 1},
+				&AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "NV"},
+			},
+			capitalLossPolicy: config.CapitalLossEliminate,
+			beforeEachEvent: func(t *testing.T, d *sql.DB, i int) error {
+				if i > 2 {
+					SetRandomSource(fixedRandomSource(20))
+				}
+				return nil
+			},
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				var count int
+				assert.NoError(t, d.QueryRow("SELECT COUNT(*) FROM nations WHERE player = 'Test User 2'").Scan(&count))
+				assert.Zero(t, count, "expected Test User 2 to be eliminated")
+				var player string
+				var armies int
+				assert.NoError(t, d.QueryRow("SELECT player, army_size FROM v_nation_holdings WHERE territory = 'UT'").Scan(&player, &armies))
+				assert.Equal(t, "Test User", player)
+				assert.Equal(t, 1, armies)
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				aar := results[3].(*AttackActionResult)
+				assert.Nil(t, aar.NationRemoved)
+				assert.Equal(t,
+					"Test User attacked Nevada from California, attack succeeded (rolled 20) and 2 defending armies were lost; "+
+						"Nation 2 lost its capital Nevada and was conquered by Test User, which annexed its territories (Utah)",
+					aar.String())
+			},
+		},
+		{
+			desc: "capital loss cripples nation",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&MoveAction{User: "Test User 2", Source: "NV", Destination: "UT", Armies: 2},
+				&AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "NV"},
+			},
+			capitalLossPolicy: config.CapitalLossCripple,
+			beforeEachEvent: func(t *testing.T, d *sql.DB, i int) error {
+				if i > 2 {
+					SetRandomSource(fixedRandomSource(20))
+				}
+				return nil
+			},
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				var armies int
+				assert.NoError(t, d.QueryRow("SELECT army_size FROM holdings WHERE territory = 'UT'").Scan(&armies))
+				assert.Equal(t, 1, armies)
+				var reinforcements int
+				assert.NoError(t, d.QueryRow("SELECT reinforcements FROM nations WHERE player = 'Test User 2'").Scan(&reinforcements))
+				assert.Zero(t, reinforcements)
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				aar := results[3].(*AttackActionResult)
+				if assert.NotNil(t, aar.CapitalFall) {
+					assert.Equal(t, []string{"Utah"}, aar.CapitalFall.Territories)
+				}
+				assert.Equal(t,
+					"Test User attacked Nevada from California, attack succeeded (rolled 20) and 1 defending armies were lost; "+
+						"Nation 2 lost its capital Nevada, its armies were halved and its reinforcements were lost",
+					aar.String())
+			},
+		},
+	}
+	terrainTestCases = []actionsTestCase{
+		{
+			desc: "terrain defense bonus",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "NV"},
+			},
+			terrain: map[string]config.Territory{"NV": {DefenseBonus: 2}},
+			beforeEachEvent: func(t *testing.T, d *sql.DB, i int) error {
+				if i > 1 {
+					// would succeed without the bonus
+					SetRandomSource(fixedRandomSource(11))
+				}
+				return nil
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				aar := results[2].(*AttackActionResult)
+				assert.Equal(t, -2, aar.Losses)
+			},
+		},
+		{
+			desc: "territory army limit when joining and raising",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&RaiseAction{User: "Test User", Territory: "CA"},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+			terrain:               map[string]config.Territory{"CA": {MaxArmies: 2}},
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				assert.EqualError(t, err, "cannot raise army size in California: already at maximum of 2")
+				var armies int
+				assert.NoError(t, d.QueryRow("SELECT army_size FROM holdings WHERE territory = 'CA'").Scan(&armies))
+				assert.Equal(t, 2, armies)
+			},
+		},
+		{
+			desc: "territory army limit when moving",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&MoveAction{User: "Test User", Source: "CA", Destination: "OR"},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+			terrain:               map[string]config.Territory{"OR": {MaxArmies: 2}},
+			doValidateQueries: func(t *testing.T, _ *sql.DB, err error) {
+				assert.EqualError(t, err, "cannot move 3 armies to Oregon: would exceed maximum of 2")
+			},
+		},
+		{
+			desc: "entering a territory uses its action cost",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&MoveAction{User: "Test User", Source: "CA", Destination: "OR"},
+			},
+			minimumPlayersToStart: 1,
+			terrain:               map[string]config.Territory{"OR": {EnterCost: 2}},
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				records, err := db.GetActionRecords(d, db.ActionRecordFilter{ActionType: "move"})
+				assert.NoError(t, err)
+				if assert.Len(t, records, 1) {
+					assert.Equal(t, 2, records[0].Cost)
+				}
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				assert.Equal(t, 2, results[1].(*MoveActionResult).ActionCost)
+			},
+		},
+		{
+			desc: "not enough actions to enter a territory",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "UT"},
+				&MoveAction{User: "Test User", Source: "CA", Destination: "OR"},
+			},
+			expectError:    true,
+			doTurnChecking: true,
+			terrain:        map[string]config.Territory{"OR": {EnterCost: 2}},
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				var actionErr *ActionError
+				assert.ErrorAs(t, err, &actionErr)
+				assert.EqualError(t, err, "not enough actions remaining for player Test User, 2 required, 1 remaining")
+				var num int
+				assert.NoError(t, d.QueryRow("SELECT COUNT(*) FROM holdings WHERE territory = 'OR'").Scan(&num))
+				assert.Equal(t, 0, num)
+			},
+		},
+		{
+			desc: "join in an impassable territory",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "OR"},
+			},
+			expectError: true,
+			terrain:     map[string]config.Territory{"OR": {Impassable: true}},
+			doValidateQueries: func(t *testing.T, _ *sql.DB, err error) {
+				assert.EqualError(t, err, "Oregon is impassable")
+			},
+		},
+		{
+			desc: "move into an impassable territory",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&MoveAction{User: "Test User", Source: "CA", Destination: "OR"},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+			terrain:               map[string]config.Territory{"OR": {Impassable: true}},
+			doValidateQueries: func(t *testing.T, _ *sql.DB, err error) {
+				assert.EqualError(t, err, "Oregon is impassable")
+			},
+		},
+		{
+			desc: "attack an impassable territory",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "OR"},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+			terrain:               map[string]config.Territory{"OR": {Impassable: true}},
+			doValidateQueries: func(t *testing.T, _ *sql.DB, err error) {
+				var actionErr *ActionError
+				assert.ErrorAs(t, err, &actionErr)
+				assert.EqualError(t, err, "Oregon is impassable")
+			},
+		},
+		{
+			desc: "impassable territories aren't dealt",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2"},
+			},
+			setupMode:             config.SetupModeRandom,
+			minimumPlayersToStart: 2,
+			terrain:               map[string]config.Territory{"UT": {Impassable: true}},
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				holdings, err := db.GetHoldings(d, config.DefaultGameID)
+				assert.NoError(t, err)
+				assert.Len(t, holdings, 4)
+				for _, holding := range holdings {
+					assert.NotEqual(t, "UT", holding.Territory)
+				}
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				assert.Contains(t, results[1].String(), "all territories have been claimed")
+			},
+		},
+	}
+	connectionTestCases = []actionsTestCase{
+		{
+			desc: "attack across a sea connection",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "AZ"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "UT"},
+				&AttackAction{User: "Test User", AttackingTerritory: "AZ", DefendingTerritory: "UT"},
+			},
+			connections: []config.Connection{{From: "AZ", To: "UT", Type: config.ConnectionSea, AttackPenalty: 2}},
+			beforeEachEvent: func(t *testing.T, d *sql.DB, i int) error {
+				if i > 1 {
+					// would succeed without the penalty
+					SetRandomSource(fixedRandomSource(11))
+				}
+				return nil
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				aar := results[2].(*AttackActionResult)
+				assert.Equal(t, -2, aar.Losses)
+			},
+		},
+		{
+			desc: "move across a one-way connection",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "AZ"},
+				&MoveAction{User: "Test User", Source: "AZ", Destination: "UT", Armies: 1},
+			},
+			minimumPlayersToStart: 1,
+			connections:           []config.Connection{{From: "AZ", To: "UT", Type: config.ConnectionOneWay}},
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				var armies int
+				assert.NoError(t, d.QueryRow("SELECT army_size FROM holdings WHERE territory = 'UT'").Scan(&armies))
+				assert.Equal(t, 1, armies)
+			},
+		},
+		{
+			desc: "move back across a one-way connection",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "UT"},
+				&MoveAction{User: "Test User", Source: "UT", Destination: "AZ", Armies: 1},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+			connections:           []config.Connection{{From: "AZ", To: "UT", Type: config.ConnectionOneWay}},
+			doValidateQueries: func(t *testing.T, _ *sql.DB, err error) {
+				assert.EqualError(t, err, "cannot move from Utah to Arizona: not a neighboring territory")
+			},
+		},
+		{
+			desc: "move across a restricted connection",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "AZ"},
+				&MoveAction{User: "Test User", Source: "AZ", Destination: "UT", Armies: 1},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+			connections:           []config.Connection{{From: "AZ", To: "UT", Type: config.ConnectionRestricted}},
+			doValidateQueries: func(t *testing.T, _ *sql.DB, err error) {
+				assert.EqualError(t, err, "cannot move from Arizona to Utah: armies can't be moved across a restricted connection")
+			},
+		},
+		{
+			desc: "too many armies moved across a connection",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "AZ"},
+				&MoveAction{User: "Test User", Source: "AZ", Destination: "UT"},
+			},
+			expectError:           true,
+			minimumPlayersToStart: 1,
+			connections:           []config.Connection{{From: "AZ", To: "UT", Type: config.ConnectionSea, MaxArmies: 2}},
+			doValidateQueries: func(t *testing.T, _ *sql.DB, err error) {
+				assert.EqualError(t, err, "cannot move 3 armies from Arizona to Utah: at most 2 can be moved across the connection")
+			},
+		},
+		{
+			desc: "no counterattack across a one-way connection",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "AZ"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "UT"},
+				&AttackAction{User: "Test User", AttackingTerritory: "AZ", DefendingTerritory: "UT"},
+			},
+			doCounterattack: true,
+			connections:     []config.Connection{{From: "AZ", To: "UT", Type: config.ConnectionOneWay}},
+			beforeEachEvent: func(t *testing.T, d *sql.DB, i int) error {
+				if i > 1 {
+					SetRandomSource(fixedRandomSource(11))
+				}
+				return nil
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				aar := results[2].(*AttackActionResult)
+				assert.Equal(t, 1, aar.Losses)
+				assert.False(t, aar.Counterattacked)
+			},
+		},
+	}
+	scoutTestCases = []actionsTestCase{
+		{
+			desc: "scout a territory that isn't visible",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "UT"},
+				&ScoutAction{User: "Test User", Territory: "UT"},
+			},
+			fogOfWar: true,
+			beforeEachEvent: func(t *testing.T, d *sql.DB, i int) error {
+				if i == 2 {
+					SetRandomSource(fixedRandomSource(75))
+				}
+				return nil
+			},
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				cfg, err := config.GetConfig()
+				assert.NoError(t, err)
+				holdings, err := db.GetVisibleHoldings(d, cfg, "Test User")
+				assert.NoError(t, err)
+				for _, holding := range holdings {
+					assert.False(t, holding.Hidden, "expected %s to be visible", holding.Territory)
+				}
+				holdings, err = db.GetVisibleHoldings(d, cfg, "Test User 2")
+				assert.NoError(t, err)
+				assert.True(t, holdings[0].Hidden, "expected California to be hidden from the other player")
+				records, err := db.GetActionRecords(d, db.ActionRecordFilter{GameID: config.DefaultGameID, ActionType: "scout"})
+				assert.NoError(t, err)
+				if assert.Len(t, records, 1) {
+					assert.JSONEq(t, `{"territory":"Utah"}`, string(records[0].Details), "expected the army size found to be left out of the log")
+				}
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				sar := results[2].(*ScoutActionResult)
+				assert.True(t, sar.Success)
+				assert.Equal(t, 3, sar.Armies)
+				assert.Equal(t, "Test User scouted Utah and found 3 armies of Nation 2", sar.String())
+			},
+		},
+		{
+			desc: "failed scouting reveals nothing",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "UT"},
+				&ScoutAction{User: "Test User", Territory: "Utah"},
+			},
+			fogOfWar: true,
+			beforeEachEvent: func(t *testing.T, d *sql.DB, i int) error {
+				if i == 2 {
+					SetRandomSource(fixedRandomSource(76))
+				}
+				return nil
+			},
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				scouted, err := db.GetScoutedTerritories(d, config.DefaultGameID, "Test User")
+				assert.NoError(t, err)
+				assert.Empty(t, scouted)
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				sar := results[2].(*ScoutActionResult)
+				assert.False(t, sar.Success)
+				assert.Zero(t, sar.Armies)
+				assert.Equal(t, "Test User failed to scout Utah", sar.String())
+			},
+		},
+		{
+			desc: "scouting requires fog of war",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "UT"},
+				&ScoutAction{User: "Test User", Territory: "UT"},
+			},
+			expectError: true,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				assert.ErrorIs(t, err, ErrNoFogOfWar)
+			},
+		},
+		{
+			desc: "territory is already visible",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&ScoutAction{User: "Test User", Territory: "NV"},
+			},
+			fogOfWar:    true,
+			expectError: true,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				assert.EqualError(t, err, "the army size in Nevada is already visible to Test User")
+			},
+		},
+		{
+			desc: "territory is out of range",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "UT"},
+				&ScoutAction{User: "Test User", Territory: "UT"},
+			},
+			fogOfWar:    true,
+			scoutRange:  1,
+			expectError: true,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				assert.EqualError(t, err, "Utah is more than 1 territories away from the territories held by Test User")
+			},
+		},
+		{
+			desc: "scouted territory is hidden again when the turn ends",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "UT"},
+				&ScoutAction{User: "Test User", Territory: "UT"},
+				&RaiseAction{User: "Test User", Territory: "CA"},
+			},
+			fogOfWar:       true,
+			doTurnChecking: true,
+			expectError:    true,
+			beforeEachEvent: func(t *testing.T, d *sql.DB, i int) error {
+				if i == 2 {
+					SetRandomSource(fixedRandomSource(1))
+				}
+				return nil
+			},
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				assert.EqualError(t, err, "no actions remaining for player Test User", "expected scouting to use an action")
+				scouted, err := db.GetScoutedTerritories(d, config.DefaultGameID, "Test User")
+				assert.NoError(t, err)
+				assert.Equal(t, []string{"UT"}, scouted)
+
+				_, err = d.Exec("INSERT INTO actions (action_type, is_new_turn, turn_action) VALUES ('end_turn', 1, 0)")
+				assert.NoError(t, err)
+				scouted, err = db.GetScoutedTerritories(d, config.DefaultGameID, "Test User")
+				assert.NoError(t, err)
+				assert.Empty(t, scouted)
+			},
+		},
+	}
+	orderTestCases = []actionsTestCase{
+		{
+			desc: "orders are stored until the turn ends",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "UT"},
+				&MoveAction{User: "Test User", Source: "CA", Destination: "NV", Armies: 1},
+				&RaiseAction{User: "Test User 2", Territory: "UT"},
+			},
+			resolutionMode: config.ResolutionSimultaneous,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				assert.Equal(t, map[string]int{"CA": 3, "UT": 3}, testArmySizes(t, d))
+				endTestTurn(t, d, 20)
+				assert.Equal(t, map[string]int{"CA": 2, "NV": 1, "UT": 4}, testArmySizes(t, d))
+
+				orders, err := db.GetOrders(d, config.DefaultGameID, 1, "")
+				assert.NoError(t, err)
+				if assert.Len(t, orders, 2) {
+					assert.Equal(t, db.OrderResolved, orders[0].Status)
+					assert.Equal(t, "Test User moved 1 armies from California to Nevada", orders[0].Outcome)
+					assert.Equal(t, db.OrderResolved, orders[1].Status)
+					assert.Equal(t, "Test User 2 raised an army in Utah", orders[1].Outcome)
+				}
+				records, err := db.GetActionRecords(d, db.ActionRecordFilter{GameID: config.DefaultGameID, ActionType: "move"})
+				assert.NoError(t, err)
+				assert.Len(t, records, 1, "expected the resolved move to be logged")
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				oar := results[2].(*OrderActionResult)
+				assert.Equal(t, "order", oar.ActionType())
+				assert.Equal(t, "Test User ordered 1 armies to move from California to Nevada", oar.String())
+				assert.Equal(t, "Test User 2 ordered an army to be raised in Utah", results[3].String())
+			},
+		},
+		{
+			desc: "larger move into a territory bounces the smaller move",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "OR"},
+				&MoveAction{User: "Test User 2", Source: "OR", Destination: "NV", Armies: 1},
+				&MoveAction{User: "Test User", Source: "CA", Destination: "NV", Armies: 2},
+			},
+			resolutionMode: config.ResolutionSimultaneous,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				endTestTurn(t, d, 20)
+				assert.Equal(t, map[string]int{"CA": 1, "NV": 2, "OR": 3}, testArmySizes(t, d))
+				orders, err := db.GetOrders(d, config.DefaultGameID, 1, "Test User 2")
+				assert.NoError(t, err)
+				if assert.Len(t, orders, 1) {
+					assert.Equal(t, db.OrderBounced, orders[0].Status)
+					assert.Equal(t, "bounced from Nevada by a larger move by Test User", orders[0].Outcome)
+				}
+			},
+		},
+		{
+			desc: "equal moves into a territory are a standoff",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "OR"},
+				&MoveAction{User: "Test User", Source: "CA", Destination: "NV", Armies: 2},
+				&MoveAction{User: "Test User 2", Source: "OR", Destination: "NV", Armies: 2},
+			},
+			resolutionMode: config.ResolutionSimultaneous,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				endTestTurn(t, d, 20)
+				assert.Equal(t, map[string]int{"CA": 3, "OR": 3}, testArmySizes(t, d))
+				orders, err := db.GetOrders(d, config.DefaultGameID, 1, "")
+				assert.NoError(t, err)
+				for _, order := range orders {
+					assert.Equal(t, db.OrderStandoff, order.Status)
+					assert.Equal(t, "standoff with an equally large move into Nevada", order.Outcome)
+				}
+			},
+		},
+		{
+			desc: "move into a territory being vacated, vacating move submitted first",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&MoveAction{User: "Test User 2", Source: "NV", Destination: "UT"},
+				&MoveAction{User: "Test User", Source: "CA", Destination: "NV", Armies: 2},
+			},
+			resolutionMode: config.ResolutionSimultaneous,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				endTestTurn(t, d, 20)
+				assert.Equal(t, map[string]int{"CA": 1, "NV": 2, "UT": 3}, testArmySizes(t, d))
+				orders, err := db.GetOrders(d, config.DefaultGameID, 1, "")
+				assert.NoError(t, err)
+				if assert.Len(t, orders, 2) {
+					assert.Equal(t, db.OrderResolved, orders[0].Status)
+					assert.Equal(t, db.OrderResolved, orders[1].Status)
+				}
+			},
+		},
+		{
+			desc: "move into a territory being vacated, entering move submitted first",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&MoveAction{User: "Test User", Source: "CA", Destination: "NV", Armies: 2},
+				&MoveAction{User: "Test User 2", Source: "NV", Destination: "UT"},
+			},
+			resolutionMode: config.ResolutionSimultaneous,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				endTestTurn(t, d, 20)
+				assert.Equal(t, map[string]int{"CA": 1, "NV": 2, "UT": 3}, testArmySizes(t, d))
+				orders, err := db.GetOrders(d, config.DefaultGameID, 1, "")
+				assert.NoError(t, err)
+				if assert.Len(t, orders, 2) {
+					assert.Equal(t, db.OrderResolved, orders[0].Status)
+					assert.Equal(t, db.OrderResolved, orders[1].Status)
+				}
+			},
+		},
+		{
+			desc: "attacks between territories with equal armies are a standoff",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "NV"},
+				&AttackAction{User: "Test User 2", AttackingTerritory: "NV", DefendingTerritory: "CA"},
+			},
+			resolutionMode: config.ResolutionSimultaneous,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				endTestTurn(t, d, 20)
+				assert.Equal(t, map[string]int{"CA": 3, "NV": 3}, testArmySizes(t, d))
+				orders, err := db.GetOrders(d, config.DefaultGameID, 1, "")
+				assert.NoError(t, err)
+				if assert.Len(t, orders, 2) {
+					assert.Equal(t, db.OrderStandoff, orders[0].Status)
+					assert.Equal(t, "standoff with the attack on California from Nevada, which has as many armies", orders[0].Outcome)
+					assert.Equal(t, db.OrderStandoff, orders[1].Status)
+				}
+			},
+		},
+		{
+			desc: "raises are resolved before attacks between territories",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&AttackAction{User: "Test User 2", AttackingTerritory: "NV", DefendingTerritory: "CA"},
+				&AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "NV"},
+				&RaiseAction{User: "Test User", Territory: "CA"},
+			},
+			resolutionMode: config.ResolutionSimultaneous,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				endTestTurn(t, d, 20)
+				orders, err := db.GetOrders(d, config.DefaultGameID, 1, "")
+				assert.NoError(t, err)
+				if assert.Len(t, orders, 3) {
+					assert.Equal(t, db.OrderBounced, orders[0].Status)
+					assert.Equal(t, "bounced by the attack on Nevada from California, which has more armies", orders[0].Outcome)
+					assert.Equal(t, db.OrderResolved, orders[1].Status)
+					assert.Equal(t, db.OrderResolved, orders[2].Status)
+				}
+				armies := testArmySizes(t, d)
+				assert.Equal(t, 4, armies["CA"])
+				assert.Less(t, armies["NV"], 3, "expected the attack on Nevada to go ahead")
+			},
+		},
+		{
+			desc: "order from a territory that is no longer held is voided",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "OR"},
+				&AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "OR"},
+				&MoveAction{User: "Test User", Source: "CA", Destination: "NV"},
+			},
+			resolutionMode: config.ResolutionSimultaneous,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				endTestTurn(t, d, 20)
+				assert.Equal(t, map[string]int{"NV": 3, "OR": 3}, testArmySizes(t, d))
+				orders, err := db.GetOrders(d, config.DefaultGameID, 1, "")
+				assert.NoError(t, err)
+				if assert.Len(t, orders, 2) {
+					assert.Equal(t, db.OrderVoid, orders[0].Status)
+					assert.NotEmpty(t, orders[0].Outcome)
+					assert.Equal(t, db.OrderResolved, orders[1].Status)
+					assert.Equal(t, "Test User moved 3 armies from California to Nevada", orders[1].Outcome)
+				}
+			},
+		},
+		{
+			desc: "order from a territory not held by the player",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "OR"},
+				&MoveAction{User: "Test User", Source: "OR", Destination: "NV"},
+			},
+			resolutionMode: config.ResolutionSimultaneous,
+			expectError:    true,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				assert.EqualError(t, err, "no armies in Oregon controlled by Test User")
+			},
+		},
+	}
+	planTestCases = []actionsTestCase{
+		{
+			desc: "all steps are applied",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "OR"},
+				&PlanAction{User: "Test User", Steps: []PlanStep{
+					{Type: "raise", Territory: "CA"},
+					{Type: "move", Source: "CA", Destination: "NV", Armies: 2},
+					{Type: "attack", AttackingTerritory: "NV", DefendingTerritory: "OR"},
+				}},
+			},
+			beforeEachEvent: func(t *testing.T, d *sql.DB, i int) error {
+				if i == 2 {
+					SetRandomSource(fixedRandomSource(20))
+				}
+				return nil
+			},
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				armies := testArmySizes(t, d)
+				assert.Equal(t, 2, armies["CA"])
+				assert.Equal(t, 2, armies["NV"])
+				assert.Less(t, armies["OR"], 3)
+				records, err := db.GetActionRecords(d, db.ActionRecordFilter{GameID: config.DefaultGameID, Player: "Test User"})
+				assert.NoError(t, err)
+				var actionTypes []string
+				for _, record := range records {
+					actionTypes = append(actionTypes, record.ActionType)
+				}
+				assert.Equal(t, []string{"join", "raise", "move", "attack"}, actionTypes, "expected each step to be logged")
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				par := results[2].(*PlanActionResult)
+				assert.Equal(t, "plan", par.ActionType())
+				if assert.Len(t, par.Results, 3) {
+					assert.IsType(t, &AttackActionResult{}, par.Results[2])
+				}
+				assert.True(t, strings.HasPrefix(par.String(), "Test User raised an army in California; Test User moved 2 armies from California to Nevada; "))
+			},
+		},
+		{
+			desc: "failing step rejects the plan",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "OR"},
+				&PlanAction{User: "Test User", Steps: []PlanStep{
+					{Type: "raise", Territory: "CA"},
+					{Type: "move", Source: "CA", Destination: "UT", Armies: 2},
+					{Type: "raise", Territory: "CA"},
+				}},
+			},
+			expectError: true,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				assert.EqualError(t, err, "step 2 (move) failed: cannot move from California to Utah: not a neighboring territory")
+				var stepErr *PlanStepError
+				if assert.ErrorAs(t, err, &stepErr) {
+					assert.Equal(t, 2, stepErr.Step)
+				}
+				assert.Equal(t, map[string]int{"CA": 3, "OR": 3}, testArmySizes(t, d), "expected the raise to be rolled back")
+				records, err := db.GetActionRecords(d, db.ActionRecordFilter{GameID: config.DefaultGameID, ActionType: "raise"})
+				assert.NoError(t, err)
+				assert.Empty(t, records)
+			},
+		},
+		{
+			desc: "steps are checked against the state left by earlier steps",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "OR"},
+				&PlanAction{User: "Test User", Steps: []PlanStep{
+					{Type: "move", Source: "CA", Destination: "NV"},
+					{Type: "raise", Territory: "CA"},
+				}},
+			},
+			expectError: true,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				assert.EqualError(t, err, "step 2 (raise) failed: no armies in California controlled by Test User to raise")
+				assert.Equal(t, map[string]int{"CA": 3, "OR": 3}, testArmySizes(t, d))
+			},
+		},
+		{
+			desc: "plan uses more actions than the player has remaining",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "OR"},
+				&PlanAction{User: "Test User", Steps: []PlanStep{
+					{Type: "raise", Territory: "CA"},
+					{Type: "raise", Territory: "CA"},
+				}},
+			},
+			doTurnChecking: true,
+			expectError:    true,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				assert.EqualError(t, err, "step 2 (raise) failed: not enough actions remaining for player Test User, 2 required, 1 remaining")
+				assert.Equal(t, map[string]int{"CA": 3, "OR": 3}, testArmySizes(t, d))
+			},
+		},
+		{
+			desc: "plan doesn't end the turn after the last player's last action",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "OR"},
+				&RaiseAction{User: "Test User 2", Territory: "OR"},
+				&PlanAction{User: "Test User", Steps: []PlanStep{
+					{Type: "raise", Territory: "CA"},
+					{Type: "raise", Territory: "CA"},
+				}},
+			},
+			doTurnChecking: true,
+			expectError:    true,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				assert.EqualError(t, err, "step 2 (raise) failed: not enough actions remaining for player Test User, 2 required, 1 remaining")
+				assert.Equal(t, map[string]int{"CA": 3, "OR": 4}, testArmySizes(t, d))
+				turn, err := db.GetCurrentTurn(d, config.DefaultGameID)
+				assert.NoError(t, err)
+				assert.Equal(t, 2, turn, "expected the plan not to end the turn")
+			},
+		},
+		{
+			desc: "plan steps are done in the same turn after the time limit passes",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "OR"},
+				&PlanAction{User: "Test User", Steps: []PlanStep{
+					{Type: "raise", Territory: "CA"},
+					{Type: "raise", Territory: "CA"},
+				}},
+			},
+			beforeEachEvent: func(t *testing.T, d *sql.DB, i int) error {
+				if i == 2 {
+					// the turn started before the time limit
+					_, err := d.Exec("UPDATE actions SET timestamp = ?", time.Now().Add(-2*time.Hour))
+					return err
+				}
+				return nil
+			},
+			doTurnChecking: true,
+			turnDuration:   durationutil.ExtendedDuration(time.Hour),
+			regions:        []config.Region{{Name: "California", Territories: []string{"CA"}, Bonus: 2}},
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				assert.Equal(t, map[string]int{"CA": 5, "OR": 3}, testArmySizes(t, d))
+				records, err := db.GetActionRecords(d, db.ActionRecordFilter{GameID: config.DefaultGameID, ActionType: "raise"})
+				assert.NoError(t, err)
+				if assert.Len(t, records, 2) {
+					assert.Equal(t, records[0].Turn, records[1].Turn, "expected the plan's steps to be done in the same turn")
+				}
+				turn, err := db.GetCurrentTurn(d, config.DefaultGameID)
+				assert.NoError(t, err)
+				assert.Greater(t, turn, records[1].Turn, "expected the turn to end after the plan")
+			},
+		},
+		{
+			desc: "invalid step type",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "OR"},
+				&PlanAction{User: "Test User", Steps: []PlanStep{{Type: "deploy", Territory: "CA"}}},
+			},
+			expectError: true,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				assert.EqualError(t, err, `step 1 (deploy) failed: invalid step type "deploy", must be raise, move, or attack`)
+			},
+		},
+		{
+			desc: "empty plan",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&PlanAction{User: "Test User"},
+			},
+			expectError: true,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				assert.ErrorIs(t, err, ErrEmptyPlan)
+			},
+		},
+		{
+			desc: "plans can't be used with simultaneous resolution",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&PlanAction{User: "Test User", Steps: []PlanStep{{Type: "raise", Territory: "CA"}}},
+			},
+			resolutionMode: config.ResolutionSimultaneous,
+			expectError:    true,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				assert.ErrorIs(t, err, ErrPlanSimultaneous)
+			},
+		},
+	}
+	victoryTestCases = []actionsTestCase{
+		{
+			desc: "last nation standing",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&LeaveAction{User: "Test User 2"},
+			},
+			victoryConditions:     config.VictoryConditions{LastNationStanding: true},
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				victory, err := db.GetVictory(d, nil, config.DefaultGameID)
+				assert.NoError(t, err)
+				assert.Equal(t, &db.Victory{Winner: "Test User", CountryName: "Nation 1", Condition: db.VictoryLastNationStanding}, victory)
+				records, err := db.GetActionRecords(d, db.ActionRecordFilter{GameID: config.DefaultGameID, ActionType: "victory"})
+				assert.NoError(t, err)
+				assert.Len(t, records, 1)
+			},
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				assert.Nil(t, GameOver(results[1]), "expected the game to continue with two nations")
+				victory := GameOver(results[2])
+				if assert.NotNil(t, victory) {
+					assert.Equal(t, "Nation 1 (led by Test User) has won the game as the last nation standing", victory.String())
+				}
+			},
+		},
+		{
+			desc: "action after the game is over",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+				&LeaveAction{User: "Test User 2"},
+				&RaiseAction{User: "Test User", Territory: "CA"},
+			},
+			expectError:           true,
+			victoryConditions:     config.VictoryConditions{LastNationStanding: true},
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, _ *sql.DB, err error) {
+				var actionErr *ActionError
+				assert.ErrorAs(t, err, &actionErr)
+				assert.ErrorIs(t, err, ErrGameOver)
+			},
+		},
+		{
+			desc: "single nation doesn't win before another joins",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&RaiseAction{User: "Test User", Territory: "CA"},
+			},
+			victoryConditions:     config.VictoryConditions{LastNationStanding: true},
+			minimumPlayersToStart: 1,
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				assert.Nil(t, GameOver(results[1]))
+			},
+		},
+		{
+			desc: "hold a percentage of the territories",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "UT"},
+				&MoveAction{User: "Test User", Source: "CA", Destination: "NV", Armies: 1},
+			},
+			victoryConditions:     config.VictoryConditions{TerritoryPercent: 40},
+			minimumPlayersToStart: 1,
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				assert.Nil(t, GameOver(results[1]))
+				victory := GameOver(results[2])
+				if assert.NotNil(t, victory) {
+					assert.Equal(t, "Test User", victory.Winner)
+					assert.Equal(t, db.VictoryTerritoryPercent, victory.Condition)
+				}
+			},
+		},
+		{
+			desc: "hold the victory territories",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "UT"},
+				&MoveAction{User: "Test User", Source: "CA", Destination: "NV", Armies: 1},
+			},
+			victoryConditions:     config.VictoryConditions{Territories: []string{"Nevada", "CA"}},
+			minimumPlayersToStart: 1,
+			doValidateResults: func(t *testing.T, results []ActionResult) {
+				victory := GameOver(results[2])
+				if assert.NotNil(t, victory) {
+					assert.Equal(t, "Nation 1 (led by Test User) has won the game by holding all of the victory territories", victory.String())
+				}
+			},
+		},
+		{
+			desc: "most territories when the turn limit is reached",
+			events: []Action{
+				&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+				&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "UT"},
+				&MoveAction{User: "Test User", Source: "CA", Destination: "NV", Armies: 1},
+			},
+			doTurnChecking:        true,
+			victoryConditions:     config.VictoryConditions{TurnLimit: 1},
+			minimumPlayersToStart: 1,
+			doValidateQueries: func(t *testing.T, d *sql.DB, err error) {
+				if !assert.NoError(t, err) {
+					t.FailNow()
+				}
+				victory, err := db.GetVictory(d, nil, config.DefaultGameID)
+				assert.NoError(t, err)
+				assert.Equal(t, &db.Victory{Winner: "Test User", CountryName: "Nation 1", Condition: db.VictoryTurnLimit}, victory)
+			},
+		},
 	}
 	raiseTestCases = []actionsTestCase{
 		{
@@ -727,8 +2740,7 @@ var (
 		{
 			desc: "move to territory with invasion check (success)",
 			beforeEachEvent: func(t *testing.T, db *sql.DB, i int) error {
-				useTestInt = true
-				testInt = 19
+				SetRandomSource(fixedRandomSource(19))
 				cfg, _ := config.GetConfig()
 				cfg.UnclaimedTerritoriesHave1Army = true
 				config.SetConfig(cfg)
@@ -766,8 +2778,7 @@ var (
 		{
 			desc: "move to territory with invasion check (failure)",
 			beforeEachEvent: func(t *testing.T, db *sql.DB, i int) error {
-				useTestInt = true
-				testInt = 1
+				SetRandomSource(fixedRandomSource(1))
 				cfg, _ := config.GetConfig()
 				cfg.UnclaimedTerritoriesHave1Army = true
 				config.SetConfig(cfg)
@@ -798,8 +2809,7 @@ var (
 		{
 			desc: "move to territory with invasion check (failure, player eliminated)",
 			beforeEachEvent: func(t *testing.T, db *sql.DB, i int) error {
-				useTestInt = true
-				testInt = 1
+				SetRandomSource(fixedRandomSource(1))
 				cfg, _ := config.GetConfig()
 				cfg.UnclaimedTerritoriesHave1Army = true
 				config.SetConfig(cfg)
@@ -867,11 +2877,64 @@ var (
 	}
 )
 
+// fixedRandomSource always returns the same number, clamped to the requested range, so that die rolls are predictable.
+// The number is treated as 1-based, so fixedRandomSource(20) always rolls a 20 on a 20-sided die
+type fixedRandomSource int
+
+func (f fixedRandomSource) IntN(n int) (int, error) {
+	return min(int(f), n) - 1, nil
+}
+
+// endTestTurn ends the current turn of the testing game, resolving its orders using a fixed random source
+func endTestTurn(t *testing.T, d *sql.DB, roll int) {
+	t.Helper()
+	cfg, err := config.GetConfig()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	g, err := game.New(cfg, d)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	g.SetRandomSource(fixedRandomSource(roll))
+	assert.NoError(t, turns.EndTurn(g, turns.TurnEndReasonPlayersAllDone, nil))
+}
+
+// testArmySizes returns the army sizes of the testing game's holdings by territory abbreviation
+func testArmySizes(t *testing.T, d *sql.DB) map[string]int {
+	t.Helper()
+	holdings, err := db.GetHoldings(d, config.DefaultGameID)
+	assert.NoError(t, err)
+	armies := map[string]int{}
+	for _, holding := range holdings {
+		armies[holding.Territory] = holding.ArmySize
+	}
+	return armies
+}
+
 type actionsTestCase struct {
 	desc                  string
 	events                []Action
 	expectError           bool
 	doTurnChecking        bool
+	turnDuration          durationutil.ExtendedDuration
+	doCounterattack       bool
+	doReinforcements      bool
+	alliesCanMoveThrough  bool
+	treatyBreakDelay      int
+	leavePolicy           string
+	neutralTerritories    []config.NeutralTerritory
+	setupMode             string
+	startingArmies        int
+	victoryConditions     config.VictoryConditions
+	capitalDefenseBonus   int
+	capitalLossPolicy     string
+	terrain               map[string]config.Territory
+	regions               []config.Region
+	connections           []config.Connection
+	fogOfWar              bool
+	scoutRange            int
+	resolutionMode        string
 	minimumPlayersToStart int
 	beforeEachEvent       func(*testing.T, *sql.DB, int) error
 	doValidateQueries     func(*testing.T, *sql.DB, error)
@@ -886,7 +2949,34 @@ func runActionTestCase(t *testing.T, tc *actionsTestCase) {
 		t.FailNow()
 	}
 	cfg.DoTurnManagement = tc.doTurnChecking
+	cfg.TurnDuration = tc.turnDuration
+	cfg.DoCounterattack = tc.doCounterattack
+	cfg.DoReinforcements = tc.doReinforcements
+	cfg.AlliesCanMoveThrough = tc.alliesCanMoveThrough
+	cfg.TreatyBreakDelay = tc.treatyBreakDelay
+	cfg.LeavePolicy = tc.leavePolicy
+	cfg.NeutralTerritories = tc.neutralTerritories
+	cfg.SetupMode = tc.setupMode
+	cfg.StartingArmies = tc.startingArmies
+	cfg.VictoryConditions = tc.victoryConditions
+	cfg.CapitalDefenseBonus = tc.capitalDefenseBonus
+	cfg.CapitalLossPolicy = tc.capitalLossPolicy
 	cfg.MinimumNationsToStart = tc.minimumPlayersToStart
+	for i := range cfg.Territories {
+		if modifiers, ok := tc.terrain[cfg.Territories[i].Abbreviation]; ok {
+			cfg.Territories[i].DefenseBonus = modifiers.DefenseBonus
+			cfg.Territories[i].MaxArmies = modifiers.MaxArmies
+			cfg.Territories[i].EnterCost = modifiers.EnterCost
+			cfg.Territories[i].Impassable = modifiers.Impassable
+		}
+	}
+	cfg.Regions = tc.regions
+	cfg.Connections = tc.connections
+	cfg.FogOfWar = tc.fogOfWar
+	if tc.scoutRange > 0 {
+		cfg.ScoutRange = tc.scoutRange
+	}
+	cfg.ResolutionMode = tc.resolutionMode
 	config.SetConfig(cfg)
 	assert.NoFileExists(t, cfg.DBFile, "expected no database file to exist before test")
 	tc.db, err = db.GetDB()
@@ -895,6 +2985,7 @@ func runActionTestCase(t *testing.T, tc *actionsTestCase) {
 	}
 
 	defer func() {
+		SetRandomSource(nil)
 		assert.NoError(t, db.CloseDB())
 		config.CloseTestingConfig(t)
 		db.CloseDB()
@@ -924,7 +3015,6 @@ func runActionTestCase(t *testing.T, tc *actionsTestCase) {
 	}
 	if tc.doValidateQueries != nil {
 		tc.doValidateQueries(t, tc.db, err)
-		useTestInt = false
 	}
 	if tc.doValidateResults != nil && !tc.expectError {
 		tc.doValidateResults(t, results)
@@ -940,7 +3030,7 @@ func TestJoinEvent(t *testing.T) {
 }
 
 func TestColorEvent(t *testing.T) {
-	useTestInt = false
+	SetRandomSource(nil)
 	for _, tc := range colorTestCases {
 		t.Run(tc.desc, func(t *testing.T) {
 			runActionTestCase(t, &tc)
@@ -972,17 +3062,131 @@ func TestMoveEvent(t *testing.T) {
 	}
 }
 
+func TestDeployEvent(t *testing.T) {
+	if !config.HasSQLiteMathFunctions {
+		t.Skip("Skipping test because the sqlite_math_functions build tag is not enabled")
+	}
+	for _, tc := range deployTestCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			runActionTestCase(t, &tc)
+		})
+	}
+}
+
+func TestDiplomacyEvents(t *testing.T) {
+	for _, tc := range diplomacyTestCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			runActionTestCase(t, &tc)
+		})
+	}
+}
+
+func TestCedeEvent(t *testing.T) {
+	for _, tc := range cedeTestCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			runActionTestCase(t, &tc)
+		})
+	}
+}
+
+func TestLeaveEvent(t *testing.T) {
+	for _, tc := range leaveTestCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			runActionTestCase(t, &tc)
+		})
+	}
+}
+
+func TestNeutralEvent(t *testing.T) {
+	if !config.HasSQLiteMathFunctions {
+		t.Skip("Skipping test because the sqlite_math_functions build tag is not enabled")
+	}
+	for _, tc := range neutralTestCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			runActionTestCase(t, &tc)
+		})
+	}
+}
+
+func TestSetupEvent(t *testing.T) {
+	for _, tc := range setupTestCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			runActionTestCase(t, &tc)
+		})
+	}
+}
+
+func TestCapitalEvent(t *testing.T) {
+	for _, tc := range capitalTestCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			runActionTestCase(t, &tc)
+		})
+	}
+}
+
+func TestTerrainEvent(t *testing.T) {
+	for _, tc := range terrainTestCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			runActionTestCase(t, &tc)
+		})
+	}
+}
+
+func TestConnectionEvent(t *testing.T) {
+	for _, tc := range connectionTestCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			runActionTestCase(t, &tc)
+		})
+	}
+}
+
+func TestScoutEvent(t *testing.T) {
+	if !config.HasSQLiteMathFunctions {
+		t.Skip("Skipping test because the sqlite_math_functions build tag is not enabled")
+	}
+	for _, tc := range scoutTestCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			runActionTestCase(t, &tc)
+		})
+	}
+}
+
+func TestOrderResolution(t *testing.T) {
+	for _, tc := range orderTestCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			runActionTestCase(t, &tc)
+		})
+	}
+}
+
+func TestPlanEvent(t *testing.T) {
+	for _, tc := range planTestCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			runActionTestCase(t, &tc)
+		})
+	}
+}
+
+func TestVictoryEvent(t *testing.T) {
+	if !config.HasSQLiteMathFunctions {
+		t.Skip("Skipping test because the sqlite_math_functions build tag is not enabled")
+	}
+	for _, tc := range victoryTestCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			runActionTestCase(t, &tc)
+		})
+	}
+}
+
 func TestAttackCalculation(t *testing.T) {
 	var failedAttacks int
 	var numTests int
 	for i := 1; i <= 20; i++ {
-		testInt = i
-		useTestInt = true
 		for attacking := 0; attacking <= 5; attacking++ {
 			for defending := 0; defending <= 5; defending++ {
 				t.Run(fmt.Sprintf("%dv%d die=%d", attacking, defending, i), func(t *testing.T) {
 					numTests++
-					dieRoll, losses, err := attackCalculation(attacking, defending)
+					dieRoll, losses, err := attackCalculation(fixedRandomSource(i), attacking, defending, 0)
 					if losses < 0 {
 						failedAttacks++
 					}
@@ -1040,6 +3244,7 @@ func TestPlayerKODoesntStopGame(t *testing.T) {
 		t.FailNow()
 	}
 	defer func() {
+		SetRandomSource(nil)
 		assert.NoError(t, db.CloseDB())
 		config.CloseTestingConfig(t)
 	}()
@@ -1073,11 +3278,10 @@ func TestPlayerKODoesntStopGame(t *testing.T) {
 	}
 	for i, action := range actions {
 		if i >= 3 {
-			// setting testInt before this would cause unique constraint violations on random color generation for join actions
-			useTestInt = true
-			testInt = 20 // attacks succeed and no stalemate, ensuring unit loss
+			// using a fixed random source before this would cause unique constraint violations on random color generation for join actions
+			SetRandomSource(fixedRandomSource(20)) // attacks succeed and no stalemate, ensuring unit loss
 		} else {
-			useTestInt = false
+			SetRandomSource(nil)
 		}
 		res, err := action.DoAction(d)
 		if !assert.NoError(t, err, "failed to do action %d", i) {
@@ -1097,3 +3301,273 @@ func TestPlayerKODoesntStopGame(t *testing.T) {
 	}
 
 }
+
+func TestActionLog(t *testing.T) {
+	tc := actionsTestCase{
+		desc:                  "action log entries",
+		doTurnChecking:        true,
+		minimumPlayersToStart: 2,
+		events: []Action{
+			&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+			&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+			&ColorAction{User: "Test User", Color: "red"},
+			&AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "NV"},
+		},
+		beforeEachEvent: func(t *testing.T, _ *sql.DB, i int) error {
+			if i == 3 {
+				SetRandomSource(fixedRandomSource(20))
+			}
+			return nil
+		},
+		doValidateQueries: func(t *testing.T, d *sql.DB, _ error) {
+			records, err := db.GetActionRecords(d, db.ActionRecordFilter{Player: "Test User"})
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+			var actionTypes []string
+			var actionTurns []int
+			for _, record := range records {
+				actionTypes = append(actionTypes, record.ActionType)
+				actionTurns = append(actionTurns, record.Turn)
+				assert.Equal(t, "Nation 1", record.CountryName)
+				assert.Equal(t, record.ActionType != "color", record.TurnAction, "expected only color actions to not count as turn actions")
+			}
+			if !assert.Equal(t, []string{"join", "color", "attack"}, actionTypes) {
+				t.FailNow()
+			}
+			// both players used their only action by joining, so the turn ended before the attack
+			assert.Equal(t, []int{1, 1, 2}, actionTurns)
+			assert.JSONEq(t, `{"action":{"user":"Test User","color":"ff0000"}}`, string(records[1].Details))
+
+			var attack AttackActionResult
+			if !assert.NoError(t, json.Unmarshal(records[2].Details, &attack)) {
+				t.FailNow()
+			}
+			assert.Equal(t, 20, attack.DieRoll)
+			assert.Equal(t, 3, attack.Attacking)
+			assert.Equal(t, 3, attack.Defending)
+			assert.Equal(t, 3, attack.Losses)
+			if assert.NotNil(t, attack.NationRemoved) {
+				assert.Equal(t, "Test User 2", attack.NationRemoved.Player)
+			}
+			action := *attack.Action
+			assert.Equal(t, "California", action.AttackingTerritory)
+			assert.Equal(t, "Nevada", action.DefendingTerritory)
+
+			records, err = db.GetActionRecords(d, db.ActionRecordFilter{Turn: 1, ActionType: "join"})
+			assert.NoError(t, err)
+			assert.Len(t, records, 2)
+
+			records, err = db.GetActionRecords(d, db.ActionRecordFilter{Turn: 1, ActionType: "end_turn"})
+			assert.NoError(t, err)
+			if assert.Len(t, records, 1) {
+				assert.True(t, records[0].IsNewTurn)
+			}
+
+			records, err = db.GetActionRecords(d, db.ActionRecordFilter{Turn: 2})
+			assert.NoError(t, err)
+			if assert.Len(t, records, 1) {
+				assert.Equal(t, "attack", records[0].ActionType)
+			}
+		},
+	}
+	runActionTestCase(t, &tc)
+}
+
+func TestMultipleGames(t *testing.T) {
+	cfg, err := config.GetTestingConfig(t)
+	if !assert.NoError(t, err, "failed to get testing config") {
+		t.FailNow()
+	}
+	cfg.DoTurnManagement = true
+	cfg.MinimumNationsToStart = 2
+	cfg.RandomSeed = 42
+	config.SetConfig(cfg)
+	game2 := *cfg
+	game2.GameID = 2
+	game2.Territories = slices.Clone(cfg.Territories)
+	if !assert.NoError(t, config.AddGameConfig(&game2)) {
+		t.FailNow()
+	}
+	d, err := db.GetDB()
+	if !assert.NoError(t, err, "failed to get test database") {
+		t.FailNow()
+	}
+	defer func() {
+		assert.NoError(t, db.CloseDB())
+		config.CloseTestingConfig(t)
+	}()
+
+	// the same player can join each game with the same nation and territory, and the turn only ends in the game
+	// where all players have used their actions
+	var colors []string
+	for _, action := range []Action{
+		&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+		&JoinAction{GameRef: GameRef{GameID: 2}, User: "Test User", Nation: "Nation 1", Territory: "CA"},
+		&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+		&RaiseAction{User: "Test User", Territory: "CA"},
+	} {
+		res, err := action.DoAction(d)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		if join, ok := res.(*JoinActionResult); ok {
+			colors = append(colors, join.Color)
+		}
+	}
+	assert.Equal(t, colors[0], colors[1], "expected each game to have its own random source with the same seed")
+
+	_, err = (&JoinAction{GameRef: GameRef{GameID: 3}, User: "Test User", Nation: "Nation 1", Territory: "CA"}).DoAction(d)
+	var actionErr *ActionError
+	assert.ErrorAs(t, err, &actionErr, "expected an unknown game to be an action error")
+	assert.ErrorIs(t, err, config.ErrUnknownGame)
+
+	testCases := []struct {
+		gameID         int64
+		expectTurn     int
+		expectNations  int
+		expectHoldings map[string]int
+		expectRecords  []string
+		expectDraws    int64
+	}{
+		{gameID: 1, expectTurn: 2, expectNations: 2, expectHoldings: map[string]int{"CA": 4, "NV": 3},
+			expectRecords: []string{"join", "join", "end_turn", "raise"}, expectDraws: 6},
+		{gameID: 2, expectTurn: 1, expectNations: 1, expectHoldings: map[string]int{"CA": 3},
+			expectRecords: []string{"join"}, expectDraws: 3},
+	}
+	for _, tc := range testCases {
+		t.Run(fmt.Sprintf("game %d", tc.gameID), func(t *testing.T) {
+			turn, err := db.GetCurrentTurn(d, tc.gameID)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectTurn, turn)
+
+			nations, err := db.GetNations(d, tc.gameID)
+			assert.NoError(t, err)
+			assert.Len(t, nations, tc.expectNations)
+
+			holdings, err := db.GetHoldings(d, tc.gameID)
+			assert.NoError(t, err)
+			armies := make(map[string]int)
+			for _, holding := range holdings {
+				armies[holding.Territory] = holding.ArmySize
+			}
+			assert.Equal(t, tc.expectHoldings, armies)
+
+			records, err := db.GetActionRecords(d, db.ActionRecordFilter{GameID: tc.gameID})
+			assert.NoError(t, err)
+			var actionTypes []string
+			for _, record := range records {
+				assert.Equal(t, tc.gameID, record.GameID)
+				actionTypes = append(actionTypes, record.ActionType)
+			}
+			assert.Equal(t, tc.expectRecords, actionTypes)
+
+			seed, draws, err := db.GetRandomSeed(d, tc.gameID)
+			assert.NoError(t, err)
+			assert.EqualValues(t, 42, seed)
+			assert.Equal(t, tc.expectDraws, draws)
+		})
+	}
+}
+
+func TestGameHandles(t *testing.T) {
+	// each game has its own configuration, database, and random source, without an active configuration
+	cfg1 := config.NewTestingConfig(t)
+	cfg1.DoTurnManagement = false
+	cfg2 := config.NewTestingConfig(t)
+	cfg2.DoTurnManagement = false
+	cfg2.InitialArmies = 5
+	_, err := config.GetConfig()
+	if !assert.ErrorIs(t, err, config.ErrGameNotConfigured, "expected no active configuration") {
+		t.FailNow()
+	}
+
+	g1, err := game.Open(cfg1)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer func() {
+		assert.NoError(t, g1.Close())
+	}()
+	g2, err := game.Open(cfg2)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer func() {
+		assert.NoError(t, g2.Close())
+	}()
+
+	for _, g := range []*game.Game{g1, g2} {
+		for _, action := range []Action{
+			&JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+			&JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+		} {
+			if _, err = action.Do(g); !assert.NoError(t, err) {
+				t.FailNow()
+			}
+		}
+	}
+
+	g1.SetRandomSource(fixedRandomSource(20))
+	res, err := (&AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "NV"}).Do(g1)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	aar := res.(*AttackActionResult)
+	assert.Equal(t, 3, aar.Losses)
+	if assert.NotNil(t, aar.NationRemoved) {
+		assert.Equal(t, "Nation 2", aar.NationRemoved.CountryName)
+	}
+
+	testCases := []struct {
+		desc           string
+		g              *game.Game
+		expectNations  int
+		expectHoldings map[string]int
+	}{
+		{desc: "game with attack", g: g1, expectNations: 1, expectHoldings: map[string]int{"CA": 3}},
+		{desc: "game without attack", g: g2, expectNations: 2, expectHoldings: map[string]int{"CA": 5, "NV": 5}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			nations, err := db.GetNations(tc.g.DB(), tc.g.ID())
+			assert.NoError(t, err)
+			assert.Len(t, nations, tc.expectNations)
+
+			holdings, err := db.GetHoldings(tc.g.DB(), tc.g.ID())
+			assert.NoError(t, err)
+			armies := make(map[string]int)
+			for _, holding := range holdings {
+				armies[holding.Territory] = holding.ArmySize
+			}
+			assert.Equal(t, tc.expectHoldings, armies)
+		})
+	}
+}
+
+func TestCompatGame(t *testing.T) {
+	cfg, err := config.GetTestingConfig(t)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	config.SetConfig(cfg)
+	tdb, err := db.GetDB()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer func() {
+		assert.NoError(t, db.CloseDB())
+		config.CloseTestingConfig(t)
+	}()
+
+	g, err := compatGame(GameRef{}, tdb)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cached, err := compatGame(GameRef{}, tdb)
+	assert.NoError(t, err)
+	assert.Same(t, g, cached, "expected the game handle to be reused by later actions")
+
+	_, err = compatGame(GameRef{}, nil)
+	assert.ErrorIs(t, err, db.ErrNoDatabase)
+}
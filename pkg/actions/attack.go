@@ -8,28 +8,99 @@ import (
 
 	"github.com/Eggbertx/territories-game/pkg/config"
 	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
 )
 
 const (
 	attackActionFailureFmt                = "%s attacked %s from %s, attack failed (rolled %d) and %d attacking armies were lost"
+	attackActionFailureAttackerRemovedFmt = "%s attacked %s from %s, attack failed (rolled %d) and all attacking armies were lost, %s has been removed from the game"
 	attackActionStalemateFmt              = "%s attacked %s from %s, attack failed (rolled %d) but no armies were lost"
 	attackActionSuccessFmt                = "%s attacked %s from %s, attack succeeded (rolled %d) and %d defending armies were lost"
 	attackActionSuccessDefenderRemovedFmt = "%s attacked %s from %s, attack succeeded (rolled %d) and all defending armies were lost, %s has been removed from the game"
+
+	counterattackFailureFmt                = "; %s counterattacked %s, counterattack failed (rolled %d) and %d defending armies were lost"
+	counterattackFailureDefenderRemovedFmt = "; %s counterattacked %s, counterattack failed (rolled %d) and all defending armies were lost, %s has been removed from the game"
+	counterattackStalemateFmt              = "; %s counterattacked %s, counterattack failed (rolled %d) but no armies were lost"
+	counterattackSuccessFmt                = "; %s counterattacked %s, counterattack succeeded (rolled %d) and %d attacking armies were lost"
+	counterattackSuccessAttackerRemovedFmt = "; %s counterattacked %s, counterattack succeeded (rolled %d) and all attacking armies were lost, %s has been removed from the game"
 )
 
 type AttackActionResult struct {
 	actionResultBase[*AttackAction]
-	DieRoll       int
-	Attacking     int
-	Defending     int
-	Losses        int
-	NationRemoved *db.Nation
+	DieRoll   int `json:"dieRoll"`
+	Attacking int `json:"attacking"`
+	Defending int `json:"defending"`
+
+	// Losses is the number of defending armies lost if it is positive, or the number of attacking armies lost if it is negative
+	Losses        int        `json:"losses"`
+	NationRemoved *db.Nation `json:"nationRemoved,omitempty"`
+
+	// Counterattacked is true if counterattacks are enabled and the defending holding survived the attack and struck back
+	Counterattacked bool `json:"counterattacked"`
+	CounterDieRoll  int  `json:"counterDieRoll,omitempty"`
+
+	// CounterLosses is the number of attacking armies lost in the counterattack if it is positive, or the number of
+	// defending armies lost if it is negative
+	CounterLosses        int        `json:"counterLosses,omitempty"`
+	CounterNationRemoved *db.Nation `json:"counterNationRemoved,omitempty"`
+
+	// CapitalFall is the outcome of the attack or counterattack destroying the armies in a nation's capital, if the
+	// nation is still in the game
+	CapitalFall *capitalFall `json:"capitalFall,omitempty"`
+}
+
+func (aar *AttackActionResult) changed() ([]string, []string) {
+	action := *aar.Action
+	players := []string{action.User}
+	for _, nation := range []*db.Nation{aar.NationRemoved, aar.CounterNationRemoved} {
+		if nation != nil {
+			players = append(players, nation.Player)
+		}
+	}
+	territories := []string{action.AttackingTerritory, action.DefendingTerritory}
+	if aar.CapitalFall != nil {
+		fallPlayers, fallTerritories := aar.CapitalFall.changed()
+		players = append(players, fallPlayers...)
+		territories = append(territories, fallTerritories...)
+	}
+	return players, territories
 }
 
 func (aar *AttackActionResult) ActionType() string {
 	return "attack"
 }
 
+// AttackerLosses returns the total number of armies lost by the attacking holding, including any lost in a counterattack
+func (aar *AttackActionResult) AttackerLosses() int {
+	var losses int
+	if aar.Losses < 0 {
+		losses -= aar.Losses
+	}
+	if aar.CounterLosses > 0 {
+		losses += aar.CounterLosses
+	}
+	return losses
+}
+
+// DefenderLosses returns the total number of armies lost by the defending holding, including any lost in a counterattack
+func (aar *AttackActionResult) DefenderLosses() int {
+	var losses int
+	if aar.Losses > 0 {
+		losses += aar.Losses
+	}
+	if aar.CounterLosses < 0 {
+		losses -= aar.CounterLosses
+	}
+	return losses
+}
+
+func nationRemovedName(nation *db.Nation) string {
+	if nation == nil || nation.Player == "" {
+		return ""
+	}
+	return nation.CountryName
+}
+
 func (aar *AttackActionResult) String() string {
 	str := aar.actionResultBase.String()
 	if str != "" {
@@ -39,31 +110,76 @@ func (aar *AttackActionResult) String() string {
 	if action == nil {
 		return noActionString
 	}
-	if aar.Losses == 0 {
-		return fmt.Sprintf(attackActionStalemateFmt, action.User, action.DefendingTerritory, action.AttackingTerritory, aar.DieRoll)
+	removed := nationRemovedName(aar.NationRemoved)
+	switch {
+	case aar.Losses == 0:
+		str = fmt.Sprintf(attackActionStalemateFmt, action.User, action.DefendingTerritory, action.AttackingTerritory, aar.DieRoll)
+	case aar.Losses > 0 && removed != "":
+		str = fmt.Sprintf(attackActionSuccessDefenderRemovedFmt, action.User, action.DefendingTerritory, action.AttackingTerritory, aar.DieRoll, removed)
+	case aar.Losses > 0:
+		str = fmt.Sprintf(attackActionSuccessFmt, action.User, action.DefendingTerritory, action.AttackingTerritory, aar.DieRoll, aar.Losses)
+	case removed != "":
+		str = fmt.Sprintf(attackActionFailureAttackerRemovedFmt, action.User, action.DefendingTerritory, action.AttackingTerritory, aar.DieRoll, removed)
+	default:
+		str = fmt.Sprintf(attackActionFailureFmt, action.User, action.DefendingTerritory, action.AttackingTerritory, aar.DieRoll, -aar.Losses)
 	}
-	if aar.Losses > 0 {
-		if aar.NationRemoved != nil && aar.NationRemoved.Player != "" {
-			return fmt.Sprintf(attackActionSuccessDefenderRemovedFmt, action.User, action.DefendingTerritory, action.AttackingTerritory, aar.DieRoll, aar.NationRemoved.CountryName)
-		}
-		return fmt.Sprintf(attackActionSuccessFmt, action.User, action.DefendingTerritory, action.AttackingTerritory, aar.DieRoll, aar.Losses)
+	if !aar.Counterattacked {
+		return str + aar.capitalFallString()
+	}
+
+	removed = nationRemovedName(aar.CounterNationRemoved)
+	switch {
+	case aar.CounterLosses == 0:
+		str += fmt.Sprintf(counterattackStalemateFmt, action.DefendingTerritory, action.AttackingTerritory, aar.CounterDieRoll)
+	case aar.CounterLosses > 0 && removed != "":
+		str += fmt.Sprintf(counterattackSuccessAttackerRemovedFmt, action.DefendingTerritory, action.AttackingTerritory, aar.CounterDieRoll, removed)
+	case aar.CounterLosses > 0:
+		str += fmt.Sprintf(counterattackSuccessFmt, action.DefendingTerritory, action.AttackingTerritory, aar.CounterDieRoll, aar.CounterLosses)
+	case removed != "":
+		str += fmt.Sprintf(counterattackFailureDefenderRemovedFmt, action.DefendingTerritory, action.AttackingTerritory, aar.CounterDieRoll, removed)
+	default:
+		str += fmt.Sprintf(counterattackFailureFmt, action.DefendingTerritory, action.AttackingTerritory, aar.CounterDieRoll, -aar.CounterLosses)
 	}
-	return fmt.Sprintf(attackActionFailureFmt, action.User, action.DefendingTerritory, action.AttackingTerritory, aar.DieRoll, -aar.Losses)
+	return str + aar.capitalFallString()
 }
 
+func (aar *AttackActionResult) capitalFallString() string {
+	if aar.CapitalFall == nil {
+		return ""
+	}
+	return aar.CapitalFall.String()
+}
+
+// AttackAction attacks a neighboring territory held by another nation. If the defending territory is its nation's
+// capital, the game's capital defense bonus is applied, and if the armies in a capital are destroyed, the game's capital
+// loss policy is applied to its nation
 type AttackAction struct {
-	User               string
-	AttackingTerritory string
-	DefendingTerritory string
+	GameRef
+	User               string `json:"user"`
+	AttackingTerritory string `json:"attacking"`
+	DefendingTerritory string `json:"defending"`
 }
 
+// DoAction attacks the defending territory using the given database
 func (aa *AttackAction) DoAction(tdb *sql.DB) (ActionResult, error) {
-	cfg, err := config.GetConfig()
+	g, err := compatGame(aa.GameRef, tdb)
 	if err != nil {
 		return nil, err
 	}
+	return aa.Do(g)
+}
+
+// Do attacks the defending territory in the given game, or stores the attack as an order to be resolved when the turn
+// ends if the game uses simultaneous resolution
+func (aa *AttackAction) Do(g *game.Game) (ActionResult, error) {
+	if err := checkGameOver(g); err != nil {
+		return nil, err
+	}
+	cfg := g.Config()
+	tdb := g.DB()
+	var err error
 
-	if err := db.ValidateUser(aa.User, tdb, cfg.LogError); err != nil {
+	if err := db.ValidateUser(aa.User, tdb, cfg.GameID, cfg.LogError); err != nil {
 		if errors.Is(err, db.ErrMissingUser) {
 			cfg.LogError("No user specified")
 			return nil, &ActionError{err: db.ErrMissingUser}
@@ -75,117 +191,197 @@ func (aa *AttackAction) DoAction(tdb *sql.DB) (ActionResult, error) {
 		return nil, err
 	}
 
-	if err = checkIfEnoughPlayersToStart(nil, cfg, cfg.LogError); err != nil {
+	if err = checkIfEnoughPlayersToStart(g, nil); err != nil {
+		return nil, err
+	}
+
+	if err = checkReturnsRemainingIfManaging(g, nil, aa.User); err != nil {
+		return nil, err
+	}
+
+	attackingTerritory, defendingTerritory, err := aa.resolveTerritories(g)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := tdb.Begin()
+	if err != nil {
+		cfg.LogError("Unable to begin transaction", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var res ActionResult
+	if cfg.ResolutionMode == config.ResolutionSimultaneous {
+		if err = aa.checkTreaty(g, tx, defendingTerritory); err != nil {
+			return nil, err
+		}
+		res, err = submitOrder(g, tx, aa, &db.Order{
+			Player:      aa.User,
+			Type:        "attack",
+			Source:      attackingTerritory.Abbreviation,
+			Destination: defendingTerritory.Abbreviation,
+		}, 1, fmt.Sprintf(orderAttackFmt, aa.User, defendingTerritory.Name, attackingTerritory.Name))
+	} else {
+		res, err = aa.apply(g, tx, attackingTerritory, defendingTerritory)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = logAction(g, tx, res, true); err != nil {
 		return nil, err
 	}
 
-	if err = checkReturnsRemainingIfManaging(nil, aa.User, cfg, cfg.LogError); err != nil {
+	if err = tx.Commit(); err != nil {
+		cfg.LogError("Unable to commit transaction", "error", err)
 		return nil, err
 	}
+	return res, nil
+}
 
+// resolveTerritories resolves the attacking and defending territories and checks that the defending territory can be
+// attacked from the attacking territory
+func (aa *AttackAction) resolveTerritories(g *game.Game) (*config.Territory, *config.Territory, error) {
+	cfg := g.Config()
 	attackingTerritory, err := cfg.ResolveTerritory(aa.AttackingTerritory)
 	if err != nil {
 		cfg.LogError("Unable to resolve attacking territory", "error", err)
-		return nil, &ActionError{err: err}
+		return nil, nil, &ActionError{err: err}
 	}
 	aa.AttackingTerritory = attackingTerritory.Name
 
 	defendingTerritory, err := cfg.ResolveTerritory(aa.DefendingTerritory)
 	if err != nil {
 		cfg.LogError("Unable to resolve defending territory", "error", err)
-		return nil, &ActionError{err: err}
+		return nil, nil, &ActionError{err: err}
 	}
 	aa.DefendingTerritory = defendingTerritory.Name
+	if err = checkPassable(g, defendingTerritory); err != nil {
+		return nil, nil, err
+	}
 
 	if attackingTerritory.Abbreviation == defendingTerritory.Abbreviation {
 		cfg.LogError("cannot attack territory: friendly fire not allowed", "defending", defendingTerritory.Name, "attacking", attackingTerritory.Name)
-		return nil, &ActionError{msg: fmt.Sprintf("cannot attack %s from %s: friendly fire not allowed", defendingTerritory.Name, attackingTerritory.Name)}
+		return nil, nil, &ActionError{msg: fmt.Sprintf("cannot attack %s from %s: friendly fire not allowed", defendingTerritory.Name, attackingTerritory.Name)}
 	}
 
 	neighbors, err := attackingTerritory.IsNeighboring(aa.DefendingTerritory)
 	if err != nil {
 		cfg.LogError("Unable to check neighboring territories", "error", err)
-		return nil, &ActionError{err: err}
+		return nil, nil, &ActionError{err: err}
 	}
 	if !neighbors {
 		cfg.LogError("cannot attack territory (not neighboring)", "defending", defendingTerritory.Name, "attacking", attackingTerritory.Name)
-		return nil, &ActionError{msg: fmt.Sprintf("cannot attack %s from %s: not a neighboring territory", defendingTerritory.Name, attackingTerritory.Name)}
+		return nil, nil, &ActionError{msg: fmt.Sprintf("cannot attack %s from %s: not a neighboring territory", defendingTerritory.Name, attackingTerritory.Name)}
 	}
+	return attackingTerritory, defendingTerritory, nil
+}
 
-	tx, err := tdb.Begin()
+// applyOrder does the attack of a resolved order
+func (aa *AttackAction) applyOrder(g *game.Game, tx *sql.Tx) (ActionResult, error) {
+	attackingTerritory, defendingTerritory, err := aa.resolveTerritories(g)
 	if err != nil {
-		cfg.LogError("Unable to begin transaction", "error", err)
 		return nil, err
 	}
-	defer tx.Rollback()
+	return aa.apply(g, tx, attackingTerritory, defendingTerritory)
+}
 
-	var res ActionResult
+// apply attacks the defending territory using the given transaction, if the defending nation doesn't have a treaty in
+// effect with the attacking player's nation
+func (aa *AttackAction) apply(g *game.Game, tx *sql.Tx, attackingTerritory, defendingTerritory *config.Territory) (*AttackActionResult, error) {
+	if err := aa.checkTreaty(g, tx, defendingTerritory); err != nil {
+		return nil, err
+	}
 
-	if cfg.DoCounterattack {
-		res, err = aa.doAttackWithCounter(tdb, tx, attackingTerritory, defendingTerritory)
+	var res *AttackActionResult
+	var err error
+	if g.Config().DoCounterattack {
+		res, err = aa.doAttackWithCounter(g, tx, attackingTerritory, defendingTerritory)
 	} else {
-		res, err = aa.doNormalAttack(tdb, tx, attackingTerritory, defendingTerritory)
+		res, err = aa.doNormalAttack(g, tx, attackingTerritory, defendingTerritory)
 	}
 	if err != nil {
-		cfg.LogError("Attack action failed", "error", err)
+		g.LogError("Attack action failed", "error", err)
 		return nil, err
 	}
+	return res, nil
+}
 
-	if err = addTurnEntryIfManaging(tx, aa.User, "attack"); err != nil {
-		return nil, err
+// checkTreaty returns an *ActionError if the defending territory is held by a nation that has a treaty in effect with
+// the attacking player's nation
+func (aa *AttackAction) checkTreaty(g *game.Game, tx *sql.Tx, defendingTerritory *config.Territory) error {
+	var defender string
+	err := tx.QueryRow("SELECT player FROM v_nation_holdings WHERE game_id = ? AND territory = ?",
+		g.ID(), defendingTerritory.Abbreviation).Scan(&defender)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && defender == aa.User) {
+		return nil
 	}
-
-	if err = tx.Commit(); err != nil {
-		cfg.LogError("Unable to commit transaction", "error", err)
-		return nil, err
+	if err != nil {
+		g.LogError("Unable to get defending player", "error", err)
+		return err
 	}
-	return res, nil
-}
 
-func (aa *AttackAction) doNormalAttack(tdb *sql.DB, tx *sql.Tx, attackingTerritory, defendingTerritory *config.Territory) (ActionResult, error) {
-	cfg, err := config.GetConfig()
+	treaty, err := db.GetTreaty(tx, g.ID(), aa.User, defender)
 	if err != nil {
-		return nil, err
+		g.LogError("Unable to get treaty", "error", err)
+		return err
+	}
+	turn, err := db.CurrentTurn(tx, g.ID())
+	if err != nil {
+		g.LogError("Unable to get current turn", "error", err)
+		return err
 	}
+	if treaty != nil && treaty.InEffect(turn) {
+		err = &ActionError{msg: fmt.Sprintf("cannot attack %s: %s has %s with %s",
+			defendingTerritory.Name, aa.User, treatyDescription(treaty.Type), defender)}
+		g.LogError("Unable to attack territory", "error", err)
+		return err
+	}
+	return nil
+}
 
+// queryArmySizes returns the number of armies in the attacking territory controlled by the attacking player, and the
+// number of armies in the defending territory
+func (aa *AttackAction) queryArmySizes(tx *sql.Tx, attackingTerritory, defendingTerritory *config.Territory, cfg *config.Config) (int, int, error) {
 	var attacking, defending int
-	const attackSQL = `SELECT army_size FROM v_nation_holdings WHERE territory = ?`
+	const attackSQL = `SELECT army_size FROM v_nation_holdings WHERE game_id = ? AND territory = ?`
 	stmt, err := tx.Prepare(attackSQL + "  AND player = ?")
 	if err != nil {
 		cfg.LogError("Unable to prepare attack query", "error", err)
-		return nil, err
+		return 0, 0, err
 	}
 	defer stmt.Close()
 
-	err = stmt.QueryRow(attackingTerritory.Abbreviation, aa.User).Scan(&attacking)
+	err = stmt.QueryRow(cfg.GameID, attackingTerritory.Abbreviation, aa.User).Scan(&attacking)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		cfg.LogError("Unable to get attacking army size", "error", err)
-		return nil, err
+		return 0, 0, err
 	}
 	if attacking == 0 {
 		err = &ActionError{
 			msg: fmt.Sprintf("no armies in %s controlled by %s to attack with", attackingTerritory.Name, aa.User),
 		}
 		cfg.LogError("No armies available to attack with", "user", aa.User, "defending", defendingTerritory.Name, "attacking", attackingTerritory.Name)
-		return nil, err
+		return 0, 0, err
 	}
 
 	if err = stmt.Close(); err != nil {
 		cfg.LogError("Unable to close statement", "error", err)
-		return nil, err
+		return 0, 0, err
 	}
 
 	stmt, err = tx.Prepare(attackSQL)
 	if err != nil {
 		cfg.LogError("Unable to prepare defending query", "error", err)
-		return nil, err
+		return 0, 0, err
 	}
 	defer stmt.Close()
 
-	err = stmt.QueryRow(defendingTerritory.Abbreviation).Scan(&defending)
+	err = stmt.QueryRow(cfg.GameID, defendingTerritory.Abbreviation).Scan(&defending)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		cfg.LogError("Unable to get defending army size", "error", err)
-		return nil, err
+		return 0, 0, err
 	}
 
 	if defending == 0 {
@@ -193,64 +389,192 @@ func (aa *AttackAction) doNormalAttack(tdb *sql.DB, tx *sql.Tx, attackingTerrito
 			msg: fmt.Sprintf("no armies in %s", defendingTerritory.Name),
 		}
 		cfg.LogError("No armies to attack in destination territory", "destination", defendingTerritory.Name)
+		return 0, 0, err
+	}
+	return attacking, defending, nil
+}
+
+// exchangeOutcome is the outcome of a single round of combat between two holdings
+type exchangeOutcome struct {
+	roll           int
+	strikingLosses int
+	targetLosses   int
+
+	// nationRemoved is the nation removed from the game because it lost its last territory, if any
+	nationRemoved *db.Nation
+
+	// capitalFall is set if the armies in a nation's capital were destroyed and the nation is still in the game
+	capitalFall *capitalFall
+}
+
+// exchange does a single round of combat between the armies in the striking territory and the armies in the target
+// territory and updates the holdings accordingly. The target territory's defense bonus and the attack penalty of the
+// connection between the territories are applied, along with the game's capital defense bonus if it is its nation's
+// capital, and if either holding is a capital that was destroyed, the game's capital loss policy is applied to its
+// nation
+func exchange(g *game.Game, tx *sql.Tx, striking, target *config.Territory, strikingArmies, targetArmies int) (*exchangeOutcome, error) {
+	cfg := g.Config()
+	strikingCapital, err := db.CapitalHolder(tx, cfg.GameID, striking.Abbreviation)
+	if err != nil {
+		cfg.LogError("Unable to check if striking territory is a capital", "error", err)
+		return nil, err
+	}
+	targetCapital, err := db.CapitalHolder(tx, cfg.GameID, target.Abbreviation)
+	if err != nil {
+		cfg.LogError("Unable to check if target territory is a capital", "error", err)
 		return nil, err
 	}
+	connection, err := striking.ConnectionTo(target.Abbreviation)
+	if err != nil {
+		cfg.LogError("Unable to get connection between territories", "error", err)
+		return nil, err
+	}
+	defenseBonus := target.DefenseBonus
+	if connection != nil {
+		defenseBonus += connection.AttackPenalty
+	}
+	if targetCapital != "" {
+		defenseBonus += cfg.CapitalDefenseBonus
+	}
 
-	x, losses, err := attackCalculation(attacking, defending)
+	rng, err := g.RandomSource(tx)
+	if err != nil {
+		return nil, err
+	}
+	x, losses, err := attackCalculation(rng, strikingArmies, targetArmies, defenseBonus)
 	if err != nil {
-		cfg.LogError("Attack calculation failed", "error", err)
 		return nil, err
 	}
 
-	var attackerLosses, defenderLosses int
-	var nationRemoved *db.Nation
+	outcome := &exchangeOutcome{roll: x}
+	var fallen, survivor *config.Territory
+	var fallenPlayer string
 	if losses > 0 {
-		// defending armies destroyed
-		defenderLosses = int(math.Min(losses, float64(defending)))
-		nationRemoved, err = db.UpdateHoldingArmySize(tdb, tx, defendingTerritory.Abbreviation, defending-defenderLosses, true)
-	} else {
-		// attacking armies destroyed
-		attackerLosses = int(math.Min(math.Abs(losses), float64(attacking)))
-		nationRemoved, err = db.UpdateHoldingArmySize(tdb, tx, attackingTerritory.Abbreviation, attacking-attackerLosses, true)
+		// target armies destroyed
+		outcome.targetLosses = int(math.Min(losses, float64(targetArmies)))
+		outcome.nationRemoved, err = db.UpdateHoldingArmySize(g.DB(), tx, cfg, target.Abbreviation, targetArmies-outcome.targetLosses, true)
+		if outcome.targetLosses == targetArmies {
+			fallen, survivor, fallenPlayer = target, striking, targetCapital
+		}
+	} else if losses < 0 {
+		// striking armies destroyed
+		outcome.strikingLosses = int(math.Min(math.Abs(losses), float64(strikingArmies)))
+		outcome.nationRemoved, err = db.UpdateHoldingArmySize(g.DB(), tx, cfg, striking.Abbreviation, strikingArmies-outcome.strikingLosses, true)
+		if outcome.strikingLosses == strikingArmies {
+			fallen, survivor, fallenPlayer = striking, target, strikingCapital
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if fallenPlayer == "" || outcome.nationRemoved != nil {
+		return outcome, nil
+	}
+	var conqueror string
+	if err = tx.QueryRow("SELECT player FROM v_nation_holdings WHERE game_id = ? AND territory = ?",
+		cfg.GameID, survivor.Abbreviation).Scan(&conqueror); err != nil {
+		cfg.LogError("Unable to get conquering player", "error", err)
+		return nil, err
+	}
+	if outcome.capitalFall, err = fallCapital(g, tx, fallen, fallenPlayer, conqueror); err != nil {
+		return nil, err
 	}
+	return outcome, nil
+}
+
+func (aa *AttackAction) doNormalAttack(g *game.Game, tx *sql.Tx, attackingTerritory, defendingTerritory *config.Territory) (*AttackActionResult, error) {
+	cfg := g.Config()
+	attacking, defending, err := aa.queryArmySizes(tx, attackingTerritory, defendingTerritory, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	outcome, err := exchange(g, tx, attackingTerritory, defendingTerritory, attacking, defending)
 	if err != nil {
-		cfg.LogError("Unable to update holding army size", "error", err)
+		cfg.LogError("Unable to resolve attack", "error", err)
 		return nil, err
 	}
 	return &AttackActionResult{
 		actionResultBase: actionResultBase[*AttackAction]{Action: &aa, user: aa.User},
-		DieRoll:          x,
+		DieRoll:          outcome.roll,
 		Attacking:        attacking,
 		Defending:        defending,
-		Losses:           defenderLosses,
-		NationRemoved:    nationRemoved,
+		Losses:           outcome.targetLosses - outcome.strikingLosses,
+		NationRemoved:    outcome.nationRemoved,
+		CapitalFall:      outcome.capitalFall,
 	}, nil
 }
 
-func (aa *AttackAction) doAttackWithCounter(_ *sql.DB, _ *sql.Tx, _, _ *config.Territory) (ActionResult, error) {
-	// Placeholder for Advance Wars-style attack logic
-	return nil, errors.New("counterattack logic not implemented yet")
+// doAttackWithCounter does an Advance Wars-style attack, where the defending holding, if it survives the attack,
+// strikes back at the attacking holding with its remaining armies
+func (aa *AttackAction) doAttackWithCounter(g *game.Game, tx *sql.Tx, attackingTerritory, defendingTerritory *config.Territory) (*AttackActionResult, error) {
+	result, err := aa.doNormalAttack(g, tx, attackingTerritory, defendingTerritory)
+	if err != nil {
+		return nil, err
+	}
+
+	attacking := result.Attacking
+	defending := result.Defending
+	if result.Losses > 0 {
+		defending -= result.Losses
+	} else {
+		attacking += result.Losses
+	}
+	if attacking <= 0 || defending <= 0 {
+		// one of the holdings was destroyed, nothing is left to counterattack with or against
+		return result, nil
+	}
+	back, err := defendingTerritory.ConnectionTo(attackingTerritory.Abbreviation)
+	if err != nil {
+		g.LogError("Unable to get connection between territories", "error", err)
+		return nil, err
+	}
+	if back == nil {
+		// the attack came across a one-way connection, the defending armies can't reach the attacking territory
+		return result, nil
+	}
+
+	outcome, err := exchange(g, tx, defendingTerritory, attackingTerritory, defending, attacking)
+	if err != nil {
+		g.LogError("Unable to resolve counterattack", "error", err)
+		return nil, err
+	}
+	result.Counterattacked = true
+	result.CounterDieRoll = outcome.roll
+	result.CounterLosses = outcome.targetLosses - outcome.strikingLosses
+	result.CounterNationRemoved = outcome.nationRemoved
+	result.CapitalFall = outcome.capitalFall
+	return result, nil
 }
 
-func attackCalculation(attacking, defending int) (int, float64, error) {
+// attackCalculation rolls a 20-sided die using the given random source and returns the roll and the resulting losses,
+// positive if the defending side lost armies or negative if the attacking side lost armies. The defense bonus is added
+// to the defending armies when calculating the outcome, but the defending side can't lose more armies than it has
+func attackCalculation(rng db.RandomSource, attacking, defending, defenseBonus int) (int, float64, error) {
 	if attacking <= 0 || defending <= 0 {
 		return 0, 0, fmt.Errorf("invalid army sizes: attacking=%d, defending=%d", attacking, defending)
 	}
 
-	x := randInt(20) + 1
-	success := x > (defending-attacking)*2+10
+	x, err := rng.IntN(20)
+	if err != nil {
+		return 0, 0, err
+	}
+	x++
+	effectiveDefending := defending + defenseBonus
+	success := x > (effectiveDefending-attacking)*2+10
 
 	var losses float64
 	if success {
 		// attack successful, losses are on the defending side
-		losses = math.Floor(0.5*float64(x) + float64(attacking-defending-5))
+		losses = math.Floor(0.5*float64(x) + float64(attacking-effectiveDefending-5))
 		if losses == 0 {
 			losses = 1
 		}
 		losses = math.Min(losses, float64(defending)) // cannot lose more armies than defending has
 	} else {
 		// attack failed, losses are on the attacking side (negative value)
-		losses = -math.Floor(0.5*float64(x) + float64(defending-attacking-5))
+		losses = -math.Floor(0.5*float64(x) + float64(effectiveDefending-attacking-5))
 		if x == 1 && losses >= 0 {
 			losses = -1 // critical failure, at least one army lost
 		}
@@ -0,0 +1,127 @@
+package actions
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/Eggbertx/territories-game/pkg/config"
+	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
+)
+
+const (
+	capitalFallenFmt    = "; %s lost its capital %s"
+	capitalEliminateFmt = " and was conquered by %s"
+	capitalAnnexedFmt   = ", which annexed its territories (%s)"
+	capitalCrippleFmt   = ", its armies were halved and its reinforcements were lost"
+)
+
+// capitalFall is the outcome of the armies in a nation's capital being destroyed in combat
+type capitalFall struct {
+	// Nation is the nation that lost its capital
+	Nation *db.Nation `json:"nation"`
+
+	// Capital is the name of the nation's capital territory
+	Capital string `json:"capital"`
+
+	// Conqueror is the player whose nation destroyed the armies in the capital
+	Conqueror string `json:"conqueror"`
+
+	// Policy is the game's capital loss policy applied to the nation
+	Policy string `json:"policy"`
+
+	// Territories are the names of the nation's other territories affected by the policy
+	Territories []string `json:"territories,omitempty"`
+}
+
+func (cf *capitalFall) changed() ([]string, []string) {
+	players := []string{cf.Nation.Player}
+	if cf.Policy == config.CapitalLossEliminate {
+		players = append(players, cf.Conqueror)
+	}
+	return players, cf.Territories
+}
+
+func (cf *capitalFall) String() string {
+	str := fmt.Sprintf(capitalFallenFmt, cf.Nation.CountryName, cf.Capital)
+	switch cf.Policy {
+	case config.CapitalLossEliminate:
+		str += fmt.Sprintf(capitalEliminateFmt, cf.Conqueror)
+		if len(cf.Territories) > 0 {
+			str += fmt.Sprintf(capitalAnnexedFmt, strings.Join(cf.Territories, ", "))
+		}
+	case config.CapitalLossCripple:
+		str += capitalCrippleFmt
+	}
+	return str
+}
+
+// fallCapital applies the game's capital loss policy to the player's nation after the armies in its capital were
+// destroyed by the conqueror's nation. The nation must still be in the game
+func fallCapital(g *game.Game, tx *sql.Tx, capital *config.Territory, player string, conqueror string) (*capitalFall, error) {
+	cfg := g.Config()
+	fall := &capitalFall{
+		Nation:    &db.Nation{Player: player},
+		Capital:   capital.Name,
+		Conqueror: conqueror,
+		Policy:    cfg.CapitalLossPolicy,
+	}
+	if err := tx.QueryRow("SELECT country_name, color FROM nations WHERE game_id = ? AND player = ?",
+		cfg.GameID, player).Scan(&fall.Nation.CountryName, &fall.Nation.Color); err != nil {
+		cfg.LogError("Unable to get nation", "error", err)
+		return nil, err
+	}
+	if cfg.CapitalLossPolicy == config.CapitalLossNone {
+		return fall, nil
+	}
+
+	rows, err := tx.Query("SELECT territory FROM v_nation_holdings WHERE game_id = ? AND player = ? ORDER BY id", cfg.GameID, player)
+	if err != nil {
+		cfg.LogError("Unable to get nation holdings", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var abbr string
+		if err = rows.Scan(&abbr); err != nil {
+			cfg.LogError("Unable to scan holding", "error", err)
+			return nil, err
+		}
+		territory, err := cfg.ResolveTerritory(abbr)
+		if err != nil {
+			cfg.LogError("Unable to resolve held territory", "territory", abbr, "error", err)
+			return nil, err
+		}
+		fall.Territories = append(fall.Territories, territory.Name)
+	}
+	if err = rows.Close(); err != nil {
+		cfg.LogError("Unable to close holdings rows", "error", err)
+		return nil, err
+	}
+
+	if cfg.CapitalLossPolicy == config.CapitalLossCripple {
+		if _, err = tx.Exec(`UPDATE holdings SET army_size = (army_size + 1) / 2
+			WHERE game_id = ?1 AND nation_id = (SELECT id FROM nations WHERE game_id = ?1 AND player = ?2)`,
+			cfg.GameID, player); err != nil {
+			cfg.LogError("Unable to halve nation armies", "error", err)
+			return nil, err
+		}
+		if _, err = tx.Exec("UPDATE nations SET reinforcements = 0 WHERE game_id = ? AND player = ?", cfg.GameID, player); err != nil {
+			cfg.LogError("Unable to discard nation reinforcements", "error", err)
+			return nil, err
+		}
+		return fall, nil
+	}
+
+	if _, err = tx.Exec(`UPDATE holdings SET nation_id = (SELECT id FROM nations WHERE game_id = ?1 AND player = ?2)
+		WHERE game_id = ?1 AND nation_id = (SELECT id FROM nations WHERE game_id = ?1 AND player = ?3)`,
+		cfg.GameID, conqueror, player); err != nil {
+		cfg.LogError("Unable to annex nation holdings", "error", err)
+		return nil, err
+	}
+	if err = db.RemoveNation(tx, cfg, player); err != nil {
+		return nil, err
+	}
+	return fall, nil
+}
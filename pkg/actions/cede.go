@@ -0,0 +1,257 @@
+package actions
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
+)
+
+const (
+	cedeActionResultFmt           = "%s offered %s to %s"
+	cedeWithArmiesActionResultFmt = "%s offered %s to %s along with its armies"
+	acceptCessionResultFmt        = "%s accepted %s from %s with %d armies"
+	acceptCessionGiverRemovedFmt  = "; %s has no territories left and has been removed from the game"
+)
+
+var (
+	ErrCedeToSelf = &ActionError{msg: "a nation can't cede a territory to itself"}
+)
+
+type CedeActionResult struct {
+	actionResultBase[*CedeAction]
+
+	// Cession is the offer made to the recipient
+	Cession *db.Cession `json:"cession"`
+}
+
+func (car *CedeActionResult) ActionType() string {
+	return "cede"
+}
+
+func (car *CedeActionResult) String() string {
+	str := car.actionResultBase.String()
+	if str != "" {
+		return str
+	}
+	action := *car.Action
+	if action == nil || car.Cession == nil {
+		return noActionString
+	}
+	resultFmt := cedeActionResultFmt
+	if car.Cession.WithArmies {
+		resultFmt = cedeWithArmiesActionResultFmt
+	}
+	return fmt.Sprintf(resultFmt, car.Cession.Giver, action.Territory, car.Cession.Recipient)
+}
+
+// CedeAction offers one of the player's territories to another nation. The territory is transferred when the other
+// nation accepts the offer with AcceptAction. It doesn't count towards the player's actions for the turn
+type CedeAction struct {
+	GameRef
+	User string `json:"user"`
+
+	// Territory is the territory being offered, replaced with its name when the action is done
+	Territory string `json:"territory"`
+
+	// Recipient is the player or country name of the nation the territory is offered to
+	Recipient string `json:"recipient"`
+
+	// WithArmies determines whether the armies in the territory are given along with it. If it is false, the recipient
+	// gets the territory with a single army and the rest of the armies in it are disbanded
+	WithArmies bool `json:"withArmies"`
+}
+
+// DoAction offers the territory using the given database
+func (ca *CedeAction) DoAction(tdb *sql.DB) (ActionResult, error) {
+	g, err := compatGame(ca.GameRef, tdb)
+	if err != nil {
+		return nil, err
+	}
+	return ca.Do(g)
+}
+
+// Do offers the territory in the given game
+func (ca *CedeAction) Do(g *game.Game) (ActionResult, error) {
+	if err := checkGameOver(g); err != nil {
+		return nil, err
+	}
+	cfg := g.Config()
+	territory, err := cfg.ResolveTerritory(ca.Territory)
+	if err != nil {
+		cfg.LogError("Unable to resolve territory", "error", err)
+		return nil, &ActionError{err: err}
+	}
+	ca.Territory = territory.Name
+
+	tx, err := beginDiplomacy(g, ca.User)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = checkIfEnoughPlayersToStart(g, tx); err != nil {
+		return nil, err
+	}
+
+	recipient, err := resolvePlayer(g, tx, ca.Recipient)
+	if err != nil {
+		return nil, err
+	}
+	if recipient == ca.User {
+		cfg.LogError("Unable to cede territory", "error", ErrCedeToSelf)
+		return nil, ErrCedeToSelf
+	}
+
+	var holdingID int64
+	if err = tx.QueryRow("SELECT id FROM v_nation_holdings WHERE game_id = ? AND territory = ? AND player = ?",
+		cfg.GameID, territory.Abbreviation, ca.User).Scan(&holdingID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = &ActionError{msg: fmt.Sprintf("cannot cede %s: not controlled by %s", territory.Name, ca.User)}
+		}
+		cfg.LogError("Unable to cede territory", "error", err)
+		return nil, err
+	}
+
+	cession := &db.Cession{
+		Territory:  territory.Abbreviation,
+		Giver:      ca.User,
+		Recipient:  recipient,
+		WithArmies: ca.WithArmies,
+	}
+	if cession.OfferedTurn, err = db.CurrentTurn(tx, cfg.GameID); err != nil {
+		cfg.LogError("Unable to get current turn", "error", err)
+		return nil, err
+	}
+	// a new offer replaces any previous offer of the territory
+	if _, err = tx.Exec("DELETE FROM cessions WHERE game_id = ? AND territory = ?", cfg.GameID, cession.Territory); err != nil {
+		cfg.LogError("Unable to remove previous territory offer", "error", err)
+		return nil, err
+	}
+	res, err := tx.Exec(`INSERT INTO cessions (game_id, holding_id, territory, giver, recipient, with_armies, offered_turn)
+		VALUES(?,?,?,?,?,?,?)`, cfg.GameID, holdingID, cession.Territory, cession.Giver, cession.Recipient,
+		cession.WithArmies, cession.OfferedTurn)
+	if err != nil {
+		cfg.LogError("Unable to add territory offer", "error", err)
+		return nil, err
+	}
+	if cession.ID, err = res.LastInsertId(); err != nil {
+		cfg.LogError("Unable to get territory offer ID", "error", err)
+		return nil, err
+	}
+
+	result := &CedeActionResult{
+		actionResultBase: actionResultBase[*CedeAction]{
+			Action: &ca,
+			user:   ca.User,
+		},
+		Cession: cession,
+	}
+	if err = logAction(g, tx, result, false); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		cfg.LogError("Unable to commit transaction", "error", err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// AcceptCessionActionResult is the result of an AcceptAction that accepted a territory offered with CedeAction
+type AcceptCessionActionResult struct {
+	actionResultBase[*AcceptAction]
+
+	// Cession is the accepted offer
+	Cession *db.Cession `json:"cession"`
+
+	// Armies is the number of armies in the territory after it was transferred
+	Armies int `json:"armies"`
+
+	// NationRemoved is the giver's nation if it has no territories left after the transfer
+	NationRemoved *db.Nation `json:"nationRemoved,omitempty"`
+}
+
+func (acr *AcceptCessionActionResult) ActionType() string {
+	return "accept"
+}
+
+func (acr *AcceptCessionActionResult) changed() ([]string, []string) {
+	return []string{acr.Cession.Giver, acr.Cession.Recipient}, []string{acr.Cession.Territory}
+}
+
+func (acr *AcceptCessionActionResult) String() string {
+	str := acr.actionResultBase.String()
+	if str != "" {
+		return str
+	}
+	action := *acr.Action
+	if action == nil || acr.Cession == nil {
+		return noActionString
+	}
+	str = fmt.Sprintf(acceptCessionResultFmt, acr.Cession.Recipient, action.Territory, acr.Cession.Giver, acr.Armies)
+	if removed := nationRemovedName(acr.NationRemoved); removed != "" {
+		str += fmt.Sprintf(acceptCessionGiverRemovedFmt, removed)
+	}
+	return str
+}
+
+// acceptCession transfers the territory offered to the player by the proposer
+func (aa *AcceptAction) acceptCession(g *game.Game, tx *sql.Tx, proposer string) (ActionResult, error) {
+	cfg := g.Config()
+	territory, err := cfg.ResolveTerritory(aa.Territory)
+	if err != nil {
+		cfg.LogError("Unable to resolve territory", "error", err)
+		return nil, &ActionError{err: err}
+	}
+	aa.Territory = territory.Name
+
+	if err = checkIfEnoughPlayersToStart(g, tx); err != nil {
+		return nil, err
+	}
+
+	cession, err := db.GetCession(tx, cfg.GameID, territory.Abbreviation)
+	if err != nil {
+		cfg.LogError("Unable to get territory offer", "error", err)
+		return nil, err
+	}
+	if cession == nil || cession.Giver != proposer || cession.Recipient != aa.User {
+		err = &ActionError{msg: fmt.Sprintf("%s has no offer of %s from %s", aa.User, territory.Name, proposer)}
+		cfg.LogError("Unable to accept territory", "error", err)
+		return nil, err
+	}
+
+	result := &AcceptCessionActionResult{
+		actionResultBase: actionResultBase[*AcceptAction]{
+			Action: &aa,
+			user:   aa.User,
+		},
+		Cession: cession,
+		Armies:  1,
+	}
+	if cession.WithArmies {
+		if err = tx.QueryRow("SELECT army_size FROM holdings WHERE game_id = ? AND territory = ?",
+			cfg.GameID, territory.Abbreviation).Scan(&result.Armies); err != nil {
+			cfg.LogError("Unable to get army size", "error", err)
+			return nil, err
+		}
+	}
+
+	if result.NationRemoved, err = db.TransferHolding(g.DB(), tx, cfg, territory.Abbreviation, aa.User, result.Armies); err != nil {
+		return nil, err
+	}
+	if _, err = tx.Exec("DELETE FROM cessions WHERE id = ?", cession.ID); err != nil {
+		cfg.LogError("Unable to remove accepted territory offer", "error", err)
+		return nil, err
+	}
+
+	if err = logAction(g, tx, result, false); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		cfg.LogError("Unable to commit transaction", "error", err)
+		return nil, err
+	}
+	return result, nil
+}
@@ -6,8 +6,8 @@ import (
 	"fmt"
 	"strings"
 
-	"github.com/Eggbertx/territories-game/pkg/config"
 	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
 	"github.com/mazznoer/csscolorparser"
 )
 
@@ -27,6 +27,11 @@ func (car *ColorActionResult) ActionType() string {
 	return "color"
 }
 
+func (car *ColorActionResult) changed() ([]string, []string) {
+	action := *car.Action
+	return []string{action.User}, nil
+}
+
 func (car *ColorActionResult) String() string {
 	str := car.actionResultBase.String()
 	if str != "" {
@@ -38,15 +43,28 @@ func (car *ColorActionResult) String() string {
 }
 
 type ColorAction struct {
-	User  string
-	Color string
+	GameRef
+	User  string `json:"user"`
+	Color string `json:"color"`
 }
 
+// DoAction changes the color of the player's nation using the given database
 func (ca *ColorAction) DoAction(tdb *sql.DB) (ActionResult, error) {
-	cfg, err := config.GetConfig()
+	g, err := compatGame(ca.GameRef, tdb)
 	if err != nil {
 		return nil, err
 	}
+	return ca.Do(g)
+}
+
+// Do changes the color of the player's nation in the given game
+func (ca *ColorAction) Do(g *game.Game) (ActionResult, error) {
+	if err := checkGameOver(g); err != nil {
+		return nil, err
+	}
+	cfg := g.Config()
+	tdb := g.DB()
+	var err error
 	if ca.Color == "" {
 		cfg.LogError("No color specified")
 		return nil, ErrMissingColor
@@ -56,7 +74,7 @@ func (ca *ColorAction) DoAction(tdb *sql.DB) (ActionResult, error) {
 		return nil, &ActionError{err: db.ErrMissingUser}
 	}
 
-	if err = db.ValidateUser(ca.User, tdb, cfg.LogError); err != nil {
+	if err = db.ValidateUser(ca.User, tdb, cfg.GameID, cfg.LogError); err != nil {
 		if errors.Is(err, db.ErrUserNotRegistered) {
 			cfg.LogError("User is not registered in the game", "user", ca.User)
 			return nil, &ActionError{err: db.ErrUserNotRegistered}
@@ -74,13 +92,20 @@ func (ca *ColorAction) DoAction(tdb *sql.DB) (ActionResult, error) {
 	parsedColor.A = 1.0 // Ensure the color is fully opaque
 	ca.Color = strings.TrimPrefix(parsedColor.Clamp().HexString(), "#")
 
-	stmt, err := tdb.Prepare("UPDATE nations SET color = ? WHERE player = ?")
+	tx, err := tdb.Begin()
+	if err != nil {
+		cfg.LogError("Unable to begin transaction", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare("UPDATE nations SET color = ? WHERE game_id = ? AND player = ?")
 	if err != nil {
 		cfg.LogError("Unable to prepare color update statement", "error", err)
 		return nil, err
 	}
 	defer stmt.Close()
-	if _, err = stmt.Exec(ca.Color, ca.User); err != nil {
+	if _, err = stmt.Exec(ca.Color, cfg.GameID, ca.User); err != nil {
 		if db.ErrorIsUniqueConstraintViolation(err) {
 			err = &ActionError{err: db.ErrColorInUse}
 		}
@@ -92,14 +117,32 @@ func (ca *ColorAction) DoAction(tdb *sql.DB) (ActionResult, error) {
 		return nil, err
 	}
 
-	return &ColorActionResult{
+	result := &ColorActionResult{
 		actionResultBase: actionResultBase[*ColorAction]{
 			Action: &ca,
 			user:   ca.User,
 		},
-	}, nil
+	}
+	// color changes don't count towards the player's turn actions
+	if err = logAction(g, tx, result, false); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		cfg.LogError("Unable to commit transaction", "error", err)
+		return nil, err
+	}
+	return result, nil
 }
 
-func randomColor() string {
-	return fmt.Sprintf("%0.2x%0.2x%0.2x", randInt(256), randInt(256), randInt(256))
+// randomColor returns a random hex color string using the given random source
+func randomColor(rng db.RandomSource) (string, error) {
+	var rgb [3]int
+	var err error
+	for c := range rgb {
+		if rgb[c], err = rng.IntN(256); err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%0.2x%0.2x%0.2x", rgb[0], rgb[1], rgb[2]), nil
 }
@@ -0,0 +1,213 @@
+package actions
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Eggbertx/territories-game/pkg/actions/turns"
+	"github.com/Eggbertx/territories-game/pkg/config"
+	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
+)
+
+const (
+	deployActionResultFmt = "%s deployed %d armies to %s"
+)
+
+var (
+	ErrReinforcementsDisabled = &ActionError{msg: "reinforcements are not enabled in this game"}
+	ErrNoDeployments          = &ActionError{msg: "no territories to deploy armies to specified"}
+)
+
+type DeployActionResult struct {
+	actionResultBase[*DeployAction]
+
+	// Remaining is the number of reinforcements the player's nation has left to deploy
+	Remaining int `json:"remaining"`
+}
+
+func (dar *DeployActionResult) ActionType() string {
+	return "deploy"
+}
+
+func (dar *DeployActionResult) changed() ([]string, []string) {
+	action := *dar.Action
+	return []string{action.User}, slices.Sorted(maps.Keys(action.Armies))
+}
+
+func (dar *DeployActionResult) String() string {
+	str := dar.actionResultBase.String()
+	if str != "" {
+		return str
+	}
+	action := *dar.Action
+	if action == nil {
+		return noActionString
+	}
+	var total int
+	territories := make([]string, 0, len(action.Armies))
+	for _, territory := range slices.Sorted(maps.Keys(action.Armies)) {
+		total += action.Armies[territory]
+		territories = append(territories, fmt.Sprintf("%s (%d)", territory, action.Armies[territory]))
+	}
+	return fmt.Sprintf(deployActionResultFmt, action.User, total, strings.Join(territories, ", "))
+}
+
+// DeployAction places reinforcements granted at the end of a turn, or the starting armies left after the game's
+// territories were dealt, in one or more of the player's territories. It doesn't count towards the player's actions for
+// the turn
+type DeployAction struct {
+	GameRef
+	User string `json:"user"`
+
+	// Armies is the number of armies to deploy to each territory (by abbreviation, name, or alias). The territories
+	// are replaced with their names when the action is done
+	Armies map[string]int `json:"armies"`
+}
+
+// DoAction places the player's reinforcements using the given database
+func (da *DeployAction) DoAction(tdb *sql.DB) (ActionResult, error) {
+	g, err := compatGame(da.GameRef, tdb)
+	if err != nil {
+		return nil, err
+	}
+	return da.Do(g)
+}
+
+// Do places the player's reinforcements in the given game
+func (da *DeployAction) Do(g *game.Game) (ActionResult, error) {
+	if err := checkGameOver(g); err != nil {
+		return nil, err
+	}
+	cfg := g.Config()
+	tdb := g.DB()
+	var err error
+
+	// games that deal their territories give the nations their starting armies as reinforcements
+	if !cfg.DoReinforcements && cfg.SetupMode == config.SetupModeClaim {
+		cfg.LogError("Reinforcements are not enabled")
+		return nil, ErrReinforcementsDisabled
+	}
+	if len(da.Armies) == 0 {
+		cfg.LogError("No territories to deploy armies to specified")
+		return nil, ErrNoDeployments
+	}
+
+	if err = db.ValidateUser(da.User, tdb, cfg.GameID, cfg.LogError); err != nil {
+		if errors.Is(err, db.ErrUserNotRegistered) {
+			cfg.LogError("User is not registered in the game", "user", da.User)
+			return nil, &ActionError{err: err}
+		}
+		cfg.LogError("Unable to validate user", "error", err)
+		return nil, err
+	}
+
+	// resolve the territories before doing anything else so that the action can be logged with their names
+	deployments := make(map[string]int, len(da.Armies))
+	abbreviations := make(map[string]string, len(da.Armies))
+	limits := make(map[string]int, len(da.Armies))
+	var total int
+	for query, armies := range da.Armies {
+		territory, err := cfg.ResolveTerritory(query)
+		if err != nil {
+			cfg.LogError("Unable to resolve territory", "error", err)
+			return nil, &ActionError{err: err}
+		}
+		if _, ok := deployments[territory.Name]; ok {
+			err = &ActionError{msg: fmt.Sprintf("%s is specified more than once", territory.Name)}
+			cfg.LogError("Unable to deploy armies", "error", err)
+			return nil, err
+		}
+		if armies <= 0 {
+			err = &ActionError{msg: fmt.Sprintf("number of armies to deploy to %s must be greater than zero", territory.Name)}
+			cfg.LogError("Unable to deploy armies", "error", err)
+			return nil, err
+		}
+		deployments[territory.Name] = armies
+		abbreviations[territory.Name] = territory.Abbreviation
+		limits[territory.Name] = territory.ArmyLimit()
+		total += armies
+	}
+	da.Armies = deployments
+
+	tx, err := tdb.Begin()
+	if err != nil {
+		cfg.LogError("Unable to begin transaction", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = checkIfEnoughPlayersToStart(g, tx); err != nil {
+		return nil, err
+	}
+	if cfg.DoTurnManagement {
+		// end the turn first if it is done, so that the reinforcements granted at the end of it can be deployed
+		if _, err = turns.IsTurnDone(g, tx); err != nil {
+			cfg.LogError("Unable to check if turn is done", "error", err)
+			return nil, err
+		}
+	}
+
+	var reinforcements int
+	if err = tx.QueryRow("SELECT reinforcements FROM nations WHERE game_id = ? AND player = ?", cfg.GameID, da.User).Scan(&reinforcements); err != nil {
+		cfg.LogError("Unable to get reinforcements", "error", err)
+		return nil, err
+	}
+	if total > reinforcements {
+		err = &ActionError{msg: fmt.Sprintf("cannot deploy %d armies: only %d reinforcements available", total, reinforcements)}
+		cfg.LogError("Not enough reinforcements", "player", da.User, "error", err)
+		return nil, err
+	}
+
+	stmt, err := tx.Prepare(`SELECT army_size FROM v_nation_holdings WHERE game_id = ? AND territory = ? AND player = ?`)
+	if err != nil {
+		cfg.LogError("Unable to prepare deploy check statement", "error", err)
+		return nil, err
+	}
+	defer stmt.Close()
+	for _, name := range slices.Sorted(maps.Keys(deployments)) {
+		var armySize int
+		if err = stmt.QueryRow(cfg.GameID, abbreviations[name], da.User).Scan(&armySize); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				err = &ActionError{msg: fmt.Sprintf("cannot deploy armies to %s: not controlled by %s", name, da.User)}
+			}
+			cfg.LogError("Unable to check deploy conditions", "error", err)
+			return nil, err
+		}
+		if armySize+deployments[name] > limits[name] {
+			err = &ActionError{msg: fmt.Sprintf("cannot deploy %d armies to %s: would exceed maximum of %d", deployments[name], name, limits[name])}
+			cfg.LogError("Unable to deploy armies", "error", err)
+			return nil, err
+		}
+		if _, err = db.UpdateHoldingArmySize(tdb, tx, cfg, abbreviations[name], armySize+deployments[name], false); err != nil {
+			cfg.LogError("Unable to update holding army size", "error", err)
+			return nil, err
+		}
+	}
+
+	if _, err = tx.Exec("UPDATE nations SET reinforcements = reinforcements - ? WHERE game_id = ? AND player = ?", total, cfg.GameID, da.User); err != nil {
+		cfg.LogError("Unable to update reinforcements", "error", err)
+		return nil, err
+	}
+
+	result := &DeployActionResult{
+		actionResultBase: actionResultBase[*DeployAction]{
+			Action: &da,
+			user:   da.User,
+		},
+		Remaining: reinforcements - total,
+	}
+	if err = logAction(g, tx, result, false); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		cfg.LogError("Unable to commit transaction", "error", err)
+		return nil, err
+	}
+	return result, nil
+}
@@ -0,0 +1,433 @@
+package actions
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Eggbertx/territories-game/pkg/actions/turns"
+	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
+)
+
+const (
+	proposeActionResultFmt = "%s proposed %s to %s"
+	acceptActionResultFmt  = "%s accepted %s proposed by %s"
+	breakActionResultFmt   = "%s broke %s with %s, it ends at the start of turn %d"
+	cancelActionResultFmt  = "%s cancelled %s proposed between %s and %s"
+)
+
+var (
+	ErrTreatyWithSelf = &ActionError{msg: "a nation can't make a treaty with itself"}
+)
+
+// treatyDescription returns the description of the treaty type used in action results, with an article
+func treatyDescription(treatyType string) string {
+	if treatyType == db.TreatyNonAggression {
+		return "a non-aggression pact"
+	}
+	return "an alliance"
+}
+
+// parseTreatyType returns the treaty type stored in the database for the given type, which is case insensitive and
+// may use a hyphen or space instead of an underscore. If it is empty, the treaty is an alliance
+func parseTreatyType(treatyType string) (string, error) {
+	normalized := strings.NewReplacer("-", "_", " ", "_").Replace(strings.ToLower(strings.TrimSpace(treatyType)))
+	switch normalized {
+	case "", db.TreatyAlliance:
+		return db.TreatyAlliance, nil
+	case db.TreatyNonAggression:
+		return db.TreatyNonAggression, nil
+	}
+	return "", &ActionError{msg: fmt.Sprintf("invalid treaty type %q, must be %q or %q", treatyType, db.TreatyAlliance, db.TreatyNonAggression)}
+}
+
+// resolvePlayer returns the player of the nation with the given player or country name, other than the neutral nation
+func resolvePlayer(g *game.Game, tx *sql.Tx, query string) (string, error) {
+	var player string
+	err := tx.QueryRow("SELECT player FROM nations WHERE game_id = ? AND (player = ? OR country_name = ?) AND player <> ?",
+		g.ID(), query, query, db.NeutralPlayer).Scan(&player)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = &ActionError{msg: fmt.Sprintf("no nation found with player or country name %q", query)}
+		g.LogError("Unable to find nation", "query", query, "error", err)
+		return "", err
+	}
+	if err != nil {
+		g.LogError("Unable to get nation", "query", query, "error", err)
+		return "", err
+	}
+	return player, nil
+}
+
+// beginDiplomacy validates the user and begins the transaction used by a diplomacy action, ending the turn first if it
+// is done so that the treaty is applied to the correct turn
+func beginDiplomacy(g *game.Game, user string) (*sql.Tx, error) {
+	cfg := g.Config()
+	tdb := g.DB()
+	if err := db.ValidateUser(user, tdb, cfg.GameID, cfg.LogError); err != nil {
+		if errors.Is(err, db.ErrUserNotRegistered) {
+			cfg.LogError("User is not registered in the game", "user", user)
+			return nil, &ActionError{err: err}
+		}
+		cfg.LogError("Unable to validate user", "error", err)
+		return nil, err
+	}
+
+	tx, err := tdb.Begin()
+	if err != nil {
+		cfg.LogError("Unable to begin transaction", "error", err)
+		return nil, err
+	}
+	if cfg.DoTurnManagement {
+		if _, err = turns.IsTurnDone(g, tx); err != nil {
+			cfg.LogError("Unable to check if turn is done", "error", err)
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+type ProposeActionResult struct {
+	actionResultBase[*ProposeAction]
+
+	// Treaty is the proposed treaty
+	Treaty *db.Treaty `json:"treaty"`
+}
+
+func (par *ProposeActionResult) ActionType() string {
+	return "propose"
+}
+
+func (par *ProposeActionResult) String() string {
+	str := par.actionResultBase.String()
+	if str != "" {
+		return str
+	}
+	if par.Treaty == nil {
+		return noActionString
+	}
+	return fmt.Sprintf(proposeActionResultFmt, par.Treaty.Proposer, treatyDescription(par.Treaty.Type), par.Treaty.Recipient)
+}
+
+// ProposeAction proposes a treaty (an alliance or a non-aggression pact) to another nation, which takes effect when
+// the other nation accepts it. It doesn't count towards the player's actions for the turn
+type ProposeAction struct {
+	GameRef
+	User string `json:"user"`
+
+	// Recipient is the player or country name of the nation the treaty is proposed to
+	Recipient string `json:"recipient"`
+
+	// Treaty is the type of treaty, "alliance" (the default) or "non_aggression"
+	Treaty string `json:"treaty"`
+}
+
+// DoAction proposes the treaty using the given database
+func (pa *ProposeAction) DoAction(tdb *sql.DB) (ActionResult, error) {
+	g, err := compatGame(pa.GameRef, tdb)
+	if err != nil {
+		return nil, err
+	}
+	return pa.Do(g)
+}
+
+// Do proposes the treaty in the given game
+func (pa *ProposeAction) Do(g *game.Game) (ActionResult, error) {
+	if err := checkGameOver(g); err != nil {
+		return nil, err
+	}
+	cfg := g.Config()
+	var err error
+	if pa.Treaty, err = parseTreatyType(pa.Treaty); err != nil {
+		cfg.LogError("Unable to propose treaty", "error", err)
+		return nil, err
+	}
+
+	tx, err := beginDiplomacy(g, pa.User)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	recipient, err := resolvePlayer(g, tx, pa.Recipient)
+	if err != nil {
+		return nil, err
+	}
+	if recipient == pa.User {
+		cfg.LogError("Unable to propose treaty", "error", ErrTreatyWithSelf)
+		return nil, ErrTreatyWithSelf
+	}
+
+	existing, err := db.GetTreaty(tx, cfg.GameID, pa.User, recipient)
+	if err != nil {
+		cfg.LogError("Unable to get existing treaty", "error", err)
+		return nil, err
+	}
+	if existing != nil {
+		state := "in effect"
+		if existing.Pending() {
+			state = "pending"
+		}
+		err = &ActionError{msg: fmt.Sprintf("%s between %s and %s is already %s",
+			treatyDescription(existing.Type), existing.Proposer, existing.Recipient, state)}
+		cfg.LogError("Unable to propose treaty", "error", err)
+		return nil, err
+	}
+
+	turn, err := db.CurrentTurn(tx, cfg.GameID)
+	if err != nil {
+		cfg.LogError("Unable to get current turn", "error", err)
+		return nil, err
+	}
+	treaty := &db.Treaty{
+		Type:         pa.Treaty,
+		Proposer:     pa.User,
+		Recipient:    recipient,
+		ProposedTurn: turn,
+	}
+	res, err := tx.Exec(`INSERT INTO treaties (game_id, treaty_type, proposer, recipient, proposed_turn) VALUES(?,?,?,?,?)`,
+		cfg.GameID, treaty.Type, treaty.Proposer, treaty.Recipient, treaty.ProposedTurn)
+	if err != nil {
+		cfg.LogError("Unable to add treaty", "error", err)
+		return nil, err
+	}
+	if treaty.ID, err = res.LastInsertId(); err != nil {
+		cfg.LogError("Unable to get treaty ID", "error", err)
+		return nil, err
+	}
+
+	result := &ProposeActionResult{
+		actionResultBase: actionResultBase[*ProposeAction]{
+			Action: &pa,
+			user:   pa.User,
+		},
+		Treaty: treaty,
+	}
+	if err = logAction(g, tx, result, false); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		cfg.LogError("Unable to commit transaction", "error", err)
+		return nil, err
+	}
+	return result, nil
+}
+
+type AcceptActionResult struct {
+	actionResultBase[*AcceptAction]
+
+	// Treaty is the accepted treaty
+	Treaty *db.Treaty `json:"treaty"`
+}
+
+func (aar *AcceptActionResult) ActionType() string {
+	return "accept"
+}
+
+func (aar *AcceptActionResult) String() string {
+	str := aar.actionResultBase.String()
+	if str != "" {
+		return str
+	}
+	if aar.Treaty == nil {
+		return noActionString
+	}
+	return fmt.Sprintf(acceptActionResultFmt, aar.Treaty.Recipient, treatyDescription(aar.Treaty.Type), aar.Treaty.Proposer)
+}
+
+// AcceptAction accepts a treaty proposed to the player's nation, putting it into effect, or a territory offered to it
+// with CedeAction. It doesn't count towards the player's actions for the turn
+type AcceptAction struct {
+	GameRef
+	User string `json:"user"`
+
+	// Proposer is the player or country name of the nation that proposed the treaty or offered the territory
+	Proposer string `json:"proposer"`
+
+	// Territory is the territory offered by the proposer. If it is set, the offer is accepted instead of a treaty
+	Territory string `json:"territory,omitempty"`
+}
+
+// DoAction accepts the treaty or territory using the given database
+func (aa *AcceptAction) DoAction(tdb *sql.DB) (ActionResult, error) {
+	g, err := compatGame(aa.GameRef, tdb)
+	if err != nil {
+		return nil, err
+	}
+	return aa.Do(g)
+}
+
+// Do accepts the treaty or territory in the given game
+func (aa *AcceptAction) Do(g *game.Game) (ActionResult, error) {
+	if err := checkGameOver(g); err != nil {
+		return nil, err
+	}
+	cfg := g.Config()
+	tx, err := beginDiplomacy(g, aa.User)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	proposer, err := resolvePlayer(g, tx, aa.Proposer)
+	if err != nil {
+		return nil, err
+	}
+	if aa.Territory != "" {
+		return aa.acceptCession(g, tx, proposer)
+	}
+	treaty, err := db.GetTreaty(tx, cfg.GameID, aa.User, proposer)
+	if err != nil {
+		cfg.LogError("Unable to get treaty", "error", err)
+		return nil, err
+	}
+	if treaty == nil || !treaty.Pending() || treaty.Recipient != aa.User {
+		err = &ActionError{msg: fmt.Sprintf("%s has no pending treaty proposed by %s", aa.User, proposer)}
+		cfg.LogError("Unable to accept treaty", "error", err)
+		return nil, err
+	}
+
+	if treaty.AcceptedTurn, err = db.CurrentTurn(tx, cfg.GameID); err != nil {
+		cfg.LogError("Unable to get current turn", "error", err)
+		return nil, err
+	}
+	if _, err = tx.Exec("UPDATE treaties SET accepted_turn = ? WHERE id = ?", treaty.AcceptedTurn, treaty.ID); err != nil {
+		cfg.LogError("Unable to accept treaty", "error", err)
+		return nil, err
+	}
+
+	result := &AcceptActionResult{
+		actionResultBase: actionResultBase[*AcceptAction]{
+			Action: &aa,
+			user:   aa.User,
+		},
+		Treaty: treaty,
+	}
+	if err = logAction(g, tx, result, false); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		cfg.LogError("Unable to commit transaction", "error", err)
+		return nil, err
+	}
+	return result, nil
+}
+
+type BreakActionResult struct {
+	actionResultBase[*BreakAction]
+
+	// Treaty is the broken treaty
+	Treaty *db.Treaty `json:"treaty"`
+
+	// Cancelled is true if the treaty was still pending, in which case it was removed instead of broken
+	Cancelled bool `json:"cancelled,omitempty"`
+}
+
+func (bar *BreakActionResult) ActionType() string {
+	return "break"
+}
+
+func (bar *BreakActionResult) String() string {
+	str := bar.actionResultBase.String()
+	if str != "" {
+		return str
+	}
+	if bar.Treaty == nil {
+		return noActionString
+	}
+	if bar.Cancelled {
+		return fmt.Sprintf(cancelActionResultFmt, bar.user, treatyDescription(bar.Treaty.Type), bar.Treaty.Proposer, bar.Treaty.Recipient)
+	}
+	return fmt.Sprintf(breakActionResultFmt, bar.Treaty.BrokenBy, treatyDescription(bar.Treaty.Type),
+		bar.Treaty.Other(bar.Treaty.BrokenBy), bar.Treaty.EndsTurn)
+}
+
+// BreakAction breaks the treaty between the player's nation and another nation. The treaty continues to apply for the
+// number of turns set by the game's treatyBreakDelay. A pending treaty is cancelled (withdrawn by the proposer or
+// declined by the recipient) instead. It doesn't count towards the player's actions for the turn
+type BreakAction struct {
+	GameRef
+	User string `json:"user"`
+
+	// With is the player or country name of the other nation in the treaty
+	With string `json:"with"`
+}
+
+// DoAction breaks the treaty using the given database
+func (ba *BreakAction) DoAction(tdb *sql.DB) (ActionResult, error) {
+	g, err := compatGame(ba.GameRef, tdb)
+	if err != nil {
+		return nil, err
+	}
+	return ba.Do(g)
+}
+
+// Do breaks the treaty in the given game
+func (ba *BreakAction) Do(g *game.Game) (ActionResult, error) {
+	if err := checkGameOver(g); err != nil {
+		return nil, err
+	}
+	cfg := g.Config()
+	tx, err := beginDiplomacy(g, ba.User)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	other, err := resolvePlayer(g, tx, ba.With)
+	if err != nil {
+		return nil, err
+	}
+	treaty, err := db.GetTreaty(tx, cfg.GameID, ba.User, other)
+	if err != nil {
+		cfg.LogError("Unable to get treaty", "error", err)
+		return nil, err
+	}
+	if treaty == nil {
+		err = &ActionError{msg: fmt.Sprintf("%s has no treaty with %s", ba.User, other)}
+		cfg.LogError("Unable to break treaty", "error", err)
+		return nil, err
+	}
+	if treaty.BrokenBy != "" {
+		err = &ActionError{msg: fmt.Sprintf("%s with %s was already broken by %s, it ends at the start of turn %d",
+			treatyDescription(treaty.Type), other, treaty.BrokenBy, treaty.EndsTurn)}
+		cfg.LogError("Unable to break treaty", "error", err)
+		return nil, err
+	}
+
+	result := &BreakActionResult{
+		actionResultBase: actionResultBase[*BreakAction]{
+			Action: &ba,
+			user:   ba.User,
+		},
+		Treaty:    treaty,
+		Cancelled: treaty.Pending(),
+	}
+	if result.Cancelled {
+		_, err = tx.Exec("DELETE FROM treaties WHERE id = ?", treaty.ID)
+	} else {
+		var turn int
+		if turn, err = db.CurrentTurn(tx, cfg.GameID); err != nil {
+			cfg.LogError("Unable to get current turn", "error", err)
+			return nil, err
+		}
+		treaty.BrokenBy = ba.User
+		treaty.EndsTurn = turn + cfg.TreatyBreakDelay + 1
+		_, err = tx.Exec("UPDATE treaties SET broken_by = ?, ends_turn = ? WHERE id = ?", treaty.BrokenBy, treaty.EndsTurn, treaty.ID)
+	}
+	if err != nil {
+		cfg.LogError("Unable to break treaty", "error", err)
+		return nil, err
+	}
+
+	if err = logAction(g, tx, result, false); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		cfg.LogError("Unable to commit transaction", "error", err)
+		return nil, err
+	}
+	return result, nil
+}
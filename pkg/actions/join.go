@@ -6,20 +6,45 @@ import (
 
 	"github.com/Eggbertx/territories-game/pkg/config"
 	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
 )
 
 const (
-	joinActionResultFmt = "%s founded by %s in %s"
+	joinActionResultFmt      = "%s founded by %s in %s"
+	joinNoTerritoryResultFmt = "%s founded by %s"
+	joinDraftStartedFmt      = "; the draft has started, %s picks first"
 )
 
 type JoinActionResult struct {
 	actionResultBase[*JoinAction]
+
+	// Color is the randomly selected color of the new nation
+	Color string `json:"color"`
+
+	// Setup is the outcome of the territories being dealt, if the game's setup mode is "random" and the nation was
+	// the last one needed to start the game
+	Setup *territorySetup `json:"setup,omitempty"`
+
+	// FirstPick is the player that picks the first territory, if the game's setup mode is "draft" and the nation was
+	// the last one needed to start the game
+	FirstPick string `json:"firstPick,omitempty"`
 }
 
 func (jar *JoinActionResult) ActionType() string {
 	return "join"
 }
 
+func (jar *JoinActionResult) changed() ([]string, []string) {
+	action := *jar.Action
+	if jar.Setup != nil {
+		return jar.Setup.changed()
+	}
+	if action.Territory == "" {
+		return []string{action.User}, nil
+	}
+	return []string{action.User}, []string{action.Territory}
+}
+
 func (jar *JoinActionResult) String() string {
 	str := jar.actionResultBase.String()
 	if str != "" {
@@ -29,39 +54,79 @@ func (jar *JoinActionResult) String() string {
 	if action == nil {
 		return noActionString
 	}
-	return fmt.Sprintf(joinActionResultFmt, action.Nation, action.User, action.Territory)
+	if action.Territory != "" {
+		return fmt.Sprintf(joinActionResultFmt, action.Nation, action.User, action.Territory)
+	}
+	str = fmt.Sprintf(joinNoTerritoryResultFmt, action.Nation, action.User)
+	if jar.Setup != nil {
+		str += jar.Setup.String()
+	} else if jar.FirstPick != "" {
+		str += fmt.Sprintf(joinDraftStartedFmt, jar.FirstPick)
+	}
+	return str
 }
 
+// JoinAction adds the player's nation to the game. If the game's setup mode is "claim", the nation starts in the chosen
+// territory with the configured initial armies, and the territory is its capital. Otherwise, no territory is chosen, and the nation gets its territories
+// when they are dealt or drafted once enough nations have joined
 type JoinAction struct {
-	User      string
-	Nation    string
-	Territory string
+	GameRef
+	User      string `json:"user"`
+	Nation    string `json:"nation"`
+	Territory string `json:"territory"`
 }
 
+// DoAction joins the player to the game using the given database
 func (ja *JoinAction) DoAction(tdb *sql.DB) (ActionResult, error) {
-	cfg, err := config.GetConfig()
+	g, err := compatGame(ja.GameRef, tdb)
 	if err != nil {
 		return nil, err
 	}
+	return ja.Do(g)
+}
+
+// Do joins the player to the given game, founding a nation in the target territory
+func (ja *JoinAction) Do(g *game.Game) (ActionResult, error) {
+	if err := checkGameOver(g); err != nil {
+		return nil, err
+	}
+	cfg := g.Config()
+	tdb := g.DB()
+	var err error
 
 	if ja.User == "" {
 		cfg.LogError("No user specified")
 		return nil, &ActionError{err: db.ErrMissingUser}
 	}
 
+	if ja.User == db.NeutralPlayer {
+		cfg.LogError("Player name is reserved", "user", ja.User)
+		return nil, &ActionError{err: db.ErrReservedPlayer}
+	}
+
 	if ja.Nation == "" {
 		ja.Nation = fmt.Sprintf("%s's Nation", ja.User)
 	}
-	if ja.Territory == "" {
+	dealt := cfg.SetupMode != config.SetupModeClaim
+	var joinTerritory *config.Territory
+	switch {
+	case dealt && ja.Territory != "":
+		cfg.LogError("Territory can't be chosen when joining", "setupMode", cfg.SetupMode)
+		return nil, ErrTerritoryNotAllowed
+	case dealt:
+	case ja.Territory == "":
 		cfg.LogError("No target territory specified")
 		return nil, ErrNoTargetTerritory
+	default:
+		if joinTerritory, err = cfg.ResolveTerritory(ja.Territory); err != nil {
+			cfg.LogError("Unable to resolve territory", "error", err)
+			return nil, &ActionError{err: err}
+		}
+		ja.Territory = joinTerritory.Name
+		if err = checkPassable(g, joinTerritory); err != nil {
+			return nil, err
+		}
 	}
-	joinTerritory, err := cfg.ResolveTerritory(ja.Territory)
-	if err != nil {
-		cfg.LogError("Unable to resolve territory", "error", err)
-		return nil, &ActionError{err: err}
-	}
-	ja.Territory = joinTerritory.Name
 
 	tx, err := tdb.Begin()
 	if err != nil {
@@ -70,15 +135,15 @@ func (ja *JoinAction) DoAction(tdb *sql.DB) (ActionResult, error) {
 	}
 	defer tx.Rollback()
 
-	const userAlreadyJoinedSQL = `SELECT COUNT(*) FROM nations WHERE player = ?`
-	const nationAlreadyJoinedSQL = `SELECT COUNT(*) FROM nations WHERE country_name = ?`
-	const nationAddSQL = `INSERT INTO nations (country_name,player, color) VALUES(?,?,?)`
-	const nationInitialHolding = `INSERT INTO holdings (nation_id, territory, army_size) VALUES(
-		(SELECT id FROM nations WHERE country_name = ?),
-		?, ?)`
+	const userAlreadyJoinedSQL = `SELECT COUNT(*) FROM nations WHERE game_id = ? AND player = ?`
+	const nationAlreadyJoinedSQL = `SELECT COUNT(*) FROM nations WHERE game_id = ? AND country_name = ?`
+	const nationAddSQL = `INSERT INTO nations (game_id, country_name, player, color, capital) VALUES(?,?,?,?,?)`
+	const nationInitialHolding = `INSERT INTO holdings (game_id, nation_id, territory, army_size) VALUES(?1,
+		(SELECT id FROM nations WHERE game_id = ?1 AND country_name = ?2),
+		?3, ?4)`
 	var numPlayerMatches int
 	var numNationMatches int
-	if err = tx.QueryRow(userAlreadyJoinedSQL, ja.User).Scan(&numPlayerMatches); err != nil {
+	if err = tx.QueryRow(userAlreadyJoinedSQL, cfg.GameID, ja.User).Scan(&numPlayerMatches); err != nil {
 		cfg.LogError("Error querying user", "error", err)
 		return nil, err
 	}
@@ -87,7 +152,7 @@ func (ja *JoinAction) DoAction(tdb *sql.DB) (ActionResult, error) {
 		return nil, &ActionError{err: db.ErrPlayerAlreadyJoined}
 	}
 
-	if err = tx.QueryRow(nationAlreadyJoinedSQL, ja.Nation).Scan(&numNationMatches); err != nil {
+	if err = tx.QueryRow(nationAlreadyJoinedSQL, cfg.GameID, ja.Nation).Scan(&numNationMatches); err != nil {
 		cfg.LogError("Error querying nation", "error", err)
 		return nil, err
 	}
@@ -96,7 +161,37 @@ func (ja *JoinAction) DoAction(tdb *sql.DB) (ActionResult, error) {
 		return nil, &ActionError{err: db.ErrNationAlreadyJoined}
 	}
 
-	if _, err = tx.Exec(nationAddSQL, ja.Nation, ja.User, randomColor()); err != nil {
+	var players []string
+	if dealt {
+		if err = checkSetupNotStarted(g, tx); err != nil {
+			return nil, err
+		}
+		if players, err = setupPlayers(g, tx); err != nil {
+			return nil, err
+		}
+		if len(players) >= cfg.MinimumNationsToStart {
+			cfg.LogError("Game setup has already started", "error", ErrSetupStarted)
+			return nil, ErrSetupStarted
+		}
+	}
+
+	rng, err := g.RandomSource(tx)
+	if err != nil {
+		cfg.LogError("Unable to get random source", "error", err)
+		return nil, err
+	}
+	color, err := randomColor(rng)
+	if err != nil {
+		cfg.LogError("Unable to generate nation color", "error", err)
+		return nil, err
+	}
+	// the territory the nation starts in is its capital. Nations that get their territories dealt or drafted get their
+	// capital when the setup is complete
+	var capital sql.NullString
+	if joinTerritory != nil {
+		capital = sql.NullString{String: joinTerritory.Abbreviation, Valid: true}
+	}
+	if _, err = tx.Exec(nationAddSQL, cfg.GameID, ja.Nation, ja.User, color, capital); err != nil {
 		if db.ErrorIsUniqueConstraintViolation(err) {
 			err = &ActionError{
 				msg: "territory is already occupied, player is already in the game, or the nation name is already taken",
@@ -105,16 +200,35 @@ func (ja *JoinAction) DoAction(tdb *sql.DB) (ActionResult, error) {
 		cfg.LogError("Unable to add nation", "error", err)
 		return nil, err
 	}
-	if _, err = tx.Exec(nationInitialHolding, ja.Nation, joinTerritory.Abbreviation, cfg.InitialArmies); err != nil {
-		if db.ErrorIsUniqueConstraintViolation(err) {
-			err = ErrTerritoryAlreadyOccupied
+	if joinTerritory != nil {
+		if _, err = tx.Exec(nationInitialHolding, cfg.GameID, ja.Nation, joinTerritory.Abbreviation,
+			min(cfg.InitialArmies, joinTerritory.ArmyLimit())); err != nil {
+			if db.ErrorIsUniqueConstraintViolation(err) {
+				err = ErrTerritoryAlreadyOccupied
+			}
+			cfg.LogError("Unable to add initial holding", "error", err)
+			return nil, err
 		}
-		cfg.LogError("Unable to add initial holding", "error", err)
-		return nil, err
 	}
 
-	if err = addTurnEntryIfManaging(tx, ja.User, "join"); err != nil {
-		cfg.LogError("Unable to add turn entry", "error", err)
+	result := &JoinActionResult{
+		actionResultBase: actionResultBase[*JoinAction]{
+			Action: &ja,
+			user:   ja.User,
+		},
+		Color: color,
+	}
+	// the territories are dealt or drafted once the last nation needed to start the game has joined
+	if dealt && len(players)+1 >= cfg.MinimumNationsToStart {
+		if cfg.SetupMode == config.SetupModeRandom {
+			if result.Setup, err = dealTerritories(g, tx); err != nil {
+				return nil, err
+			}
+		} else {
+			result.FirstPick = append(players, ja.User)[0]
+		}
+	}
+	if err = logAction(g, tx, result, true); err != nil {
 		return nil, err
 	}
 
@@ -122,11 +236,5 @@ func (ja *JoinAction) DoAction(tdb *sql.DB) (ActionResult, error) {
 		cfg.LogError("Unable to commit transaction", "error", err)
 		return nil, err
 	}
-
-	return &JoinActionResult{
-		actionResultBase: actionResultBase[*JoinAction]{
-			Action: &ja,
-			user:   ja.User,
-		},
-	}, nil
+	return result, nil
 }
@@ -0,0 +1,311 @@
+package actions
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/Eggbertx/territories-game/pkg/actions/turns"
+	"github.com/Eggbertx/territories-game/pkg/config"
+	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
+)
+
+const (
+	leaveActionResultFmt  = "%s left the game"
+	removeActionResultFmt = "%s was removed from the game"
+
+	departureDeletedFmt = "; its armies in %s were disbanded"
+	departureNeutralFmt = "; its territories (%s) became neutral"
+	departureHeirFmt    = "; its territories (%s) were given to %s"
+)
+
+var (
+	ErrHeirRequired   = &ActionError{msg: "an heir must be named to leave the game"}
+	ErrHeirNotAllowed = &ActionError{msg: "the game's leave policy doesn't allow naming an heir"}
+)
+
+// nationDeparture is the outcome of a nation leaving or being removed from the game
+type nationDeparture struct {
+	// Nation is the nation that left the game
+	Nation *db.Nation `json:"nation"`
+
+	// Policy is the game's leave policy used for the nation's territories
+	Policy string `json:"policy"`
+
+	// Territories are the names of the territories the nation held
+	Territories []string `json:"territories"`
+
+	// Heir is the player whose nation was given the territories, if the leave policy is "heir"
+	Heir string `json:"heir,omitempty"`
+}
+
+func (nd *nationDeparture) changed() ([]string, []string) {
+	players := []string{nd.Nation.Player}
+	switch nd.Policy {
+	case config.LeavePolicyNeutral:
+		players = append(players, db.NeutralPlayer)
+	case config.LeavePolicyHeir:
+		players = append(players, nd.Heir)
+	}
+	return players, nd.Territories
+}
+
+func (nd *nationDeparture) territoriesString() string {
+	if len(nd.Territories) == 0 {
+		return ""
+	}
+	territories := strings.Join(nd.Territories, ", ")
+	switch nd.Policy {
+	case config.LeavePolicyNeutral:
+		return fmt.Sprintf(departureNeutralFmt, territories)
+	case config.LeavePolicyHeir:
+		return fmt.Sprintf(departureHeirFmt, territories, nd.Heir)
+	}
+	return fmt.Sprintf(departureDeletedFmt, territories)
+}
+
+// departNation removes the player's nation from the game, handling its territories using the game's leave policy. Nations
+// can't leave while the game's territories are being drafted
+func departNation(g *game.Game, tx *sql.Tx, player string, heir string) (*nationDeparture, error) {
+	cfg := g.Config()
+	err := checkNotDrafting(g, tx)
+	if err != nil {
+		return nil, err
+	}
+	departure := &nationDeparture{Policy: cfg.LeavePolicy}
+	switch {
+	case cfg.LeavePolicy == config.LeavePolicyHeir && heir == "":
+		cfg.LogError("Unable to remove nation", "error", ErrHeirRequired)
+		return nil, ErrHeirRequired
+	case cfg.LeavePolicy != config.LeavePolicyHeir && heir != "":
+		cfg.LogError("Unable to remove nation", "error", ErrHeirNotAllowed)
+		return nil, ErrHeirNotAllowed
+	case heir != "":
+		if departure.Heir, err = resolvePlayer(g, tx, heir); err != nil {
+			return nil, err
+		}
+		if departure.Heir == player {
+			err = &ActionError{msg: "a nation can't be its own heir"}
+			cfg.LogError("Unable to remove nation", "error", err)
+			return nil, err
+		}
+	}
+
+	var nationID int64
+	departure.Nation = &db.Nation{Player: player}
+	if err = tx.QueryRow("SELECT id, country_name, color, reinforcements FROM nations WHERE game_id = ? AND player = ?",
+		cfg.GameID, player).Scan(&nationID, &departure.Nation.CountryName, &departure.Nation.Color, &departure.Nation.Reinforcements); err != nil {
+		cfg.LogError("Unable to get nation", "error", err)
+		return nil, err
+	}
+
+	rows, err := tx.Query("SELECT territory FROM holdings WHERE game_id = ? AND nation_id = ? ORDER BY id", cfg.GameID, nationID)
+	if err != nil {
+		cfg.LogError("Unable to get nation holdings", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+	departure.Territories = []string{}
+	for rows.Next() {
+		var abbr string
+		if err = rows.Scan(&abbr); err != nil {
+			cfg.LogError("Unable to scan holding", "error", err)
+			return nil, err
+		}
+		territory, err := cfg.ResolveTerritory(abbr)
+		if err != nil {
+			cfg.LogError("Unable to resolve held territory", "territory", abbr, "error", err)
+			return nil, err
+		}
+		departure.Territories = append(departure.Territories, territory.Name)
+	}
+	if err = rows.Close(); err != nil {
+		cfg.LogError("Unable to close holdings rows", "error", err)
+		return nil, err
+	}
+
+	switch cfg.LeavePolicy {
+	case config.LeavePolicyNeutral:
+		var neutralID int64
+		if neutralID, err = db.NeutralNationID(tx, cfg); err != nil {
+			cfg.LogError("Unable to get neutral nation", "error", err)
+			return nil, err
+		}
+		_, err = tx.Exec("UPDATE holdings SET nation_id = ? WHERE game_id = ? AND nation_id = ?", neutralID, cfg.GameID, nationID)
+	case config.LeavePolicyHeir:
+		_, err = tx.Exec(`UPDATE holdings SET nation_id = (SELECT id FROM nations WHERE game_id = ?1 AND player = ?2)
+			WHERE game_id = ?1 AND nation_id = ?3`, cfg.GameID, departure.Heir, nationID)
+	default:
+		_, err = tx.Exec("DELETE FROM holdings WHERE game_id = ? AND nation_id = ?", cfg.GameID, nationID)
+	}
+	if err != nil {
+		cfg.LogError("Unable to update nation holdings", "policy", cfg.LeavePolicy, "error", err)
+		return nil, err
+	}
+
+	if err = db.RemoveNation(tx, cfg, player); err != nil {
+		return nil, err
+	}
+	return departure, nil
+}
+
+// finishDeparture logs the result of a nation leaving the game and commits the transaction. If turn management is
+// enabled, the turn is ended if the remaining players are done
+func finishDeparture(g *game.Game, tx *sql.Tx, result ActionResult) error {
+	cfg := g.Config()
+	if err := logAction(g, tx, result, false); err != nil {
+		return err
+	}
+	if cfg.DoTurnManagement {
+		if _, err := turns.IsTurnDone(g, tx); err != nil {
+			cfg.LogError("Unable to check if turn is done", "error", err)
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		cfg.LogError("Unable to commit transaction", "error", err)
+		return err
+	}
+	return nil
+}
+
+type LeaveActionResult struct {
+	actionResultBase[*LeaveAction]
+	nationDeparture
+}
+
+func (lar *LeaveActionResult) ActionType() string {
+	return "leave"
+}
+
+func (lar *LeaveActionResult) String() string {
+	str := lar.actionResultBase.String()
+	if str != "" {
+		return str
+	}
+	if lar.Nation == nil {
+		return noActionString
+	}
+	return fmt.Sprintf(leaveActionResultFmt, lar.Nation.CountryName) + lar.territoriesString()
+}
+
+// LeaveAction removes the player's nation from the game. Its territories are removed, given to the neutral nation, or
+// given to the named heir, depending on the game's leave policy. It doesn't count towards the player's actions for the
+// turn
+type LeaveAction struct {
+	GameRef
+	User string `json:"user"`
+
+	// Heir is the player or country name of the nation that gets the territories. It must be set if the game's leave
+	// policy is "heir", and must not be set otherwise
+	Heir string `json:"heir,omitempty"`
+}
+
+// DoAction removes the player's nation using the given database
+func (la *LeaveAction) DoAction(tdb *sql.DB) (ActionResult, error) {
+	g, err := compatGame(la.GameRef, tdb)
+	if err != nil {
+		return nil, err
+	}
+	return la.Do(g)
+}
+
+// Do removes the player's nation from the given game
+func (la *LeaveAction) Do(g *game.Game) (ActionResult, error) {
+	if err := checkGameOver(g); err != nil {
+		return nil, err
+	}
+	tx, err := beginDiplomacy(g, la.User)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	departure, err := departNation(g, tx, la.User, la.Heir)
+	if err != nil {
+		return nil, err
+	}
+	result := &LeaveActionResult{
+		actionResultBase: actionResultBase[*LeaveAction]{
+			Action: &la,
+			user:   la.User,
+		},
+		nationDeparture: *departure,
+	}
+	if err = finishDeparture(g, tx, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+type RemoveActionResult struct {
+	actionResultBase[*RemoveAction]
+	nationDeparture
+}
+
+func (rar *RemoveActionResult) ActionType() string {
+	return "remove"
+}
+
+func (rar *RemoveActionResult) String() string {
+	str := rar.actionResultBase.String()
+	if str != "" {
+		return str
+	}
+	if rar.Nation == nil {
+		return noActionString
+	}
+	return fmt.Sprintf(removeActionResultFmt, rar.Nation.CountryName) + rar.territoriesString()
+}
+
+// RemoveAction is the administrative equivalent of LeaveAction, removing a player's nation from the game without the
+// player doing it, for example if they stopped playing. Consuming applications should only allow game administrators
+// to do it
+type RemoveAction struct {
+	GameRef
+
+	// Player is the player whose nation is removed
+	Player string `json:"player"`
+
+	// Heir is the player or country name of the nation that gets the territories. It must be set if the game's leave
+	// policy is "heir", and must not be set otherwise
+	Heir string `json:"heir,omitempty"`
+}
+
+// DoAction removes the player's nation using the given database
+func (ra *RemoveAction) DoAction(tdb *sql.DB) (ActionResult, error) {
+	g, err := compatGame(ra.GameRef, tdb)
+	if err != nil {
+		return nil, err
+	}
+	return ra.Do(g)
+}
+
+// Do removes the player's nation from the given game
+func (ra *RemoveAction) Do(g *game.Game) (ActionResult, error) {
+	if err := checkGameOver(g); err != nil {
+		return nil, err
+	}
+	tx, err := beginDiplomacy(g, ra.Player)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	departure, err := departNation(g, tx, ra.Player, ra.Heir)
+	if err != nil {
+		return nil, err
+	}
+	result := &RemoveActionResult{
+		actionResultBase: actionResultBase[*RemoveAction]{
+			Action: &ra,
+			user:   ra.Player,
+		},
+		nationDeparture: *departure,
+	}
+	if err = finishDeparture(g, tx, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/Eggbertx/territories-game/pkg/config"
 	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
 )
 
 const (
@@ -25,14 +26,33 @@ var (
 
 type MoveActionResult struct {
 	actionResultBase[*MoveAction]
-	FailedMove    bool
-	NationRemoved *db.Nation
+	FailedMove    bool       `json:"failedMove"`
+	NationRemoved *db.Nation `json:"nationRemoved,omitempty"`
+
+	// InvasionCheck is true if the destination was unclaimed and UnclaimedTerritoriesHave1Army is enabled, in which
+	// case DieRoll and Losses are the results of the attack on the destination's army
+	InvasionCheck bool `json:"invasionCheck,omitempty"`
+	DieRoll       int  `json:"dieRoll,omitempty"`
+	Losses        int  `json:"losses,omitempty"`
+
+	// ActionCost is the number of the player's actions for the turn that the move used, if the destination has an
+	// enterCost. Otherwise it used one action
+	ActionCost int `json:"actionCost,omitempty"`
 }
 
 func (mar *MoveActionResult) ActionType() string {
 	return "move"
 }
 
+func (mar *MoveActionResult) actionCost() int {
+	return mar.ActionCost
+}
+
+func (mar *MoveActionResult) changed() ([]string, []string) {
+	action := *mar.Action
+	return []string{action.User}, []string{action.Source, action.Destination}
+}
+
 func (mar *MoveActionResult) String() string {
 	str := mar.actionResultBase.String()
 	if str != "" {
@@ -58,91 +78,166 @@ func (mar *MoveActionResult) String() string {
 }
 
 type MoveAction struct {
-	User        string
-	Source      string
-	Destination string
-	Armies      int
+	GameRef
+	User        string `json:"user"`
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Armies      int    `json:"armies"`
 }
 
+// DoAction moves the player's armies using the given database
 func (ma *MoveAction) DoAction(tdb *sql.DB) (ActionResult, error) {
-	cfg, err := config.GetConfig()
+	g, err := compatGame(ma.GameRef, tdb)
 	if err != nil {
 		return nil, err
 	}
+	return ma.Do(g)
+}
 
+// Do moves the player's armies in the given game, or stores the move as an order to be resolved when the turn ends if
+// the game uses simultaneous resolution
+func (ma *MoveAction) Do(g *game.Game) (ActionResult, error) {
+	if err := checkGameOver(g); err != nil {
+		return nil, err
+	}
+	cfg := g.Config()
+	tdb := g.DB()
+
+	sourceTerritory, destTerritory, connection, err := ma.resolveTerritories(g)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.ValidateUser(ma.User, tdb, cfg.GameID, cfg.LogError); err != nil {
+		if errors.Is(err, db.ErrUserNotRegistered) {
+			cfg.LogError("User is not registered in the game", "user", ma.User)
+			return nil, &ActionError{err: err}
+		}
+		cfg.LogError("Unable to validate user", "error", err)
+		return nil, err
+	}
+
+	tx, err := tdb.Begin()
+	if err != nil {
+		cfg.LogError("Unable to begin transaction", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = checkIfEnoughPlayersToStart(g, tx); err != nil {
+		return nil, err
+	}
+
+	if err = checkReturnsRemainingIfManaging(g, tx, ma.User); err != nil {
+		return nil, err
+	}
+	if err = checkActionCost(g, tx, ma.User, destTerritory.ActionCost()); err != nil {
+		return nil, err
+	}
+
+	var result ActionResult
+	if cfg.ResolutionMode == config.ResolutionSimultaneous {
+		message := fmt.Sprintf(orderMoveFmt, ma.User, ma.Armies, sourceTerritory.Name, destTerritory.Name)
+		if ma.Armies <= 0 {
+			message = fmt.Sprintf(orderMoveAllFmt, ma.User, sourceTerritory.Name, destTerritory.Name)
+		}
+		result, err = submitOrder(g, tx, ma, &db.Order{
+			Player:      ma.User,
+			Type:        "move",
+			Source:      sourceTerritory.Abbreviation,
+			Destination: destTerritory.Abbreviation,
+			Armies:      max(ma.Armies, 0),
+		}, destTerritory.ActionCost(), message)
+	} else {
+		result, err = ma.apply(g, tx, sourceTerritory, destTerritory, connection)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = logAction(g, tx, result, true); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		cfg.LogError("Unable to commit transaction", "error", err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// resolveTerritories resolves the move's source and destination territories and checks that the armies can be moved
+// between them, returning the connection between them, or nil if the destination may be reachable through allied
+// territories
+func (ma *MoveAction) resolveTerritories(g *game.Game) (*config.Territory, *config.Territory, *config.Connection, error) {
+	cfg := g.Config()
 	if ma.Source == "" {
 		cfg.LogError("No source territory specified")
-		return nil, ErrMissingSourceTerritory
+		return nil, nil, nil, ErrMissingSourceTerritory
 	}
 	if ma.Destination == "" {
 		cfg.LogError("No destination territory specified")
-		return nil, ErrMissingDestTerritory
+		return nil, nil, nil, ErrMissingDestTerritory
 	}
 	if ma.Source == ma.Destination {
 		cfg.LogError("Source and destination territories cannot be the same")
-		return nil, ErrSourceEqualsDestination
+		return nil, nil, nil, ErrSourceEqualsDestination
 	}
 
 	sourceTerritory, err := cfg.ResolveTerritory(ma.Source)
 	if err != nil {
 		cfg.LogError("Unable to resolve source territory", "error", err)
-		return nil, &ActionError{err: err}
+		return nil, nil, nil, &ActionError{err: err}
 	}
 	ma.Source = sourceTerritory.Name
 
 	destTerritory, err := cfg.ResolveTerritory(ma.Destination)
 	if err != nil {
 		cfg.LogError("Unable to resolve destination territory", "error", err)
-		return nil, &ActionError{err: err}
+		return nil, nil, nil, &ActionError{err: err}
 	}
 	ma.Destination = destTerritory.Name
+	if err = checkPassable(g, destTerritory); err != nil {
+		return nil, nil, nil, err
+	}
 
-	isNeighboring, err := sourceTerritory.IsNeighboring(ma.Destination)
+	connection, err := sourceTerritory.ConnectionTo(ma.Destination)
 	if err != nil {
 		cfg.LogError("Unable to check if territories are neighboring", "error", err)
-		return nil, &ActionError{err: err}
+		return nil, nil, nil, &ActionError{err: err}
 	}
 
-	if !isNeighboring {
+	if connection == nil && !cfg.AlliesCanMoveThrough {
 		err = &ActionError{msg: fmt.Sprintf("cannot move from %s to %s: not a neighboring territory", sourceTerritory.Name, destTerritory.Name)}
 		cfg.LogError("Unable to move armies", "error", err)
-		return nil, err
-	}
-
-	if err = db.ValidateUser(ma.User, tdb, cfg.LogError); err != nil {
-		if errors.Is(err, db.ErrUserNotRegistered) {
-			cfg.LogError("User is not registered in the game", "user", ma.User)
-			return nil, &ActionError{err: err}
-		}
-		cfg.LogError("Unable to validate user", "error", err)
-		return nil, err
+		return nil, nil, nil, err
 	}
+	return sourceTerritory, destTerritory, connection, nil
+}
 
-	tx, err := tdb.Begin()
+// applyOrder moves the armies of a resolved order
+func (ma *MoveAction) applyOrder(g *game.Game, tx *sql.Tx) (ActionResult, error) {
+	sourceTerritory, destTerritory, connection, err := ma.resolveTerritories(g)
 	if err != nil {
-		cfg.LogError("Unable to begin transaction", "error", err)
-		return nil, err
-	}
-	defer tx.Rollback()
-
-	if err = checkIfEnoughPlayersToStart(tx, cfg, cfg.LogError); err != nil {
-		return nil, err
-	}
-
-	if err = checkReturnsRemainingIfManaging(tx, ma.User, cfg, cfg.LogError); err != nil {
 		return nil, err
 	}
+	return ma.apply(g, tx, sourceTerritory, destTerritory, connection)
+}
 
+// apply moves the player's armies using the given transaction
+func (ma *MoveAction) apply(g *game.Game, tx *sql.Tx, sourceTerritory, destTerritory *config.Territory, connection *config.Connection) (*MoveActionResult, error) {
+	cfg := g.Config()
+	tdb := g.DB()
+	isNeighboring := connection != nil
 	var armiesInSourceTerritory, armiesInDestTerritory int
 	var fromPlayer, destinationPlayer string
-	const moveSQL = "SELECT army_size, player FROM v_nation_holdings WHERE territory = ?"
+	const moveSQL = "SELECT army_size, player FROM v_nation_holdings WHERE game_id = ? AND territory = ?"
 	stmt, err := tx.Prepare(moveSQL)
 	if err != nil {
 		cfg.LogError("Unable to prepare move query", "error", err)
 		return nil, err
 	}
 	defer stmt.Close()
-	err = stmt.QueryRow(sourceTerritory.Abbreviation).Scan(&armiesInSourceTerritory, &fromPlayer)
+	err = stmt.QueryRow(cfg.GameID, sourceTerritory.Abbreviation).Scan(&armiesInSourceTerritory, &fromPlayer)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			err = &ActionError{msg: fmt.Sprintf("no armies in %s controlled by %s to move", sourceTerritory.Name, ma.User)}
@@ -160,7 +255,7 @@ func (ma *MoveAction) DoAction(tdb *sql.DB) (ActionResult, error) {
 		ma.Armies = armiesInSourceTerritory // none specified, move all armies in source territory
 	}
 
-	err = stmt.QueryRow(destTerritory.Abbreviation).Scan(&armiesInDestTerritory, &destinationPlayer)
+	err = stmt.QueryRow(cfg.GameID, destTerritory.Abbreviation).Scan(&armiesInDestTerritory, &destinationPlayer)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		cfg.LogError("Unable to query destination territory", "error", err)
 		return nil, err
@@ -178,19 +273,56 @@ func (ma *MoveAction) DoAction(tdb *sql.DB) (ActionResult, error) {
 		return nil, err
 	}
 
-	if armiesInDestTerritory+ma.Armies > cfg.MaxArmiesPerTerritory {
-		err = &ActionError{msg: fmt.Sprintf("cannot move %d armies to %s: would exceed maximum of %d", ma.Armies, destTerritory.Name, cfg.MaxArmiesPerTerritory)}
+	if isNeighboring && !connection.AllowsMove(ma.Armies) {
+		if connection.Type == config.ConnectionRestricted {
+			err = &ActionError{msg: fmt.Sprintf("cannot move from %s to %s: armies can't be moved across a restricted connection", sourceTerritory.Name, destTerritory.Name)}
+		} else {
+			err = &ActionError{msg: fmt.Sprintf("cannot move %d armies from %s to %s: at most %d can be moved across the connection", ma.Armies, sourceTerritory.Name, destTerritory.Name, connection.MaxArmies)}
+		}
 		cfg.LogError("Unable to move armies", "error", err)
 		return nil, err
 	}
 
+	if !isNeighboring {
+		reachable, err := ma.reachableThroughAllies(g, tx, sourceTerritory, destTerritory)
+		if err != nil {
+			return nil, err
+		}
+		if !reachable {
+			err = &ActionError{msg: fmt.Sprintf("cannot move from %s to %s: not a neighboring territory or reachable through allied territories", sourceTerritory.Name, destTerritory.Name)}
+			cfg.LogError("Unable to move armies", "error", err)
+			return nil, err
+		}
+	}
+
+	if armiesInDestTerritory+ma.Armies > destTerritory.ArmyLimit() {
+		err = &ActionError{msg: fmt.Sprintf("cannot move %d armies to %s: would exceed maximum of %d", ma.Armies, destTerritory.Name, destTerritory.ArmyLimit())}
+		cfg.LogError("Unable to move armies", "error", err)
+		return nil, err
+	}
+
+	result := &MoveActionResult{
+		actionResultBase: actionResultBase[*MoveAction]{
+			Action: &ma,
+			user:   ma.User,
+		},
+		ActionCost: destTerritory.EnterCost,
+	}
 	var newDestinationArmies int
 	if armiesInDestTerritory == 0 && cfg.UnclaimedTerritoriesHave1Army {
-		_, losses, err := attackCalculation(ma.Armies, 1)
+		rng, err := g.RandomSource(tx)
+		if err != nil {
+			cfg.LogError("Unable to get random source", "error", err)
+			return nil, err
+		}
+		x, losses, err := attackCalculation(rng, ma.Armies, 1, destTerritory.DefenseBonus)
 		if err != nil {
 			cfg.LogError("Unable to calculate attack", "error", err)
 			return nil, err
 		}
+		result.InvasionCheck = true
+		result.DieRoll = x
+		result.Losses = int(losses)
 		if losses < 0 {
 			// territory not cleared, attack failed
 			newDestinationArmies = ma.Armies + int(losses)
@@ -203,46 +335,95 @@ func (ma *MoveAction) DoAction(tdb *sql.DB) (ActionResult, error) {
 
 	if armiesInDestTerritory == 0 && newDestinationArmies > 0 {
 		// player is claiming an unoccupied territory, insert a new holding
-		stmt, err := tx.Prepare(`INSERT INTO holdings (nation_id, territory, army_size) VALUES(
-			(SELECT id FROM nations WHERE player = ?),
-			?, ?)`)
+		stmt, err := tx.Prepare(`INSERT INTO holdings (game_id, nation_id, territory, army_size) VALUES(?1,
+			(SELECT id FROM nations WHERE game_id = ?1 AND player = ?2),
+			?3, ?4)`)
 		if err != nil {
 			cfg.LogError("Unable to prepare insert holding statement", "error", err)
 			return nil, err
 		}
 		defer stmt.Close()
-		if _, err = stmt.Exec(ma.User, destTerritory.Abbreviation, newDestinationArmies); err != nil {
+		if _, err = stmt.Exec(cfg.GameID, ma.User, destTerritory.Abbreviation, newDestinationArmies); err != nil {
 			cfg.LogError("Unable to insert new holding", "error", err)
 			return nil, err
 		}
 	} else if newDestinationArmies > 0 {
 		// player is joining armies into an existing holding, update the army size
-		if _, err = db.UpdateHoldingArmySize(tdb, tx, destTerritory.Abbreviation, newDestinationArmies, false); err != nil {
+		if _, err = db.UpdateHoldingArmySize(tdb, tx, cfg, destTerritory.Abbreviation, newDestinationArmies, false); err != nil {
 			cfg.LogError("Unable to update holding army size", "error", err)
 			return nil, err
 		}
 	}
 
 	// remove armies from source territory, if they lost armies in the attack and have no armies left, delete the holding
-	nationRemoved, err := db.UpdateHoldingArmySize(tdb, tx, sourceTerritory.Abbreviation, armiesInSourceTerritory-ma.Armies, true)
+	nationRemoved, err := db.UpdateHoldingArmySize(tdb, tx, cfg, sourceTerritory.Abbreviation, armiesInSourceTerritory-ma.Armies, true)
 	if err != nil {
 		return nil, err
 	}
 
-	if err = addTurnEntryIfManaging(tx, ma.User, "move"); err != nil {
-		return nil, err
+	result.FailedMove = newDestinationArmies == 0
+	result.NationRemoved = nationRemoved
+	return result, nil
+}
+
+// reachableThroughAllies returns true if the destination territory is a neighbor of the source territory or of a
+// territory that can be reached from the source territory by only passing through territories held by the player's
+// allies, using only connections the player's armies can be moved across
+func (ma *MoveAction) reachableThroughAllies(g *game.Game, tx *sql.Tx, source *config.Territory, dest *config.Territory) (bool, error) {
+	allies, err := db.AlliedPlayers(tx, g.ID(), ma.User)
+	if err != nil {
+		g.LogError("Unable to get allies", "error", err)
+		return false, err
+	}
+	if len(allies) == 0 {
+		return false, nil
 	}
 
-	if err = tx.Commit(); err != nil {
-		cfg.LogError("Unable to commit transaction", "error", err)
-		return nil, err
+	rows, err := tx.Query("SELECT territory, player FROM v_nation_holdings WHERE game_id = ?", g.ID())
+	if err != nil {
+		g.LogError("Unable to get holdings", "error", err)
+		return false, err
 	}
-	return &MoveActionResult{
-		actionResultBase: actionResultBase[*MoveAction]{
-			Action: &ma,
-			user:   ma.User,
-		},
-		FailedMove:    newDestinationArmies == 0,
-		NationRemoved: nationRemoved,
-	}, nil
+	defer rows.Close()
+	allied := map[string]bool{}
+	for rows.Next() {
+		var territory, player string
+		if err = rows.Scan(&territory, &player); err != nil {
+			g.LogError("Unable to scan holding", "error", err)
+			return false, err
+		}
+		allied[territory] = allies[player]
+	}
+	if err = rows.Close(); err != nil {
+		g.LogError("Unable to close holdings rows", "error", err)
+		return false, err
+	}
+
+	cfg := g.Config()
+	visited := map[string]bool{source.Abbreviation: true}
+	queue := []*config.Territory{source}
+	for len(queue) > 0 {
+		territory := queue[0]
+		queue = queue[1:]
+		for _, connection := range territory.Connections() {
+			if !connection.AllowsMove(ma.Armies) {
+				continue
+			}
+			neighbor := connection.To
+			if neighbor == dest.Abbreviation {
+				return true, nil
+			}
+			if visited[neighbor] || !allied[neighbor] {
+				continue
+			}
+			visited[neighbor] = true
+			next, err := cfg.ResolveTerritory(neighbor)
+			if err != nil {
+				g.LogError("Unable to resolve neighboring territory", "error", err)
+				return false, err
+			}
+			queue = append(queue, next)
+		}
+	}
+	return false, nil
 }
@@ -0,0 +1,350 @@
+package actions
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/Eggbertx/territories-game/pkg/actions/turns"
+	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
+)
+
+const (
+	orderMoveFmt    = "%s ordered %d armies to move from %s to %s"
+	orderMoveAllFmt = "%s ordered all armies to move from %s to %s"
+	orderAttackFmt  = "%s ordered an attack on %s from %s"
+	orderRaiseFmt   = "%s ordered an army to be raised in %s"
+
+	orderBouncedMoveFmt    = "bounced from %s by a larger move by %s"
+	orderStandoffMoveFmt   = "standoff with an equally large move into %s"
+	orderBouncedAttackFmt  = "bounced by the attack on %s from %s, which has more armies"
+	orderStandoffAttackFmt = "standoff with the attack on %s from %s, which has as many armies"
+	orderGameOver          = "the game ended before the order was resolved"
+)
+
+func init() {
+	turns.SetOrderResolver(resolveOrders)
+}
+
+// orderApplier is implemented by the actions that can be submitted as orders in games using simultaneous resolution or
+// used as plan steps
+type orderApplier interface {
+	// applyOrder does the action using the given transaction, either the one ending the turn or the plan's, without
+	// the user and turn checks done by Do
+	applyOrder(g *game.Game, tx *sql.Tx) (ActionResult, error)
+}
+
+// OrderActionResult is the result of a move, attack, or raise action done in a game using simultaneous resolution,
+// which is stored as an order to be resolved when the turn ends
+type OrderActionResult struct {
+	// Order is the stored order
+	Order *db.Order `json:"order"`
+
+	// Action is the action the order was submitted with
+	Action Action `json:"action"`
+
+	user    string
+	message string
+	cost    int
+}
+
+func (oar *OrderActionResult) ActionType() string {
+	return "order"
+}
+
+func (oar *OrderActionResult) User() string {
+	return oar.user
+}
+
+func (oar *OrderActionResult) String() string {
+	if oar.Order == nil {
+		return noActionString
+	}
+	return oar.message
+}
+
+func (oar *OrderActionResult) actionCost() int {
+	return oar.cost
+}
+
+// submitOrder stores the order to be resolved when the turn ends, after checking that the player holds the territory
+// it is given from. The order's armies are only checked when it is resolved
+func submitOrder(g *game.Game, tx *sql.Tx, action Action, order *db.Order, cost int, message string) (*OrderActionResult, error) {
+	cfg := g.Config()
+	source, err := cfg.ResolveTerritory(order.Source)
+	if err != nil {
+		cfg.LogError("Unable to resolve order territory", "error", err)
+		return nil, &ActionError{err: err}
+	}
+	var armies int
+	if err = tx.QueryRow("SELECT army_size FROM v_nation_holdings WHERE game_id = ? AND territory = ? AND player = ?",
+		cfg.GameID, source.Abbreviation, order.Player).Scan(&armies); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = &ActionError{msg: fmt.Sprintf("no armies in %s controlled by %s", source.Name, order.Player)}
+		}
+		cfg.LogError("Unable to check order territory", "error", err)
+		return nil, err
+	}
+
+	if err = db.InsertOrder(tx, cfg.GameID, order); err != nil {
+		cfg.LogError("Unable to add order", "error", err)
+		return nil, err
+	}
+	return &OrderActionResult{
+		Order:   order,
+		Action:  action,
+		user:    order.Player,
+		message: message,
+		cost:    cost,
+	}, nil
+}
+
+// resolveOrders resolves the pending orders in a game using simultaneous resolution when its turn ends. The raises are
+// resolved first, then the moves, then the attacks, so the order the players submitted them in doesn't matter. Conflicting
+// moves and attacks are bounced (see bounceMoves and bounceAttacks), the remaining moves are resolved in the order
+// given by orderMoves, and the remaining attacks are resolved starting with the attacking territories with the most
+// armies. Orders that are no longer valid are voided
+func resolveOrders(g *game.Game, tx *sql.Tx) error {
+	cfg := g.Config()
+	orders, err := db.PendingOrders(tx, cfg.GameID)
+	if err != nil {
+		cfg.LogError("Unable to get pending orders", "error", err)
+		return err
+	}
+	var raises, moves, attacks []*db.Order
+	for o := range orders {
+		switch orders[o].Type {
+		case "raise":
+			raises = append(raises, &orders[o])
+		case "move":
+			moves = append(moves, &orders[o])
+		case "attack":
+			attacks = append(attacks, &orders[o])
+		}
+	}
+
+	for _, order := range raises {
+		if err = resolveOrder(g, tx, order); err != nil {
+			return err
+		}
+	}
+
+	if err = bounceMoves(g, tx, moves); err != nil {
+		return err
+	}
+	for _, order := range orderMoves(moves) {
+		if err = resolveOrder(g, tx, order); err != nil {
+			return err
+		}
+	}
+
+	holdings, err := queryHoldings(tx, cfg)
+	if err != nil {
+		cfg.LogError("Unable to get holdings", "error", err)
+		return err
+	}
+	armies := map[string]int{}
+	for _, holding := range holdings {
+		armies[holding.Territory] = holding.ArmySize
+	}
+	if err = bounceAttacks(g, tx, attacks, armies); err != nil {
+		return err
+	}
+	slices.SortStableFunc(attacks, func(a, b *db.Order) int {
+		return cmp.Or(cmp.Compare(armies[b.Source], armies[a.Source]), cmp.Compare(a.Source, b.Source), cmp.Compare(a.ID, b.ID))
+	})
+	for _, order := range attacks {
+		if err = resolveOrder(g, tx, order); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveOrder applies the order if it is still pending, logging the resulting action, or voids it if it is no longer
+// valid or the game has ended
+func resolveOrder(g *game.Game, tx *sql.Tx, order *db.Order) error {
+	cfg := g.Config()
+	if order.Status != db.OrderPending {
+		return nil
+	}
+	victory, err := db.GetVictory(g.DB(), tx, cfg.GameID)
+	if err != nil {
+		cfg.LogError("Unable to check if the game is over", "error", err)
+		return err
+	}
+	if victory != nil {
+		return setOrderOutcome(g, tx, order, db.OrderVoid, orderGameOver)
+	}
+
+	ref := GameRef{GameID: cfg.GameID}
+	var action orderApplier
+	switch order.Type {
+	case "raise":
+		action = &RaiseAction{GameRef: ref, User: order.Player, Territory: order.Source}
+	case "move":
+		action = &MoveAction{GameRef: ref, User: order.Player, Source: order.Source, Destination: order.Destination, Armies: order.Armies}
+	default:
+		action = &AttackAction{GameRef: ref, User: order.Player, AttackingTerritory: order.Source, DefendingTerritory: order.Destination}
+	}
+	result, err := action.applyOrder(g, tx)
+	var actionErr *ActionError
+	if errors.As(err, &actionErr) {
+		return setOrderOutcome(g, tx, order, db.OrderVoid, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	if err = logAction(g, tx, result, false); err != nil {
+		return err
+	}
+	return setOrderOutcome(g, tx, order, db.OrderResolved, result.String())
+}
+
+func setOrderOutcome(g *game.Game, tx *sql.Tx, order *db.Order, status string, outcome string) error {
+	if err := db.SetOrderOutcome(tx, order, status, outcome); err != nil {
+		g.LogError("Unable to set order outcome", "order", order.ID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// bounceMoves stops conflicting moves by different players into the same territory that none of them hold. The player
+// moving the most armies into the territory moves in and the other moves bounce, or if more than one player moves the
+// most armies, all of the moves into the territory bounce in a standoff. Moves of all of a territory's armies are set to
+// the number of armies it has before any of the moves are applied
+func bounceMoves(g *game.Game, tx *sql.Tx, moves []*db.Order) error {
+	cfg := g.Config()
+	holdings, err := queryHoldings(tx, cfg)
+	if err != nil {
+		cfg.LogError("Unable to get holdings", "error", err)
+		return err
+	}
+	holders := map[string]string{}
+	armies := map[string]int{}
+	for _, holding := range holdings {
+		holders[holding.Territory] = holding.Player
+		armies[holding.Territory] = holding.ArmySize
+	}
+
+	strength := map[string]map[string]int{}
+	for _, move := range moves {
+		if move.Armies <= 0 {
+			move.Armies = armies[move.Source]
+		}
+		if holders[move.Destination] == move.Player {
+			continue
+		}
+		if strength[move.Destination] == nil {
+			strength[move.Destination] = map[string]int{}
+		}
+		strength[move.Destination][move.Player] += move.Armies
+	}
+
+	for _, move := range moves {
+		players := strength[move.Destination]
+		if len(players) < 2 || holders[move.Destination] == move.Player {
+			continue
+		}
+		var strongest string
+		var tied bool
+		for player, moving := range players {
+			switch {
+			case strongest == "" || moving > players[strongest]:
+				strongest, tied = player, false
+			case moving == players[strongest]:
+				tied = true
+			}
+		}
+		destination, err := cfg.ResolveTerritory(move.Destination)
+		if err != nil {
+			cfg.LogError("Unable to resolve order territory", "error", err)
+			return err
+		}
+		switch {
+		case tied:
+			err = setOrderOutcome(g, tx, move, db.OrderStandoff, fmt.Sprintf(orderStandoffMoveFmt, destination.Name))
+		case strongest != move.Player:
+			err = setOrderOutcome(g, tx, move, db.OrderBounced, fmt.Sprintf(orderBouncedMoveFmt, destination.Name, strongest))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderMoves returns the pending moves in the order they are resolved. A move out of a territory is resolved before
+// the moves into it, so a move into a territory that another move is vacating doesn't depend on the order they were
+// submitted in. Otherwise, and for moves between territories that move into each other, the moves are sorted by source
+// territory, destination territory, and player
+func orderMoves(moves []*db.Order) []*db.Order {
+	pending := make([]*db.Order, 0, len(moves))
+	for _, move := range moves {
+		if move.Status == db.OrderPending {
+			pending = append(pending, move)
+		}
+	}
+	slices.SortFunc(pending, func(a, b *db.Order) int {
+		return cmp.Or(cmp.Compare(a.Source, b.Source), cmp.Compare(a.Destination, b.Destination), cmp.Compare(a.Player, b.Player),
+			cmp.Compare(a.Armies, b.Armies), cmp.Compare(a.ID, b.ID))
+	})
+
+	ordered := make([]*db.Order, 0, len(pending))
+	for len(pending) > 0 {
+		next := 0
+		for m, move := range pending {
+			if !slices.ContainsFunc(pending, func(other *db.Order) bool {
+				return other != move && other.Source == move.Destination
+			}) {
+				next = m
+				break
+			}
+		}
+		ordered = append(ordered, pending[next])
+		pending = slices.Delete(pending, next, next+1)
+	}
+	return ordered
+}
+
+// bounceAttacks stops attacks by different players between two territories that attack each other. The attack from
+// the territory with more armies goes ahead and the other attack bounces, or if both territories have the same number
+// of armies, both attacks bounce in a standoff
+func bounceAttacks(g *game.Game, tx *sql.Tx, attacks []*db.Order, armies map[string]int) error {
+	cfg := g.Config()
+	for a, attack := range attacks {
+		for _, other := range attacks[a+1:] {
+			if attack.Source != other.Destination || attack.Destination != other.Source || attack.Player == other.Player ||
+				attack.Status != db.OrderPending || other.Status != db.OrderPending {
+				continue
+			}
+			source, err := cfg.ResolveTerritory(attack.Source)
+			if err != nil {
+				cfg.LogError("Unable to resolve order territory", "error", err)
+				return err
+			}
+			destination, err := cfg.ResolveTerritory(attack.Destination)
+			if err != nil {
+				cfg.LogError("Unable to resolve order territory", "error", err)
+				return err
+			}
+			switch {
+			case armies[attack.Source] > armies[other.Source]:
+				err = setOrderOutcome(g, tx, other, db.OrderBounced, fmt.Sprintf(orderBouncedAttackFmt, destination.Name, source.Name))
+			case armies[attack.Source] < armies[other.Source]:
+				err = setOrderOutcome(g, tx, attack, db.OrderBounced, fmt.Sprintf(orderBouncedAttackFmt, source.Name, destination.Name))
+			default:
+				if err = setOrderOutcome(g, tx, attack, db.OrderStandoff, fmt.Sprintf(orderStandoffAttackFmt, source.Name, destination.Name)); err == nil {
+					err = setOrderOutcome(g, tx, other, db.OrderStandoff, fmt.Sprintf(orderStandoffAttackFmt, destination.Name, source.Name))
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
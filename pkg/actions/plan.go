@@ -0,0 +1,261 @@
+package actions
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Eggbertx/territories-game/pkg/actions/turns"
+	"github.com/Eggbertx/territories-game/pkg/config"
+	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
+)
+
+var (
+	ErrEmptyPlan        = &ActionError{msg: "the plan has no steps"}
+	ErrPlanSimultaneous = &ActionError{
+		msg: "plans can't be used in games using simultaneous resolution, the orders are resolved when the turn ends",
+	}
+)
+
+// PlanStepError is the reason a plan was rejected, wrapped in an *ActionError
+type PlanStepError struct {
+	// Step is the position of the first failing step in the plan, starting at 1
+	Step int
+
+	// Type is the type of the failing step
+	Type string
+
+	err error
+}
+
+func (pse *PlanStepError) Error() string {
+	return fmt.Sprintf("step %d (%s) failed: %s", pse.Step, pse.Type, pse.err.Error())
+}
+
+func (pse *PlanStepError) Unwrap() error {
+	return pse.err
+}
+
+// PlanStep is one of the actions in a plan. Type is "raise", "move", or "attack", and the other fields are the
+// arguments of the action with the same names
+type PlanStep struct {
+	Type string `json:"type"`
+
+	// Territory is the territory an army is raised in
+	Territory string `json:"territory,omitempty"`
+
+	// Source, Destination, and Armies are the arguments of a move
+	Source      string `json:"source,omitempty"`
+	Destination string `json:"destination,omitempty"`
+	Armies      int    `json:"armies,omitempty"`
+
+	// AttackingTerritory and DefendingTerritory are the arguments of an attack
+	AttackingTerritory string `json:"attacking,omitempty"`
+	DefendingTerritory string `json:"defending,omitempty"`
+}
+
+// action returns the player's action for the step and the number of the player's actions for the turn that it uses
+func (ps *PlanStep) action(cfg *config.Config, ref GameRef, user string) (orderApplier, int, error) {
+	switch ps.Type {
+	case "raise":
+		return &RaiseAction{GameRef: ref, User: user, Territory: ps.Territory}, 1, nil
+	case "move":
+		cost := 1
+		if destination, err := cfg.ResolveTerritory(ps.Destination); err == nil {
+			cost = destination.ActionCost()
+		}
+		return &MoveAction{GameRef: ref, User: user, Source: ps.Source, Destination: ps.Destination, Armies: ps.Armies}, cost, nil
+	case "attack":
+		return &AttackAction{GameRef: ref, User: user, AttackingTerritory: ps.AttackingTerritory, DefendingTerritory: ps.DefendingTerritory}, 1, nil
+	}
+	return nil, 0, &ActionError{msg: fmt.Sprintf("invalid step type %q, must be raise, move, or attack", ps.Type)}
+}
+
+type PlanActionResult struct {
+	// Results are the results of the plan's steps, in order
+	Results []ActionResult `json:"results"`
+
+	// Victory announces the winner of the game if one of the steps ended it
+	Victory *VictoryResult `json:"victory,omitempty"`
+
+	user string
+}
+
+func (par *PlanActionResult) ActionType() string {
+	return "plan"
+}
+
+func (par *PlanActionResult) User() string {
+	return par.user
+}
+
+func (par *PlanActionResult) String() string {
+	if len(par.Results) == 0 {
+		return noActionString
+	}
+	steps := make([]string, 0, len(par.Results))
+	for _, result := range par.Results {
+		steps = append(steps, result.String())
+	}
+	return strings.Join(steps, "; ")
+}
+
+func (par *PlanActionResult) victory() *VictoryResult {
+	return par.Victory
+}
+
+func (par *PlanActionResult) setVictory(victory *VictoryResult) {
+	par.Victory = victory
+}
+
+// PlanAction does a list of raise, move, and attack actions in order in a single transaction. The actions the steps use
+// are checked against the player's actions remaining when the plan is done, and whether the turn is done is only
+// checked after the last step, so all of the steps are applied in the same turn. Each step is checked against the state
+// left by the steps before it. If any step fails, none of them are applied and the *ActionError returned wraps a
+// *PlanStepError with the failing step. If a step ends the game, the steps after it are skipped
+type PlanAction struct {
+	GameRef
+	User  string     `json:"user"`
+	Steps []PlanStep `json:"steps"`
+}
+
+// DoAction does the plan's steps using the given database
+func (pa *PlanAction) DoAction(tdb *sql.DB) (ActionResult, error) {
+	g, err := compatGame(pa.GameRef, tdb)
+	if err != nil {
+		return nil, err
+	}
+	return pa.Do(g)
+}
+
+// Do does the plan's steps in the given game, logging each of them as its own action
+func (pa *PlanAction) Do(g *game.Game) (ActionResult, error) {
+	if err := checkGameOver(g); err != nil {
+		return nil, err
+	}
+	cfg := g.Config()
+	tdb := g.DB()
+	var err error
+
+	if cfg.ResolutionMode == config.ResolutionSimultaneous {
+		cfg.LogError("Unable to do plan", "error", ErrPlanSimultaneous)
+		return nil, ErrPlanSimultaneous
+	}
+	if len(pa.Steps) == 0 {
+		cfg.LogError("No plan steps specified")
+		return nil, ErrEmptyPlan
+	}
+
+	if err = db.ValidateUser(pa.User, tdb, cfg.GameID, cfg.LogError); err != nil {
+		if errors.Is(err, db.ErrUserNotRegistered) {
+			cfg.LogError("User is not registered in the game", "user", pa.User)
+			return nil, &ActionError{err: err}
+		}
+		cfg.LogError("Unable to validate user", "error", err)
+		return nil, err
+	}
+
+	tx, err := tdb.Begin()
+	if err != nil {
+		cfg.LogError("Unable to begin transaction", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = checkIfEnoughPlayersToStart(g, tx); err != nil {
+		return nil, err
+	}
+
+	actions := make([]orderApplier, len(pa.Steps))
+	costs := make([]int, len(pa.Steps))
+	for s := range pa.Steps {
+		if actions[s], costs[s], err = pa.Steps[s].action(cfg, pa.GameRef, pa.User); err != nil {
+			return nil, pa.rejectStep(cfg, s, err)
+		}
+	}
+	if s, err := pa.checkActionsRemaining(g, tx, costs); err != nil {
+		return nil, pa.rejectStep(cfg, s, err)
+	}
+
+	result := &PlanActionResult{user: pa.User}
+	for s, action := range actions {
+		stepResult, err := doStep(g, tx, action)
+		if err != nil {
+			return nil, pa.rejectStep(cfg, s, err)
+		}
+		result.Results = append(result.Results, stepResult)
+		if victory := GameOver(stepResult); victory != nil {
+			result.Victory = victory
+			break
+		}
+	}
+
+	if cfg.DoTurnManagement {
+		if _, err = turns.IsTurnDone(g, tx); err != nil {
+			cfg.LogError("Unable to check if turn is done", "error", err)
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		cfg.LogError("Unable to commit transaction", "error", err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// checkActionsRemaining returns an *ActionError and the index of the first step that the player doesn't have enough
+// actions remaining for if turn management is enabled. The actions remaining are only read once, before any of the steps
+// are applied, since reading them again after the player's last action could end the turn in the middle of the plan
+func (pa *PlanAction) checkActionsRemaining(g *game.Game, tx *sql.Tx, costs []int) (int, error) {
+	cfg := g.Config()
+	if !cfg.DoTurnManagement {
+		return 0, nil
+	}
+	if err := checkReturnsRemainingIfManaging(g, tx, pa.User); err != nil {
+		return 0, err
+	}
+	actionsRemaining, err := turns.PlayerActionsRemaining(g, pa.User, tx)
+	if err != nil {
+		cfg.LogError("Unable to get player actions remaining", "error", err)
+		return 0, err
+	}
+	var required int
+	for s, cost := range costs {
+		required += cost
+		if required > actionsRemaining {
+			err = &ActionError{
+				msg: fmt.Sprintf("not enough actions remaining for player %s, %d required, %d remaining", pa.User, required, actionsRemaining),
+			}
+			cfg.LogError("Not enough actions remaining", "player", pa.User, "required", required, "remaining", actionsRemaining, "error", err)
+			return s, err
+		}
+	}
+	return 0, nil
+}
+
+// rejectStep wraps an *ActionError returned for the step at the given index in a *PlanStepError. Other errors are
+// returned unchanged
+func (pa *PlanAction) rejectStep(cfg *config.Config, s int, err error) error {
+	var actionErr *ActionError
+	if !errors.As(err, &actionErr) {
+		return err
+	}
+	err = &ActionError{err: &PlanStepError{Step: s + 1, Type: pa.Steps[s].Type, err: err}}
+	cfg.LogError("Plan rejected", "user", pa.User, "error", err)
+	return err
+}
+
+// doStep applies and logs the step's action using the plan's transaction, without checking if the turn is done
+func doStep(g *game.Game, tx *sql.Tx, action orderApplier) (ActionResult, error) {
+	result, err := action.applyOrder(g, tx)
+	if err != nil {
+		return nil, err
+	}
+	if err = logActionUsing(g, tx, result, true, turns.InsertPlayerActionRecord); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
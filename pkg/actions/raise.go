@@ -7,6 +7,7 @@ import (
 
 	"github.com/Eggbertx/territories-game/pkg/config"
 	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
 )
 
 const (
@@ -15,12 +16,20 @@ const (
 
 type RaiseActionResult struct {
 	actionResultBase[*RaiseAction]
+
+	// Armies is the number of armies in the territory after the raise
+	Armies int `json:"armies"`
 }
 
 func (rar *RaiseActionResult) ActionType() string {
 	return "raise"
 }
 
+func (rar *RaiseActionResult) changed() ([]string, []string) {
+	action := *rar.Action
+	return nil, []string{action.Territory}
+}
+
 func (rar *RaiseActionResult) String() string {
 	str := rar.actionResultBase.String()
 	if str != "" {
@@ -34,22 +43,36 @@ func (rar *RaiseActionResult) String() string {
 }
 
 type RaiseAction struct {
-	User      string
-	Territory string
+	GameRef
+	User      string `json:"user"`
+	Territory string `json:"territory"`
 }
 
+// DoAction adds an army to the player's holding using the given database
 func (ra *RaiseAction) DoAction(tdb *sql.DB) (ActionResult, error) {
-	cfg, err := config.GetConfig()
+	g, err := compatGame(ra.GameRef, tdb)
 	if err != nil {
 		return nil, err
 	}
+	return ra.Do(g)
+}
+
+// Do adds an army to the player's holding in the given game, or stores it as an order to be resolved when the turn
+// ends if the game uses simultaneous resolution
+func (ra *RaiseAction) Do(g *game.Game) (ActionResult, error) {
+	if err := checkGameOver(g); err != nil {
+		return nil, err
+	}
+	cfg := g.Config()
+	tdb := g.DB()
+	var err error
 
 	if ra.Territory == "" {
 		cfg.LogError("No target territory specified")
 		return nil, ErrNoTargetTerritory
 	}
 
-	if err = db.ValidateUser(ra.User, tdb, cfg.LogError); err != nil {
+	if err = db.ValidateUser(ra.User, tdb, cfg.GameID, cfg.LogError); err != nil {
 		if errors.Is(err, db.ErrUserNotRegistered) {
 			cfg.LogError("User is not registered in the game", "user", ra.User)
 			return nil, &ActionError{err: err}
@@ -65,11 +88,11 @@ func (ra *RaiseAction) DoAction(tdb *sql.DB) (ActionResult, error) {
 	}
 	defer tx.Rollback()
 
-	if err = checkIfEnoughPlayersToStart(tx, cfg, cfg.LogError); err != nil {
+	if err = checkIfEnoughPlayersToStart(g, tx); err != nil {
 		return nil, err
 	}
 
-	if err = checkReturnsRemainingIfManaging(tx, ra.User, cfg, cfg.LogError); err != nil {
+	if err = checkReturnsRemainingIfManaging(g, tx, ra.User); err != nil {
 		return nil, err
 	}
 
@@ -80,7 +103,41 @@ func (ra *RaiseAction) DoAction(tdb *sql.DB) (ActionResult, error) {
 	}
 	ra.Territory = territory.Name
 
-	stmt, err := tx.Prepare(`SELECT army_size FROM v_nation_holdings WHERE territory = ? and player = ?`)
+	var result ActionResult
+	if cfg.ResolutionMode == config.ResolutionSimultaneous {
+		result, err = submitOrder(g, tx, ra, &db.Order{Player: ra.User, Type: "raise", Source: territory.Abbreviation}, 1,
+			fmt.Sprintf(orderRaiseFmt, ra.User, territory.Name))
+	} else {
+		result, err = ra.apply(g, tx, territory)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = logAction(g, tx, result, true); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		cfg.LogError("Unable to commit transaction", "error", err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// applyOrder raises the army of a resolved order
+func (ra *RaiseAction) applyOrder(g *game.Game, tx *sql.Tx) (ActionResult, error) {
+	territory, err := g.Config().ResolveTerritory(ra.Territory)
+	if err != nil {
+		return nil, &ActionError{err: err}
+	}
+	ra.Territory = territory.Name
+	return ra.apply(g, tx, territory)
+}
+
+// apply adds an army to the player's holding in the territory using the given transaction
+func (ra *RaiseAction) apply(g *game.Game, tx *sql.Tx, territory *config.Territory) (*RaiseActionResult, error) {
+	cfg := g.Config()
+	stmt, err := tx.Prepare(`SELECT army_size FROM v_nation_holdings WHERE game_id = ? AND territory = ? and player = ?`)
 	if err != nil {
 		cfg.LogError("Unable to prepare raise check statement", "error", err)
 		return nil, err
@@ -88,7 +145,7 @@ func (ra *RaiseAction) DoAction(tdb *sql.DB) (ActionResult, error) {
 	defer stmt.Close()
 
 	var armySize int
-	if err = stmt.QueryRow(territory.Abbreviation, ra.User).Scan(&armySize); err != nil {
+	if err = stmt.QueryRow(cfg.GameID, territory.Abbreviation, ra.User).Scan(&armySize); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			err = &ActionError{msg: fmt.Sprintf("no armies in %s controlled by %s to raise", territory.Name, ra.User)}
 		}
@@ -96,22 +153,13 @@ func (ra *RaiseAction) DoAction(tdb *sql.DB) (ActionResult, error) {
 		return nil, err
 	}
 
-	if armySize == cfg.MaxArmiesPerTerritory {
-		err = &ActionError{msg: fmt.Sprintf("cannot raise army size in %s: already at maximum of %d", territory.Name, cfg.MaxArmiesPerTerritory)}
+	if armySize >= territory.ArmyLimit() {
+		err = &ActionError{msg: fmt.Sprintf("cannot raise army size in %s: already at maximum of %d", territory.Name, territory.ArmyLimit())}
 		cfg.LogError("Not enough actions remaining", "player", ra.User, "error", err)
 		return nil, err
 	}
 
-	if _, err = db.UpdateHoldingArmySize(tdb, tx, territory.Abbreviation, armySize+1, false); err != nil {
-		return nil, err
-	}
-
-	if err = addTurnEntryIfManaging(tx, ra.User, "raise"); err != nil {
-		return nil, err
-	}
-
-	if err = tx.Commit(); err != nil {
-		cfg.LogError("Unable to commit transaction", "error", err)
+	if _, err = db.UpdateHoldingArmySize(g.DB(), tx, cfg, territory.Abbreviation, armySize+1, false); err != nil {
 		return nil, err
 	}
 
@@ -120,5 +168,6 @@ func (ra *RaiseAction) DoAction(tdb *sql.DB) (ActionResult, error) {
 			Action: &ra,
 			user:   ra.User,
 		},
+		Armies: armySize + 1,
 	}, nil
 }
@@ -0,0 +1,235 @@
+package actions
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/Eggbertx/territories-game/pkg/config"
+	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
+)
+
+const (
+	scoutSuccessResultFmt = "%s scouted %s and found %d armies of %s"
+	scoutFailureResultFmt = "%s failed to scout %s"
+)
+
+var ErrNoFogOfWar = &ActionError{msg: "the game doesn't use fog of war, so every army size is already visible"}
+
+type ScoutActionResult struct {
+	actionResultBase[*ScoutAction]
+
+	// Success is true if the army size in the territory was revealed
+	Success bool `json:"success"`
+
+	// Nation is the country name of the nation holding the territory
+	Nation string `json:"nation"`
+
+	// Armies is the number of armies found in the territory, if the scouting succeeded
+	Armies int `json:"armies,omitempty"`
+}
+
+func (sar *ScoutActionResult) ActionType() string {
+	return "scout"
+}
+
+func (sar *ScoutActionResult) String() string {
+	str := sar.actionResultBase.String()
+	if str != "" {
+		return str
+	}
+	action := *sar.Action
+	if action == nil {
+		return noActionString
+	}
+	if !sar.Success {
+		return fmt.Sprintf(scoutFailureResultFmt, action.User, action.Territory)
+	}
+	return fmt.Sprintf(scoutSuccessResultFmt, action.User, action.Territory, sar.Armies, sar.Nation)
+}
+
+// loggedDetails returns only the scouted territory, so the army size found is only known to the scouting player
+func (sar *ScoutActionResult) loggedDetails() any {
+	var territory string
+	if action := *sar.Action; action != nil {
+		territory = action.Territory
+	}
+	return struct {
+		Territory string `json:"territory"`
+	}{territory}
+}
+
+// ScoutAction attempts to reveal the army size in a territory that the player can't see in a game using fog of war.
+// The territory must be within the game's scout range of a territory held by the player's nation. If it succeeds, the
+// army size is visible to the player until the end of the turn
+type ScoutAction struct {
+	GameRef
+	User      string `json:"user"`
+	Territory string `json:"territory"`
+}
+
+// DoAction scouts the territory using the given database
+func (sa *ScoutAction) DoAction(tdb *sql.DB) (ActionResult, error) {
+	g, err := compatGame(sa.GameRef, tdb)
+	if err != nil {
+		return nil, err
+	}
+	return sa.Do(g)
+}
+
+// Do scouts the territory in the given game
+func (sa *ScoutAction) Do(g *game.Game) (ActionResult, error) {
+	if err := checkGameOver(g); err != nil {
+		return nil, err
+	}
+	cfg := g.Config()
+	tdb := g.DB()
+	var err error
+
+	if !cfg.FogOfWar {
+		cfg.LogError("Unable to scout territory", "error", ErrNoFogOfWar)
+		return nil, ErrNoFogOfWar
+	}
+	if sa.Territory == "" {
+		cfg.LogError("No target territory specified")
+		return nil, ErrNoTargetTerritory
+	}
+
+	if err = db.ValidateUser(sa.User, tdb, cfg.GameID, cfg.LogError); err != nil {
+		if errors.Is(err, db.ErrUserNotRegistered) {
+			cfg.LogError("User is not registered in the game", "user", sa.User)
+			return nil, &ActionError{err: err}
+		}
+		cfg.LogError("Unable to validate user", "error", err)
+		return nil, err
+	}
+
+	tx, err := tdb.Begin()
+	if err != nil {
+		cfg.LogError("Unable to begin transaction", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = checkIfEnoughPlayersToStart(g, tx); err != nil {
+		return nil, err
+	}
+
+	if err = checkReturnsRemainingIfManaging(g, tx, sa.User); err != nil {
+		return nil, err
+	}
+
+	territory, err := cfg.ResolveTerritory(sa.Territory)
+	if err != nil {
+		cfg.LogError("Unable to resolve territory", "error", err)
+		return nil, &ActionError{err: err}
+	}
+	sa.Territory = territory.Name
+
+	holdings, err := queryHoldings(tx, cfg)
+	if err != nil {
+		cfg.LogError("Unable to get holdings", "error", err)
+		return nil, err
+	}
+	var target *db.HoldingRecord
+	for h := range holdings {
+		if holdings[h].Territory == territory.Abbreviation {
+			target = &holdings[h]
+			break
+		}
+	}
+	if target == nil {
+		err = &ActionError{msg: fmt.Sprintf("%s isn't held by any nation", territory.Name)}
+		cfg.LogError("Unable to scout territory", "territory", territory.Name, "error", err)
+		return nil, err
+	}
+
+	visible := db.VisibleTerritories(cfg, holdings, sa.User)
+	scouted, err := db.ScoutedTerritories(tx, cfg.GameID, sa.User)
+	if err != nil {
+		cfg.LogError("Unable to get scouted territories", "error", err)
+		return nil, err
+	}
+	for _, abbr := range scouted {
+		visible[abbr] = true
+	}
+	if visible[territory.Abbreviation] {
+		err = &ActionError{msg: fmt.Sprintf("the army size in %s is already visible to %s", territory.Name, sa.User)}
+		cfg.LogError("Unable to scout territory", "territory", territory.Name, "error", err)
+		return nil, err
+	}
+	if !territoriesInRange(cfg, holdings, sa.User, cfg.ScoutRange)[territory.Abbreviation] {
+		err = &ActionError{
+			msg: fmt.Sprintf("%s is more than %d territories away from the territories held by %s", territory.Name, cfg.ScoutRange, sa.User),
+		}
+		cfg.LogError("Unable to scout territory", "territory", territory.Name, "error", err)
+		return nil, err
+	}
+
+	rng, err := g.RandomSource(tx)
+	if err != nil {
+		cfg.LogError("Unable to get random source", "error", err)
+		return nil, err
+	}
+	roll, err := rng.IntN(100)
+	if err != nil {
+		cfg.LogError("Unable to get random number", "error", err)
+		return nil, err
+	}
+
+	result := &ScoutActionResult{
+		actionResultBase: actionResultBase[*ScoutAction]{
+			Action: &sa,
+			user:   sa.User,
+		},
+		Success: roll < cfg.ScoutSuccessPercent,
+		Nation:  target.CountryName,
+	}
+	if result.Success {
+		result.Armies = target.ArmySize
+		if err = db.AddScoutedTerritory(tx, cfg.GameID, sa.User, territory.Abbreviation); err != nil {
+			cfg.LogError("Unable to add scouted territory", "error", err)
+			return nil, err
+		}
+	}
+	if err = logAction(g, tx, result, true); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		cfg.LogError("Unable to commit transaction", "error", err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// territoriesInRange returns the abbreviations of the territories that are at most the given number of borders or
+// connections away from a territory held by the player, without passing through impassable territories
+func territoriesInRange(cfg *config.Config, holdings []db.HoldingRecord, player string, hops int) map[string]bool {
+	inRange := map[string]bool{}
+	var frontier []string
+	for _, holding := range holdings {
+		if holding.Player == player {
+			inRange[holding.Territory] = true
+			frontier = append(frontier, holding.Territory)
+		}
+	}
+	for hop := 0; hop < hops && len(frontier) > 0; hop++ {
+		var next []string
+		for _, abbr := range frontier {
+			territory, err := cfg.ResolveTerritory(abbr)
+			if err != nil || territory.Impassable {
+				continue
+			}
+			for _, connection := range territory.Connections() {
+				if !inRange[connection.To] {
+					inRange[connection.To] = true
+					next = append(next, connection.To)
+				}
+			}
+		}
+		frontier = next
+	}
+	return inRange
+}
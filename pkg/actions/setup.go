@@ -0,0 +1,458 @@
+package actions
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Eggbertx/territories-game/pkg/config"
+	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
+)
+
+const (
+	pickActionResultFmt = "%s picked %s"
+	pickNextFmt         = "; %s picks next"
+	setupCompleteFmt    = "; all territories have been claimed, starting armies left to deploy: %s"
+)
+
+var (
+	ErrSetupNotDone        = &ActionError{msg: "the game's territories haven't all been dealt yet"}
+	ErrSetupStarted        = &ActionError{msg: "the game's territories have already been dealt, no more nations can join"}
+	ErrTerritoryNotAllowed = &ActionError{msg: "territories are dealt in this game, a territory can't be chosen when joining"}
+	ErrNotDrafting         = &ActionError{msg: "territories can only be picked in games using the draft setup mode"}
+	ErrDraftInProgress     = &ActionError{msg: "nations can't leave the game while its territories are being drafted"}
+)
+
+// territorySetup is the outcome of the game's territories being dealt or drafted
+type territorySetup struct {
+	// Holdings are the names of the territories each player's nation got, by player
+	Holdings map[string][]string `json:"holdings"`
+
+	// Reinforcements is the number of starting armies each player's nation has left to deploy, by player
+	Reinforcements map[string]int `json:"reinforcements"`
+}
+
+func (ts *territorySetup) changed() ([]string, []string) {
+	players := slices.Sorted(maps.Keys(ts.Holdings))
+	var territories []string
+	for _, player := range players {
+		territories = append(territories, ts.Holdings[player]...)
+	}
+	return players, territories
+}
+
+func (ts *territorySetup) String() string {
+	players := slices.Sorted(maps.Keys(ts.Reinforcements))
+	armies := make([]string, 0, len(players))
+	for _, player := range players {
+		armies = append(armies, fmt.Sprintf("%s (%d)", player, ts.Reinforcements[player]))
+	}
+	return fmt.Sprintf(setupCompleteFmt, strings.Join(armies, ", "))
+}
+
+// setupPlayers returns the players in the game other than the neutral nation, in the order they joined
+func setupPlayers(g *game.Game, tx *sql.Tx) ([]string, error) {
+	cfg := g.Config()
+	rows, err := tx.Query("SELECT player FROM nations WHERE game_id = ? AND player <> ? ORDER BY id", cfg.GameID, db.NeutralPlayer)
+	if err != nil {
+		cfg.LogError("Unable to get players", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var players []string
+	for rows.Next() {
+		var player string
+		if err = rows.Scan(&player); err != nil {
+			cfg.LogError("Unable to scan player", "error", err)
+			return nil, err
+		}
+		players = append(players, player)
+	}
+	if err = rows.Close(); err != nil {
+		cfg.LogError("Unable to close players rows", "error", err)
+		return nil, err
+	}
+	return players, nil
+}
+
+// unclaimedTerritories returns the abbreviations of the passable territories that aren't held by any nation, in the
+// order they are configured
+func unclaimedTerritories(g *game.Game, tx *sql.Tx) ([]string, error) {
+	cfg := g.Config()
+	rows, err := tx.Query("SELECT territory FROM holdings WHERE game_id = ?", cfg.GameID)
+	if err != nil {
+		cfg.LogError("Unable to get holdings", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+	held := map[string]bool{}
+	for rows.Next() {
+		var territory string
+		if err = rows.Scan(&territory); err != nil {
+			cfg.LogError("Unable to scan holding", "error", err)
+			return nil, err
+		}
+		held[territory] = true
+	}
+	if err = rows.Close(); err != nil {
+		cfg.LogError("Unable to close holdings rows", "error", err)
+		return nil, err
+	}
+
+	var unclaimed []string
+	for _, territory := range cfg.Territories {
+		if !held[territory.Abbreviation] && !territory.Impassable {
+			unclaimed = append(unclaimed, territory.Abbreviation)
+		}
+	}
+	return unclaimed, nil
+}
+
+// checkSetupDone returns ErrSetupNotDone if the game deals its territories and they haven't all been dealt or drafted
+func checkSetupDone(g *game.Game, tx *sql.Tx) error {
+	cfg := g.Config()
+	if cfg.SetupMode == config.SetupModeClaim {
+		return nil
+	}
+	done, err := db.SetupDone(g.DB(), tx, cfg.GameID)
+	if err != nil {
+		cfg.LogError("Unable to check if the game's territories have been dealt", "error", err)
+		return err
+	}
+	if !done {
+		cfg.LogError("Game setup isn't done", "error", ErrSetupNotDone)
+		return ErrSetupNotDone
+	}
+	return nil
+}
+
+// draftPicks returns the number of territories that have been picked in the game's draft
+func draftPicks(g *game.Game, tx *sql.Tx) (int, error) {
+	cfg := g.Config()
+	var picks int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM actions WHERE game_id = ? AND action_type = 'pick'", cfg.GameID).Scan(&picks); err != nil {
+		cfg.LogError("Unable to get number of picks", "error", err)
+		return 0, err
+	}
+	return picks, nil
+}
+
+// checkSetupNotStarted returns ErrSetupStarted if the game deals its territories and they have already been dealt or
+// the draft has started, so no more nations can join
+func checkSetupNotStarted(g *game.Game, tx *sql.Tx) error {
+	cfg := g.Config()
+	if cfg.SetupMode == config.SetupModeClaim {
+		return nil
+	}
+	done, err := db.SetupDone(g.DB(), tx, cfg.GameID)
+	if err != nil {
+		cfg.LogError("Unable to check if the game's territories have been dealt", "error", err)
+		return err
+	}
+	var picks int
+	if !done {
+		if picks, err = draftPicks(g, tx); err != nil {
+			return err
+		}
+	}
+	if done || picks > 0 {
+		cfg.LogError("Game setup has already started", "error", ErrSetupStarted)
+		return ErrSetupStarted
+	}
+	return nil
+}
+
+// checkNotDrafting returns ErrDraftInProgress if the game's territories are being drafted. The nations pick in the
+// order they joined, so a nation leaving during the draft would change whose turn it is to pick
+func checkNotDrafting(g *game.Game, tx *sql.Tx) error {
+	cfg := g.Config()
+	if cfg.SetupMode != config.SetupModeDraft {
+		return nil
+	}
+	done, err := db.SetupDone(g.DB(), tx, cfg.GameID)
+	if err != nil {
+		cfg.LogError("Unable to check if the draft is done", "error", err)
+		return err
+	}
+	if done {
+		return nil
+	}
+	picks, err := draftPicks(g, tx)
+	if err != nil {
+		return err
+	}
+	if picks > 0 {
+		cfg.LogError("Unable to remove nation", "error", ErrDraftInProgress)
+		return ErrDraftInProgress
+	}
+	return nil
+}
+
+// dealTerritories deals the unclaimed territories to the nations at random, one army each, so that each nation gets
+// the same number of territories or one more than the others, then completes the setup
+func dealTerritories(g *game.Game, tx *sql.Tx) (*territorySetup, error) {
+	cfg := g.Config()
+	players, err := setupPlayers(g, tx)
+	if err != nil {
+		return nil, err
+	}
+	territories, err := unclaimedTerritories(g, tx)
+	if err != nil {
+		return nil, err
+	}
+	rng, err := g.RandomSource(tx)
+	if err != nil {
+		cfg.LogError("Unable to get random source", "error", err)
+		return nil, err
+	}
+	for t := len(territories) - 1; t > 0; t-- {
+		swap, err := rng.IntN(t + 1)
+		if err != nil {
+			cfg.LogError("Unable to shuffle territories", "error", err)
+			return nil, err
+		}
+		territories[t], territories[swap] = territories[swap], territories[t]
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO holdings (game_id, nation_id, territory, army_size) VALUES(?1,
+		(SELECT id FROM nations WHERE game_id = ?1 AND player = ?2), ?3, 1)`)
+	if err != nil {
+		cfg.LogError("Unable to prepare holding statement", "error", err)
+		return nil, err
+	}
+	defer stmt.Close()
+	for t, territory := range territories {
+		if _, err = stmt.Exec(cfg.GameID, players[t%len(players)], territory); err != nil {
+			cfg.LogError("Unable to deal territory", "territory", territory, "error", err)
+			return nil, err
+		}
+	}
+	return completeSetup(g, tx)
+}
+
+// completeSetup gives each nation the starting armies it has left after placing one in each of its territories as
+// reinforcements, makes the first territory each nation got its capital, and marks the game's setup as done
+func completeSetup(g *game.Game, tx *sql.Tx) (*territorySetup, error) {
+	cfg := g.Config()
+	setup := &territorySetup{
+		Holdings:       map[string][]string{},
+		Reinforcements: map[string]int{},
+	}
+	rows, err := tx.Query("SELECT player, territory FROM v_nation_holdings WHERE game_id = ? AND player <> ? ORDER BY id",
+		cfg.GameID, db.NeutralPlayer)
+	if err != nil {
+		cfg.LogError("Unable to get holdings", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+	capitals := make(map[string]string)
+	for rows.Next() {
+		var player, abbr string
+		if err = rows.Scan(&player, &abbr); err != nil {
+			cfg.LogError("Unable to scan holding", "error", err)
+			return nil, err
+		}
+		territory, err := cfg.ResolveTerritory(abbr)
+		if err != nil {
+			cfg.LogError("Unable to resolve held territory", "territory", abbr, "error", err)
+			return nil, err
+		}
+		if _, ok := capitals[player]; !ok {
+			capitals[player] = abbr
+		}
+		setup.Holdings[player] = append(setup.Holdings[player], territory.Name)
+	}
+	if err = rows.Close(); err != nil {
+		cfg.LogError("Unable to close holdings rows", "error", err)
+		return nil, err
+	}
+
+	for player, territories := range setup.Holdings {
+		setup.Reinforcements[player] = max(cfg.StartingArmies-len(territories), 0)
+		if _, err = tx.Exec("UPDATE nations SET reinforcements = reinforcements + ? WHERE game_id = ? AND player = ?",
+			setup.Reinforcements[player], cfg.GameID, player); err != nil {
+			cfg.LogError("Unable to give starting armies", "player", player, "error", err)
+			return nil, err
+		}
+		if err = db.SetCapital(tx, cfg.GameID, player, capitals[player], true); err != nil {
+			cfg.LogError("Unable to set nation capital", "player", player, "error", err)
+			return nil, err
+		}
+	}
+	if err = db.CompleteSetup(tx, cfg.GameID); err != nil {
+		cfg.LogError("Unable to complete game setup", "error", err)
+		return nil, err
+	}
+	return setup, nil
+}
+
+type PickActionResult struct {
+	actionResultBase[*PickAction]
+
+	// Next is the player that picks the next territory, if there are any territories left
+	Next string `json:"next,omitempty"`
+
+	// Setup is the outcome of the draft if the picked territory was the last one
+	Setup *territorySetup `json:"setup,omitempty"`
+}
+
+func (par *PickActionResult) ActionType() string {
+	return "pick"
+}
+
+func (par *PickActionResult) changed() ([]string, []string) {
+	action := *par.Action
+	if par.Setup != nil {
+		return par.Setup.changed()
+	}
+	return []string{action.User}, []string{action.Territory}
+}
+
+func (par *PickActionResult) String() string {
+	str := par.actionResultBase.String()
+	if str != "" {
+		return str
+	}
+	action := *par.Action
+	if action == nil {
+		return noActionString
+	}
+	str = fmt.Sprintf(pickActionResultFmt, action.User, action.Territory)
+	if par.Setup != nil {
+		return str + par.Setup.String()
+	}
+	return str + fmt.Sprintf(pickNextFmt, par.Next)
+}
+
+// PickAction claims an unclaimed territory with one army in a game using the draft setup mode. The nations pick in
+// the order they joined, starting once enough nations have joined, until all of the territories have been picked. It
+// doesn't count towards the player's actions for the turn
+type PickAction struct {
+	GameRef
+	User      string `json:"user"`
+	Territory string `json:"territory"`
+}
+
+// DoAction claims the territory using the given database
+func (pa *PickAction) DoAction(tdb *sql.DB) (ActionResult, error) {
+	g, err := compatGame(pa.GameRef, tdb)
+	if err != nil {
+		return nil, err
+	}
+	return pa.Do(g)
+}
+
+// Do claims the territory in the given game
+func (pa *PickAction) Do(g *game.Game) (ActionResult, error) {
+	if err := checkGameOver(g); err != nil {
+		return nil, err
+	}
+	cfg := g.Config()
+	tdb := g.DB()
+	if cfg.SetupMode != config.SetupModeDraft {
+		cfg.LogError("Game doesn't use the draft setup mode", "setupMode", cfg.SetupMode)
+		return nil, ErrNotDrafting
+	}
+	if pa.Territory == "" {
+		cfg.LogError("No target territory specified")
+		return nil, ErrNoTargetTerritory
+	}
+	territory, err := cfg.ResolveTerritory(pa.Territory)
+	if err != nil {
+		cfg.LogError("Unable to resolve territory", "error", err)
+		return nil, &ActionError{err: err}
+	}
+	pa.Territory = territory.Name
+	if err = checkPassable(g, territory); err != nil {
+		return nil, err
+	}
+
+	if err = db.ValidateUser(pa.User, tdb, cfg.GameID, cfg.LogError); err != nil {
+		if errors.Is(err, db.ErrUserNotRegistered) {
+			cfg.LogError("User is not registered in the game", "user", pa.User)
+			return nil, &ActionError{err: err}
+		}
+		cfg.LogError("Unable to validate user", "error", err)
+		return nil, err
+	}
+
+	tx, err := tdb.Begin()
+	if err != nil {
+		cfg.LogError("Unable to begin transaction", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	done, err := db.SetupDone(tdb, tx, cfg.GameID)
+	if err != nil {
+		cfg.LogError("Unable to check if the draft is done", "error", err)
+		return nil, err
+	}
+	if done {
+		err = &ActionError{msg: "all of the territories have already been picked"}
+		cfg.LogError("Unable to pick territory", "error", err)
+		return nil, err
+	}
+
+	players, err := setupPlayers(g, tx)
+	if err != nil {
+		return nil, err
+	}
+	if len(players) < cfg.MinimumNationsToStart {
+		err = &ActionError{
+			msg: fmt.Sprintf("not enough players to start the draft, minimum required: %d, currently joined: %d", cfg.MinimumNationsToStart, len(players)),
+		}
+		cfg.LogError("Not enough players to start the draft", "error", err)
+		return nil, err
+	}
+	picks, err := draftPicks(g, tx)
+	if err != nil {
+		return nil, err
+	}
+	if picker := players[picks%len(players)]; picker != pa.User {
+		err = &ActionError{msg: fmt.Sprintf("it is %s's turn to pick a territory", picker)}
+		cfg.LogError("Unable to pick territory", "error", err)
+		return nil, err
+	}
+
+	if _, err = tx.Exec(`INSERT INTO holdings (game_id, nation_id, territory, army_size) VALUES(?1,
+		(SELECT id FROM nations WHERE game_id = ?1 AND player = ?2), ?3, 1)`,
+		cfg.GameID, pa.User, territory.Abbreviation); err != nil {
+		if db.ErrorIsUniqueConstraintViolation(err) {
+			err = ErrTerritoryAlreadyOccupied
+		}
+		cfg.LogError("Unable to pick territory", "error", err)
+		return nil, err
+	}
+
+	result := &PickActionResult{
+		actionResultBase: actionResultBase[*PickAction]{
+			Action: &pa,
+			user:   pa.User,
+		},
+		Next: players[(picks+1)%len(players)],
+	}
+	unclaimed, err := unclaimedTerritories(g, tx)
+	if err != nil {
+		return nil, err
+	}
+	if len(unclaimed) == 0 {
+		result.Next = ""
+		if result.Setup, err = completeSetup(g, tx); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = logAction(g, tx, result, false); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		cfg.LogError("Unable to commit transaction", "error", err)
+		return nil, err
+	}
+	return result, nil
+}
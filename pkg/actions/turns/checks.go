@@ -4,8 +4,8 @@ import (
 	"database/sql"
 	"time"
 
-	"github.com/Eggbertx/territories-game/pkg/config"
 	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
 )
 
 const (
@@ -18,27 +18,24 @@ type TurnEndReason int
 
 // PlayerActions represents the actions taken and maximum actions (based on holdings) a player can take in a turn.
 type PlayerActions struct {
-	ActionsCompleted int
-	MaxActions       int
+	ActionsCompleted int `json:"actionsCompleted"`
+	MaxActions       int `json:"maxActions"`
 }
 
-func queryPlayersWithActionsLeft(tx *sql.Tx, actionsPerTurnHoldingsDivisor float64) (map[string]PlayerActions, error) {
+func queryPlayersWithActionsLeft(g *game.Game, tx *sql.Tx, actionsPerTurnHoldingsDivisor float64) (map[string]PlayerActions, error) {
 	const query = `SELECT q1.player, coalesce(actions_completed, 0) as actions_completed, max_actions
 	FROM (
-		SELECT player, nation_id,
+		SELECT game_id, player, nation_id,
 			CEIL(COUNT(*) / ?) AS max_actions
 		FROM v_nation_holdings
+		WHERE game_id = ? AND player <> ?
 		GROUP BY player, nation_id
-	) q1 LEFT JOIN v_current_turn_player_actions q2 ON q1.player = q2.player
-	WHERE COALESCE(q2.actions_completed, 0) < q1.max_actions`
+	) q1 LEFT JOIN v_current_turn_player_actions q2 ON q1.game_id = q2.game_id AND q1.player = q2.player`
 
-	db, err := db.GetDB()
-	if err != nil {
-		return nil, err
-	}
+	var err error
 	shouldCommit := tx == nil
 	if shouldCommit {
-		tx, err = db.Begin()
+		tx, err = g.DB().Begin()
 		if err != nil {
 			return nil, err
 		}
@@ -51,7 +48,7 @@ func queryPlayersWithActionsLeft(tx *sql.Tx, actionsPerTurnHoldingsDivisor float
 	}
 	defer stmt.Close()
 
-	rows, err := stmt.Query(actionsPerTurnHoldingsDivisor)
+	rows, err := stmt.Query(actionsPerTurnHoldingsDivisor, g.ID(), db.NeutralPlayer)
 	if err != nil {
 		return nil, err
 	}
@@ -73,6 +70,22 @@ func queryPlayersWithActionsLeft(tx *sql.Tx, actionsPerTurnHoldingsDivisor float
 		return nil, err
 	}
 
+	bonuses, err := regionBonuses(g, tx, "")
+	if err != nil {
+		return nil, err
+	}
+	for player, actionInfo := range playerActions {
+		actionInfo.MaxActions += bonuses[player]
+		if actionInfo.ActionsCompleted >= actionInfo.MaxActions {
+			delete(playerActions, player)
+		} else {
+			playerActions[player] = actionInfo
+		}
+	}
+	if len(playerActions) == 0 {
+		playerActions = nil
+	}
+
 	if shouldCommit {
 		if err = tx.Commit(); err != nil {
 			return playerActions, err
@@ -81,41 +94,33 @@ func queryPlayersWithActionsLeft(tx *sql.Tx, actionsPerTurnHoldingsDivisor float
 	return playerActions, nil
 }
 
-// PlayersWithActionsLeft returns a map of player names to PlayerActions for all players that still have actions available in the current turns.
-// If all players are done and the configuration allows it, it will end the turn.
-func PlayersWithActionsLeft(tx *sql.Tx) (map[string]PlayerActions, error) {
-	cfg, err := config.GetConfig()
-	if err != nil {
-		return nil, err
-	}
-
-	db, err := db.GetDB()
-	if err != nil {
-		return nil, err
-	}
-
+// PlayersWithActionsLeft returns a map of player names to PlayerActions for all players in the game that still have actions available
+// in the current turn. If all players are done and the game's configuration allows it, it will end the turn.
+func PlayersWithActionsLeft(g *game.Game, tx *sql.Tx) (map[string]PlayerActions, error) {
+	cfg := g.Config()
+	var err error
 	shouldCommit := tx == nil
 	if shouldCommit {
-		tx, err = db.Begin()
+		tx, err = g.DB().Begin()
 		if err != nil {
 			return nil, err
 		}
 		defer tx.Rollback()
 	}
 
-	playerActions, err := queryPlayersWithActionsLeft(tx, cfg.ActionsPerTurnHoldingsDivisor)
+	playerActions, err := queryPlayersWithActionsLeft(g, tx, cfg.ActionsPerTurnHoldingsDivisor)
 	if err != nil {
 		return nil, err
 	}
 
 	if len(playerActions) == 0 && cfg.TurnEndsWhenAllPlayersDone {
 		// all players are done, configuration set to end turn when all players are done
-		if err = EndTurn(TurnEndReasonPlayersAllDone, tx); err != nil {
+		if err = EndTurn(g, TurnEndReasonPlayersAllDone, tx); err != nil {
 			return playerActions, err
 		}
 
 		// re-query to get updated player actions after turn end
-		playerActions, err = queryPlayersWithActionsLeft(tx, cfg.ActionsPerTurnHoldingsDivisor)
+		playerActions, err = queryPlayersWithActionsLeft(g, tx, cfg.ActionsPerTurnHoldingsDivisor)
 		if err != nil {
 			return nil, err
 		}
@@ -129,25 +134,18 @@ func PlayersWithActionsLeft(tx *sql.Tx) (map[string]PlayerActions, error) {
 	return playerActions, nil
 }
 
-// HasTurnDurationExpired returns true if the turn duration has expired based on the last action timestamp.
+// HasTurnDurationExpired returns true if the game's turn duration has expired based on the last action timestamp.
 // if turnDuration is empty or unset, it always returns false (no time limit)
-func HasTurnDurationExpired(tx *sql.Tx) (bool, error) {
-	cfg, err := config.GetConfig()
-	if err != nil {
-		return false, err
-	}
-
+func HasTurnDurationExpired(g *game.Game, tx *sql.Tx) (bool, error) {
+	cfg := g.Config()
 	if cfg.TurnDuration <= 0 {
 		return false, nil // turns have no time limit if turnDuration is unset or empty
 	}
 
-	tdb, err := db.GetDB()
-	if err != nil {
-		return false, err
-	}
+	var err error
 	shouldCommit := tx == nil
 	if shouldCommit {
-		tx, err = tdb.Begin()
+		tx, err = g.DB().Begin()
 		if err != nil {
 			return false, err
 		}
@@ -156,14 +154,14 @@ func HasTurnDurationExpired(tx *sql.Tx) (bool, error) {
 
 	var lastTurnEndTimestamp db.SQLite3Timestamp
 	var actionCount int
-	err = tx.QueryRow("SELECT MAX(timestamp), COUNT(*) FROM v_new_turn_actions").Scan(&lastTurnEndTimestamp, &actionCount)
+	err = tx.QueryRow("SELECT MAX(timestamp), COUNT(*) FROM v_new_turn_actions WHERE game_id = ?", cfg.GameID).Scan(&lastTurnEndTimestamp, &actionCount)
 	if err != nil {
 		return false, err
 	}
 
 	if !lastTurnEndTimestamp.Valid || actionCount == 0 {
 		// return false, nil // No previous turn end time found
-		if err = tx.QueryRow("SELECT MIN(timestamp) FROM actions").Scan(&lastTurnEndTimestamp); err != nil {
+		if err = tx.QueryRow("SELECT MIN(timestamp) FROM actions WHERE game_id = ?", cfg.GameID).Scan(&lastTurnEndTimestamp); err != nil {
 			return false, err
 		}
 		if !lastTurnEndTimestamp.Valid {
@@ -175,29 +173,27 @@ func HasTurnDurationExpired(tx *sql.Tx) (bool, error) {
 	if !expired {
 		return false, nil
 	}
-	if err = EndTurn(TurnEndReasonTimeLimit, tx); err != nil {
+	if err = EndTurn(g, TurnEndReasonTimeLimit, tx); err != nil {
 		return false, err
 	}
 	return true, nil
 }
 
-// IsTurnDone checks if the turn is done based on the configuration and player actions. If all players are
+// IsTurnDone checks if the game's turn is done based on its configuration and player actions. If all players are
 // done or the turn duration has expired, it will insert a turn end entry and return true.
-func IsTurnDone(tx *sql.Tx) (bool, error) {
-	cfg, err := config.GetConfig()
-	if err != nil {
-		return false, err
-	}
+func IsTurnDone(g *game.Game, tx *sql.Tx) (bool, error) {
+	cfg := g.Config()
 	var shouldEndTurn bool
+	var err error
 	if cfg.TurnEndsWhenAllPlayersDone {
-		playerActions, err := PlayersWithActionsLeft(tx)
+		playerActions, err := PlayersWithActionsLeft(g, tx)
 		if err != nil {
 			return false, err
 		}
 		shouldEndTurn = len(playerActions) == 0
 	}
 	if !shouldEndTurn && cfg.TurnDuration > 0 {
-		if shouldEndTurn, err = HasTurnDurationExpired(tx); err != nil {
+		if shouldEndTurn, err = HasTurnDurationExpired(g, tx); err != nil {
 			return false, err
 		}
 	}
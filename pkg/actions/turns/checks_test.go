@@ -7,11 +7,12 @@ import (
 
 	"github.com/Eggbertx/territories-game/pkg/config"
 	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
 	"github.com/stretchr/testify/assert"
 )
 
-func setupTurnCheckDB(t *testing.T) *sql.DB {
-	_, err := config.GetTestingConfig(t)
+func setupTurnCheckDB(t *testing.T) *game.Game {
+	cfg, err := config.GetTestingConfig(t)
 	if !assert.NoError(t, err) {
 		t.FailNow()
 	}
@@ -20,6 +21,10 @@ func setupTurnCheckDB(t *testing.T) *sql.DB {
 	if !assert.NoError(t, err) {
 		t.FailNow()
 	}
+	g, err := game.New(cfg, tdb)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
 
 	_, err = tdb.Exec(`INSERT INTO nations (country_name, player, color) VALUES
 	('nation0', 'player0', '111'),
@@ -37,29 +42,30 @@ func setupTurnCheckDB(t *testing.T) *sql.DB {
 		t.FailNow()
 	}
 
-	if !assert.NoError(t, AddPlayerActionEntry(nil, "join", "player0", time.Date(2025, 1, 1, 1, 0, 0, 0, time.UTC))) {
+	if !assert.NoError(t, AddPlayerActionEntry(g, nil, "join", "player0", time.Date(2025, 1, 1, 1, 0, 0, 0, time.UTC))) {
 		t.FailNow()
 	}
-	if !assert.NoError(t, AddPlayerActionEntry(nil, "join", "player1", time.Date(2025, 1, 1, 2, 0, 0, 0, time.UTC))) {
+	if !assert.NoError(t, AddPlayerActionEntry(g, nil, "join", "player1", time.Date(2025, 1, 1, 2, 0, 0, 0, time.UTC))) {
 		t.FailNow()
 	}
-	if !assert.NoError(t, AddPlayerActionEntry(nil, "join", "player2", time.Date(2025, 1, 1, 3, 0, 0, 0, time.UTC))) {
+	if !assert.NoError(t, AddPlayerActionEntry(g, nil, "join", "player2", time.Date(2025, 1, 1, 3, 0, 0, 0, time.UTC))) {
 		t.FailNow()
 	}
 
-	return tdb
+	return g
 }
 
 func doTestAreAllPlayersFinished(t *testing.T, withTx bool) {
 	turnEndHandlers = nil
 	var turnEnds int
 	var turnEndReason TurnEndReason
-	RegisterTurnEndHandler(func(_ time.Time, reason TurnEndReason) error {
+	RegisterTurnEndHandler(func(_ *game.Game, _ time.Time, reason TurnEndReason) error {
 		turnEndReason = reason
 		turnEnds++
 		return nil
 	})
-	tdb := setupTurnCheckDB(t)
+	g := setupTurnCheckDB(t)
+	tdb := g.DB()
 	defer db.CloseDB()
 	var tx *sql.Tx
 	if withTx {
@@ -70,7 +76,7 @@ func doTestAreAllPlayersFinished(t *testing.T, withTx bool) {
 		}
 		defer tx.Rollback()
 	}
-	playersWithActions, err := PlayersWithActionsLeft(tx)
+	playersWithActions, err := PlayersWithActionsLeft(g, tx)
 	if !assert.NoError(t, err, "Failed to get players with actions left") {
 		t.FailNow()
 	}
@@ -98,7 +104,7 @@ func doTestAreAllPlayersFinished(t *testing.T, withTx bool) {
 		t.FailNow()
 	}
 
-	playersWithActions, err = PlayersWithActionsLeft(tx)
+	playersWithActions, err = PlayersWithActionsLeft(g, tx)
 	if !assert.NoError(t, err) {
 		t.FailNow()
 	}
@@ -110,10 +116,10 @@ func doTestAreAllPlayersFinished(t *testing.T, withTx bool) {
 		t.FailNow()
 	}
 
-	if !assert.NoError(t, AddPlayerActionEntry(tx, "move", "player0", time.Date(2025, 1, 1, 5, 0, 0, 0, time.UTC))) {
+	if !assert.NoError(t, AddPlayerActionEntry(g, tx, "move", "player0", time.Date(2025, 1, 1, 5, 0, 0, 0, time.UTC))) {
 		t.FailNow()
 	}
-	playersWithActions, err = PlayersWithActionsLeft(tx)
+	playersWithActions, err = PlayersWithActionsLeft(g, tx)
 	if !assert.NoError(t, err) {
 		t.FailNow()
 	}
@@ -121,14 +127,14 @@ func doTestAreAllPlayersFinished(t *testing.T, withTx bool) {
 		t.FailNow()
 	}
 
-	if !assert.NoError(t, AddPlayerActionEntry(tx, "move", "player1", time.Date(2025, 1, 1, 6, 0, 0, 0, time.UTC))) {
+	if !assert.NoError(t, AddPlayerActionEntry(g, tx, "move", "player1", time.Date(2025, 1, 1, 6, 0, 0, 0, time.UTC))) {
 		t.FailNow()
 	}
-	if !assert.NoError(t, AddPlayerActionEntry(tx, "move", "player2", time.Date(2025, 1, 1, 7, 0, 0, 0, time.UTC))) {
+	if !assert.NoError(t, AddPlayerActionEntry(g, tx, "move", "player2", time.Date(2025, 1, 1, 7, 0, 0, 0, time.UTC))) {
 		t.FailNow()
 	}
 
-	playersWithActions, err = PlayersWithActionsLeft(tx)
+	playersWithActions, err = PlayersWithActionsLeft(g, tx)
 	if !assert.NoError(t, err) {
 		t.FailNow()
 	}
@@ -139,13 +145,13 @@ func doTestAreAllPlayersFinished(t *testing.T, withTx bool) {
 	// assert.Equal(t, 2, playersWithActions["player2"].MaxActions, "player2 should have 2 actions per-turn")
 	assert.Equal(t, 1, playersWithActions["player2"].ActionsCompleted, "player2 should have completed 1 action")
 
-	if !assert.NoError(t, AddTurnEndActionEntry(time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC), tx)) {
+	if !assert.NoError(t, AddTurnEndActionEntry(g, time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC), tx)) {
 		t.FailNow()
 	}
-	if !assert.NoError(t, AddPlayerActionEntry(tx, "move", "player0", time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC))) {
+	if !assert.NoError(t, AddPlayerActionEntry(g, tx, "move", "player0", time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC))) {
 		t.FailNow()
 	}
-	if !assert.NoError(t, AddPlayerActionEntry(tx, "move", "player1", time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC))) {
+	if !assert.NoError(t, AddPlayerActionEntry(g, tx, "move", "player1", time.Date(2025, 1, 1, 10, 0, 0, 0, time.UTC))) {
 		t.FailNow()
 	}
 
@@ -177,3 +183,57 @@ func TestAreAllPlayersFinished(t *testing.T) {
 		doTestAreAllPlayersFinished(t, false)
 	})
 }
+
+func TestRegionBonus(t *testing.T) {
+	if !config.HasSQLiteMathFunctions {
+		t.Skip("Skipping test because the sqlite_math_functions build tag is not enabled")
+	}
+
+	config.CloseTestingConfig(t)
+	cfg, err := config.GetTestingConfig(t)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cfg.TurnDuration = 0
+	cfg.Regions = []config.Region{
+		{Name: "Great Basin", Territories: []string{"Nevada", "UT"}, Bonus: 2},
+		{Name: "West Coast", Territories: []string{"CA", "OR"}, Bonus: 1},
+	}
+	if !assert.NoError(t, config.SetConfig(cfg)) {
+		t.FailNow()
+	}
+	defer config.CloseTestingConfig(t)
+	assert.Equal(t, []string{"NV", "UT"}, cfg.Regions[0].Territories, "expected region territories to be resolved to abbreviations")
+
+	g := setupTurnCheckDB(t)
+	defer db.CloseDB()
+	// player1 takes Utah from player2, controlling the Great Basin
+	if _, err = g.DB().Exec(`UPDATE holdings SET nation_id = 2 WHERE territory = 'UT'`); !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	testCases := []struct {
+		player        string
+		expectActions int
+	}{
+		{player: "player0", expectActions: 1},
+		{player: "player1", expectActions: 3},
+		{player: "player2", expectActions: 0},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.player, func(t *testing.T) {
+			actions, err := MaxPlayerActionsPerTurn(g, tc.player, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectActions, actions)
+		})
+	}
+
+	playersWithActions, err := PlayersWithActionsLeft(g, nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	// each player's join counts towards the first turn, only player1 has bonus actions left
+	assert.Equal(t, map[string]PlayerActions{
+		"player1": {ActionsCompleted: 1, MaxActions: 3},
+	}, playersWithActions)
+}
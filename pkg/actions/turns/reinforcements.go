@@ -0,0 +1,89 @@
+package turns
+
+import (
+	"database/sql"
+	"maps"
+	"math"
+	"slices"
+
+	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
+)
+
+// ReinforcementIncome returns the number of armies each player in the game is granted when the current turn ends if
+// reinforcements are enabled, based on the number of territories they hold and the regions they control
+func ReinforcementIncome(g *game.Game, tx *sql.Tx) (map[string]int, error) {
+	cfg := g.Config()
+	divisor := cfg.ReinforcementsHoldingsDivisor
+	if divisor <= 0 {
+		divisor = 3
+	}
+	var err error
+	shouldCommit := tx == nil
+	if shouldCommit {
+		tx, err = g.DB().Begin()
+		if err != nil {
+			return nil, err
+		}
+		defer tx.Rollback()
+	}
+
+	rows, err := tx.Query("SELECT player, COUNT(*) FROM v_nation_holdings WHERE game_id = ? AND player <> ? GROUP BY player",
+		g.ID(), db.NeutralPlayer)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	income := make(map[string]int)
+	for rows.Next() {
+		var player string
+		var holdings int
+		if err = rows.Scan(&player, &holdings); err != nil {
+			return nil, err
+		}
+		income[player] = int(math.Ceil(float64(holdings) / divisor))
+	}
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+
+	bonuses, err := regionBonuses(g, tx, "")
+	if err != nil {
+		return nil, err
+	}
+	for player, bonus := range bonuses {
+		income[player] += bonus
+	}
+
+	if shouldCommit {
+		if err = tx.Commit(); err != nil {
+			return income, err
+		}
+	}
+	return income, nil
+}
+
+// grantReinforcements adds each player's reinforcement income to their nation's undeployed reinforcements, returning
+// the players whose nations were changed
+func grantReinforcements(g *game.Game, tx *sql.Tx) ([]string, error) {
+	income, err := ReinforcementIncome(g, tx)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := tx.Prepare("UPDATE nations SET reinforcements = reinforcements + ? WHERE game_id = ? AND player = ?")
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	var players []string
+	for _, player := range slices.Sorted(maps.Keys(income)) {
+		if income[player] <= 0 {
+			continue
+		}
+		if _, err = stmt.Exec(income[player], g.ID(), player); err != nil {
+			return nil, err
+		}
+		players = append(players, player)
+	}
+	return players, stmt.Close()
+}
@@ -7,32 +7,38 @@ import (
 
 	"github.com/Eggbertx/territories-game/pkg/config"
 	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
 )
 
 var (
-	turnEndHandlers []func(time.Time, TurnEndReason) error
+	turnEndHandlers []func(*game.Game, time.Time, TurnEndReason) error
+	orderResolver   func(*game.Game, *sql.Tx) error
 )
 
-// RegisterTurnEndHandler registers a function to be called when a turn ends, passing to it the timestamp
-// and the reason for the turn ending.
-func RegisterTurnEndHandler(handler func(time.Time, TurnEndReason) error) {
+// RegisterTurnEndHandler registers a function to be called when a turn ends in any game, passing to it the game,
+// the timestamp, and the reason for the turn ending.
+func RegisterTurnEndHandler(handler func(*game.Game, time.Time, TurnEndReason) error) {
 	turnEndHandlers = append(turnEndHandlers, handler)
 }
 
-// CurrentTurnStarted returns the timestamp of the current turn's start time and whether the current turn is the first turn
-func CurrentTurnStarted() (time.Time, bool, error) {
+// SetOrderResolver sets the function called by EndTurn with its transaction to resolve the orders submitted during the
+// turn in games using simultaneous resolution, before the turn end is logged. It is set by the actions package, which
+// applies the orders
+func SetOrderResolver(resolver func(*game.Game, *sql.Tx) error) {
+	orderResolver = resolver
+}
+
+// CurrentTurnStarted returns the timestamp of the game's current turn's start time and whether the current turn is the first turn
+func CurrentTurnStarted(g *game.Game) (time.Time, bool, error) {
 	// var turnTimestampStr sql.NullString
 	var turnTimestamp db.SQLite3Timestamp
-	tdb, err := db.GetDB()
-	if err != nil {
-		return turnTimestamp.Time, false, err
-	}
-	stmt, err := tdb.Prepare("SELECT MAX(timestamp) FROM v_new_turn_actions")
+	tdb := g.DB()
+	stmt, err := tdb.Prepare("SELECT MAX(timestamp) FROM v_new_turn_actions WHERE game_id = ?")
 	if err != nil {
 		return turnTimestamp.Time, false, err
 	}
 	defer stmt.Close()
-	if err = stmt.QueryRow().Scan(&turnTimestamp); err != nil {
+	if err = stmt.QueryRow(g.ID()).Scan(&turnTimestamp); err != nil {
 		return turnTimestamp.Time, false, err
 	}
 	if err = stmt.Close(); err != nil {
@@ -42,12 +48,12 @@ func CurrentTurnStarted() (time.Time, bool, error) {
 	firstTurn := turnTimestamp.Time.IsZero()
 	if firstTurn {
 		// still on the first turn, get the first action and use its timestamp
-		stmt, err = tdb.Prepare("SELECT MIN(timestamp) FROM actions")
+		stmt, err = tdb.Prepare("SELECT MIN(timestamp) FROM actions WHERE game_id = ?")
 		if err != nil {
 			return turnTimestamp.Time, firstTurn, err
 		}
 		defer stmt.Close()
-		if err = stmt.QueryRow().Scan(&turnTimestamp); err != nil {
+		if err = stmt.QueryRow(g.ID()).Scan(&turnTimestamp); err != nil {
 			return turnTimestamp.Time, firstTurn, err
 		}
 		if err = stmt.Close(); err != nil {
@@ -58,54 +64,91 @@ func CurrentTurnStarted() (time.Time, bool, error) {
 	return turnTimestamp.Time, firstTurn, nil
 }
 
-// MaxPlayerActionsPerTurn calculates the number of actions a player can take per turn based on their holdings and the configured divisor.
-// If the player does not have any holdings, it returns 0.
-func MaxPlayerActionsPerTurn(player string, tx *sql.Tx) (int, error) {
-	cfg, err := config.GetConfig()
-	if err != nil {
-		return 0, err
-	}
+// MaxPlayerActionsPerTurn calculates the number of actions a player can take per turn based on their holdings and the configured divisor,
+// plus the bonus of each configured region the player controls. If the player does not have any holdings, it returns 0.
+func MaxPlayerActionsPerTurn(g *game.Game, player string, tx *sql.Tx) (int, error) {
+	cfg := g.Config()
 	divisor := cfg.ActionsPerTurnHoldingsDivisor
 	if divisor <= 0 {
 		cfg.ActionsPerTurnHoldingsDivisor = 3
 		divisor = 3
 	}
 	var holdings int
-	db, err := db.GetDB()
-	if err != nil {
-		return 0, err
-	}
+	var err error
 	shouldCommit := tx == nil
 	if shouldCommit {
-		tx, err = db.Begin()
+		tx, err = g.DB().Begin()
 		if err != nil {
 			return 0, err
 		}
 		defer tx.Rollback()
 	}
 
-	stmt, err := tx.Prepare("SELECT COUNT(*) FROM v_nation_holdings WHERE player = ?")
+	stmt, err := tx.Prepare("SELECT COUNT(*) FROM v_nation_holdings WHERE game_id = ? AND player = ?")
 	if err != nil {
 		return 0, err
 	}
 	defer stmt.Close()
-	if err = stmt.QueryRow(player).Scan(&holdings); err != nil {
+	if err = stmt.QueryRow(cfg.GameID, player).Scan(&holdings); err != nil {
 		return 0, err
 	}
 	if err = stmt.Close(); err != nil {
 		return 0, err
 	}
+	bonuses, err := regionBonuses(g, tx, player)
+	if err != nil {
+		return 0, err
+	}
 	if shouldCommit {
 		if err = tx.Commit(); err != nil {
 			return 0, err
 		}
 	}
-	return int(math.Ceil(float64(holdings) / divisor)), nil
+	return int(math.Ceil(float64(holdings)/divisor)) + bonuses[player], nil
+}
+
+// regionBonuses returns the total bonus of the configured regions controlled by each player in the game that
+// controls at least one (other than the neutral nation), or only by the given player if player is not empty
+func regionBonuses(g *game.Game, tx *sql.Tx, player string) (map[string]int, error) {
+	cfg := g.Config()
+	if len(cfg.Regions) == 0 {
+		return nil, nil
+	}
+	query := "SELECT player, territory FROM v_nation_holdings WHERE game_id = ? AND player <> ?"
+	args := []any{g.ID(), db.NeutralPlayer}
+	if player != "" {
+		query += " AND player = ?"
+		args = append(args, player)
+	}
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	holdings := make(map[string][]string)
+	for rows.Next() {
+		var holder, territory string
+		if err = rows.Scan(&holder, &territory); err != nil {
+			return nil, err
+		}
+		holdings[holder] = append(holdings[holder], territory)
+	}
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+
+	bonuses := make(map[string]int)
+	for holder, territories := range holdings {
+		if bonus, _ := cfg.RegionBonus(territories); bonus > 0 {
+			bonuses[holder] = bonus
+		}
+	}
+	return bonuses, nil
 }
 
 // PlayerActionsRemaining returns the number of actions a player can still take in the current turn.
-func PlayerActionsRemaining(player string, tx *sql.Tx) (int, error) {
-	playersWithActions, err := PlayersWithActionsLeft(tx)
+func PlayerActionsRemaining(g *game.Game, player string, tx *sql.Tx) (int, error) {
+	playersWithActions, err := PlayersWithActionsLeft(g, tx)
 	if err != nil {
 		return 0, err
 	}
@@ -115,58 +158,94 @@ func PlayerActionsRemaining(player string, tx *sql.Tx) (int, error) {
 	return 0, nil
 }
 
-// EndTurn ends the current turn, inserting a new action with is_new_turn set to true, and calling all registered turn end handlers.
-// This is mainly used by the game when all players have used their available actions or the time limit has been reached
-func EndTurn(reason TurnEndReason, tx *sql.Tx) error {
+// EndTurn ends the game's current turn, resolving the orders submitted during the turn if the game uses simultaneous
+// resolution, inserting a new action with is_new_turn set to true, granting each nation its reinforcements if they are
+// enabled, checking the game's victory conditions, and calling all registered turn end handlers. This is mainly used by
+// the game when all players have used their available actions or the time limit has been reached. Turns don't end once
+// the game has been won, including by the resolved orders
+func EndTurn(g *game.Game, reason TurnEndReason, tx *sql.Tx) error {
+	var err error
+	shouldCommit := tx == nil
+	if shouldCommit {
+		tx, err = g.DB().Begin()
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+	}
+
+	victory, err := db.GetVictory(g.DB(), tx, g.ID())
+	if err != nil || victory != nil {
+		return err
+	}
+	if orderResolver != nil && g.Config().ResolutionMode == config.ResolutionSimultaneous {
+		if err = orderResolver(g, tx); err != nil {
+			return err
+		}
+		if victory, err = db.GetVictory(g.DB(), tx, g.ID()); err != nil {
+			return err
+		}
+		if victory != nil {
+			if shouldCommit {
+				return tx.Commit()
+			}
+			return nil
+		}
+	}
+
 	now := time.Now()
-	err := AddTurnEndActionEntry(now, tx)
-	if err != nil {
+	record := &db.ActionRecord{
+		ActionType: "end_turn",
+		IsNewTurn:  true,
+		Timestamp:  now,
+	}
+	if g.Config().DoReinforcements {
+		players, err := grantReinforcements(g, tx)
+		if err != nil {
+			return err
+		}
+		if len(players) > 0 {
+			if record.Changes, err = db.CaptureStateChanges(tx, g.ID(), players, nil); err != nil {
+				return err
+			}
+		}
+	}
+	if err = addActionEntry(g, tx, record); err != nil {
+		return err
+	}
+	if _, err = db.CheckVictory(tx, g.Config()); err != nil {
 		return err
 	}
 
 	for _, handler := range turnEndHandlers {
-		if err = handler(now, reason); err != nil {
+		if err = handler(g, now, reason); err != nil {
 			return err
 		}
 	}
 
+	if shouldCommit {
+		return tx.Commit()
+	}
 	return nil
 }
 
-func addActionEntry(tx *sql.Tx, actionType string, player string, timestamp time.Time) error {
+func addActionEntry(g *game.Game, tx *sql.Tx, record *db.ActionRecord) error {
 	shouldCommit := tx == nil
 	if shouldCommit {
-		db, err := db.GetDB()
-		if err != nil {
-			return err
-		}
-		tx, err = db.Begin()
+		var err error
+		tx, err = g.DB().Begin()
 		if err != nil {
 			return err
 		}
 		defer tx.Rollback()
 	}
 
-	var stmt *sql.Stmt
-	var err error
-	var args []any
-	if player == "" {
-		stmt, err = tx.Prepare("INSERT INTO actions (action_type, timestamp, is_new_turn) VALUES ('end_turn', ?, 1)")
-		args = []any{timestamp}
-	} else {
-		stmt, err = tx.Prepare(`INSERT INTO actions (action_type, nation_id, timestamp)
-			VALUES (?, (SELECT id FROM nations WHERE player = ?), ?)`)
-		args = []any{actionType, player, timestamp}
-	}
-	if err != nil {
-		return err
-	}
-	defer stmt.Close()
-	if _, err = stmt.Exec(args...); err != nil {
+	record.GameID = g.ID()
+	if err := db.InsertActionRecord(tx, record); err != nil {
 		return err
 	}
 
-	if _, err = HasTurnDurationExpired(tx); err != nil {
+	if _, err := HasTurnDurationExpired(g, tx); err != nil {
 		return err
 	}
 
@@ -176,14 +255,40 @@ func addActionEntry(tx *sql.Tx, actionType string, player string, timestamp time
 	return nil
 }
 
-// AddPlayerActionEntry adds a new row in the actions table representing a turn action taken by a player.
+// AddPlayerActionEntry adds a new row in the actions table representing a turn action taken by a player in the game.
 // It is assumed that this will be run at the end of an action handler function, after all necessary checks
 // have been made
-func AddPlayerActionEntry(tx *sql.Tx, actionType string, player string, timestamp time.Time) error {
-	return addActionEntry(tx, actionType, player, timestamp)
+func AddPlayerActionEntry(g *game.Game, tx *sql.Tx, actionType string, player string, timestamp time.Time) error {
+	return AddPlayerActionRecord(g, tx, &db.ActionRecord{
+		ActionType: actionType,
+		Player:     player,
+		Timestamp:  timestamp,
+	})
+}
+
+// AddPlayerActionRecord is like AddPlayerActionEntry, but adds the given record to the action log, including its
+// details and state changes
+func AddPlayerActionRecord(g *game.Game, tx *sql.Tx, record *db.ActionRecord) error {
+	record.TurnAction = true
+	record.IsNewTurn = false
+	return addActionEntry(g, tx, record)
+}
+
+// InsertPlayerActionRecord is like AddPlayerActionRecord, but doesn't check if the turn's time limit has passed, so the
+// turn can't end while it is being used. It is used for the steps of actions made up of several actions, which check if
+// the turn is done once all of the steps have been logged
+func InsertPlayerActionRecord(g *game.Game, tx *sql.Tx, record *db.ActionRecord) error {
+	record.GameID = g.ID()
+	record.TurnAction = true
+	record.IsNewTurn = false
+	return db.InsertActionRecord(tx, record)
 }
 
-// AddTurnEndActionEntry adds a new row in the actions table representing the end of a turn.
-func AddTurnEndActionEntry(timestamp time.Time, tx *sql.Tx) error {
-	return addActionEntry(tx, "end_turn", "", timestamp)
+// AddTurnEndActionEntry adds a new row in the actions table representing the end of the game's turn.
+func AddTurnEndActionEntry(g *game.Game, timestamp time.Time, tx *sql.Tx) error {
+	return addActionEntry(g, tx, &db.ActionRecord{
+		ActionType: "end_turn",
+		IsNewTurn:  true,
+		Timestamp:  timestamp,
+	})
 }
@@ -2,57 +2,96 @@ package actions
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
-	"math/rand"
-	"testing"
+	"sync"
 	"time"
 
 	"github.com/Eggbertx/territories-game/pkg/actions/turns"
 	"github.com/Eggbertx/territories-game/pkg/config"
 	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
 )
 
-func randInt(max int) int {
-	if testing.Testing() && useTestInt {
-		return int(math.Min(float64(testInt), float64(max))) - 1
+// SetRandomSource sets the source of random numbers used by actions done with DoAction, for example to use a
+// predetermined sequence in tests or simulations. If src is nil, the game's seeded random source stored in the database
+// is used. Actions done with Do use the source set with (*game.Game).SetRandomSource instead.
+func SetRandomSource(src db.RandomSource) {
+	randomSourceOverride = src
+}
+
+var (
+	// compatGames are the handles used by actions done with DoAction, by game configuration, so that the configuration
+	// isn't validated and the game isn't initialized again for every action
+	compatGames     = map[*config.Config]*game.Game{}
+	compatGamesLock sync.Mutex
+)
+
+// compatGame returns a handle for the game the action is done in using the given database, for actions done with
+// DoAction. The handle is reused by later actions in the same game and database
+func compatGame(ref GameRef, tdb *sql.DB) (*game.Game, error) {
+	cfg, err := gameConfig(ref)
+	if err != nil {
+		return nil, err
+	}
+	compatGamesLock.Lock()
+	defer compatGamesLock.Unlock()
+	g, ok := compatGames[cfg]
+	if !ok || g.DB() != tdb {
+		if g, err = game.New(cfg, tdb); err != nil {
+			return nil, err
+		}
+		// the games are all stored in the active configuration's database, so handles using another one are stale
+		for c, cached := range compatGames {
+			if cached.DB() != tdb {
+				delete(compatGames, c)
+			}
+		}
+		compatGames[cfg] = g
 	}
-	return rand.Intn(max)
+	g.SetRandomSource(randomSourceOverride)
+	return g, nil
 }
 
-func checkIfEnoughPlayersToStart(tx *sql.Tx, cfg *config.Config, logger config.LoggerFunc) error {
-	if cfg == nil {
-		var err error
-		cfg, err = config.GetConfig()
-		if err != nil {
-			logger("Unable to get configuration", "error", err)
-			return err
+// gameConfig returns the configuration of the game the action is done in. An unknown game is logged using the
+// default game's logger and returned as an *ActionError since it is usually caused by an invalid request
+func gameConfig(ref GameRef) (*config.Config, error) {
+	cfg, err := config.GetGameConfig(ref.GameID)
+	if errors.Is(err, config.ErrUnknownGame) {
+		if defaultCfg, cfgErr := config.GetConfig(); cfgErr == nil {
+			defaultCfg.LogError("Unable to get game configuration", "gameID", ref.GameID, "error", err)
 		}
+		return nil, &ActionError{err: err}
 	}
+	return cfg, err
+}
 
+func checkIfEnoughPlayersToStart(g *game.Game, tx *sql.Tx) error {
+	cfg := g.Config()
+	logger := g.LogError
+	if err := checkSetupDone(g, tx); err != nil {
+		return err
+	}
 	if cfg.MinimumNationsToStart < 2 {
 		return nil
 	}
 
-	enough, numPlayers, err := db.EnoughPlayersToStart(tx)
+	enough, numPlayers, err := db.EnoughPlayersToStart(g.DB(), tx, cfg)
 	if err != nil {
 		logger("Unable to check if enough players are joined", "error", err)
 		return err
 	}
 
 	if !enough {
-		const gameStartedQuery = `SELECT COUNT(*) FROM actions WHERE action_type NOT IN ('end_turn', 'join')`
+		const gameStartedQuery = `SELECT COUNT(*) FROM actions
+			WHERE game_id = ? AND turn_action = 1 AND action_type NOT IN ('end_turn', 'join')`
 		var numActionsTaken int
 		var row *sql.Row
 		if tx != nil {
-			row = tx.QueryRow(gameStartedQuery)
+			row = tx.QueryRow(gameStartedQuery, cfg.GameID)
 		} else {
-			db, err := db.GetDB()
-			if err != nil {
-				logger("Unable to get database connection", "error", err)
-				return err
-			}
-			row = db.QueryRow(gameStartedQuery)
+			row = g.DB().QueryRow(gameStartedQuery, cfg.GameID)
 		}
 
 		if err = row.Scan(&numActionsTaken); err != nil {
@@ -75,17 +114,11 @@ func checkIfEnoughPlayersToStart(tx *sql.Tx, cfg *config.Config, logger config.L
 	return nil
 }
 
-func checkReturnsRemainingIfManaging(tx *sql.Tx, user string, cfg *config.Config, logger config.LoggerFunc) error {
-	var err error
-	if cfg == nil {
-		cfg, err = config.GetConfig()
-		if err != nil {
-			logger("Unable to get configuration", "error", err)
-			return err
-		}
-	}
+func checkReturnsRemainingIfManaging(g *game.Game, tx *sql.Tx, user string) error {
+	cfg := g.Config()
+	logger := g.LogError
 	if cfg.DoTurnManagement {
-		actionsRemaining, err := turns.PlayerActionsRemaining(user, tx)
+		actionsRemaining, err := turns.PlayerActionsRemaining(g, user, tx)
 		if err != nil {
 			logger("Unable to get player actions remaining", "error", err)
 			return err
@@ -100,7 +133,7 @@ func checkReturnsRemainingIfManaging(tx *sql.Tx, user string, cfg *config.Config
 			}
 
 			// check if turn duration has expired
-			shouldEndTurn, err := turns.HasTurnDurationExpired(tx)
+			shouldEndTurn, err := turns.HasTurnDurationExpired(g, tx)
 			if err != nil {
 				logger("Unable to check if turn duration has expired", "error", err)
 				return err
@@ -118,17 +151,147 @@ func checkReturnsRemainingIfManaging(tx *sql.Tx, user string, cfg *config.Config
 	return nil
 }
 
-func addTurnEntryIfManaging(tx *sql.Tx, user string, actionType string) error {
-	cfg, err := config.GetConfig()
+// stateChanger is implemented by the results of actions that change nations or holdings
+type stateChanger interface {
+	// changed returns the players whose nations and the territories (names or abbreviations) whose holdings may have
+	// been changed by the action
+	changed() (players []string, territories []string)
+}
+
+// actionCoster is implemented by the results of actions that may use more than one of the player's actions for the turn
+type actionCoster interface {
+	// actionCost returns the number of the player's actions for the turn that the action uses
+	actionCost() int
+}
+
+// privateResult is implemented by the results of actions whose outcome should only be known to the player doing them
+type privateResult interface {
+	// loggedDetails returns the details of the action that can be recorded in the shared action log
+	loggedDetails() any
+}
+
+// checkActionCost returns an *ActionError if turn management is enabled and the player doesn't have enough actions
+// remaining in the current turn for an action that uses the given number of actions. Actions using one action are
+// checked by checkReturnsRemainingIfManaging
+func checkActionCost(g *game.Game, tx *sql.Tx, user string, cost int) error {
+	cfg := g.Config()
+	if !cfg.DoTurnManagement || cost <= 1 {
+		return nil
+	}
+	actionsRemaining, err := turns.PlayerActionsRemaining(g, user, tx)
 	if err != nil {
+		cfg.LogError("Unable to get player actions remaining", "error", err)
 		return err
 	}
-	if cfg.DoTurnManagement {
-		if err := turns.AddPlayerActionEntry(tx, actionType, user, time.Now()); err != nil {
-			cfg.LogError("Unable to add player action entry", "error", err)
+	if actionsRemaining > 0 && actionsRemaining < cost {
+		err = &ActionError{
+			msg: fmt.Sprintf("not enough actions remaining for player %s, %d required, %d remaining", user, cost, actionsRemaining),
+		}
+		cfg.LogError("Not enough actions remaining", "player", user, "cost", cost, "remaining", actionsRemaining, "error", err)
+		return err
+	}
+	return nil
+}
+
+// checkPassable returns an *ActionError if the territory is impassable
+func checkPassable(g *game.Game, territory *config.Territory) error {
+	if !territory.Impassable {
+		return nil
+	}
+	err := &ActionError{msg: fmt.Sprintf("%s is impassable", territory.Name)}
+	g.LogError("Territory is impassable", "territory", territory.Name, "error", err)
+	return err
+}
+
+// queryHoldings returns the holdings in the game using the given transaction
+func queryHoldings(tx *sql.Tx, cfg *config.Config) ([]db.HoldingRecord, error) {
+	rows, err := tx.Query(`SELECT territory, army_size, player, country_name FROM v_nation_holdings WHERE game_id = ? ORDER BY id`,
+		cfg.GameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var holdings []db.HoldingRecord
+	for rows.Next() {
+		var holding db.HoldingRecord
+		if err = rows.Scan(&holding.Territory, &holding.ArmySize, &holding.Player, &holding.CountryName); err != nil {
+			return nil, err
+		}
+		holdings = append(holdings, holding)
+	}
+	return holdings, rows.Close()
+}
+
+// logAction adds the result of a successful action to the game's action log, including the JSON representation of its
+// inputs and outcome and the resulting state of any nations and holdings it changed. Only part of the details is logged
+// if the result implements privateResult. If turnAction is true and turn management is enabled, the action counts
+// towards the player's actions for the current turn. It uses more than one of them if the result implements
+// actionCoster. The game's victory conditions are checked afterwards. If the action ended the game, the victory is set
+// in the result.
+func logAction(g *game.Game, tx *sql.Tx, result ActionResult, turnAction bool) error {
+	return logActionUsing(g, tx, result, turnAction, turns.AddPlayerActionRecord)
+}
+
+// logActionUsing is logAction with the function that adds the record to the log if it counts towards the player's
+// actions for the turn
+func logActionUsing(g *game.Game, tx *sql.Tx, result ActionResult, turnAction bool,
+	addTurnAction func(*game.Game, *sql.Tx, *db.ActionRecord) error) error {
+	cfg := g.Config()
+	var err error
+	record := &db.ActionRecord{
+		GameID:     cfg.GameID,
+		ActionType: result.ActionType(),
+		Player:     result.User(),
+		TurnAction: turnAction,
+		Timestamp:  time.Now(),
+	}
+	if coster, ok := result.(actionCoster); ok {
+		record.Cost = coster.actionCost()
+	}
+	var details any = result
+	if private, ok := result.(privateResult); ok {
+		details = private.loggedDetails()
+	}
+	if record.Details, err = json.Marshal(details); err != nil {
+		cfg.LogError("Unable to encode action details", "error", err)
+		return err
+	}
+
+	if sc, ok := result.(stateChanger); ok {
+		players, territories := sc.changed()
+		abbreviations := make([]string, 0, len(territories))
+		for _, territory := range territories {
+			resolved, err := cfg.ResolveTerritory(territory)
+			if err != nil {
+				cfg.LogError("Unable to resolve changed territory", "territory", territory, "error", err)
+				return err
+			}
+			abbreviations = append(abbreviations, resolved.Abbreviation)
+		}
+		if record.Changes, err = db.CaptureStateChanges(tx, cfg.GameID, players, abbreviations); err != nil {
+			cfg.LogError("Unable to get changed game state", "error", err)
 			return err
 		}
 	}
+
+	if cfg.DoTurnManagement && turnAction {
+		err = addTurnAction(g, tx, record)
+	} else {
+		err = db.InsertActionRecord(tx, record)
+	}
+	if err != nil {
+		cfg.LogError("Unable to add action log entry", "error", err)
+		return err
+	}
+
+	victory, err := db.CheckVictory(tx, cfg)
+	if err != nil {
+		cfg.LogError("Unable to check victory conditions", "error", err)
+		return err
+	}
+	if ender, ok := result.(gameEnder); ok && victory != nil {
+		ender.setVictory(&VictoryResult{Victory: *victory})
+	}
 	return nil
 }
 
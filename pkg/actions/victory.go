@@ -0,0 +1,69 @@
+package actions
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
+)
+
+var (
+	// ErrGameOver is wrapped by the *ActionError returned by actions done after the game has been won
+	ErrGameOver = errors.New("the game is over")
+
+	victoryConditionStrings = map[string]string{
+		db.VictoryLastNationStanding: "as the last nation standing",
+		db.VictoryTerritoryPercent:   "by holding enough of the territories",
+		db.VictoryTerritories:        "by holding all of the victory territories",
+		db.VictoryTurnLimit:          "by holding the most territories when the last turn ended",
+	}
+)
+
+// VictoryResult announces the winner of the game. It is set in the result of the action that ended the game (see
+// GameOver), and is logged in the action log with the "victory" action type
+type VictoryResult struct {
+	db.Victory
+}
+
+func (vr *VictoryResult) ActionType() string {
+	return "victory"
+}
+
+func (vr *VictoryResult) User() string {
+	return vr.Winner
+}
+
+func (vr *VictoryResult) String() string {
+	return fmt.Sprintf("%s (led by %s) has won the game %s", vr.CountryName, vr.Winner, victoryConditionStrings[vr.Condition])
+}
+
+// gameEnder is implemented by action results that can hold the victory of the action that ended the game
+type gameEnder interface {
+	victory() *VictoryResult
+	setVictory(victory *VictoryResult)
+}
+
+// GameOver returns the victory announcement if the action that returned the result ended the game, or nil otherwise
+func GameOver(result ActionResult) *VictoryResult {
+	if ender, ok := result.(gameEnder); ok {
+		return ender.victory()
+	}
+	return nil
+}
+
+// checkGameOver returns an *ActionError wrapping ErrGameOver if the game has been won
+func checkGameOver(g *game.Game) error {
+	cfg := g.Config()
+	victory, err := db.GetVictory(g.DB(), nil, cfg.GameID)
+	if err != nil {
+		cfg.LogError("Unable to check if the game is over", "error", err)
+		return err
+	}
+	if victory != nil {
+		err = &ActionError{err: fmt.Errorf("%w, %s won", ErrGameOver, victory.CountryName)}
+		cfg.LogError("Unable to do action", "error", err)
+		return err
+	}
+	return nil
+}
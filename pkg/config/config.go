@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"maps"
 	"path"
 	"slices"
 	"strings"
@@ -15,11 +16,68 @@ const (
 	defaultInitialArmies                 = 3
 	defaultMinimumNationsToStart         = 2
 	defaultActionsPerTurnHoldingsDivisor = 3.0
+	defaultReinforcementsHoldingsDivisor = 3.0
+	defaultNeutralNationName             = "Neutral"
+	defaultNeutralColor                  = "808080"
+	defaultStartingArmies                = 20
+	defaultScoutRange                    = 2
+	defaultScoutSuccessPercent           = 75
+
+	// PNGRendererBuiltin is used to render the PNG output file with the built-in pure Go renderer
+	PNGRendererBuiltin = "builtin"
+	// PNGRendererFFmpeg is used to render the PNG output file with ffmpeg, which must be installed
+	PNGRendererFFmpeg = "ffmpeg"
+
+	// DefaultGameID is the ID of the game used by a configuration without a gameID
+	DefaultGameID int64 = 1
+
+	// LeavePolicyDelete removes the territories of a nation that leaves the game
+	LeavePolicyDelete = "delete"
+	// LeavePolicyNeutral gives the territories of a nation that leaves the game to the neutral nation, keeping their armies
+	LeavePolicyNeutral = "neutral"
+	// LeavePolicyHeir gives the territories of a nation that leaves the game to the nation named as its heir
+	LeavePolicyHeir = "heir"
+
+	// SetupModeClaim has each player choose the territory their nation starts in when they join the game
+	SetupModeClaim = "claim"
+	// SetupModeRandom deals all of the territories to the nations at random once enough nations have joined
+	SetupModeRandom = "random"
+	// SetupModeDraft has the nations pick the territories one at a time in the order they joined once enough nations
+	// have joined, until all of them have been picked
+	SetupModeDraft = "draft"
+
+	// CapitalLossNone only takes away the defense bonus of a nation's capital when its armies are destroyed, until the
+	// nation takes it back
+	CapitalLossNone = "none"
+	// CapitalLossEliminate removes a nation from the game when the armies in its capital are destroyed, giving its
+	// other territories to the nation that destroyed them
+	CapitalLossEliminate = "eliminate"
+	// CapitalLossCripple halves the armies in a nation's other territories and discards its reinforcements when the
+	// armies in its capital are destroyed
+	CapitalLossCripple = "cripple"
+
+	// ConnectionLand is an ordinary border between two territories, the same as listing them as neighbors
+	ConnectionLand = "land"
+	// ConnectionSea is a sea lane between two territories that can be crossed in either direction
+	ConnectionSea = "sea"
+	// ConnectionOneWay can only be crossed from the connection's From territory to its To territory
+	ConnectionOneWay = "oneWay"
+	// ConnectionRestricted can be attacked across in either direction, but armies can't be moved across it
+	ConnectionRestricted = "restricted"
+
+	// ResolutionImmediate applies each move, attack, and raise action as soon as it is done
+	ResolutionImmediate = "immediate"
+	// ResolutionSimultaneous stores move, attack, and raise actions as orders that are resolved together when the turn
+	// ends
+	ResolutionSimultaneous = "simultaneous"
 )
 
 var (
-	cfg                  *Config
+	cfg *Config
+	// games contains the configurations of the games other than the default game, by game ID
+	games                map[int64]*Config
 	ErrGameNotConfigured = fmt.Errorf("no active configuration has been set")
+	ErrUnknownGame       = fmt.Errorf("no configuration has been added for the game")
 )
 
 func noopLoggerFunc(string, ...any) {}
@@ -27,6 +85,10 @@ func noopLoggerFunc(string, ...any) {}
 type LoggerFunc func(string, ...any)
 
 type Config struct {
+	// GameID is the ID of the game in the database that this configuration is used for. Each game in a database has its
+	// own configuration. If it is 0, DefaultGameID is used
+	GameID int64 `json:"gameID,omitempty"`
+
 	// MapFile is the path to the SVG input file
 	MapFile string `json:"mapFile"`
 
@@ -47,16 +109,32 @@ type Config struct {
 	// PNGOutFile is the path to the exported PNG output file generated from the SVG output file
 	PNGOutFile string `json:"pngOutFile"`
 
-	// DoCounterattack will eventually be used to determine if a defending territory automatically counterattacks
+	// PNGRenderer determines how the PNG output file is rendered from the SVG output file. It can be "builtin" (the default)
+	// to use the built-in renderer, or "ffmpeg" to use ffmpeg
+	PNGRenderer string `json:"pngRenderer"`
+
+	// DoCounterattack determines if a defending territory that survives an attack automatically counterattacks the attacking territory
+	// with its remaining armies
 	DoCounterattack bool `json:"doCounterattack"`
 
 	// InitialArmies is the number of armies each player starts with in their initial territory.
 	InitialArmies int `json:"initialArmies"`
 
+	// SetupMode determines how the nations get their starting territories. It can be "claim" (the default) to have each
+	// player choose a territory when joining, "random" to deal all of the territories to the nations at random once
+	// MinimumNationsToStart nations have joined, or "draft" to have the nations pick them in the order they joined
+	SetupMode string `json:"setupMode"`
+
+	// StartingArmies is the number of armies each nation starts with if SetupMode is "random" or "draft". Each
+	// territory a nation gets has one army, and the rest are given to the nation as reinforcements that it can place
+	// with the deploy action. Default is 20.
+	StartingArmies int `json:"startingArmies"`
+
 	// MinimumNationsToStart is the minimum number of nations required before players can start taking turns, aside from color
 	MinimumNationsToStart int `json:"minimumNationsToStart"`
 
-	// MaxArmiesPerTerritory is the maximum number of armies that can be moved into or raised in a territory.
+	// MaxArmiesPerTerritory is the maximum number of armies that can be moved into or raised in a territory, unless
+	// the territory has its own maxArmies.
 	MaxArmiesPerTerritory int `json:"maxArmiesPerTerritory"`
 
 	// UnclaimedTerritoriesHave1Army indicates whether unclaimed territories are treated as having 1 army to destroy
@@ -64,9 +142,71 @@ type Config struct {
 	UnclaimedTerritoriesHave1Army bool `json:"unclaimedTerritoriesHave1Army"`
 
 	// ActionsPerTurnHoldingsDivisor is used to determine how many actions a player can take per turn.
-	// A player can take ceil(holdings / ActionsPerTurnHoldingsDivisor) actions per turn.
+	// A player can take ceil(holdings / ActionsPerTurnHoldingsDivisor) actions per turn, plus the bonus of each region they control.
 	ActionsPerTurnHoldingsDivisor float64 `json:"actionsPerTurnHoldingsDivisor"`
 
+	// DoReinforcements determines whether each nation is granted reinforcements (armies it can place in its territories
+	// with the deploy action) when a turn ends. A nation is granted ceil(holdings / ReinforcementsHoldingsDivisor)
+	// armies, plus the bonus of each region it controls.
+	DoReinforcements bool `json:"doReinforcements"`
+
+	// ReinforcementsHoldingsDivisor is used to determine how many armies a nation is granted when a turn ends, if
+	// DoReinforcements is true. Default is 3.
+	ReinforcementsHoldingsDivisor float64 `json:"reinforcementsHoldingsDivisor"`
+
+	// LeavePolicy determines what happens to the territories of a nation that leaves the game or is removed from it.
+	// It can be "delete" (the default) to remove them, "neutral" to give them to the neutral nation with their armies,
+	// or "heir" to give them to the nation named in the leave action
+	LeavePolicy string `json:"leavePolicy"`
+
+	// CapitalDefenseBonus is added to the number of armies defending a nation's capital when the outcome of an attack on
+	// it is calculated. It doesn't change the number of armies that can be lost. Each nation's capital is the territory
+	// it started in, or the first territory it was dealt or picked if SetupMode isn't "claim"
+	CapitalDefenseBonus int `json:"capitalDefenseBonus"`
+
+	// CapitalLossPolicy determines what happens to a nation when the armies in its capital are destroyed in combat. It
+	// can be "none" (the default) to only lose the capital's defense bonus until the nation takes it back, "eliminate"
+	// to remove the nation from the game and give its other territories to the nation that destroyed the armies, or
+	// "cripple" to halve the armies in the nation's other territories and discard its reinforcements
+	CapitalLossPolicy string `json:"capitalLossPolicy"`
+
+	// ResolutionMode determines when move, attack, and raise actions are applied. It can be "immediate" (the default)
+	// to apply them as soon as they are done, or "simultaneous" to store them as orders that are resolved together
+	// when the turn ends, so the order they were submitted in doesn't matter. If DoTurnManagement is false, the orders
+	// stay pending until the consuming application ends the turn
+	ResolutionMode string `json:"resolutionMode"`
+
+	// FogOfWar hides the army sizes of the territories that a player doesn't hold and that aren't connected to one it
+	// holds, in the holdings returned by db.GetVisibleHoldings and the per-player maps rendered by svgmap
+	FogOfWar bool `json:"fogOfWar"`
+
+	// ScoutRange is the maximum number of borders or connections between a territory held by the player's nation and
+	// a territory it scouts with the scout action, if FogOfWar is true. Default is 2.
+	ScoutRange int `json:"scoutRange"`
+
+	// ScoutSuccessPercent is the chance, as a percentage, that a scout action reveals the army size in the scouted
+	// territory. Default is 75.
+	ScoutSuccessPercent int `json:"scoutSuccessPercent"`
+
+	// NeutralNationName is the name of the nation that holds territories that aren't controlled by any player, such as
+	// the territories of a nation that left the game. Default is "Neutral".
+	NeutralNationName string `json:"neutralNationName"`
+
+	// NeutralColor is the hex color of the neutral nation. Default is "808080".
+	NeutralColor string `json:"neutralColor"`
+
+	// NeutralTerritories are the territories held by the neutral nation when the game is created, which must be
+	// attacked like any other nation's territories before they can be claimed
+	NeutralTerritories []NeutralTerritory `json:"neutralTerritories,omitempty"`
+
+	// TreatyBreakDelay is the number of turns a broken treaty (alliance or non-aggression pact) continues to apply after
+	// the turn it was broken in. If it is 0, the treaty stops applying when the current turn ends.
+	TreatyBreakDelay int `json:"treatyBreakDelay"`
+
+	// AlliesCanMoveThrough determines whether a nation can move armies to a territory that isn't a neighbor of the
+	// source territory, if it can be reached through territories held by its allies
+	AlliesCanMoveThrough bool `json:"alliesCanMoveThrough"`
+
 	// TurnEndsWhenAllPlayersDone indicates whether a turn ends when all players have done all their actions. If TurnDurationString is
 	// unset, this must be true (otherwise, the turn will never end).
 	TurnEndsWhenAllPlayersDone bool `json:"turnEndsWhenAllPlayersDone"`
@@ -75,12 +215,168 @@ type Config struct {
 	// It is expected to be a valid duration string parseable by `durationutil.ParseLongerDuration`
 	TurnDuration durationutil.ExtendedDuration `json:"turnDuration,omitempty"`
 
+	// RandomSeed is the seed used for the game's random numbers (die rolls, random colors, etc) when the database is created. If it is 0,
+	// a random seed is generated. Once a game is created, its seed is stored in the database and this is ignored
+	RandomSeed int64 `json:"randomSeed,omitempty"`
+
 	// DoTurnManagement indicates whether turn management should be handled internally. If it is false, it is assumed that the consuming
 	// application will handle turn management, such as by using a timer or a game loop. Default is true.
 	DoTurnManagement bool `json:"doTurnManagement"`
 
 	// Territories is the list of valid territories that can be owned by players
 	Territories []Territory `json:"territories"`
+
+	// Connections are typed links between territories in addition to the land borders listed in each territory's
+	// neighbors, such as sea lanes and one-way links
+	Connections []Connection `json:"connections,omitempty"`
+
+	// Regions are named groups of territories. A player that holds every territory in a region gets the region's bonus
+	// added to the number of actions they can take per turn and, if DoReinforcements is enabled, to the reinforcements
+	// they are granted when a turn ends. Regions can also be required to win with VictoryConditions.Regions
+	Regions []Region `json:"regions,omitempty"`
+
+	// VictoryConditions determine when a nation wins the game. If none of them are set, the game never ends
+	VictoryConditions VictoryConditions `json:"victoryConditions"`
+}
+
+// VictoryConditions are the ways a nation can win the game. They are checked after each action and at the end of each
+// turn, and the first one met ends the game
+type VictoryConditions struct {
+	// LastNationStanding ends the game when only one nation is left, once at least two nations (or
+	// MinimumNationsToStart nations, if it is greater) have joined
+	LastNationStanding bool `json:"lastNationStanding"`
+
+	// TerritoryPercent ends the game when a nation holds at least this percentage of the territories. It is not used
+	// if it is 0
+	TerritoryPercent float64 `json:"territoryPercent,omitempty"`
+
+	// Territories are the abbreviations, names, or aliases of territories a nation must hold to win the game, along
+	// with every territory in Regions. They are replaced with the territories' abbreviations when the configuration is
+	// validated
+	Territories []string `json:"territories,omitempty"`
+
+	// Regions are the names of regions a nation must control to win the game, along with Territories
+	Regions []string `json:"regions,omitempty"`
+
+	// TurnLimit ends the game when the given turn ends. The nation holding the most territories wins, and ties are
+	// broken by the number of armies, then by the order the nations joined. It is not used if it is 0
+	TurnLimit int `json:"turnLimit,omitempty"`
+}
+
+// Enabled returns true if any of the victory conditions are set
+func (vc *VictoryConditions) Enabled() bool {
+	return vc.LastNationStanding || vc.TerritoryPercent > 0 || len(vc.Territories) > 0 || len(vc.Regions) > 0 || vc.TurnLimit > 0
+}
+
+// NeutralTerritory is a territory held by the neutral nation when the game is created
+type NeutralTerritory struct {
+	// Territory is the abbreviation, name, or alias of the territory. It is replaced with the territory's abbreviation
+	// when the configuration is validated
+	Territory string `json:"territory"`
+
+	// Armies is the number of armies in the territory. If it is 0, a random number of armies between MinArmies and
+	// MaxArmies (inclusive) is used
+	Armies    int `json:"armies,omitempty"`
+	MinArmies int `json:"minArmies,omitempty"`
+	MaxArmies int `json:"maxArmies,omitempty"`
+}
+
+// Connection is a typed link between two territories that aren't listed as each other's neighbors
+type Connection struct {
+	// From and To are the abbreviations, names, or aliases of the connected territories. They are replaced with the
+	// territories' abbreviations when the configuration is validated
+	From string `json:"from"`
+	To   string `json:"to"`
+
+	// Type is the type of the connection, "land" (the default), "sea", "oneWay", or "restricted"
+	Type string `json:"type,omitempty"`
+
+	// AttackPenalty is added to the defending armies when a territory is attacked across the connection, for example
+	// to represent an amphibious assault
+	AttackPenalty int `json:"attackPenalty,omitempty"`
+
+	// MaxArmies is the maximum number of armies that can be moved across the connection at once. It is not used if it
+	// is 0
+	MaxArmies int `json:"maxArmies,omitempty"`
+}
+
+// AllowsMove returns true if the given number of armies can be moved across the connection
+func (c *Connection) AllowsMove(armies int) bool {
+	return c.Type != ConnectionRestricted && (c.MaxArmies == 0 || armies <= c.MaxArmies)
+}
+
+// Region is a named group of territories that gives a bonus to the player that controls all of them
+type Region struct {
+	Name string `json:"name"`
+
+	// Territories are the abbreviations, names, or aliases of the territories in the region. They are replaced with
+	// the territories' abbreviations when the configuration is validated
+	Territories []string `json:"territories"`
+
+	// Bonus is the number of extra actions per turn and extra reinforcements per turn the player controlling the
+	// region gets
+	Bonus int `json:"bonus"`
+}
+
+// ControlledBy returns true if every territory in the region is in the given set of territory abbreviations
+func (r *Region) ControlledBy(held map[string]bool) bool {
+	for _, territory := range r.Territories {
+		if !held[territory] {
+			return false
+		}
+	}
+	return len(r.Territories) > 0
+}
+
+// VictoryTerritories returns the abbreviations of the territories a nation must hold to win the game, from the
+// victory condition's territories and regions
+func (tc *Config) VictoryTerritories() []string {
+	territories := slices.Clone(tc.VictoryConditions.Territories)
+	for _, name := range tc.VictoryConditions.Regions {
+		for r := range tc.Regions {
+			if tc.Regions[r].Name != name {
+				continue
+			}
+			for _, territory := range tc.Regions[r].Territories {
+				if !slices.Contains(territories, territory) {
+					territories = append(territories, territory)
+				}
+			}
+		}
+	}
+	return territories
+}
+
+// PassableTerritories returns the number of territories that aren't impassable
+func (tc *Config) PassableTerritories() int {
+	var passable int
+	for t := range tc.Territories {
+		if !tc.Territories[t].Impassable {
+			passable++
+		}
+	}
+	return passable
+}
+
+// RegionBonus returns the total bonus of the regions controlled by a player holding the given territories
+// (abbreviations), and the names of the controlled regions
+func (tc *Config) RegionBonus(territories []string) (int, []string) {
+	if len(tc.Regions) == 0 {
+		return 0, nil
+	}
+	held := make(map[string]bool, len(territories))
+	for _, territory := range territories {
+		held[territory] = true
+	}
+	var bonus int
+	var controlled []string
+	for r := range tc.Regions {
+		if tc.Regions[r].ControlledBy(held) {
+			bonus += tc.Regions[r].Bonus
+			controlled = append(controlled, tc.Regions[r].Name)
+		}
+	}
+	return bonus, controlled
 }
 
 func (tc *Config) ResolveTerritory(query string) (*Territory, error) {
@@ -104,6 +400,12 @@ func (tc *Config) ResolveTerritory(query string) (*Territory, error) {
 }
 
 func (tc *Config) validateRequiredValues() error {
+	if tc.GameID < 0 {
+		return fmt.Errorf("invalid gameID %d", tc.GameID)
+	}
+	if tc.GameID == 0 {
+		tc.GameID = DefaultGameID
+	}
 	if tc.MapFile == "" {
 		return &missingFieldError{"mapFile"}
 	}
@@ -116,6 +418,13 @@ func (tc *Config) validateRequiredValues() error {
 	if tc.PNGOutFile == "" {
 		return &missingFieldError{"pngOutFile"}
 	}
+	switch tc.PNGRenderer {
+	case "":
+		tc.PNGRenderer = PNGRendererBuiltin
+	case PNGRendererBuiltin, PNGRendererFFmpeg:
+	default:
+		return fmt.Errorf("invalid pngRenderer %q, must be %q or %q", tc.PNGRenderer, PNGRendererBuiltin, PNGRendererFFmpeg)
+	}
 	if tc.MaxArmiesPerTerritory <= 0 {
 		tc.MaxArmiesPerTerritory = defaultMaxArmiesPerTerritory
 	}
@@ -125,12 +434,70 @@ func (tc *Config) validateRequiredValues() error {
 	if tc.MinimumNationsToStart <= 0 {
 		tc.MinimumNationsToStart = defaultMinimumNationsToStart
 	}
+	switch tc.SetupMode {
+	case "":
+		tc.SetupMode = SetupModeClaim
+	case SetupModeClaim, SetupModeRandom, SetupModeDraft:
+	default:
+		return fmt.Errorf("invalid setupMode %q, must be %q, %q, or %q", tc.SetupMode, SetupModeClaim, SetupModeRandom, SetupModeDraft)
+	}
+	if tc.StartingArmies <= 0 {
+		tc.StartingArmies = defaultStartingArmies
+	}
 	if len(tc.Territories) == 0 {
 		return fmt.Errorf("at least one territory is required")
 	}
 	if tc.ActionsPerTurnHoldingsDivisor <= 0 {
 		tc.ActionsPerTurnHoldingsDivisor = defaultActionsPerTurnHoldingsDivisor
 	}
+	if tc.ReinforcementsHoldingsDivisor <= 0 {
+		tc.ReinforcementsHoldingsDivisor = defaultReinforcementsHoldingsDivisor
+	}
+
+	switch tc.LeavePolicy {
+	case "":
+		tc.LeavePolicy = LeavePolicyDelete
+	case LeavePolicyDelete, LeavePolicyNeutral, LeavePolicyHeir:
+	default:
+		return fmt.Errorf("invalid leavePolicy %q, must be %q, %q, or %q", tc.LeavePolicy, LeavePolicyDelete, LeavePolicyNeutral, LeavePolicyHeir)
+	}
+	switch tc.CapitalLossPolicy {
+	case "":
+		tc.CapitalLossPolicy = CapitalLossNone
+	case CapitalLossNone, CapitalLossEliminate, CapitalLossCripple:
+	default:
+		return fmt.Errorf("invalid capitalLossPolicy %q, must be %q, %q, or %q", tc.CapitalLossPolicy, CapitalLossNone, CapitalLossEliminate, CapitalLossCripple)
+	}
+	switch tc.ResolutionMode {
+	case "":
+		tc.ResolutionMode = ResolutionImmediate
+	case ResolutionImmediate, ResolutionSimultaneous:
+	default:
+		return fmt.Errorf("invalid resolutionMode %q, must be %q or %q", tc.ResolutionMode, ResolutionImmediate, ResolutionSimultaneous)
+	}
+	if tc.ScoutRange <= 0 {
+		tc.ScoutRange = defaultScoutRange
+	}
+	if tc.ScoutSuccessPercent <= 0 {
+		tc.ScoutSuccessPercent = defaultScoutSuccessPercent
+	}
+	if tc.ScoutSuccessPercent > 100 {
+		return fmt.Errorf("scoutSuccessPercent must not be more than 100")
+	}
+	if tc.NeutralNationName == "" {
+		tc.NeutralNationName = defaultNeutralNationName
+	}
+	if tc.NeutralColor == "" {
+		tc.NeutralColor = defaultNeutralColor
+	}
+	tc.NeutralColor = strings.TrimPrefix(tc.NeutralColor, "#")
+	if !isHexColor(tc.NeutralColor) {
+		return fmt.Errorf("invalid neutralColor %q, must be a 3 or 6 digit hex color", tc.NeutralColor)
+	}
+
+	if tc.TreatyBreakDelay < 0 {
+		return fmt.Errorf("treatyBreakDelay must not be negative")
+	}
 
 	if !tc.TurnEndsWhenAllPlayersDone && tc.TurnDuration == 0 {
 		return fmt.Errorf("turnDuration must be set if turnEndsWhenAllPlayersDone is false")
@@ -143,6 +510,19 @@ func (tc *Config) validateRequiredValues() error {
 	return nil
 }
 
+// isHexColor returns true if the color is a 3 or 6 digit hex color without a leading #
+func isHexColor(color string) bool {
+	if len(color) != 3 && len(color) != 6 {
+		return false
+	}
+	for _, c := range strings.ToLower(color) {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
 func (tc *Config) validateUniqueness() error {
 	const errFmt = "found non-unique territory with query %q"
 	uniqueTerritories := make(map[string]string)
@@ -173,7 +553,7 @@ func (tc *Config) validateUniqueness() error {
 func (tc *Config) validateNeighborMutuality() error {
 	for _, territory := range tc.Territories {
 		abbr := territory.Abbreviation
-		if len(territory.Neighbors) == 0 {
+		if len(territory.Neighbors) == 0 && len(territory.Connections()) == 0 {
 			return fmt.Errorf("found territory %q with no neighbors", territory.Name)
 		}
 		for _, neighborAbbr := range territory.Neighbors {
@@ -184,13 +564,174 @@ func (tc *Config) validateNeighborMutuality() error {
 			if err != nil {
 				return err
 			}
-			mutual, err := neighbor.IsNeighboring(abbr)
+			if !slices.Contains(neighbor.Neighbors, abbr) {
+				return fmt.Errorf("found non-mutual neighbors %q and %q", abbr, neighborAbbr)
+			}
+		}
+	}
+	return nil
+}
+
+func (tc *Config) validateConnections() error {
+	for c := range tc.Connections {
+		connection := &tc.Connections[c]
+		from, err := tc.ResolveTerritory(connection.From)
+		if err != nil {
+			return err
+		}
+		to, err := tc.ResolveTerritory(connection.To)
+		if err != nil {
+			return err
+		}
+		connection.From, connection.To = from.Abbreviation, to.Abbreviation
+		if connection.Type == "" {
+			connection.Type = ConnectionLand
+		}
+		switch {
+		case !slices.Contains([]string{ConnectionLand, ConnectionSea, ConnectionOneWay, ConnectionRestricted}, connection.Type):
+			return fmt.Errorf("connection between %q and %q has an unrecognized type %q", from.Abbreviation, to.Abbreviation, connection.Type)
+		case from.Abbreviation == to.Abbreviation:
+			return fmt.Errorf("found territory %q connected to itself", from.Abbreviation)
+		case slices.Contains(from.Neighbors, to.Abbreviation) || slices.Contains(to.Neighbors, from.Abbreviation):
+			return fmt.Errorf("territories %q and %q are already neighbors", from.Abbreviation, to.Abbreviation)
+		case from.Impassable || to.Impassable:
+			return fmt.Errorf("connection between %q and %q has an impassable territory", from.Abbreviation, to.Abbreviation)
+		case connection.AttackPenalty < 0:
+			return fmt.Errorf("connection between %q and %q has a negative attackPenalty", from.Abbreviation, to.Abbreviation)
+		case connection.MaxArmies < 0:
+			return fmt.Errorf("connection between %q and %q has a negative maxArmies", from.Abbreviation, to.Abbreviation)
+		}
+		for _, other := range tc.Connections[:c] {
+			if (other.From == connection.From && other.To == connection.To) || (other.From == connection.To && other.To == connection.From) {
+				return fmt.Errorf("found connection between %q and %q more than once", from.Abbreviation, to.Abbreviation)
+			}
+		}
+	}
+	return nil
+}
+
+func (tc *Config) validateTerritoryModifiers() error {
+	passable := 0
+	for t := range tc.Territories {
+		territory := &tc.Territories[t]
+		switch {
+		case territory.DefenseBonus < 0:
+			return fmt.Errorf("territory %q has a negative defenseBonus", territory.Abbreviation)
+		case territory.MaxArmies < 0:
+			return fmt.Errorf("territory %q has a negative maxArmies", territory.Abbreviation)
+		case territory.EnterCost < 0:
+			return fmt.Errorf("territory %q has a negative enterCost", territory.Abbreviation)
+		case territory.Impassable && (territory.DefenseBonus != 0 || territory.MaxArmies != 0 || territory.EnterCost != 0):
+			return fmt.Errorf("impassable territory %q can't have defenseBonus, maxArmies, or enterCost set", territory.Abbreviation)
+		case !territory.Impassable:
+			passable++
+		}
+	}
+	if passable == 0 {
+		return fmt.Errorf("at least one territory must not be impassable")
+	}
+	return nil
+}
+
+func (tc *Config) validateRegions() error {
+	names := make(map[string]bool, len(tc.Regions))
+	for r := range tc.Regions {
+		region := &tc.Regions[r]
+		if region.Name == "" {
+			return fmt.Errorf("region %d has no name", r)
+		}
+		if names[region.Name] {
+			return fmt.Errorf("found non-unique region %q", region.Name)
+		}
+		names[region.Name] = true
+		if len(region.Territories) == 0 {
+			return fmt.Errorf("region %q has no territories", region.Name)
+		}
+		if region.Bonus < 0 {
+			return fmt.Errorf("region %q has a negative bonus", region.Name)
+		}
+		abbreviations := make([]string, 0, len(region.Territories))
+		for _, query := range region.Territories {
+			territory, err := tc.ResolveTerritory(query)
 			if err != nil {
-				return err
+				return fmt.Errorf("region %q: %w", region.Name, err)
 			}
-			if !mutual {
-				return fmt.Errorf("found non-mutual neighbors %q and %q", abbr, neighborAbbr)
+			if slices.Contains(abbreviations, territory.Abbreviation) {
+				return fmt.Errorf("region %q has territory %q more than once", region.Name, territory.Abbreviation)
 			}
+			if territory.Impassable {
+				return fmt.Errorf("region %q has impassable territory %q", region.Name, territory.Abbreviation)
+			}
+			abbreviations = append(abbreviations, territory.Abbreviation)
+		}
+		region.Territories = abbreviations
+	}
+	return nil
+}
+
+func (tc *Config) validateNeutralTerritories() error {
+	seen := make(map[string]bool, len(tc.NeutralTerritories))
+	for n := range tc.NeutralTerritories {
+		neutral := &tc.NeutralTerritories[n]
+		territory, err := tc.ResolveTerritory(neutral.Territory)
+		if err != nil {
+			return err
+		}
+		if seen[territory.Abbreviation] {
+			return fmt.Errorf("found territory %q more than once", territory.Abbreviation)
+		}
+		seen[territory.Abbreviation] = true
+		neutral.Territory = territory.Abbreviation
+		if territory.Impassable {
+			return fmt.Errorf("territory %q is impassable", neutral.Territory)
+		}
+
+		limit, limitName := tc.MaxArmiesPerTerritory, "maxArmiesPerTerritory"
+		if territory.MaxArmies > 0 {
+			limit, limitName = territory.MaxArmies, "the territory's maxArmies"
+		}
+		switch {
+		case neutral.Armies < 0:
+			return fmt.Errorf("territory %q has a negative number of armies", neutral.Territory)
+		case neutral.Armies > 0 && (neutral.MinArmies != 0 || neutral.MaxArmies != 0):
+			return fmt.Errorf("territory %q must have either armies or minArmies and maxArmies set, not both", neutral.Territory)
+		case neutral.Armies > limit:
+			return fmt.Errorf("territory %q has more than %s (%d) armies", neutral.Territory, limitName, limit)
+		case neutral.Armies == 0 && (neutral.MinArmies < 1 || neutral.MaxArmies < neutral.MinArmies):
+			return fmt.Errorf("territory %q must have armies set, or minArmies set to at least 1 and maxArmies set to at least minArmies", neutral.Territory)
+		case neutral.MaxArmies > limit:
+			return fmt.Errorf("territory %q has a maxArmies greater than %s (%d)", neutral.Territory, limitName, limit)
+		}
+	}
+	return nil
+}
+
+func (tc *Config) validateVictoryConditions() error {
+	vc := &tc.VictoryConditions
+	if vc.TerritoryPercent < 0 || vc.TerritoryPercent > 100 {
+		return fmt.Errorf("territoryPercent must be between 0 and 100")
+	}
+	if vc.TurnLimit < 0 {
+		return fmt.Errorf("turnLimit must not be negative")
+	}
+	abbreviations := make([]string, 0, len(vc.Territories))
+	for _, query := range vc.Territories {
+		territory, err := tc.ResolveTerritory(query)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(abbreviations, territory.Abbreviation) {
+			return fmt.Errorf("found territory %q more than once", territory.Abbreviation)
+		}
+		if territory.Impassable {
+			return fmt.Errorf("territory %q is impassable", territory.Abbreviation)
+		}
+		abbreviations = append(abbreviations, territory.Abbreviation)
+	}
+	vc.Territories = abbreviations
+	for _, name := range vc.Regions {
+		if !slices.ContainsFunc(tc.Regions, func(r Region) bool { return r.Name == name }) {
+			return fmt.Errorf("unrecognized region %q", name)
 		}
 	}
 	return nil
@@ -204,40 +745,56 @@ func (e *missingFieldError) Error() string {
 	return fmt.Sprintf("%s is required", e.field)
 }
 
-func validateConfig() (err error) {
-	if cfg == nil {
+func validateConfig(c *Config) (err error) {
+	if c == nil {
 		return ErrGameNotConfigured
 	}
-	for t := range cfg.Territories {
-		cfg.Territories[t].cfg = cfg
+	for t := range c.Territories {
+		c.Territories[t].cfg = c
 	}
-	if err = cfg.validateRequiredValues(); err != nil {
+	if err = c.validateRequiredValues(); err != nil {
 		return fmt.Errorf("failed to validate required values: %w", err)
 	}
-	if err = cfg.validateUniqueness(); err != nil {
+	if err = c.validateUniqueness(); err != nil {
 		return fmt.Errorf("failed to validate uniqueness of territories: %w", err)
 	}
-	if err = cfg.validateNeighborMutuality(); err != nil {
+	if err = c.validateConnections(); err != nil {
+		return fmt.Errorf("failed to validate connections: %w", err)
+	}
+	if err = c.validateNeighborMutuality(); err != nil {
 		return fmt.Errorf("failed to validate mutuality of neighbors: %w", err)
 	}
+	if err = c.validateTerritoryModifiers(); err != nil {
+		return fmt.Errorf("failed to validate territory modifiers: %w", err)
+	}
+	if err = c.validateRegions(); err != nil {
+		return fmt.Errorf("failed to validate regions: %w", err)
+	}
+	if err = c.validateNeutralTerritories(); err != nil {
+		return fmt.Errorf("failed to validate neutral territories: %w", err)
+	}
+	if err = c.validateVictoryConditions(); err != nil {
+		return fmt.Errorf("failed to validate victory conditions: %w", err)
+	}
+	if c.LogInfo == nil {
+		c.LogInfo = noopLoggerFunc
+	}
+	if c.LogError == nil {
+		c.LogError = noopLoggerFunc
+	}
 	return nil
 }
 
 // SetConfig validates the incoming configuration struct, and if it passes validation, sets it as the active configuration.
+// The active configuration is used for the default game, and its database file is used for all games.
 func SetConfig(c *Config) error {
 	if c == nil {
 		return ErrGameNotConfigured
 	}
 	cfg = c
-	err := validateConfig()
+	err := validateConfig(cfg)
 	if err == nil {
-		if cfg.LogInfo == nil {
-			cfg.LogInfo = noopLoggerFunc
-		}
-		if cfg.LogError == nil {
-			cfg.LogError = noopLoggerFunc
-		}
-		*c = *cfg
+		delete(games, cfg.GameID)
 	}
 	return err
 }
@@ -250,47 +807,131 @@ func GetConfig() (*Config, error) {
 	return cfg, nil
 }
 
+// AddGameConfig validates the configuration of a game other than the default game and adds it, replacing the
+// configuration of the game with the same ID if one was added. The active configuration must be set first, and since all
+// games are stored in the same database, the game's dbFile must be unset or the same as the active configuration's.
+func AddGameConfig(c *Config) error {
+	if cfg == nil {
+		return ErrGameNotConfigured
+	}
+	if c == nil {
+		return ErrUnknownGame
+	}
+	if c.DBFile == "" {
+		c.DBFile = cfg.DBFile
+	} else if c.DBFile != cfg.DBFile {
+		return fmt.Errorf("game %d has a different dbFile than the active configuration", c.GameID)
+	}
+	if err := validateConfig(c); err != nil {
+		return err
+	}
+	if c.GameID == cfg.GameID {
+		return fmt.Errorf("game %d is already used by the active configuration", c.GameID)
+	}
+	if games == nil {
+		games = make(map[int64]*Config)
+	}
+	games[c.GameID] = c
+	return nil
+}
+
+// GetGameConfig returns the configuration of the game with the given ID. If gameID is 0, the active configuration is
+// returned. ErrUnknownGame is returned if no configuration has been set or added for the game.
+func GetGameConfig(gameID int64) (*Config, error) {
+	if cfg == nil {
+		return nil, ErrGameNotConfigured
+	}
+	if gameID == 0 || gameID == cfg.GameID {
+		return cfg, nil
+	}
+	c, ok := games[gameID]
+	if !ok {
+		return nil, fmt.Errorf("%w (game %d)", ErrUnknownGame, gameID)
+	}
+	return c, nil
+}
+
+// GetGameConfigs returns the configurations of all games, starting with the active configuration and followed by
+// the added games in order of their IDs
+func GetGameConfigs() ([]*Config, error) {
+	if cfg == nil {
+		return nil, ErrGameNotConfigured
+	}
+	configs := []*Config{cfg}
+	for _, gameID := range slices.Sorted(maps.Keys(games)) {
+		configs = append(configs, games[gameID])
+	}
+	return configs, nil
+}
+
+// Validate checks the configuration for missing or invalid values and sets the defaults of optional values. It is done
+// by SetConfig and AddGameConfig, and should be used for configurations that aren't added to either.
+func (c *Config) Validate() error {
+	return validateConfig(c)
+}
+
 func GetTestingConfig(t *testing.T) (*Config, error) {
 	if !testing.Testing() {
 		panic("GetTestingConfig should only be called in testing mode")
 	}
 	if cfg == nil {
-		dir := t.TempDir()
-		cfg = &Config{
-			MapFile: path.Join(dir, "test.svg"),
-			DBFile:  path.Join(dir, "test.db"),
-
-			LogInfo: func(s string, a ...any) {
-				t.Helper()
-				t.Log(append([]any{s}, a...)...)
-			},
-			LogError: func(s string, a ...any) {
-				t.Helper()
-				t.Log(append([]any{s}, a...)...)
-			},
-			SVGOutFile:                    path.Join(dir, "test.svg"),
-			PNGOutFile:                    path.Join(dir, "test.png"),
-			DoCounterattack:               false,
-			MaxArmiesPerTerritory:         defaultMaxArmiesPerTerritory,
-			InitialArmies:                 defaultInitialArmies,
-			MinimumNationsToStart:         defaultMinimumNationsToStart,
-			ActionsPerTurnHoldingsDivisor: defaultActionsPerTurnHoldingsDivisor,
-			DoTurnManagement:              true,
-			TurnEndsWhenAllPlayersDone:    true,
-			Territories: []Territory{
-				{Name: "California", Abbreviation: "CA", Neighbors: []string{"NV", "OR", "AZ"}},
-				{Name: "Nevada", Abbreviation: "NV", Neighbors: []string{"CA", "OR", "UT", "AZ"}},
-				{Name: "Oregon", Abbreviation: "OR", Neighbors: []string{"CA", "NV"}},
-				{Name: "Arizona", Abbreviation: "AZ", Neighbors: []string{"CA", "NV"}},
-				{Name: "Utah", Abbreviation: "UT", Neighbors: []string{"NV"}},
-			},
-		}
+		cfg = newTestingConfig(t)
 	}
 	return cfg, nil
 }
 
+// NewTestingConfig returns a new validated testing configuration with its own database file, without setting it as the
+// active configuration
+func NewTestingConfig(t *testing.T) *Config {
+	if !testing.Testing() {
+		panic("NewTestingConfig should only be called in testing mode")
+	}
+	c := newTestingConfig(t)
+	if err := c.Validate(); err != nil {
+		t.Fatalf("invalid testing configuration: %v", err)
+	}
+	return c
+}
+
+func newTestingConfig(t *testing.T) *Config {
+	dir := t.TempDir()
+	return &Config{
+		GameID:  DefaultGameID,
+		MapFile: path.Join(dir, "test.svg"),
+		DBFile:  path.Join(dir, "test.db"),
+
+		LogInfo: func(s string, a ...any) {
+			t.Helper()
+			t.Log(append([]any{s}, a...)...)
+		},
+		LogError: func(s string, a ...any) {
+			t.Helper()
+			t.Log(append([]any{s}, a...)...)
+		},
+		SVGOutFile:                    path.Join(dir, "test.svg"),
+		PNGOutFile:                    path.Join(dir, "test.png"),
+		DoCounterattack:               false,
+		MaxArmiesPerTerritory:         defaultMaxArmiesPerTerritory,
+		InitialArmies:                 defaultInitialArmies,
+		MinimumNationsToStart:         defaultMinimumNationsToStart,
+		ActionsPerTurnHoldingsDivisor: defaultActionsPerTurnHoldingsDivisor,
+		ScoutRange:                    defaultScoutRange,
+		ScoutSuccessPercent:           defaultScoutSuccessPercent,
+		DoTurnManagement:              true,
+		TurnEndsWhenAllPlayersDone:    true,
+		Territories: []Territory{
+			{Name: "California", Abbreviation: "CA", Neighbors: []string{"NV", "OR", "AZ"}},
+			{Name: "Nevada", Abbreviation: "NV", Neighbors: []string{"CA", "OR", "UT", "AZ"}},
+			{Name: "Oregon", Abbreviation: "OR", Neighbors: []string{"CA", "NV"}},
+			{Name: "Arizona", Abbreviation: "AZ", Neighbors: []string{"CA", "NV"}},
+			{Name: "Utah", Abbreviation: "UT", Neighbors: []string{"NV"}},
+		},
+	}
+}
+
 func CloseTestingConfig(t *testing.T) {
 	cfg = nil
+	games = nil
 }
 
 type Territory struct {
@@ -298,13 +939,80 @@ type Territory struct {
 	Name         string   `json:"name"`
 	Aliases      []string `json:"aliases"`
 	Neighbors    []string `json:"neighbors"`
-	cfg          *Config
+
+	// DefenseBonus is added to the number of armies defending the territory when the outcome of an attack on it is
+	// calculated, for example to represent mountains or fortifications. It doesn't change the number of armies that
+	// can be lost
+	DefenseBonus int `json:"defenseBonus,omitempty"`
+
+	// MaxArmies is the maximum number of armies that can be in the territory, overriding MaxArmiesPerTerritory if it
+	// is set
+	MaxArmies int `json:"maxArmies,omitempty"`
+
+	// EnterCost is the number of the player's actions for the turn that moving armies into the territory uses, if turn
+	// management is enabled. Default is 1
+	EnterCost int `json:"enterCost,omitempty"`
+
+	// Impassable territories can't be claimed, entered, or attacked, for example to represent a lake or a mountain
+	// range on the map. They don't count towards the territories needed to win with territoryPercent
+	Impassable bool `json:"impassable,omitempty"`
+
+	cfg *Config
+}
+
+// ArmyLimit returns the maximum number of armies that can be in the territory
+func (t *Territory) ArmyLimit() int {
+	if t.MaxArmies > 0 || t.cfg == nil {
+		return t.MaxArmies
+	}
+	return t.cfg.MaxArmiesPerTerritory
 }
 
+// ActionCost returns the number of the player's actions for the turn that moving armies into the territory uses
+func (t *Territory) ActionCost() int {
+	return max(t.EnterCost, 1)
+}
+
+// IsNeighboring returns true if the territory matching the query can be reached from the territory, either because it
+// is listed as a neighbor or because of a connection
 func (t *Territory) IsNeighboring(query string) (bool, error) {
+	connection, err := t.ConnectionTo(query)
+	return connection != nil, err
+}
+
+// ConnectionTo returns the connection used to reach the territory matching the query from the territory, or nil if it
+// can't be reached. Neighbors are returned as land connections
+func (t *Territory) ConnectionTo(query string) (*Connection, error) {
 	found, err := t.cfg.ResolveTerritory(query)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+	for _, connection := range t.Connections() {
+		if connection.To == found.Abbreviation {
+			return &connection, nil
+		}
+	}
+	return nil, nil
+}
+
+// Connections returns the connections that can be used to leave the territory, with the territory as From, starting
+// with its neighbors as land connections
+func (t *Territory) Connections() []Connection {
+	connections := make([]Connection, 0, len(t.Neighbors))
+	for _, neighbor := range t.Neighbors {
+		connections = append(connections, Connection{From: t.Abbreviation, To: neighbor, Type: ConnectionLand})
+	}
+	if t.cfg == nil {
+		return connections
+	}
+	for _, connection := range t.cfg.Connections {
+		switch {
+		case connection.From == t.Abbreviation:
+			connections = append(connections, connection)
+		case connection.To == t.Abbreviation && connection.Type != ConnectionOneWay:
+			connection.From, connection.To = connection.To, connection.From
+			connections = append(connections, connection)
+		}
 	}
-	return slices.Contains(t.Neighbors, found.Abbreviation), nil
+	return connections
 }
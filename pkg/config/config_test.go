@@ -1,6 +1,7 @@
 package config
 
 import (
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -302,6 +303,113 @@ func TestMutualNeighborValidation(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestConnectionValidation(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		connections []Connection
+		expectError string
+		expect      []Connection
+	}{
+		{
+			desc:        "valid connections",
+			connections: []Connection{{From: "California", To: "hi", Type: ConnectionSea, AttackPenalty: 1}, {From: "NV", To: "HI"}},
+			expect: []Connection{
+				{From: "CA", To: "HI", Type: ConnectionSea, AttackPenalty: 1},
+				{From: "NV", To: "HI", Type: ConnectionLand},
+			},
+		},
+		{
+			desc:        "unknown type",
+			connections: []Connection{{From: "CA", To: "HI", Type: "air"}},
+			expectError: `connection between "CA" and "HI" has an unrecognized type "air"`,
+		},
+		{
+			desc:        "connected to itself",
+			connections: []Connection{{From: "HI", To: "Hawaii"}},
+			expectError: `found territory "HI" connected to itself`,
+		},
+		{
+			desc:        "already neighbors",
+			connections: []Connection{{From: "CA", To: "NV", Type: ConnectionSea}},
+			expectError: `territories "CA" and "NV" are already neighbors`,
+		},
+		{
+			desc:        "negative attack penalty",
+			connections: []Connection{{From: "CA", To: "HI", AttackPenalty: -1}},
+			expectError: `connection between "CA" and "HI" has a negative attackPenalty`,
+		},
+		{
+			desc:        "negative max armies",
+			connections: []Connection{{From: "CA", To: "HI", MaxArmies: -1}},
+			expectError: `connection between "CA" and "HI" has a negative maxArmies`,
+		},
+		{
+			desc:        "duplicate connection",
+			connections: []Connection{{From: "CA", To: "HI", Type: ConnectionOneWay}, {From: "HI", To: "CA", Type: ConnectionOneWay}},
+			expectError: `found connection between "HI" and "CA" more than once`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			tcfg := &Config{
+				Territories: append(slices.Clone(dummyTerritories), Territory{Abbreviation: "HI", Name: "Hawaii"}),
+				Connections: tc.connections,
+			}
+			for i := range tcfg.Territories {
+				tcfg.Territories[i].cfg = tcfg
+			}
+			err := tcfg.validateConnections()
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.expect, tcfg.Connections)
+				// Hawaii has no neighbors, but can be reached through its connections
+				assert.NoError(t, tcfg.validateNeighborMutuality())
+			}
+		})
+	}
+}
+
+func TestConnectionTo(t *testing.T) {
+	tcfg := &Config{
+		Territories: append(slices.Clone(dummyTerritories), Territory{Abbreviation: "HI", Name: "Hawaii"}),
+		Connections: []Connection{
+			{From: "CA", To: "HI", Type: ConnectionOneWay},
+			{From: "NV", To: "HI", Type: ConnectionRestricted, MaxArmies: 2},
+		},
+	}
+	if !assert.NoError(t, tcfg.validateConnections()) {
+		t.FailNow()
+	}
+	testCases := []struct {
+		from   string
+		to     string
+		expect *Connection
+	}{
+		{from: "CA", to: "NV", expect: &Connection{From: "CA", To: "NV", Type: ConnectionLand}},
+		{from: "CA", to: "HI", expect: &Connection{From: "CA", To: "HI", Type: ConnectionOneWay}},
+		{from: "HI", to: "CA"},
+		{from: "HI", to: "NV", expect: &Connection{From: "HI", To: "NV", Type: ConnectionRestricted, MaxArmies: 2}},
+	}
+	for _, tc := range testCases {
+		from, err := tcfg.ResolveTerritory(tc.from)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		connection, err := from.ConnectionTo(tc.to)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expect, connection, "%s to %s", tc.from, tc.to)
+		neighboring, err := from.IsNeighboring(tc.to)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.expect != nil, neighboring)
+	}
+	assert.True(t, (&Connection{Type: ConnectionSea, MaxArmies: 2}).AllowsMove(2))
+	assert.False(t, (&Connection{Type: ConnectionSea, MaxArmies: 2}).AllowsMove(3))
+	assert.False(t, (&Connection{Type: ConnectionRestricted}).AllowsMove(1))
+}
+
 func TestValidateRequiredValues(t *testing.T) {
 	for _, tc := range validateRequiredValuesTestCases {
 		t.Run(tc.desc, func(t *testing.T) {
@@ -317,3 +425,288 @@ func TestValidateRequiredValues(t *testing.T) {
 		})
 	}
 }
+
+func TestRegionValidation(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		regions     []Region
+		expectError string
+		expect      []string
+	}{
+		{
+			desc:    "valid region",
+			regions: []Region{{Name: "Region", Territories: []string{"California", "nv"}, Bonus: 2}},
+			expect:  []string{"CA", "NV"},
+		},
+		{
+			desc:        "missing name",
+			regions:     []Region{{Territories: []string{"CA"}, Bonus: 1}},
+			expectError: "region 0 has no name",
+		},
+		{
+			desc: "duplicate name",
+			regions: []Region{
+				{Name: "Region", Territories: []string{"CA"}, Bonus: 1},
+				{Name: "Region", Territories: []string{"NV"}, Bonus: 1},
+			},
+			expectError: `found non-unique region "Region"`,
+		},
+		{
+			desc:        "no territories",
+			regions:     []Region{{Name: "Region", Bonus: 1}},
+			expectError: `region "Region" has no territories`,
+		},
+		{
+			desc:        "negative bonus",
+			regions:     []Region{{Name: "Region", Territories: []string{"CA"}, Bonus: -1}},
+			expectError: `region "Region" has a negative bonus`,
+		},
+		{
+			desc:        "unknown territory",
+			regions:     []Region{{Name: "Region", Territories: []string{"CA", "OR"}, Bonus: 1}},
+			expectError: `region "Region": unrecognized abbreviation, name, or alias "OR"`,
+		},
+		{
+			desc:        "duplicate territory",
+			regions:     []Region{{Name: "Region", Territories: []string{"CA", "California"}, Bonus: 1}},
+			expectError: `region "Region" has territory "CA" more than once`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			tcfg := &Config{Territories: dummyTerritories, Regions: tc.regions}
+			err := tcfg.validateRegions()
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.expect, tcfg.Regions[0].Territories)
+			}
+		})
+	}
+}
+
+func TestNeutralTerritoryValidation(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		neutral     []NeutralTerritory
+		expectError string
+		expect      string
+	}{
+		{
+			desc:    "fixed armies",
+			neutral: []NeutralTerritory{{Territory: "California", Armies: 3}},
+			expect:  "CA",
+		},
+		{
+			desc:    "random armies",
+			neutral: []NeutralTerritory{{Territory: "nv", MinArmies: 1, MaxArmies: 5}},
+			expect:  "NV",
+		},
+		{
+			desc:        "unknown territory",
+			neutral:     []NeutralTerritory{{Territory: "OR", Armies: 1}},
+			expectError: `unrecognized abbreviation, name, or alias "OR"`,
+		},
+		{
+			desc:        "duplicate territory",
+			neutral:     []NeutralTerritory{{Territory: "CA", Armies: 1}, {Territory: "California", Armies: 2}},
+			expectError: `found territory "CA" more than once`,
+		},
+		{
+			desc:        "no armies",
+			neutral:     []NeutralTerritory{{Territory: "CA"}},
+			expectError: `territory "CA" must have armies set, or minArmies set to at least 1 and maxArmies set to at least minArmies`,
+		},
+		{
+			desc:        "fixed and random armies",
+			neutral:     []NeutralTerritory{{Territory: "CA", Armies: 2, MinArmies: 1, MaxArmies: 3}},
+			expectError: `territory "CA" must have either armies or minArmies and maxArmies set, not both`,
+		},
+		{
+			desc:        "too many armies",
+			neutral:     []NeutralTerritory{{Territory: "CA", Armies: 6}},
+			expectError: `territory "CA" has more than maxArmiesPerTerritory (5) armies`,
+		},
+		{
+			desc:        "inverted range",
+			neutral:     []NeutralTerritory{{Territory: "CA", MinArmies: 3, MaxArmies: 2}},
+			expectError: `territory "CA" must have armies set, or minArmies set to at least 1 and maxArmies set to at least minArmies`,
+		},
+		{
+			desc:        "range above maximum",
+			neutral:     []NeutralTerritory{{Territory: "CA", MinArmies: 1, MaxArmies: 6}},
+			expectError: `territory "CA" has a maxArmies greater than maxArmiesPerTerritory (5)`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			tcfg := &Config{Territories: dummyTerritories, MaxArmiesPerTerritory: 5, NeutralTerritories: tc.neutral}
+			err := tcfg.validateNeutralTerritories()
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.expect, tcfg.NeutralTerritories[0].Territory)
+			}
+		})
+	}
+}
+
+func TestTerritoryModifierValidation(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		modifiers   Territory
+		expectError string
+		expectLimit int
+	}{
+		{
+			desc:        "no modifiers",
+			expectLimit: 5,
+		},
+		{
+			desc:        "valid modifiers",
+			modifiers:   Territory{DefenseBonus: 2, MaxArmies: 8, EnterCost: 2},
+			expectLimit: 8,
+		},
+		{
+			desc:        "negative defense bonus",
+			modifiers:   Territory{DefenseBonus: -1},
+			expectError: `territory "CA" has a negative defenseBonus`,
+		},
+		{
+			desc:        "negative max armies",
+			modifiers:   Territory{MaxArmies: -1},
+			expectError: `territory "CA" has a negative maxArmies`,
+		},
+		{
+			desc:        "negative enter cost",
+			modifiers:   Territory{EnterCost: -1},
+			expectError: `territory "CA" has a negative enterCost`,
+		},
+		{
+			desc:        "impassable with modifiers",
+			modifiers:   Territory{Impassable: true, DefenseBonus: 1},
+			expectError: `impassable territory "CA" can't have defenseBonus, maxArmies, or enterCost set`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			ca := tc.modifiers
+			ca.Abbreviation, ca.Name, ca.Neighbors = "CA", "California", []string{"NV"}
+			tcfg := &Config{Territories: []Territory{ca, dummyTerritories[1]}, MaxArmiesPerTerritory: 5}
+			err := tcfg.validateTerritoryModifiers()
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			if assert.NoError(t, err) {
+				territory, err := tcfg.ResolveTerritory("CA")
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectLimit, territory.ArmyLimit())
+				assert.Equal(t, max(tc.modifiers.EnterCost, 1), territory.ActionCost())
+			}
+		})
+	}
+
+	impassable := []Territory{
+		{Abbreviation: "CA", Name: "California", Neighbors: []string{"NV"}, Impassable: true},
+		{Abbreviation: "NV", Name: "Nevada", Neighbors: []string{"CA"}, Impassable: true},
+	}
+	tcfg := &Config{Territories: impassable}
+	assert.EqualError(t, tcfg.validateTerritoryModifiers(), "at least one territory must not be impassable")
+
+	impassable[1].Impassable = false
+	assert.NoError(t, tcfg.validateTerritoryModifiers())
+	assert.Equal(t, 1, tcfg.PassableTerritories())
+	tcfg.Regions = []Region{{Name: "Region", Territories: []string{"CA"}, Bonus: 1}}
+	assert.EqualError(t, tcfg.validateRegions(), `region "Region" has impassable territory "CA"`)
+	tcfg.NeutralTerritories = []NeutralTerritory{{Territory: "CA", Armies: 1}}
+	assert.EqualError(t, tcfg.validateNeutralTerritories(), `territory "CA" is impassable`)
+}
+
+func TestVictoryConditionValidation(t *testing.T) {
+	testCases := []struct {
+		desc        string
+		conditions  VictoryConditions
+		expectError string
+		expect      []string
+	}{
+		{
+			desc:       "valid conditions",
+			conditions: VictoryConditions{TerritoryPercent: 60, Territories: []string{"California"}, Regions: []string{"Region"}},
+			expect:     []string{"CA", "NV"},
+		},
+		{
+			desc:        "percentage out of range",
+			conditions:  VictoryConditions{TerritoryPercent: 101},
+			expectError: "territoryPercent must be between 0 and 100",
+		},
+		{
+			desc:        "negative turn limit",
+			conditions:  VictoryConditions{TurnLimit: -1},
+			expectError: "turnLimit must not be negative",
+		},
+		{
+			desc:        "duplicate territory",
+			conditions:  VictoryConditions{Territories: []string{"CA", "california"}},
+			expectError: `found territory "CA" more than once`,
+		},
+		{
+			desc:        "unknown region",
+			conditions:  VictoryConditions{Regions: []string{"Other"}},
+			expectError: `unrecognized region "Other"`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			tcfg := &Config{
+				Territories:       dummyTerritories,
+				Regions:           []Region{{Name: "Region", Territories: []string{"NV"}, Bonus: 1}},
+				VictoryConditions: tc.conditions,
+			}
+			err := tcfg.validateVictoryConditions()
+			if tc.expectError != "" {
+				assert.EqualError(t, err, tc.expectError)
+				return
+			}
+			if assert.NoError(t, err) {
+				assert.True(t, tcfg.VictoryConditions.Enabled())
+				assert.Equal(t, tc.expect, tcfg.VictoryTerritories())
+			}
+		})
+	}
+}
+
+func TestRegionBonus(t *testing.T) {
+	tcfg := getTestConfig()
+	tcfg.Regions = []Region{
+		{Name: "West Coast", Territories: []string{"CA", "OR", "WA"}, Bonus: 2},
+		{Name: "Four Corners", Territories: []string{"AZ", "CO", "NM", "UT"}, Bonus: 3},
+	}
+	testCases := []struct {
+		desc             string
+		territories      []string
+		expectBonus      int
+		expectControlled []string
+	}{
+		{desc: "no territories"},
+		{desc: "partial region", territories: []string{"CA", "OR", "AZ"}},
+		{desc: "one region", territories: []string{"CA", "OR", "WA", "AZ"}, expectBonus: 2, expectControlled: []string{"West Coast"}},
+		{
+			desc:             "both regions",
+			territories:      []string{"WA", "OR", "CA", "AZ", "CO", "NM", "UT"},
+			expectBonus:      5,
+			expectControlled: []string{"West Coast", "Four Corners"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			bonus, controlled := tcfg.RegionBonus(tc.territories)
+			assert.Equal(t, tc.expectBonus, bonus)
+			assert.Equal(t, tc.expectControlled, controlled)
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Eggbertx/territories-game/pkg/config"
+)
+
+// ActionRecord is an entry in the action log, representing either an action done by a player or the end of a turn
+type ActionRecord struct {
+	ID          int64  `json:"id"`
+	GameID      int64  `json:"gameID"`
+	Turn        int    `json:"turn"`
+	ActionType  string `json:"actionType"`
+	Player      string `json:"player,omitempty"`
+	CountryName string `json:"countryName,omitempty"`
+
+	// IsNewTurn is true if the record represents the end of a turn
+	IsNewTurn bool `json:"isNewTurn"`
+
+	// TurnAction is true if the action counts towards the number of actions the player can take in a turn
+	TurnAction bool `json:"turnAction"`
+
+	// Cost is the number of the player's actions for the turn that the action uses if TurnAction is true. Values less
+	// than 1 are treated as 1
+	Cost int `json:"cost,omitempty"`
+
+	// Details is the JSON representation of the action's inputs and outcome, such as the action result
+	Details json.RawMessage `json:"details,omitempty"`
+
+	// Changes is the state of the nations and holdings changed by the action, used for rebuilding the game state from
+	// the action log
+	Changes *StateChanges `json:"changes,omitempty"`
+
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ActionRecordFilter is used to select action log entries. Zero value fields are not used for filtering
+type ActionRecordFilter struct {
+	GameID     int64
+	Turn       int
+	Player     string
+	ActionType string
+}
+
+// InsertActionRecord adds the record to the action log, setting its ID and turn. If the record has a player, the
+// action is associated with the player's nation. If the record's GameID is 0, it is added to the default game.
+func InsertActionRecord(tx *sql.Tx, record *ActionRecord) error {
+	if tx == nil {
+		return errors.New("a transaction is required to add an action record")
+	}
+	if record.GameID == 0 {
+		record.GameID = config.DefaultGameID
+	}
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now()
+	}
+	var player sql.NullString
+	if record.Player != "" {
+		player = sql.NullString{String: record.Player, Valid: true}
+	}
+	var details sql.NullString
+	if len(record.Details) > 0 {
+		details = sql.NullString{String: string(record.Details), Valid: true}
+	}
+	var changes sql.NullString
+	if record.Changes != nil {
+		ba, err := json.Marshal(record.Changes)
+		if err != nil {
+			return err
+		}
+		changes = sql.NullString{String: string(ba), Valid: true}
+	}
+
+	// the turn number is the number of turns that have ended before this one, plus one
+	record.Cost = max(record.Cost, 1)
+	err := tx.QueryRow(`INSERT INTO actions (game_id, action_type, nation_id, player, is_new_turn, turn_action, action_cost, turn,
+			details, changes, timestamp)
+		VALUES (?1, ?2, (SELECT id FROM nations WHERE game_id = ?1 AND player = ?3), ?3, ?4, ?5, ?6,
+			(SELECT COUNT(*) FROM actions WHERE game_id = ?1 AND is_new_turn = 1) + 1, ?7, ?8, ?9)
+		RETURNING id, turn`,
+		record.GameID, record.ActionType, player, record.IsNewTurn, record.TurnAction, record.Cost, details, changes,
+		record.Timestamp,
+	).Scan(&record.ID, &record.Turn)
+	return err
+}
+
+// GetActionRecords returns the action log entries matching the filter, in the order they were added
+func GetActionRecords(tdb *sql.DB, filter ActionRecordFilter) ([]ActionRecord, error) {
+	query := `SELECT id, game_id, turn, action_type, COALESCE(player, ''), COALESCE(country_name, ''), is_new_turn,
+		turn_action, action_cost, details, changes, timestamp FROM v_actions`
+	var conditions []string
+	var args []any
+	if filter.GameID > 0 {
+		conditions = append(conditions, "game_id = ?")
+		args = append(args, filter.GameID)
+	}
+	if filter.Turn > 0 {
+		conditions = append(conditions, "turn = ?")
+		args = append(args, filter.Turn)
+	}
+	if filter.Player != "" {
+		conditions = append(conditions, "player = ?")
+		args = append(args, filter.Player)
+	}
+	if filter.ActionType != "" {
+		conditions = append(conditions, "action_type = ?")
+		args = append(args, filter.ActionType)
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id"
+
+	rows, err := tdb.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []ActionRecord{}
+	for rows.Next() {
+		var record ActionRecord
+		var details, changes sql.NullString
+		var timestamp SQLite3Timestamp
+		if err = rows.Scan(&record.ID, &record.GameID, &record.Turn, &record.ActionType, &record.Player, &record.CountryName,
+			&record.IsNewTurn, &record.TurnAction, &record.Cost, &details, &changes, &timestamp); err != nil {
+			return nil, err
+		}
+		if details.Valid {
+			record.Details = json.RawMessage(details.String)
+		}
+		if changes.Valid {
+			record.Changes = &StateChanges{}
+			if err = json.Unmarshal([]byte(changes.String), record.Changes); err != nil {
+				return nil, fmt.Errorf("invalid state changes in action %d: %w", record.ID, err)
+			}
+		}
+		record.Timestamp = timestamp.Time
+		records = append(records, record)
+	}
+	return records, rows.Close()
+}
+
+const currentTurnSQL = "SELECT COUNT(*) + 1 FROM actions WHERE game_id = ? AND is_new_turn = 1"
+
+// GetCurrentTurn returns the game's current turn number, starting at 1
+func GetCurrentTurn(tdb *sql.DB, gameID int64) (int, error) {
+	var turn int
+	err := tdb.QueryRow(currentTurnSQL, gameID).Scan(&turn)
+	return turn, err
+}
+
+// CurrentTurn returns the game's current turn number using the given transaction
+func CurrentTurn(tx *sql.Tx, gameID int64) (int, error) {
+	var turn int
+	err := tx.QueryRow(currentTurnSQL, gameID).Scan(&turn)
+	return turn, err
+}
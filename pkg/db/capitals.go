@@ -0,0 +1,30 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// CapitalHolder returns the player whose nation holds the territory as its capital, or an empty string if the territory
+// isn't the capital of the nation holding it
+func CapitalHolder(tx *sql.Tx, gameID int64, territory string) (string, error) {
+	var player string
+	err := tx.QueryRow(`SELECT n.player FROM nations n
+		JOIN holdings h ON h.nation_id = n.id AND h.game_id = n.game_id
+		WHERE n.game_id = ? AND h.territory = ? AND n.capital = h.territory`, gameID, territory).Scan(&player)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return player, err
+}
+
+// SetCapital makes the territory the capital of the player's nation. If onlyIfUnset is true, a nation that already has
+// a capital keeps it
+func SetCapital(tx *sql.Tx, gameID int64, player string, territory string, onlyIfUnset bool) error {
+	query := "UPDATE nations SET capital = ? WHERE game_id = ? AND player = ?"
+	if onlyIfUnset {
+		query += " AND capital IS NULL"
+	}
+	_, err := tx.Exec(query, territory, gameID, player)
+	return err
+}
@@ -0,0 +1,70 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// only offers for holdings still held by the giver apply
+const cessionsSQL = `SELECT cessions.id, cessions.territory, giver, recipient, with_armies, offered_turn
+	FROM cessions JOIN v_nation_holdings AS h ON h.id = cessions.holding_id AND h.player = cessions.giver
+	WHERE cessions.game_id = ?`
+
+// Cession is an offer made with the cede action to give a territory to another nation
+type Cession struct {
+	ID int64 `json:"id"`
+
+	// Territory is the abbreviation of the offered territory
+	Territory string `json:"territory"`
+	Giver     string `json:"giver"`
+	Recipient string `json:"recipient"`
+
+	// WithArmies is true if the armies in the territory are given along with it
+	WithArmies  bool `json:"withArmies"`
+	OfferedTurn int  `json:"offeredTurn"`
+}
+
+func scanCession(row interface{ Scan(...any) error }) (*Cession, error) {
+	var cession Cession
+	if err := row.Scan(&cession.ID, &cession.Territory, &cession.Giver, &cession.Recipient, &cession.WithArmies,
+		&cession.OfferedTurn); err != nil {
+		return nil, err
+	}
+	return &cession, nil
+}
+
+// GetCessions returns the territory offers in the game that haven't been accepted yet
+func GetCessions(tdb *sql.DB, gameID int64) ([]Cession, error) {
+	rows, err := tdb.Query(cessionsSQL+" ORDER BY cessions.id", gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cessions := []Cession{}
+	for rows.Next() {
+		cession, err := scanCession(rows)
+		if err != nil {
+			return nil, err
+		}
+		cessions = append(cessions, *cession)
+	}
+	return cessions, rows.Close()
+}
+
+// GetCession returns the offer of the territory (by abbreviation) that hasn't been accepted yet, or nil if there isn't
+// one
+func GetCession(tx *sql.Tx, gameID int64, territory string) (*Cession, error) {
+	cession, err := scanCession(tx.QueryRow(cessionsSQL+" AND cessions.territory = ?", gameID, territory))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return cession, err
+}
+
+// DeletePlayerCessions removes the territory offers made by or to the player, used when the player's nation is removed
+// from the game
+func DeletePlayerCessions(tx *sql.Tx, gameID int64, player string) error {
+	_, err := tx.Exec("DELETE FROM cessions WHERE game_id = ? AND (giver = ? OR recipient = ?)", gameID, player, player)
+	return err
+}
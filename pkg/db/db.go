@@ -3,7 +3,6 @@ package db
 import (
 	"database/sql"
 	"errors"
-	"net"
 	"strings"
 
 	"github.com/Eggbertx/territories-game/pkg/config"
@@ -14,58 +13,78 @@ import (
 )
 
 var (
+	// ErrNoDatabase is returned when a game is given a nil database
+	ErrNoDatabase = errors.New("no database was given for the game")
+
 	db *sql.DB
 
+	// provisionStr is the initial schema (version 1), see migrate.go
 	//go:embed provision.sql
 	provisionStr string
 )
 
 type HoldingRecord struct {
-	HoldingID   int
-	NationID    int
-	Territory   string
-	ArmySize    int
-	Color       string
-	CountryName string
-	Player      string
+	HoldingID   int    `json:"holdingID"`
+	NationID    int    `json:"nationID"`
+	Territory   string `json:"territory"`
+	ArmySize    int    `json:"armySize"`
+	Color       string `json:"color"`
+	CountryName string `json:"countryName"`
+	Player      string `json:"player"`
+
+	// Hidden is true if the army size is hidden from the player the holding was filtered for by fog of war, in which
+	// case ArmySize is 0
+	Hidden bool `json:"hidden,omitempty"`
 }
 
-func openDB() (*sql.DB, error) {
-	cfg, err := config.GetConfig()
+// Open opens the SQLite database file, creating or upgrading its schema if needed (see ProvisionDB)
+func Open(file string) (*sql.DB, error) {
+	tdb, err := sql.Open("sqlite3", file)
 	if err != nil {
 		return nil, err
 	}
-	db, err = sql.Open("sqlite3", cfg.DBFile)
-	if err != nil {
+	if err = ProvisionDB(tdb); err != nil {
+		tdb.Close()
 		return nil, err
 	}
-	return db, nil
-}
-
-func ProvisionDB(tdb *sql.DB) error {
-	if tdb == nil {
-		return net.ErrClosed
-	}
-	_, err := tdb.Exec(provisionStr)
-	return err
+	return tdb, nil
 }
 
+// GetDB returns the database of the active configuration, opening it and initializing the configured games if it
+// isn't already open
 func GetDB() (*sql.DB, error) {
-	var err error
 	if db == nil {
-		db, err = openDB()
+		cfg, err := config.GetConfig()
+		if err != nil {
+			return nil, err
+		}
+		tdb, err := Open(cfg.DBFile)
 		if err != nil {
 			return nil, err
 		}
-		if err = ProvisionDB(db); err != nil {
-			db.Close()
+		if err = initGames(tdb); err != nil {
+			tdb.Close()
 			return nil, err
 		}
+		db = tdb
 	}
 
 	return db, nil
 }
 
+func initGames(tdb *sql.DB) error {
+	configs, err := config.GetGameConfigs()
+	if err != nil {
+		return err
+	}
+	for _, cfg := range configs {
+		if err = InitGame(tdb, cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // ErrorIsMissingSQLFunction returns true if the error indicates that a required SQLite function is missing, possibly because it
 // was not built with the sqlite_math_functions build tag.
 func ErrorIsMissingSQLFunction(err error) bool {
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"database/sql"
+
+	"github.com/Eggbertx/territories-game/pkg/config"
+)
+
+// VisibleTerritories returns the abbreviations of the territories whose army sizes the player can see in the given
+// holdings if the game uses fog of war: the territories held by the player's nation and the territories that can be
+// reached from them
+func VisibleTerritories(cfg *config.Config, holdings []HoldingRecord, player string) map[string]bool {
+	visible := map[string]bool{}
+	for _, holding := range holdings {
+		if holding.Player != player {
+			continue
+		}
+		visible[holding.Territory] = true
+		territory, err := cfg.ResolveTerritory(holding.Territory)
+		if err != nil {
+			// territory was removed from the configuration, nothing can be seen from it
+			continue
+		}
+		for _, connection := range territory.Connections() {
+			visible[connection.To] = true
+		}
+	}
+	return visible
+}
+
+// FilterHoldings returns the holdings as seen by the player if the game uses fog of war, with the army sizes of the
+// holdings the player can't see hidden. The territories (by abbreviation) scouted by the player in the current turn are
+// also visible. The holdings are returned unchanged if the game doesn't use fog of war
+func FilterHoldings(cfg *config.Config, holdings []HoldingRecord, player string, scouted []string) []HoldingRecord {
+	if !cfg.FogOfWar {
+		return holdings
+	}
+	visible := VisibleTerritories(cfg, holdings, player)
+	for _, territory := range scouted {
+		visible[territory] = true
+	}
+	filtered := make([]HoldingRecord, 0, len(holdings))
+	for _, holding := range holdings {
+		if !visible[holding.Territory] {
+			holding.ArmySize = 0
+			holding.Hidden = true
+		}
+		filtered = append(filtered, holding)
+	}
+	return filtered
+}
+
+// GetVisibleHoldings is like GetHoldings, but returns the holdings as seen by the player, using FilterHoldings with the
+// territories the player scouted in the current turn
+func GetVisibleHoldings(tdb *sql.DB, cfg *config.Config, player string) ([]HoldingRecord, error) {
+	holdings, err := GetHoldings(tdb, cfg.GameID)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.FogOfWar {
+		return holdings, nil
+	}
+	scouted, err := GetScoutedTerritories(tdb, cfg.GameID, player)
+	if err != nil {
+		return nil, err
+	}
+	return FilterHoldings(cfg, holdings, player, scouted), nil
+}
+
+// GetVisibleActionRecords is like GetActionRecords, but returns the records as seen by the player if the game uses fog
+// of war. The holdings changes of the territories the player can't currently see are removed, and so are the details
+// of other players' actions, since they can include the army sizes in hidden territories
+func GetVisibleActionRecords(tdb *sql.DB, cfg *config.Config, filter ActionRecordFilter, player string) ([]ActionRecord, error) {
+	records, err := GetActionRecords(tdb, filter)
+	if err != nil || !cfg.FogOfWar {
+		return records, err
+	}
+	holdings, err := GetHoldings(tdb, cfg.GameID)
+	if err != nil {
+		return nil, err
+	}
+	visible := VisibleTerritories(cfg, holdings, player)
+	scouted, err := GetScoutedTerritories(tdb, cfg.GameID, player)
+	if err != nil {
+		return nil, err
+	}
+	for _, territory := range scouted {
+		visible[territory] = true
+	}
+	for r := range records {
+		if records[r].Player != player {
+			records[r].Details = nil
+		}
+		changes := records[r].Changes
+		if changes == nil || changes.Holdings == nil {
+			continue
+		}
+		filtered := &StateChanges{Nations: changes.Nations, Holdings: map[string]*HoldingState{}}
+		for territory, holding := range changes.Holdings {
+			if visible[territory] {
+				filtered.Holdings[territory] = holding
+			}
+		}
+		records[r].Changes = filtered
+	}
+	return records, nil
+}
+
+const scoutedTerritoriesSQL = `SELECT DISTINCT territory FROM scouted_territories
+	WHERE game_id = ? AND player = ? AND turn = (` + currentTurnSQL + `) ORDER BY territory`
+
+func scanScoutedTerritories(rows *sql.Rows, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	territories := []string{}
+	for rows.Next() {
+		var territory string
+		if err = rows.Scan(&territory); err != nil {
+			return nil, err
+		}
+		territories = append(territories, territory)
+	}
+	return territories, rows.Close()
+}
+
+// GetScoutedTerritories returns the abbreviations of the territories the player scouted in the game's current turn
+func GetScoutedTerritories(tdb *sql.DB, gameID int64, player string) ([]string, error) {
+	return scanScoutedTerritories(tdb.Query(scoutedTerritoriesSQL, gameID, player, gameID))
+}
+
+// ScoutedTerritories returns the abbreviations of the territories the player scouted in the game's current turn using
+// the given transaction
+func ScoutedTerritories(tx *sql.Tx, gameID int64, player string) ([]string, error) {
+	return scanScoutedTerritories(tx.Query(scoutedTerritoriesSQL, gameID, player, gameID))
+}
+
+// AddScoutedTerritory records that the player scouted the territory (by abbreviation) in the game's current turn
+func AddScoutedTerritory(tx *sql.Tx, gameID int64, player string, territory string) error {
+	turn, err := CurrentTurn(tx, gameID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO scouted_territories (game_id, player, territory, turn) VALUES(?, ?, ?, ?)",
+		gameID, player, territory, turn)
+	return err
+}
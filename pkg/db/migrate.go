@@ -0,0 +1,124 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	// migrationsFS contains the schema changes made after the initial schema in provision.sql (version 1). Each file
+	// is named NNNN_description.sql, where NNNN is the schema version the database is at after it is applied
+	//go:embed migrations/*.sql
+	migrationsFS embed.FS
+
+	// ErrSchemaTooNew is returned when the database was created or upgraded by a newer version of territories-game
+	ErrSchemaTooNew = errors.New("database schema is newer than the latest supported version")
+)
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationsFS, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	migrations := []migration{{version: 1, name: "provision.sql", sql: provisionStr}}
+	for _, entry := range entries {
+		versionStr, _, ok := strings.Cut(entry.Name(), "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s is not named NNNN_description.sql", entry.Name())
+		}
+		version, err := strconv.Atoi(versionStr)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s is not named NNNN_description.sql", entry.Name())
+		}
+		ba, err := migrationsFS.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration{version: version, name: entry.Name(), sql: string(ba)})
+	}
+	slices.SortFunc(migrations, func(a, b migration) int {
+		return a.version - b.version
+	})
+	for m := range migrations {
+		if migrations[m].version != m+1 {
+			return nil, fmt.Errorf("expected migration for schema version %d, got %s", m+1, migrations[m].name)
+		}
+	}
+	return migrations, nil
+}
+
+// LatestSchemaVersion returns the schema version that ProvisionDB brings the database to
+func LatestSchemaVersion() (int, error) {
+	migrations, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	return len(migrations), nil
+}
+
+// GetSchemaVersion returns the schema version stored in the database, or 0 if it hasn't been provisioned by a
+// version of territories-game with schema versioning
+func GetSchemaVersion(tdb *sql.DB) (int, error) {
+	var version int
+	err := tdb.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+// ProvisionDB creates the database schema if it doesn't exist, or upgrades it to the latest version by applying
+// each migration it hasn't had applied yet in its own transaction. The schema version is stored in the database's
+// user_version. If the database's schema is newer than the latest known version, ErrSchemaTooNew is returned.
+func ProvisionDB(tdb *sql.DB) error {
+	if tdb == nil {
+		return net.ErrClosed
+	}
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	version, err := GetSchemaVersion(tdb)
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("%w (database version: %d, latest version: %d)", ErrSchemaTooNew, version, len(migrations))
+	}
+
+	// databases created before schema versioning have a user_version of 0 and the initial schema, which
+	// provision.sql leaves as is since it only creates what doesn't exist
+	for _, m := range migrations[version:] {
+		if err = applyMigration(tdb, m); err != nil {
+			return fmt.Errorf("unable to migrate database to schema version %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(tdb *sql.DB, m migration) error {
+	tx, err := tdb.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err = tx.Exec(m.sql); err != nil {
+		return err
+	}
+	// PRAGMA statements don't accept parameters
+	if _, err = tx.Exec("PRAGMA user_version = " + strconv.Itoa(m.version)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/Eggbertx/territories-game/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := loadMigrations()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, "provision.sql", migrations[0].name)
+	for m, migration := range migrations {
+		assert.Equal(t, m+1, migration.version)
+		assert.NotEmpty(t, migration.sql)
+	}
+}
+
+// openUnversionedDB creates a database using only provision.sql, the way it was done before schema versioning
+func openUnversionedDB(t *testing.T) *sql.DB {
+	t.Helper()
+	cfg, err := config.GetTestingConfig(t)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	tdb, err := sql.Open("sqlite3", cfg.DBFile)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	_, err = tdb.Exec(provisionStr)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return tdb
+}
+
+func TestUpgradeUnversionedDB(t *testing.T) {
+	tdb := openUnversionedDB(t)
+	defer func() {
+		assert.NoError(t, CloseDB())
+		config.CloseTestingConfig(t)
+	}()
+
+	_, err := tdb.Exec(`INSERT INTO nations (id, country_name, player, color) VALUES (1, 'Nation 1', 'Test User', 'ff0000');
+		INSERT INTO holdings (territory, nation_id, army_size) VALUES ('CA', 1, 3);
+		INSERT INTO actions (action_type, nation_id) VALUES ('join', 1);
+		INSERT INTO actions (action_type, is_new_turn) VALUES ('end_turn', 1);
+		INSERT INTO actions (action_type, nation_id) VALUES ('raise', 1);`)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	version, err := GetSchemaVersion(tdb)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, version)
+	if !assert.NoError(t, tdb.Close()) {
+		t.FailNow()
+	}
+
+	tdb, err = GetDB()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	latest, err := LatestSchemaVersion()
+	assert.NoError(t, err)
+	version, err = GetSchemaVersion(tdb)
+	assert.NoError(t, err)
+	assert.Equal(t, latest, version)
+
+	// existing data is kept and the new columns are filled in
+	records, err := GetActionRecords(tdb, ActionRecordFilter{})
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	var turns []int
+	for _, record := range records {
+		turns = append(turns, record.Turn)
+		if !record.IsNewTurn {
+			assert.Equal(t, "Test User", record.Player)
+			assert.True(t, record.TurnAction)
+		}
+		assert.Nil(t, record.Changes)
+	}
+	assert.Equal(t, []int{1, 1, 2}, turns)
+	turn, err := GetCurrentTurn(tdb, config.DefaultGameID)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, turn)
+
+	holdings, err := GetHoldings(tdb, config.DefaultGameID)
+	assert.NoError(t, err)
+	if assert.Len(t, holdings, 1) {
+		assert.Equal(t, "Test User", holdings[0].Player)
+	}
+
+	// the game was initialized by the new games table
+	_, _, err = GetRandomSeed(tdb, config.DefaultGameID)
+	assert.NoError(t, err)
+
+	// provisioning an up to date database doesn't change it
+	assert.NoError(t, ProvisionDB(tdb))
+	version, err = GetSchemaVersion(tdb)
+	assert.NoError(t, err)
+	assert.Equal(t, latest, version)
+}
+
+func TestRejectNewerSchema(t *testing.T) {
+	tdb := openUnversionedDB(t)
+	defer func() {
+		assert.NoError(t, CloseDB())
+		config.CloseTestingConfig(t)
+	}()
+	assert.NoError(t, ProvisionDB(tdb))
+	_, err := tdb.Exec("PRAGMA user_version = 1000")
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, ProvisionDB(tdb), ErrSchemaTooNew)
+	version, err := GetSchemaVersion(tdb)
+	assert.NoError(t, err)
+	assert.Equal(t, 1000, version, "expected the database to be left as is")
+	assert.NoError(t, tdb.Close())
+
+	_, err = GetDB()
+	assert.ErrorIs(t, err, ErrSchemaTooNew)
+	assert.Nil(t, db, "expected the database to be closed after failing to provision it")
+}
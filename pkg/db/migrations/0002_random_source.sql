@@ -0,0 +1,6 @@
+-- the game's random seed and the number of random numbers drawn from it, so that a game can be replayed exactly
+CREATE TABLE games (
+	id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	random_seed INTEGER NOT NULL,
+	random_draws INTEGER NOT NULL DEFAULT 0
+);
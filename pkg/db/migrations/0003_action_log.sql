@@ -0,0 +1,24 @@
+-- record the player, turn, and details of each action so that the action log can be queried
+ALTER TABLE actions ADD COLUMN player VARCHAR(90);
+ALTER TABLE actions ADD COLUMN turn_action BOOLEAN NOT NULL DEFAULT 1;
+ALTER TABLE actions ADD COLUMN turn INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE actions ADD COLUMN details TEXT;
+
+UPDATE actions SET
+	player = (SELECT player FROM nations WHERE nations.id = actions.nation_id),
+	turn = (SELECT COUNT(*) FROM actions AS previous WHERE previous.is_new_turn = 1 AND previous.id < actions.id) + 1;
+
+CREATE INDEX actions_turn_idx ON actions(turn);
+
+DROP VIEW v_current_turn_player_actions;
+DROP VIEW v_actions;
+
+CREATE VIEW v_actions
+	AS SELECT actions.id as id, nations.id as nation_id, country_name, COALESCE(nations.player, actions.player) as player,
+		action_type, is_new_turn, turn_action, turn, details, timestamp
+	FROM actions left join nations on nation_id = nations.id;
+
+CREATE VIEW v_current_turn_player_actions
+	AS SELECT player, count(*) as actions_completed FROM v_actions
+	WHERE turn_action = 1 AND id > COALESCE((SELECT MAX(id) FROM v_new_turn_actions), 0)
+	GROUP BY player;
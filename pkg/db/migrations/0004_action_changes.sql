@@ -0,0 +1,16 @@
+-- record the state of the nations and holdings changed by each action so that the game state can be rebuilt from the
+-- action log
+ALTER TABLE actions ADD COLUMN changes TEXT;
+
+DROP VIEW v_current_turn_player_actions;
+DROP VIEW v_actions;
+
+CREATE VIEW v_actions
+	AS SELECT actions.id as id, nations.id as nation_id, country_name, COALESCE(nations.player, actions.player) as player,
+		action_type, is_new_turn, turn_action, turn, details, changes, timestamp
+	FROM actions left join nations on nation_id = nations.id;
+
+CREATE VIEW v_current_turn_player_actions
+	AS SELECT player, count(*) as actions_completed FROM v_actions
+	WHERE turn_action = 1 AND id > COALESCE((SELECT MAX(id) FROM v_new_turn_actions), 0)
+	GROUP BY player;
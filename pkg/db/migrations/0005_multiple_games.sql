@@ -0,0 +1,96 @@
+-- add the game ID to the nations, holdings, and actions tables so that a database can have more than one game. Since
+-- SQLite can't change constraints, the tables are rebuilt with unique constraints scoped to the game. Existing rows
+-- are in the default game (1)
+DROP VIEW v_current_turn_player_actions;
+DROP VIEW v_new_turn_actions;
+DROP VIEW v_actions;
+DROP VIEW v_nation_holdings;
+DROP INDEX actions_turn_idx;
+
+CREATE TABLE nations_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	game_id INTEGER NOT NULL DEFAULT 1,
+	country_name VARCHAR(125) NOT NULL,
+	player VARCHAR(90) NOT NULL,
+	color CHAR(25) NOT NULL,
+	CONSTRAINT country_name_length CHECK(LENGTH(country_name) > 0),
+	CONSTRAINT player_length CHECK(LENGTH(player) > 0),
+	CONSTRAINT unique_country_name UNIQUE(game_id, country_name)
+	CONSTRAINT unique_player UNIQUE(game_id, player)
+	CONSTRAINT color_length CHECK(LENGTH(color) = 6 OR LENGTH(color) = 3),
+	CONSTRAINT unique_color UNIQUE(game_id, color)
+);
+INSERT INTO nations_new (id, game_id, country_name, player, color)
+	SELECT id, 1, country_name, player, color FROM nations;
+
+CREATE TABLE holdings_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	game_id INTEGER NOT NULL DEFAULT 1,
+	territory VARCHAR(45) NOT NULL,
+	nation_id INTEGER NOT NULL,
+	army_size INTEGER NOT NULL CHECK(army_size > 0),
+
+	CONSTRAINT unique_territory UNIQUE(game_id, territory),
+	CONSTRAINT holdings_nations_id_fk
+		FOREIGN KEY(nation_id)
+		REFERENCES nations(id)
+		ON DELETE CASCADE
+);
+INSERT INTO holdings_new (id, game_id, territory, nation_id, army_size)
+	SELECT id, 1, territory, nation_id, army_size FROM holdings;
+
+CREATE TABLE actions_new (
+	id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	game_id INTEGER NOT NULL DEFAULT 1,
+	action_type VARCHAR(45) NOT NULL,
+	nation_id INTEGER,
+	player VARCHAR(90),
+	is_new_turn BOOLEAN NOT NULL DEFAULT 0,
+	turn_action BOOLEAN NOT NULL DEFAULT 1,
+	turn INTEGER NOT NULL DEFAULT 1,
+	details TEXT,
+	changes TEXT,
+	timestamp DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+	CONSTRAINT actions_nation_id_fk
+		FOREIGN KEY(nation_id)
+		REFERENCES nations(id)
+		ON DELETE SET NULL
+);
+INSERT INTO actions_new (id, game_id, action_type, nation_id, player, is_new_turn, turn_action, turn, details, changes, timestamp)
+	SELECT id, 1, action_type, nation_id, player, is_new_turn, turn_action, turn, details, changes, timestamp FROM actions;
+
+-- keep the AUTOINCREMENT sequences so that the IDs of deleted rows aren't reused
+DELETE FROM sqlite_sequence WHERE name IN ('nations_new', 'holdings_new', 'actions_new');
+INSERT INTO sqlite_sequence (name, seq)
+	SELECT name || '_new', seq FROM sqlite_sequence WHERE name IN ('nations', 'holdings', 'actions');
+
+DROP TABLE actions;
+DROP TABLE holdings;
+DROP TABLE nations;
+ALTER TABLE nations_new RENAME TO nations;
+ALTER TABLE holdings_new RENAME TO holdings;
+ALTER TABLE actions_new RENAME TO actions;
+
+CREATE INDEX actions_game_turn_idx ON actions(game_id, turn);
+
+CREATE VIEW v_nation_holdings
+	AS SELECT holdings.id as id, holdings.game_id as game_id, nations.id as nation_id, country_name, color, territory,
+		army_size, player
+	FROM holdings left join nations on nation_id = nations.id;
+
+CREATE VIEW v_actions
+	AS SELECT actions.id as id, actions.game_id as game_id, nations.id as nation_id, country_name,
+		COALESCE(nations.player, actions.player) as player, action_type, is_new_turn, turn_action, turn, details, changes,
+		timestamp
+	FROM actions left join nations on nation_id = nations.id;
+
+CREATE VIEW v_new_turn_actions
+	AS SELECT actions.id as id, game_id, timestamp
+	FROM actions WHERE is_new_turn = 1;
+
+CREATE VIEW v_current_turn_player_actions
+	AS SELECT game_id, player, count(*) as actions_completed FROM v_actions
+	WHERE turn_action = 1 AND id > COALESCE((SELECT MAX(id) FROM v_new_turn_actions
+		WHERE v_new_turn_actions.game_id = v_actions.game_id), 0)
+	GROUP BY game_id, player;
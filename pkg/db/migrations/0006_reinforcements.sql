@@ -0,0 +1,2 @@
+-- the number of armies each nation has been granted at the end of a turn and hasn't deployed yet
+ALTER TABLE nations ADD COLUMN reinforcements INTEGER NOT NULL DEFAULT 0 CHECK(reinforcements >= 0);
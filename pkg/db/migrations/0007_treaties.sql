@@ -0,0 +1,17 @@
+-- treaties (alliances and non-aggression pacts) between two nations, identified by their players. A treaty is pending
+-- until the recipient accepts it, and when it is broken it stops applying at the start of ends_turn
+CREATE TABLE treaties (
+	id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	game_id INTEGER NOT NULL DEFAULT 1,
+	treaty_type VARCHAR(20) NOT NULL,
+	proposer VARCHAR(90) NOT NULL,
+	recipient VARCHAR(90) NOT NULL,
+	proposed_turn INTEGER NOT NULL,
+	accepted_turn INTEGER,
+	broken_by VARCHAR(90),
+	ends_turn INTEGER,
+
+	CONSTRAINT valid_treaty_type CHECK(treaty_type IN ('alliance', 'non_aggression')),
+	CONSTRAINT different_players CHECK(proposer <> recipient)
+);
+CREATE INDEX treaties_game_idx ON treaties(game_id);
@@ -0,0 +1,15 @@
+-- territories offered by one nation to another with the cede action, waiting for the recipient to accept them. An
+-- offer only applies while the holding it was made for is still held by the giver
+CREATE TABLE cessions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	game_id INTEGER NOT NULL DEFAULT 1,
+	holding_id INTEGER NOT NULL,
+	territory VARCHAR(45) NOT NULL,
+	giver VARCHAR(90) NOT NULL,
+	recipient VARCHAR(90) NOT NULL,
+	with_armies BOOLEAN NOT NULL DEFAULT 0,
+	offered_turn INTEGER NOT NULL,
+
+	CONSTRAINT unique_territory_offer UNIQUE(game_id, territory),
+	CONSTRAINT different_players CHECK(giver <> recipient)
+);
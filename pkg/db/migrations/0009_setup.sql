@@ -0,0 +1,3 @@
+-- whether the game's territories have been dealt or drafted, for games that don't have players choose the territory
+-- their nation starts in
+ALTER TABLE games ADD COLUMN setup_done BOOLEAN NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+-- the nation that won the game and the victory condition it met, set when the game is over
+ALTER TABLE games ADD COLUMN winner VARCHAR(90);
+ALTER TABLE games ADD COLUMN winner_country VARCHAR(125);
+ALTER TABLE games ADD COLUMN victory_condition VARCHAR(45);
@@ -0,0 +1,3 @@
+-- the territory each nation has as its capital, which is given a defense bonus and may cripple or eliminate the nation
+-- when its armies are destroyed
+ALTER TABLE nations ADD COLUMN capital VARCHAR(45);
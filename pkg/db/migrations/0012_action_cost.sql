@@ -0,0 +1,18 @@
+-- the number of the player's actions for the turn that each action uses, which may be more than one for moves into
+-- territories with an entry cost
+ALTER TABLE actions ADD COLUMN action_cost INTEGER NOT NULL DEFAULT 1;
+
+DROP VIEW v_current_turn_player_actions;
+DROP VIEW v_actions;
+
+CREATE VIEW v_actions
+	AS SELECT actions.id as id, actions.game_id as game_id, nations.id as nation_id, country_name,
+		COALESCE(nations.player, actions.player) as player, action_type, is_new_turn, turn_action, action_cost, turn,
+		details, changes, timestamp
+	FROM actions left join nations on nation_id = nations.id;
+
+CREATE VIEW v_current_turn_player_actions
+	AS SELECT game_id, player, SUM(action_cost) as actions_completed FROM v_actions
+	WHERE turn_action = 1 AND id > COALESCE((SELECT MAX(id) FROM v_new_turn_actions
+		WHERE v_new_turn_actions.game_id = v_actions.game_id), 0)
+	GROUP BY game_id, player;
@@ -0,0 +1,9 @@
+-- territories scouted by each player with the scout action. If the game uses fog of war, the army size in a scouted
+-- territory is visible to the player until the end of the turn it was scouted in
+CREATE TABLE scouted_territories (
+	id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	game_id INTEGER NOT NULL DEFAULT 1,
+	player VARCHAR(90) NOT NULL,
+	territory VARCHAR(45) NOT NULL,
+	turn INTEGER NOT NULL
+);
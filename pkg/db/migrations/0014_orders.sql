@@ -0,0 +1,17 @@
+-- move, attack, and raise actions submitted in games using simultaneous resolution, which are stored until they are
+-- resolved together when the turn they were submitted in ends. Resolved orders are kept as the turn's resolution report
+CREATE TABLE orders (
+	id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+	game_id INTEGER NOT NULL DEFAULT 1,
+	turn INTEGER NOT NULL,
+	player VARCHAR(90) NOT NULL,
+	order_type VARCHAR(16) NOT NULL,
+	source VARCHAR(45) NOT NULL,
+	destination VARCHAR(45),
+	armies INTEGER NOT NULL DEFAULT 0,
+	status VARCHAR(16) NOT NULL DEFAULT 'pending',
+	outcome TEXT,
+
+	CONSTRAINT valid_order_type CHECK(order_type IN ('move', 'attack', 'raise')),
+	CONSTRAINT valid_status CHECK(status IN ('pending', 'resolved', 'bounced', 'standoff', 'void'))
+);
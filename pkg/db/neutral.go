@@ -0,0 +1,69 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/Eggbertx/territories-game/pkg/config"
+)
+
+// NeutralPlayer is the player of a game's neutral nation, which holds territories that aren't controlled by any player.
+// It never takes actions, and isn't counted as a player when checking if the game can start or the turn is done
+const NeutralPlayer = "(neutral)"
+
+// NeutralNationID returns the ID of the game's neutral nation, adding it with the configured name and color if it
+// doesn't exist yet
+func NeutralNationID(tx *sql.Tx, cfg *config.Config) (int64, error) {
+	var id int64
+	err := tx.QueryRow("SELECT id FROM nations WHERE game_id = ? AND player = ?", cfg.GameID, NeutralPlayer).Scan(&id)
+	if err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return id, err
+	}
+
+	res, err := tx.Exec("INSERT INTO nations (game_id, country_name, player, color) VALUES(?,?,?,?)",
+		cfg.GameID, cfg.NeutralNationName, NeutralPlayer, cfg.NeutralColor)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// seedNeutralTerritories gives the configured neutral territories to the neutral nation and logs them, so that they are
+// included when the game is replayed. The number of armies in territories with a range is drawn from the game's random
+// source
+func seedNeutralTerritories(tx *sql.Tx, cfg *config.Config) error {
+	nationID, err := NeutralNationID(tx, cfg)
+	if err != nil {
+		return err
+	}
+	src, err := NewGameRandomSource(tx, cfg.GameID)
+	if err != nil {
+		return err
+	}
+	territories := make([]string, 0, len(cfg.NeutralTerritories))
+	for _, neutral := range cfg.NeutralTerritories {
+		armies := neutral.Armies
+		if armies == 0 {
+			roll, err := src.IntN(neutral.MaxArmies - neutral.MinArmies + 1)
+			if err != nil {
+				return err
+			}
+			armies = neutral.MinArmies + roll
+		}
+		if _, err = tx.Exec("INSERT INTO holdings (game_id, nation_id, territory, army_size) VALUES(?,?,?,?)",
+			cfg.GameID, nationID, neutral.Territory, armies); err != nil {
+			return err
+		}
+		territories = append(territories, neutral.Territory)
+	}
+
+	record := &ActionRecord{
+		GameID:     cfg.GameID,
+		ActionType: "neutral",
+		Player:     NeutralPlayer,
+	}
+	if record.Changes, err = CaptureStateChanges(tx, cfg.GameID, []string{NeutralPlayer}, territories); err != nil {
+		return err
+	}
+	return InsertActionRecord(tx, record)
+}
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"database/sql"
+)
+
+const (
+	// OrderPending is the status of an order that hasn't been resolved yet
+	OrderPending = "pending"
+	// OrderResolved is the status of an order that was applied when the turn ended
+	OrderResolved = "resolved"
+	// OrderBounced is the status of an order that was stopped by a stronger conflicting order
+	OrderBounced = "bounced"
+	// OrderStandoff is the status of an order that was stopped by an equally strong conflicting order, which was also
+	// stopped
+	OrderStandoff = "standoff"
+	// OrderVoid is the status of an order that was no longer valid when it was resolved, for example because the
+	// player lost the territory it was given from
+	OrderVoid = "void"
+)
+
+const ordersSQL = `SELECT id, turn, player, order_type, source, coalesce(destination, ''), armies, status,
+	coalesce(outcome, '') FROM orders WHERE game_id = ?`
+
+// Order is a move, attack, or raise action submitted in a game using simultaneous resolution, which is stored until it
+// is resolved when the turn ends
+type Order struct {
+	ID     int64  `json:"id"`
+	Turn   int    `json:"turn"`
+	Player string `json:"player"`
+
+	// Type is the type of the action, "move", "attack", or "raise"
+	Type string `json:"type"`
+
+	// Source is the abbreviation of the territory the armies are moved from, the attacking territory, or the
+	// territory an army is raised in
+	Source string `json:"source"`
+
+	// Destination is the abbreviation of the territory the armies are moved to or the defending territory
+	Destination string `json:"destination,omitempty"`
+
+	// Armies is the number of armies moved, or 0 to move all of the armies in the source territory
+	Armies int `json:"armies,omitempty"`
+
+	Status string `json:"status"`
+
+	// Outcome describes the result of the order once it has been resolved
+	Outcome string `json:"outcome,omitempty"`
+}
+
+func scanOrders(rows *sql.Rows, err error) ([]Order, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []Order{}
+	for rows.Next() {
+		var order Order
+		if err = rows.Scan(&order.ID, &order.Turn, &order.Player, &order.Type, &order.Source, &order.Destination,
+			&order.Armies, &order.Status, &order.Outcome); err != nil {
+			return nil, err
+		}
+		orders = append(orders, order)
+	}
+	return orders, rows.Close()
+}
+
+// GetOrders returns the orders submitted in the given turn of the game, or only those submitted by the player if
+// player is not empty. The orders of a turn that has ended are its resolution report
+func GetOrders(tdb *sql.DB, gameID int64, turn int, player string) ([]Order, error) {
+	query := ordersSQL + " AND turn = ?"
+	args := []any{gameID, turn}
+	if player != "" {
+		query += " AND player = ?"
+		args = append(args, player)
+	}
+	return scanOrders(tdb.Query(query+" ORDER BY id", args...))
+}
+
+// PendingOrders returns the orders in the game that haven't been resolved yet, in the order they were submitted
+func PendingOrders(tx *sql.Tx, gameID int64) ([]Order, error) {
+	return scanOrders(tx.Query(ordersSQL+" AND status = ? ORDER BY id", gameID, OrderPending))
+}
+
+// InsertOrder adds the order to the game in the current turn, setting its ID, turn, and status
+func InsertOrder(tx *sql.Tx, gameID int64, order *Order) error {
+	var err error
+	if order.Turn, err = CurrentTurn(tx, gameID); err != nil {
+		return err
+	}
+	order.Status = OrderPending
+	var destination sql.NullString
+	if order.Destination != "" {
+		destination = sql.NullString{String: order.Destination, Valid: true}
+	}
+	res, err := tx.Exec(`INSERT INTO orders (game_id, turn, player, order_type, source, destination, armies)
+		VALUES(?,?,?,?,?,?,?)`, gameID, order.Turn, order.Player, order.Type, order.Source, destination, order.Armies)
+	if err != nil {
+		return err
+	}
+	order.ID, err = res.LastInsertId()
+	return err
+}
+
+// SetOrderOutcome sets the status and outcome of the order after it is resolved
+func SetOrderOutcome(tx *sql.Tx, order *Order, status string, outcome string) error {
+	order.Status = status
+	order.Outcome = outcome
+	_, err := tx.Exec("UPDATE orders SET status = ?, outcome = ? WHERE id = ?", status, outcome, order.ID)
+	return err
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/Eggbertx/territories-game/pkg/config"
+)
+
+// RandomSource is a source of random numbers for in-game events such as die rolls and random colors
+type RandomSource interface {
+	// IntN returns a random number in the half-open interval [0,n)
+	IntN(n int) (int, error)
+}
+
+// GameRandomSource is a deterministic RandomSource seeded with the game's random seed. Each number is determined by the
+// seed and the number of numbers previously drawn, which is stored in the database using the same transaction as the
+// action, so a game can be replayed exactly from its seed and its action log, and numbers drawn by an action that was
+// rolled back aren't counted.
+type GameRandomSource struct {
+	tx     *sql.Tx
+	gameID int64
+	seed   int64
+	draws  int64
+}
+
+// NewGameRandomSource returns a GameRandomSource for the given game that stores the number of draws using the given
+// transaction
+func NewGameRandomSource(tx *sql.Tx, gameID int64) (*GameRandomSource, error) {
+	if tx == nil {
+		return nil, errors.New("a transaction is required for the game random source")
+	}
+	src := &GameRandomSource{tx: tx, gameID: gameID}
+	if err := tx.QueryRow("SELECT random_seed, random_draws FROM games WHERE id = ?", gameID).Scan(&src.seed, &src.draws); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = fmt.Errorf("game %d has not been initialized", gameID)
+		}
+		return nil, err
+	}
+	return src, nil
+}
+
+// IntN returns the next random number in [0,n) and increments the stored number of draws
+func (src *GameRandomSource) IntN(n int) (int, error) {
+	if n <= 0 {
+		return 0, fmt.Errorf("invalid random number range: %d", n)
+	}
+	value := rand.New(rand.NewPCG(uint64(src.seed), uint64(src.draws))).IntN(n)
+	if _, err := src.tx.Exec("UPDATE games SET random_draws = random_draws + 1 WHERE id = ?", src.gameID); err != nil {
+		return 0, err
+	}
+	src.draws++
+	return value, nil
+}
+
+// GetRandomSeed returns the game's random seed and the number of random numbers drawn so far
+func GetRandomSeed(tdb *sql.DB, gameID int64) (seed int64, draws int64, err error) {
+	err = tdb.QueryRow("SELECT random_seed, random_draws FROM games WHERE id = ?", gameID).Scan(&seed, &draws)
+	return seed, draws, err
+}
+
+// InitGame creates the configured game's row if it doesn't already exist, using the configured random seed or
+// generating one, and gives the configured neutral territories to the neutral nation when the game is created. GetDB
+// does this for every game configured when the database is opened.
+func InitGame(tdb *sql.DB, cfg *config.Config) error {
+	seed := cfg.RandomSeed
+	for seed == 0 {
+		seed = rand.Int64()
+	}
+	tx, err := tdb.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO games (id, random_seed) SELECT ?, ? WHERE NOT EXISTS (SELECT 1 FROM games WHERE id = ?)",
+		cfg.GameID, seed, cfg.GameID)
+	if err != nil {
+		return err
+	}
+	created, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if created > 0 && len(cfg.NeutralTerritories) > 0 {
+		if err = seedNeutralTerritories(tx, cfg); err != nil {
+			return fmt.Errorf("failed to add neutral territories: %w", err)
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/Eggbertx/territories-game/pkg/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// drawRandomNumbers opens a fresh test database with the given seed and returns the first n numbers drawn from it
+func drawRandomNumbers(t *testing.T, seed int64, n int) []int {
+	t.Helper()
+	cfg, err := config.GetTestingConfig(t)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cfg.RandomSeed = seed
+	defer func() {
+		assert.NoError(t, CloseDB())
+		config.CloseTestingConfig(t)
+	}()
+	tdb, err := GetDB()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	storedSeed, draws, err := GetRandomSeed(tdb, config.DefaultGameID)
+	assert.NoError(t, err)
+	assert.Equal(t, seed, storedSeed)
+	assert.EqualValues(t, 0, draws)
+
+	// numbers drawn in a transaction that is rolled back aren't counted
+	tx, err := tdb.Begin()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	src, err := NewGameRandomSource(tx, config.DefaultGameID)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	rolledBack, err := src.IntN(1000)
+	assert.NoError(t, err)
+	assert.NoError(t, tx.Rollback())
+
+	var numbers []int
+	for range n {
+		tx, err = tdb.Begin()
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		src, err = NewGameRandomSource(tx, config.DefaultGameID)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		num, err := src.IntN(1000)
+		assert.NoError(t, err)
+		assert.NoError(t, tx.Commit())
+		numbers = append(numbers, num)
+	}
+	assert.Equal(t, rolledBack, numbers[0], "expected the rolled back draw to be repeated")
+
+	_, draws, err = GetRandomSeed(tdb, config.DefaultGameID)
+	assert.NoError(t, err)
+	assert.EqualValues(t, n, draws)
+	return numbers
+}
+
+func TestGameRandomSource(t *testing.T) {
+	first := drawRandomNumbers(t, 42, 10)
+	second := drawRandomNumbers(t, 42, 10)
+	assert.Equal(t, first, second, "expected the same seed to produce the same numbers")
+
+	other := drawRandomNumbers(t, 43, 10)
+	assert.NotEqual(t, first, other, "expected different seeds to produce different numbers")
+}
+
+func TestInitGameNeutralTerritories(t *testing.T) {
+	cfg, err := config.GetTestingConfig(t)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cfg.DoTurnManagement = false
+	cfg.NeutralTerritories = []config.NeutralTerritory{
+		{Territory: "CA", Armies: 3},
+		{Territory: "Nevada", MinArmies: 2, MaxArmies: 4},
+	}
+	if !assert.NoError(t, config.SetConfig(cfg)) {
+		t.FailNow()
+	}
+	defer func() {
+		assert.NoError(t, CloseDB())
+		config.CloseTestingConfig(t)
+	}()
+	tdb, err := GetDB()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	// initializing the game again doesn't add the territories again
+	assert.NoError(t, InitGame(tdb, cfg))
+
+	rows, err := tdb.Query("SELECT territory, army_size, player FROM v_nation_holdings WHERE game_id = ? ORDER BY territory", cfg.GameID)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer rows.Close()
+	armies := map[string]int{}
+	for rows.Next() {
+		var territory, player string
+		var size int
+		if !assert.NoError(t, rows.Scan(&territory, &size, &player)) {
+			t.FailNow()
+		}
+		assert.Equal(t, NeutralPlayer, player)
+		armies[territory] = size
+	}
+	assert.NoError(t, rows.Close())
+	assert.Len(t, armies, 2)
+	assert.Equal(t, 3, armies["CA"])
+	assert.GreaterOrEqual(t, armies["NV"], 2)
+	assert.LessOrEqual(t, armies["NV"], 4)
+
+	_, draws, err := GetRandomSeed(tdb, cfg.GameID)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, draws, "expected a random number to be drawn for the territory with a range")
+
+	records, err := GetActionRecords(tdb, ActionRecordFilter{GameID: cfg.GameID, ActionType: "neutral"})
+	if assert.NoError(t, err) && assert.Len(t, records, 1) {
+		assert.Equal(t, NeutralPlayer, records[0].Player)
+		if assert.NotNil(t, records[0].Changes) {
+			assert.Len(t, records[0].Changes.Holdings, 2)
+			assert.Equal(t, armies["NV"], records[0].Changes.Holdings["NV"].Armies)
+		}
+	}
+}
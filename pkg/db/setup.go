@@ -0,0 +1,24 @@
+package db
+
+import "database/sql"
+
+// SetupDone returns true if the game's territories have been dealt or drafted. It is only used by games with a setup
+// mode other than "claim". If tx is nil, the database is queried directly
+func SetupDone(tdb *sql.DB, tx *sql.Tx, gameID int64) (bool, error) {
+	const query = "SELECT setup_done FROM games WHERE id = ?"
+	var row *sql.Row
+	if tx != nil {
+		row = tx.QueryRow(query, gameID)
+	} else {
+		row = tdb.QueryRow(query, gameID)
+	}
+	var done bool
+	err := row.Scan(&done)
+	return done, err
+}
+
+// CompleteSetup marks the game's territories as dealt or drafted, allowing the players to start taking turns
+func CompleteSetup(tx *sql.Tx, gameID int64) error {
+	_, err := tx.Exec("UPDATE games SET setup_done = 1 WHERE id = ?", gameID)
+	return err
+}
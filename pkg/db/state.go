@@ -0,0 +1,72 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// NationState is the state of a nation at a point in the game
+type NationState struct {
+	ID          int64  `json:"id"`
+	CountryName string `json:"countryName"`
+	Color       string `json:"color"`
+
+	// Reinforcements is the number of armies the nation has been granted and hasn't deployed yet
+	Reinforcements int `json:"reinforcements,omitempty"`
+
+	// Capital is the abbreviation of the nation's capital territory, if it has one
+	Capital string `json:"capital,omitempty"`
+}
+
+// HoldingState is the state of a claimed territory at a point in the game
+type HoldingState struct {
+	Player string `json:"player"`
+	Armies int    `json:"armies"`
+}
+
+// StateChanges is the state of the nations (by player) and holdings (by territory abbreviation) that were changed by
+// an action, after the action was done. A nil value means that the nation was removed from the game or that the
+// territory is unclaimed.
+type StateChanges struct {
+	Nations  map[string]*NationState  `json:"nations,omitempty"`
+	Holdings map[string]*HoldingState `json:"holdings,omitempty"`
+}
+
+// CaptureStateChanges returns the current state of the given players' nations and the given territories' holdings in
+// the game
+func CaptureStateChanges(tx *sql.Tx, gameID int64, players []string, territories []string) (*StateChanges, error) {
+	changes := &StateChanges{}
+	if len(players) > 0 {
+		changes.Nations = make(map[string]*NationState)
+	}
+	for _, player := range players {
+		var nation NationState
+		err := tx.QueryRow(`SELECT id, country_name, color, reinforcements, COALESCE(capital, '')
+			FROM nations WHERE game_id = ? AND player = ?`, gameID, player).Scan(
+			&nation.ID, &nation.CountryName, &nation.Color, &nation.Reinforcements, &nation.Capital)
+		if errors.Is(err, sql.ErrNoRows) {
+			changes.Nations[player] = nil
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		changes.Nations[player] = &nation
+	}
+
+	if len(territories) > 0 {
+		changes.Holdings = make(map[string]*HoldingState)
+	}
+	for _, territory := range territories {
+		var holding HoldingState
+		err := tx.QueryRow("SELECT player, army_size FROM v_nation_holdings WHERE game_id = ? AND territory = ?", gameID, territory).Scan(
+			&holding.Player, &holding.Armies)
+		if errors.Is(err, sql.ErrNoRows) {
+			changes.Holdings[territory] = nil
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		changes.Holdings[territory] = &holding
+	}
+	return changes, nil
+}
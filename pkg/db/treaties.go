@@ -0,0 +1,141 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+)
+
+const (
+	// TreatyAlliance is a treaty where the nations can't attack each other, and may be able to move armies through
+	// each other's territories if the game allows it
+	TreatyAlliance = "alliance"
+	// TreatyNonAggression is a treaty where the nations can't attack each other
+	TreatyNonAggression = "non_aggression"
+)
+
+const treatyColumns = `id, treaty_type, proposer, recipient, proposed_turn, accepted_turn, broken_by, ends_turn`
+
+// Treaty is an alliance or non-aggression pact between two nations, identified by their players
+type Treaty struct {
+	ID           int64  `json:"id"`
+	Type         string `json:"type"`
+	Proposer     string `json:"proposer"`
+	Recipient    string `json:"recipient"`
+	ProposedTurn int    `json:"proposedTurn"`
+
+	// AcceptedTurn is the turn the recipient accepted the treaty, or 0 if it is still pending
+	AcceptedTurn int `json:"acceptedTurn,omitempty"`
+
+	// BrokenBy is the player that broke the treaty, if it was broken
+	BrokenBy string `json:"brokenBy,omitempty"`
+
+	// EndsTurn is the turn the treaty stops applying after it was broken, or 0 if it wasn't broken
+	EndsTurn int `json:"endsTurn,omitempty"`
+}
+
+// Pending returns true if the treaty has been proposed but not accepted
+func (t *Treaty) Pending() bool {
+	return t.AcceptedTurn == 0
+}
+
+// InEffect returns true if the treaty has been accepted and, if it was broken, the delay hasn't passed yet
+func (t *Treaty) InEffect(turn int) bool {
+	return t.AcceptedTurn > 0 && (t.EndsTurn == 0 || turn < t.EndsTurn)
+}
+
+// Other returns the player on the other side of the treaty from the given player
+func (t *Treaty) Other(player string) string {
+	if t.Proposer == player {
+		return t.Recipient
+	}
+	return t.Proposer
+}
+
+func scanTreaty(row interface{ Scan(...any) error }) (*Treaty, error) {
+	var treaty Treaty
+	var acceptedTurn, endsTurn sql.NullInt64
+	var brokenBy sql.NullString
+	if err := row.Scan(&treaty.ID, &treaty.Type, &treaty.Proposer, &treaty.Recipient, &treaty.ProposedTurn,
+		&acceptedTurn, &brokenBy, &endsTurn); err != nil {
+		return nil, err
+	}
+	treaty.AcceptedTurn = int(acceptedTurn.Int64)
+	treaty.BrokenBy = brokenBy.String
+	treaty.EndsTurn = int(endsTurn.Int64)
+	return &treaty, nil
+}
+
+// GetTreaties returns the pending and current treaties in the game. Treaties that were broken and have stopped
+// applying are not included
+func GetTreaties(tdb *sql.DB, gameID int64) ([]Treaty, error) {
+	turn, err := GetCurrentTurn(tdb, gameID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tdb.Query(`SELECT `+treatyColumns+` FROM treaties
+		WHERE game_id = ? AND (ends_turn IS NULL OR ends_turn > ?) ORDER BY id`, gameID, turn)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	treaties := []Treaty{}
+	for rows.Next() {
+		treaty, err := scanTreaty(rows)
+		if err != nil {
+			return nil, err
+		}
+		treaties = append(treaties, *treaty)
+	}
+	return treaties, rows.Close()
+}
+
+// GetTreaty returns the pending or current treaty between the two players, or nil if there isn't one
+func GetTreaty(tx *sql.Tx, gameID int64, player1 string, player2 string) (*Treaty, error) {
+	turn, err := CurrentTurn(tx, gameID)
+	if err != nil {
+		return nil, err
+	}
+	treaty, err := scanTreaty(tx.QueryRow(`SELECT `+treatyColumns+` FROM treaties
+		WHERE game_id = ? AND ((proposer = ? AND recipient = ?) OR (proposer = ? AND recipient = ?))
+		AND (ends_turn IS NULL OR ends_turn > ?) ORDER BY id DESC LIMIT 1`,
+		gameID, player1, player2, player2, player1, turn))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return treaty, err
+}
+
+// AlliedPlayers returns the players that have an alliance in effect with the given player
+func AlliedPlayers(tx *sql.Tx, gameID int64, player string) (map[string]bool, error) {
+	turn, err := CurrentTurn(tx, gameID)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := tx.Query(`SELECT `+treatyColumns+` FROM treaties
+		WHERE game_id = ? AND treaty_type = ? AND (proposer = ? OR recipient = ?) AND accepted_turn IS NOT NULL`,
+		gameID, TreatyAlliance, player, player)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	allies := map[string]bool{}
+	for rows.Next() {
+		treaty, err := scanTreaty(rows)
+		if err != nil {
+			return nil, err
+		}
+		if treaty.InEffect(turn) {
+			allies[treaty.Other(player)] = true
+		}
+	}
+	return allies, rows.Close()
+}
+
+// DeletePlayerTreaties removes all of the player's treaties, used when the player's nation is removed from the game so
+// that they don't apply if the player joins again
+func DeletePlayerTreaties(tx *sql.Tx, gameID int64, player string) error {
+	_, err := tx.Exec("DELETE FROM treaties WHERE game_id = ? AND (proposer = ? OR recipient = ?)", gameID, player, player)
+	return err
+}
@@ -16,21 +16,14 @@ var (
 	ErrMissingUser         = errors.New("unset user string")
 	ErrUserNotRegistered   = errors.New("user is not registered in the game")
 	ErrColorInUse          = errors.New("color already in use by another player")
+	ErrReservedPlayer      = errors.New("the player name is reserved")
 )
 
 // EnoughPlayersToStart checks if there are enough players to start the game based on the configured minimum number of nations.
-func EnoughPlayersToStart(tx *sql.Tx) (bool, int, error) {
-	cfg, err := config.GetConfig()
-	if err != nil {
-		return false, 0, err
-	}
-
+func EnoughPlayersToStart(db *sql.DB, tx *sql.Tx, cfg *config.Config) (bool, int, error) {
+	var err error
 	shouldCommit := tx == nil
 	if shouldCommit {
-		db, err := GetDB()
-		if err != nil {
-			return false, 0, err
-		}
 		tx, err = db.Begin()
 		if err != nil {
 			return false, 0, err
@@ -43,7 +36,7 @@ func EnoughPlayersToStart(tx *sql.Tx) (bool, int, error) {
 	}
 
 	var count int
-	if err = tx.QueryRow("SELECT COUNT(*) FROM nations").Scan(&count); err != nil {
+	if err = tx.QueryRow("SELECT COUNT(*) FROM nations WHERE game_id = ? AND player <> ?", cfg.GameID, NeutralPlayer).Scan(&count); err != nil {
 		return false, 0, err
 	}
 	if shouldCommit {
@@ -55,21 +48,25 @@ func EnoughPlayersToStart(tx *sql.Tx) (bool, int, error) {
 }
 
 // ValidateUser checks if the user is registered in the game by querying the nations table
-func ValidateUser(user string, tdb *sql.DB, logger config.LoggerFunc) error {
+func ValidateUser(user string, tdb *sql.DB, gameID int64, logger config.LoggerFunc) error {
 	if user == "" {
 		logger("User is not registered in the game")
 		return ErrMissingUser
 	}
+	if user == NeutralPlayer {
+		logger("The neutral nation can't take actions")
+		return ErrUserNotRegistered
+	}
 
 	var countryName string
-	stmt, err := tdb.Prepare("SELECT country_name FROM nations WHERE player = ?")
+	stmt, err := tdb.Prepare("SELECT country_name FROM nations WHERE game_id = ? AND player = ?")
 	if err != nil {
 		logger("Unable to prepare user check statement: %w", err)
 		return err
 	}
 	defer stmt.Close()
 
-	if err = stmt.QueryRow(user).Scan(&countryName); err != nil {
+	if err = stmt.QueryRow(gameID, user).Scan(&countryName); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			logger("User is not registered in the game")
 			return ErrUserNotRegistered
@@ -86,8 +83,8 @@ func ValidateUser(user string, tdb *sql.DB, logger config.LoggerFunc) error {
 }
 
 // PlayerHoldings returns the number of territories a player currently holds
-func PlayerHoldings(db *sql.DB, tx *sql.Tx, player string, logger config.LoggerFunc) (int, error) {
-	const territoriesLeftSQL = `SELECT COUNT(*) FROM v_nation_holdings WHERE player = ?`
+func PlayerHoldings(db *sql.DB, tx *sql.Tx, gameID int64, player string, logger config.LoggerFunc) (int, error) {
+	const territoriesLeftSQL = `SELECT COUNT(*) FROM v_nation_holdings WHERE game_id = ? AND player = ?`
 	var stmt *sql.Stmt
 	var err error
 	if tx == nil {
@@ -102,7 +99,7 @@ func PlayerHoldings(db *sql.DB, tx *sql.Tx, player string, logger config.LoggerF
 	defer stmt.Close()
 
 	var count int
-	if err = stmt.QueryRow(player).Scan(&count); err != nil {
+	if err = stmt.QueryRow(gameID, player).Scan(&count); err != nil {
 		logger("Unable to check if user has territories left: %w", err)
 		return 0, err
 	}
@@ -111,14 +108,10 @@ func PlayerHoldings(db *sql.DB, tx *sql.Tx, player string, logger config.LoggerF
 
 // UpdateHoldingArmySize updates the army size of a holding in the database. If deleteNationIfNoTerritories is true and the size is 0,
 // it will remove the nation from play if it has no remaining territories.
-func UpdateHoldingArmySize(db *sql.DB, tx *sql.Tx, territory string, size int, deleteNationIfNoTerritories bool) (*Nation, error) {
+func UpdateHoldingArmySize(db *sql.DB, tx *sql.Tx, cfg *config.Config, territory string, size int, deleteNationIfNoTerritories bool) (*Nation, error) {
 	var stmt *sql.Stmt
 	var err error
 	shouldCommit := tx == nil
-	cfg, err := config.GetConfig()
-	if err != nil {
-		return nil, err
-	}
 	if tx == nil {
 		tx, err = db.Begin()
 		if err != nil {
@@ -128,14 +121,14 @@ func UpdateHoldingArmySize(db *sql.DB, tx *sql.Tx, territory string, size int, d
 		defer tx.Rollback()
 	}
 
-	stmt, err = tx.Prepare("SELECT country_name, player FROM v_nation_holdings WHERE territory = ?")
+	stmt, err = tx.Prepare("SELECT country_name, player FROM v_nation_holdings WHERE game_id = ? AND territory = ?")
 	if err != nil {
 		cfg.LogError("Unable to prepare get defending nation statement", "error", err)
 		return nil, err
 	}
 	defer stmt.Close()
 	var nationRemoved Nation
-	if err = stmt.QueryRow(territory).Scan(&nationRemoved.CountryName, &nationRemoved.Player); err != nil {
+	if err = stmt.QueryRow(cfg.GameID, territory).Scan(&nationRemoved.CountryName, &nationRemoved.Player); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			err = fmt.Errorf("no defending nation found for territory %s", territory)
 		}
@@ -148,19 +141,19 @@ func UpdateHoldingArmySize(db *sql.DB, tx *sql.Tx, territory string, size int, d
 	}
 
 	if size > 0 {
-		if stmt, err = tx.Prepare("UPDATE holdings SET army_size = ? WHERE territory = ?"); err != nil {
+		if stmt, err = tx.Prepare("UPDATE holdings SET army_size = ? WHERE game_id = ? AND territory = ?"); err != nil {
 			cfg.LogError("Unable to prepare update holding army size statement", "error", err)
 			return nil, err
 		}
 		defer stmt.Close()
-		_, err = stmt.Exec(size, territory)
+		_, err = stmt.Exec(size, cfg.GameID, territory)
 	} else {
-		if stmt, err = tx.Prepare("DELETE FROM holdings WHERE territory = ?"); err != nil {
+		if stmt, err = tx.Prepare("DELETE FROM holdings WHERE game_id = ? AND territory = ?"); err != nil {
 			cfg.LogError("Unable to prepare delete holding statement", "error", err)
 			return nil, err
 		}
 		defer stmt.Close()
-		_, err = stmt.Exec(territory)
+		_, err = stmt.Exec(cfg.GameID, territory)
 	}
 	if err != nil {
 		cfg.LogError("Unable to update holding army size", "error", err)
@@ -172,27 +165,9 @@ func UpdateHoldingArmySize(db *sql.DB, tx *sql.Tx, territory string, size int, d
 
 	var wasNationRemoved bool
 	if size <= 0 && deleteNationIfNoTerritories {
-		territoryCount, err := PlayerHoldings(db, tx, nationRemoved.Player, cfg.LogError)
-		if err != nil {
+		if wasNationRemoved, err = removeNationIfNoHoldings(db, tx, cfg, nationRemoved.Player); err != nil {
 			return nil, err
 		}
-		if territoryCount == 0 {
-			if stmt, err = tx.Prepare(`DELETE FROM nations WHERE player = ?`); err != nil {
-				cfg.LogError("Unable to prepare delete nation statement", "error", err)
-				return nil, err
-			}
-			defer stmt.Close()
-			if _, err = stmt.Exec(nationRemoved.Player); err != nil {
-				cfg.LogError("Unable to delete nation", "error", err)
-				return nil, err
-			}
-			if err = stmt.Close(); err != nil {
-				cfg.LogError("Unable to close delete nation statement", "error", err)
-				return nil, err
-			}
-			// cfg.LogInfo(fmt.Sprintf("Player %s has no territories left, nation removed from play", nationRemoved.Player), "player", nationRemoved.Player)
-			wasNationRemoved = true
-		}
 	}
 
 	if shouldCommit {
@@ -208,6 +183,111 @@ func UpdateHoldingArmySize(db *sql.DB, tx *sql.Tx, territory string, size int, d
 	return nil, err
 }
 
+// TransferHolding gives the holding in the given territory to the recipient's nation with the given number of armies.
+// If the nation that held the territory has no territories left, it is removed from play and returned.
+func TransferHolding(db *sql.DB, tx *sql.Tx, cfg *config.Config, territory string, recipient string, size int) (*Nation, error) {
+	var err error
+	shouldCommit := tx == nil
+	if shouldCommit {
+		tx, err = db.Begin()
+		if err != nil {
+			cfg.LogError("Unable to begin transaction", "error", err)
+			return nil, err
+		}
+		defer tx.Rollback()
+	}
+
+	var giver Nation
+	if err = tx.QueryRow("SELECT country_name, player FROM v_nation_holdings WHERE game_id = ? AND territory = ?",
+		cfg.GameID, territory).Scan(&giver.CountryName, &giver.Player); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = fmt.Errorf("no nation found for territory %s", territory)
+		}
+		cfg.LogError("Unable to get territory nation", "error", err)
+		return nil, err
+	}
+
+	res, err := tx.Exec(`UPDATE holdings SET army_size = ?,
+		nation_id = (SELECT id FROM nations WHERE game_id = ? AND player = ?)
+		WHERE game_id = ? AND territory = ?`, size, cfg.GameID, recipient, cfg.GameID, territory)
+	if err != nil {
+		cfg.LogError("Unable to transfer holding", "error", err)
+		return nil, err
+	}
+	if rows, err := res.RowsAffected(); err != nil || rows != 1 {
+		if err == nil {
+			err = fmt.Errorf("no holding found for territory %s", territory)
+		}
+		cfg.LogError("Unable to transfer holding", "error", err)
+		return nil, err
+	}
+
+	wasNationRemoved, err := removeNationIfNoHoldings(db, tx, cfg, giver.Player)
+	if err != nil {
+		return nil, err
+	}
+
+	if shouldCommit {
+		if err = tx.Commit(); err != nil {
+			cfg.LogError("Unable to commit transaction", "error", err)
+			return nil, err
+		}
+	}
+	if wasNationRemoved {
+		return &giver, nil
+	}
+	return nil, nil
+}
+
+// removeNationIfNoHoldings removes the player's nation, its treaties, and its territory offers from play if it has no territories left,
+// returning true if it was removed
+func removeNationIfNoHoldings(db *sql.DB, tx *sql.Tx, cfg *config.Config, player string) (bool, error) {
+	territoryCount, err := PlayerHoldings(db, tx, cfg.GameID, player, cfg.LogError)
+	if err != nil {
+		return false, err
+	}
+	if territoryCount > 0 {
+		return false, nil
+	}
+
+	if err = RemoveNation(tx, cfg, player); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// RemoveNation removes the player's nation from play, along with its treaties and territory offers. Its holdings must
+// be removed or given to another nation first
+func RemoveNation(tx *sql.Tx, cfg *config.Config, player string) error {
+	stmt, err := tx.Prepare(`DELETE FROM nations WHERE game_id = ? AND player = ?`)
+	if err != nil {
+		cfg.LogError("Unable to prepare delete nation statement", "error", err)
+		return err
+	}
+	defer stmt.Close()
+	if _, err = stmt.Exec(cfg.GameID, player); err != nil {
+		cfg.LogError("Unable to delete nation", "error", err)
+		return err
+	}
+	if err = stmt.Close(); err != nil {
+		cfg.LogError("Unable to close delete nation statement", "error", err)
+		return err
+	}
+	if err = DeletePlayerTreaties(tx, cfg.GameID, player); err != nil {
+		cfg.LogError("Unable to delete treaties of removed nation", "error", err)
+		return err
+	}
+	if err = DeletePlayerCessions(tx, cfg.GameID, player); err != nil {
+		cfg.LogError("Unable to delete territory offers of removed nation", "error", err)
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM scouted_territories WHERE game_id = ? AND player = ?", cfg.GameID, player); err != nil {
+		cfg.LogError("Unable to delete scouted territories of removed nation", "error", err)
+		return err
+	}
+	return nil
+}
+
 // SQLite3Timestamp is used to represent timestamps in SQLite3 format that may scan into a time.Time, or a
 // string representation of a timestamp.
 // It implements the sql.Scanner interface to allow scanning from database rows.
@@ -220,7 +300,7 @@ func (t *SQLite3Timestamp) Scan(value any) error {
 		return nil
 	}
 	var nt sql.NullTime
-	if err := nt.Scan(&value); err == nil {
+	if err := nt.Scan(value); err == nil {
 		t.Time = nt.Time
 		t.Valid = nt.Valid
 		return nil
@@ -256,7 +336,52 @@ func (t *SQLite3Timestamp) parseSQLite3Timestamp(ts string) (err error) {
 }
 
 type Nation struct {
-	CountryName string
-	Player      string
-	Color       string
+	CountryName    string `json:"countryName"`
+	Player         string `json:"player"`
+	Color          string `json:"color"`
+	Reinforcements int    `json:"reinforcements"`
+
+	// Capital is the abbreviation of the nation's capital territory, if it has one
+	Capital string `json:"capital,omitempty"`
+}
+
+// GetNations returns all nations currently in the game
+func GetNations(tdb *sql.DB, gameID int64) ([]Nation, error) {
+	rows, err := tdb.Query(`SELECT country_name, player, color, reinforcements, COALESCE(capital, '')
+		FROM nations WHERE game_id = ? ORDER BY id`, gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	nations := []Nation{}
+	for rows.Next() {
+		var nation Nation
+		if err = rows.Scan(&nation.CountryName, &nation.Player, &nation.Color, &nation.Reinforcements, &nation.Capital); err != nil {
+			return nil, err
+		}
+		nations = append(nations, nation)
+	}
+	return nations, rows.Close()
+}
+
+// GetHoldings returns all territory holdings currently in the game, along with the nations that hold them
+func GetHoldings(tdb *sql.DB, gameID int64) ([]HoldingRecord, error) {
+	rows, err := tdb.Query(`SELECT id, nation_id, territory, army_size, color, country_name, player
+		FROM v_nation_holdings WHERE game_id = ? ORDER BY id`, gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	holdings := []HoldingRecord{}
+	for rows.Next() {
+		var holding HoldingRecord
+		if err = rows.Scan(&holding.HoldingID, &holding.NationID, &holding.Territory, &holding.ArmySize,
+			&holding.Color, &holding.CountryName, &holding.Player); err != nil {
+			return nil, err
+		}
+		holdings = append(holdings, holding)
+	}
+	return holdings, rows.Close()
 }
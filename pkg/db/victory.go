@@ -0,0 +1,179 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/Eggbertx/territories-game/pkg/config"
+)
+
+const (
+	// VictoryLastNationStanding is met by the only nation left in the game
+	VictoryLastNationStanding = "last_nation_standing"
+	// VictoryTerritoryPercent is met by a nation holding the configured percentage of the territories
+	VictoryTerritoryPercent = "territory_percent"
+	// VictoryTerritories is met by a nation holding all of the configured victory territories and regions
+	VictoryTerritories = "territories"
+	// VictoryTurnLimit is met by the nation holding the most territories when the configured last turn ends
+	VictoryTurnLimit = "turn_limit"
+)
+
+// Victory is the outcome of a game that has been won
+type Victory struct {
+	Winner      string `json:"winner"`
+	CountryName string `json:"countryName"`
+
+	// Condition is the victory condition the winner met
+	Condition string `json:"condition"`
+}
+
+// nationStanding is a nation and the territories it holds, used to check the victory conditions
+type nationStanding struct {
+	player      string
+	countryName string
+	territories []string
+}
+
+// GetVictory returns the game's outcome if it has been won, or nil if it is still being played. If tx is nil, the
+// database is queried directly
+func GetVictory(tdb *sql.DB, tx *sql.Tx, gameID int64) (*Victory, error) {
+	const query = "SELECT winner, winner_country, victory_condition FROM games WHERE id = ?"
+	var row *sql.Row
+	if tx != nil {
+		row = tx.QueryRow(query, gameID)
+	} else {
+		row = tdb.QueryRow(query, gameID)
+	}
+	var winner, country, condition sql.NullString
+	if err := row.Scan(&winner, &country, &condition); err != nil {
+		return nil, err
+	}
+	if !winner.Valid {
+		return nil, nil
+	}
+	return &Victory{Winner: winner.String, CountryName: country.String, Condition: condition.String}, nil
+}
+
+// CheckVictory checks the game's victory conditions, returning the outcome if the game has been won. If a nation meets
+// one of the conditions, the game is marked as won and the victory is added to the action log. If the game was
+// already won, the existing outcome is returned
+func CheckVictory(tx *sql.Tx, cfg *config.Config) (*Victory, error) {
+	victory, err := GetVictory(nil, tx, cfg.GameID)
+	if err != nil || victory != nil || !cfg.VictoryConditions.Enabled() {
+		return victory, err
+	}
+
+	standings, err := getStandings(tx, cfg.GameID)
+	if err != nil {
+		return nil, err
+	}
+	if victory, err = evaluateVictory(tx, cfg, standings); err != nil || victory == nil {
+		return nil, err
+	}
+
+	if _, err = tx.Exec("UPDATE games SET winner = ?, winner_country = ?, victory_condition = ? WHERE id = ?",
+		victory.Winner, victory.CountryName, victory.Condition, cfg.GameID); err != nil {
+		return nil, err
+	}
+	record := &ActionRecord{
+		GameID:     cfg.GameID,
+		ActionType: "victory",
+		Player:     victory.Winner,
+		Timestamp:  time.Now(),
+	}
+	if record.Details, err = json.Marshal(victory); err != nil {
+		return nil, err
+	}
+	if err = InsertActionRecord(tx, record); err != nil {
+		return nil, err
+	}
+	return victory, nil
+}
+
+// getStandings returns the nations other than the neutral nation, ordered by the number of territories they hold, then
+// the number of armies, then the order they joined
+func getStandings(tx *sql.Tx, gameID int64) ([]nationStanding, error) {
+	rows, err := tx.Query(`SELECT n.player, n.country_name, h.territory FROM nations n
+		LEFT JOIN holdings h ON h.nation_id = n.id AND h.game_id = n.game_id
+		WHERE n.game_id = ? AND n.player <> ?
+		ORDER BY
+			(SELECT COUNT(*) FROM holdings WHERE nation_id = n.id) DESC,
+			(SELECT COALESCE(SUM(army_size), 0) FROM holdings WHERE nation_id = n.id) DESC,
+			n.id, h.id`, gameID, NeutralPlayer)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var standings []nationStanding
+	for rows.Next() {
+		var player, country string
+		var territory sql.NullString
+		if err = rows.Scan(&player, &country, &territory); err != nil {
+			return nil, err
+		}
+		if len(standings) == 0 || standings[len(standings)-1].player != player {
+			standings = append(standings, nationStanding{player: player, countryName: country})
+		}
+		if territory.Valid {
+			standings[len(standings)-1].territories = append(standings[len(standings)-1].territories, territory.String)
+		}
+	}
+	return standings, rows.Close()
+}
+
+// evaluateVictory returns the outcome of the first victory condition met, or nil if none are met
+func evaluateVictory(tx *sql.Tx, cfg *config.Config, standings []nationStanding) (*Victory, error) {
+	if len(standings) == 0 {
+		return nil, nil
+	}
+	conditions := &cfg.VictoryConditions
+	leader := standings[0]
+	won := func(standing nationStanding, condition string) *Victory {
+		return &Victory{Winner: standing.player, CountryName: standing.countryName, Condition: condition}
+	}
+
+	if conditions.LastNationStanding && len(standings) == 1 {
+		var joined int
+		if err := tx.QueryRow("SELECT COUNT(DISTINCT player) FROM actions WHERE game_id = ? AND action_type = 'join'",
+			cfg.GameID).Scan(&joined); err != nil {
+			return nil, err
+		}
+		if joined >= max(2, cfg.MinimumNationsToStart) {
+			return won(leader, VictoryLastNationStanding), nil
+		}
+	}
+
+	if required := cfg.VictoryTerritories(); len(required) > 0 {
+		for _, standing := range standings {
+			held := make(map[string]bool, len(standing.territories))
+			for _, territory := range standing.territories {
+				held[territory] = true
+			}
+			holdsAll := true
+			for _, territory := range required {
+				holdsAll = holdsAll && held[territory]
+			}
+			if holdsAll {
+				return won(standing, VictoryTerritories), nil
+			}
+		}
+	}
+
+	if conditions.TerritoryPercent > 0 &&
+		float64(len(leader.territories))*100 >= conditions.TerritoryPercent*float64(cfg.PassableTerritories()) {
+		return won(leader, VictoryTerritoryPercent), nil
+	}
+
+	if conditions.TurnLimit > 0 && len(leader.territories) > 0 {
+		turn, err := CurrentTurn(tx, cfg.GameID)
+		if err != nil {
+			return nil, err
+		}
+		if turn > conditions.TurnLimit {
+			return won(leader, VictoryTurnLimit), nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,107 @@
+// Package game provides a handle for a single game that owns its configuration, database connection, logger, and
+// source of random numbers, so that actions, turn checks, and map rendering don't depend on the active configuration
+// or the shared database connection, and more than one configuration can be used in the same process.
+package game
+
+import (
+	"database/sql"
+
+	"github.com/Eggbertx/territories-game/pkg/config"
+	"github.com/Eggbertx/territories-game/pkg/db"
+)
+
+// Game is a handle for a game stored in a database. It is not safe for concurrent use by actions, since actions depend
+// on the state left by the previous action.
+type Game struct {
+	cfg    *config.Config
+	db     *sql.DB
+	rng    db.RandomSource
+	ownsDB bool
+}
+
+// New returns a handle for the game with the given configuration in the given database, which must already be
+// provisioned (see db.Open). The configuration is validated, and the game is initialized in the database if it hasn't
+// been already. db.ErrNoDatabase is returned if tdb is nil. Closing the game doesn't close the database, so it can be shared by multiple games.
+func New(cfg *config.Config, tdb *sql.DB) (*Game, error) {
+	if cfg == nil {
+		return nil, config.ErrGameNotConfigured
+	}
+	if tdb == nil {
+		return nil, db.ErrNoDatabase
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if err := db.InitGame(tdb, cfg); err != nil {
+		cfg.LogError("Unable to initialize game", "gameID", cfg.GameID, "error", err)
+		return nil, err
+	}
+	return &Game{cfg: cfg, db: tdb}, nil
+}
+
+// Open opens the configured database file and returns a handle for the game. Closing the game closes the database.
+func Open(cfg *config.Config) (*Game, error) {
+	if cfg == nil {
+		return nil, config.ErrGameNotConfigured
+	}
+	tdb, err := db.Open(cfg.DBFile)
+	if err != nil {
+		cfg.LogError("Unable to open database", "dbFile", cfg.DBFile, "error", err)
+		return nil, err
+	}
+	g, err := New(cfg, tdb)
+	if err != nil {
+		tdb.Close()
+		return nil, err
+	}
+	g.ownsDB = true
+	return g, nil
+}
+
+// ID returns the game's ID in the database
+func (g *Game) ID() int64 {
+	return g.cfg.GameID
+}
+
+// Config returns the game's configuration
+func (g *Game) Config() *config.Config {
+	return g.cfg
+}
+
+// DB returns the database the game is stored in
+func (g *Game) DB() *sql.DB {
+	return g.db
+}
+
+// LogInfo logs an informational message using the game's configured logger
+func (g *Game) LogInfo(msg string, args ...any) {
+	g.cfg.LogInfo(msg, args...)
+}
+
+// LogError logs an error message using the game's configured logger
+func (g *Game) LogError(msg string, args ...any) {
+	g.cfg.LogError(msg, args...)
+}
+
+// SetRandomSource sets the source of random numbers used by actions done in the game, for example to use a
+// predetermined sequence in tests or simulations. If src is nil, the game's seeded random source stored in the
+// database is used.
+func (g *Game) SetRandomSource(src db.RandomSource) {
+	g.rng = src
+}
+
+// RandomSource returns the source of random numbers to be used by an action done with the given transaction
+func (g *Game) RandomSource(tx *sql.Tx) (db.RandomSource, error) {
+	if g.rng != nil {
+		return g.rng, nil
+	}
+	return db.NewGameRandomSource(tx, g.ID())
+}
+
+// Close closes the game's database if it was opened by Open
+func (g *Game) Close() error {
+	if !g.ownsDB {
+		return nil
+	}
+	return g.db.Close()
+}
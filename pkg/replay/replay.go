@@ -0,0 +1,316 @@
+// Package replay rebuilds the nations and holdings tables from the action log, either to verify or repair the current
+// state of the game, or to get the state at the end of a previous turn.
+package replay
+
+import (
+	"database/sql"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/Eggbertx/territories-game/pkg/db"
+)
+
+// State is the state of the game's nations (by player) and holdings (by territory abbreviation) at a point in the game
+type State struct {
+	// GameID is the game the state belongs to
+	GameID int64
+
+	// Turn is the last turn included in the state
+	Turn int
+
+	// Actions is the number of logged actions that were applied to get the state
+	Actions int
+
+	Nations  map[string]db.NationState
+	Holdings map[string]db.HoldingState
+}
+
+func newState(gameID int64) *State {
+	return &State{
+		GameID:   gameID,
+		Nations:  make(map[string]db.NationState),
+		Holdings: make(map[string]db.HoldingState),
+	}
+}
+
+// Apply applies the state changes recorded in the action log entry
+func (s *State) Apply(record *db.ActionRecord) {
+	s.Turn = record.Turn
+	if record.Changes == nil {
+		return
+	}
+	s.Actions++
+	for player, nation := range record.Changes.Nations {
+		if nation == nil {
+			delete(s.Nations, player)
+		} else {
+			s.Nations[player] = *nation
+		}
+	}
+	for territory, holding := range record.Changes.Holdings {
+		if holding == nil {
+			delete(s.Holdings, territory)
+		} else {
+			s.Holdings[territory] = *holding
+		}
+	}
+}
+
+// Rebuild returns the state of the game at the end of the given turn by re-applying the logged actions up to and
+// including that turn. If turn is 0 or greater than the current turn, all logged actions are applied.
+func Rebuild(tdb *sql.DB, gameID int64, turn int) (*State, error) {
+	records, err := db.GetActionRecords(tdb, db.ActionRecordFilter{GameID: gameID})
+	if err != nil {
+		return nil, err
+	}
+	state := newState(gameID)
+	for r := range records {
+		if turn > 0 && records[r].Turn > turn {
+			break
+		}
+		state.Apply(&records[r])
+	}
+	return state, nil
+}
+
+// Clone returns a copy of the state that can be modified without affecting the original
+func (s *State) Clone() *State {
+	return &State{
+		GameID:   s.GameID,
+		Turn:     s.Turn,
+		Actions:  s.Actions,
+		Nations:  maps.Clone(s.Nations),
+		Holdings: maps.Clone(s.Holdings),
+	}
+}
+
+// Timeline returns the state of the game at the end of each turn in the action log, or after each action that
+// changed the state if perAction is true. An action that didn't change any nations or holdings (like the end of a
+// turn) doesn't get its own state.
+func Timeline(tdb *sql.DB, gameID int64, perAction bool) ([]*State, error) {
+	records, err := db.GetActionRecords(tdb, db.ActionRecordFilter{GameID: gameID})
+	if err != nil {
+		return nil, err
+	}
+	state := newState(gameID)
+	var timeline []*State
+	for r := range records {
+		if !perAction && r > 0 && records[r].Turn != records[r-1].Turn {
+			timeline = append(timeline, state.Clone())
+		}
+		state.Apply(&records[r])
+		if perAction && records[r].Changes != nil {
+			timeline = append(timeline, state.Clone())
+		}
+	}
+	if !perAction && len(records) > 0 {
+		timeline = append(timeline, state)
+	}
+	return timeline, nil
+}
+
+// CurrentState returns the state of the game as it is in the nations and holdings tables
+func CurrentState(tdb *sql.DB, gameID int64) (*State, error) {
+	state := newState(gameID)
+	var err error
+	if state.Turn, err = db.GetCurrentTurn(tdb, gameID); err != nil {
+		return nil, err
+	}
+
+	rows, err := tdb.Query(`SELECT id, player, country_name, color, reinforcements, COALESCE(capital, '')
+		FROM nations WHERE game_id = ?`, gameID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var player string
+		var nation db.NationState
+		if err = rows.Scan(&nation.ID, &player, &nation.CountryName, &nation.Color, &nation.Reinforcements, &nation.Capital); err != nil {
+			return nil, err
+		}
+		state.Nations[player] = nation
+	}
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+
+	holdings, err := db.GetHoldings(tdb, gameID)
+	if err != nil {
+		return nil, err
+	}
+	for _, holding := range holdings {
+		state.Holdings[holding.Territory] = db.HoldingState{Player: holding.Player, Armies: holding.ArmySize}
+	}
+	return state, nil
+}
+
+// Discrepancy is a difference between the state rebuilt from the action log and the current state of the game
+type Discrepancy struct {
+	// Table is either "nations" or "holdings"
+	Table string
+
+	// Key is the player for nations, or the territory abbreviation for holdings
+	Key string
+
+	// Expected is the state rebuilt from the action log, or nil if the nation or holding shouldn't exist
+	Expected any
+
+	// Actual is the current state, or nil if the nation or holding doesn't exist
+	Actual any
+}
+
+func (d Discrepancy) String() string {
+	return fmt.Sprintf("%s %s: expected %s, got %s", d.Table, d.Key, describe(d.Expected), describe(d.Actual))
+}
+
+func describe(v any) string {
+	switch state := v.(type) {
+	case *db.NationState:
+		if state == nil {
+			break
+		}
+		details := fmt.Sprintf("color %s, id %d", state.Color, state.ID)
+		if state.Reinforcements > 0 {
+			details += fmt.Sprintf(", %d reinforcements", state.Reinforcements)
+		}
+		if state.Capital != "" {
+			details += ", capital " + state.Capital
+		}
+		return fmt.Sprintf("%q (%s)", state.CountryName, details)
+	case *db.HoldingState:
+		if state == nil {
+			break
+		}
+		return fmt.Sprintf("%d armies controlled by %s", state.Armies, state.Player)
+	}
+	return "none"
+}
+
+func compare[T comparable](table string, expected, actual map[string]T) []Discrepancy {
+	var discrepancies []Discrepancy
+	keys := slices.Sorted(maps.Keys(expected))
+	for key := range actual {
+		if _, ok := expected[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		e, inExpected := expected[key]
+		a, inActual := actual[key]
+		if inExpected && inActual && e == a {
+			continue
+		}
+		d := Discrepancy{Table: table, Key: key, Expected: (*T)(nil), Actual: (*T)(nil)}
+		if inExpected {
+			d.Expected = &e
+		}
+		if inActual {
+			d.Actual = &a
+		}
+		discrepancies = append(discrepancies, d)
+	}
+	return discrepancies
+}
+
+// Compare returns the differences between the expected and actual states
+func Compare(expected, actual *State) []Discrepancy {
+	return append(compare("nations", expected.Nations, actual.Nations),
+		compare("holdings", expected.Holdings, actual.Holdings)...)
+}
+
+// Verify rebuilds the state of the game from the action log and compares it to the current nations and holdings
+// tables, returning any differences. If the returned slice is empty, the database is consistent with the log.
+func Verify(tdb *sql.DB, gameID int64) ([]Discrepancy, error) {
+	expected, err := Rebuild(tdb, gameID, 0)
+	if err != nil {
+		return nil, err
+	}
+	actual, err := CurrentState(tdb, gameID)
+	if err != nil {
+		return nil, err
+	}
+	return Compare(expected, actual), nil
+}
+
+// WriteTo replaces the state's game's nations and holdings with the state using the given transaction. Other games
+// in the database are left as is.
+func (s *State) WriteTo(tx *sql.Tx) error {
+	if _, err := tx.Exec("DELETE FROM holdings WHERE game_id = ?", s.GameID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM nations WHERE game_id = ?", s.GameID); err != nil {
+		return err
+	}
+	for _, player := range slices.Sorted(maps.Keys(s.Nations)) {
+		nation := s.Nations[player]
+		if _, err := tx.Exec(`INSERT INTO nations (id, game_id, country_name, player, color, reinforcements, capital)
+			VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''))`, nation.ID, s.GameID, nation.CountryName, player, nation.Color,
+			nation.Reinforcements, nation.Capital); err != nil {
+			return fmt.Errorf("unable to insert nation for %s: %w", player, err)
+		}
+	}
+	for _, territory := range slices.Sorted(maps.Keys(s.Holdings)) {
+		holding := s.Holdings[territory]
+		if _, err := tx.Exec(`INSERT INTO holdings (game_id, territory, nation_id, army_size)
+			VALUES (?1, ?2, (SELECT id FROM nations WHERE game_id = ?1 AND player = ?3), ?4)`,
+			s.GameID, territory, holding.Player, holding.Armies); err != nil {
+			return fmt.Errorf("unable to insert holding for %s: %w", territory, err)
+		}
+	}
+	return nil
+}
+
+// Repair replaces the nations and holdings tables with the state rebuilt from the action log, returning the
+// differences that were fixed
+func Repair(tdb *sql.DB, gameID int64) ([]Discrepancy, error) {
+	discrepancies, err := Verify(tdb, gameID)
+	if err != nil || len(discrepancies) == 0 {
+		return discrepancies, err
+	}
+	state, err := Rebuild(tdb, gameID, 0)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := tdb.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err = state.WriteTo(tx); err != nil {
+		return nil, err
+	}
+	return discrepancies, tx.Commit()
+}
+
+// OpenMemoryDB returns a new provisioned in-memory database containing only the state's nations and holdings, which
+// can be used to render the map at a previous point in the game
+func (s *State) OpenMemoryDB() (*sql.DB, error) {
+	tdb, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		return nil, err
+	}
+	// each connection to :memory: is a separate database
+	tdb.SetMaxOpenConns(1)
+	if err = db.ProvisionDB(tdb); err != nil {
+		tdb.Close()
+		return nil, err
+	}
+	tx, err := tdb.Begin()
+	if err != nil {
+		tdb.Close()
+		return nil, err
+	}
+	defer tx.Rollback()
+	if err = s.WriteTo(tx); err != nil {
+		tdb.Close()
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		tdb.Close()
+		return nil, err
+	}
+	return tdb, nil
+}
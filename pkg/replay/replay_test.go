@@ -0,0 +1,153 @@
+package replay
+
+import (
+	"testing"
+
+	"github.com/Eggbertx/territories-game/pkg/actions"
+	"github.com/Eggbertx/territories-game/pkg/config"
+	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/stretchr/testify/assert"
+)
+
+// maxRandomSource always returns the highest possible number
+type maxRandomSource struct{}
+
+func (maxRandomSource) IntN(n int) (int, error) {
+	return n - 1, nil
+}
+
+func TestReplay(t *testing.T) {
+	cfg, err := config.GetTestingConfig(t)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cfg.MinimumNationsToStart = 2
+	defer func() {
+		actions.SetRandomSource(nil)
+		assert.NoError(t, db.CloseDB())
+		config.CloseTestingConfig(t)
+	}()
+	tdb, err := db.GetDB()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	events := []actions.Action{
+		&actions.JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+		&actions.JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+		&actions.ColorAction{User: "Test User", Color: "red"},
+		&actions.AttackAction{User: "Test User", AttackingTerritory: "CA", DefendingTerritory: "NV"},
+	}
+	for i, event := range events {
+		if i == 3 {
+			// the join actions use the game's random source to pick distinct colors
+			actions.SetRandomSource(maxRandomSource{})
+		}
+		_, err = event.DoAction(tdb)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+	}
+
+	current, err := CurrentState(tdb, config.DefaultGameID)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	rebuilt, err := Rebuild(tdb, config.DefaultGameID, 0)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, 2, rebuilt.Turn)
+	assert.Equal(t, 4, rebuilt.Actions)
+	assert.Equal(t, current.Nations, rebuilt.Nations)
+	assert.Equal(t, current.Holdings, rebuilt.Holdings)
+	assert.NotContains(t, rebuilt.Nations, "Test User 2", "expected the defeated nation to be removed")
+
+	discrepancies, err := Verify(tdb, config.DefaultGameID)
+	assert.NoError(t, err)
+	assert.Empty(t, discrepancies)
+
+	// the end of the first turn is before the attack
+	firstTurn, err := Rebuild(tdb, config.DefaultGameID, 1)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, 1, firstTurn.Turn)
+	assert.Equal(t, 3, firstTurn.Actions)
+	assert.Equal(t, "ff0000", firstTurn.Nations["Test User"].Color)
+	assert.Equal(t, "Nation 2", firstTurn.Nations["Test User 2"].CountryName)
+	assert.Equal(t, db.HoldingState{Player: "Test User", Armies: cfg.InitialArmies}, firstTurn.Holdings["CA"])
+	assert.Equal(t, db.HoldingState{Player: "Test User 2", Armies: cfg.InitialArmies}, firstTurn.Holdings["NV"])
+
+	memDB, err := firstTurn.OpenMemoryDB()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer memDB.Close()
+	memState, err := CurrentState(memDB, config.DefaultGameID)
+	if assert.NoError(t, err) {
+		assert.Empty(t, Compare(firstTurn, memState))
+	}
+
+	// changes made outside of actions are detected and can be reverted
+	_, err = tdb.Exec("UPDATE holdings SET army_size = 10 WHERE territory = 'CA'")
+	assert.NoError(t, err)
+	_, err = tdb.Exec("UPDATE nations SET color = '00ff00' WHERE player = 'Test User'")
+	assert.NoError(t, err)
+	discrepancies, err = Verify(tdb, config.DefaultGameID)
+	assert.NoError(t, err)
+	if assert.Len(t, discrepancies, 2) {
+		assert.Equal(t, "nations", discrepancies[0].Table)
+		assert.Equal(t, "Test User", discrepancies[0].Key)
+		assert.Equal(t, "holdings", discrepancies[1].Table)
+		assert.Equal(t, "CA", discrepancies[1].Key)
+		assert.Contains(t, discrepancies[1].String(), "got 10 armies controlled by Test User")
+	}
+
+	repaired, err := Repair(tdb, config.DefaultGameID)
+	assert.NoError(t, err)
+	assert.Equal(t, discrepancies, repaired)
+	discrepancies, err = Verify(tdb, config.DefaultGameID)
+	assert.NoError(t, err)
+	assert.Empty(t, discrepancies)
+}
+
+func TestReplayReinforcements(t *testing.T) {
+	cfg, err := config.GetTestingConfig(t)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cfg.MinimumNationsToStart = 2
+	cfg.DoReinforcements = true
+	defer func() {
+		assert.NoError(t, db.CloseDB())
+		config.CloseTestingConfig(t)
+	}()
+	tdb, err := db.GetDB()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	for _, event := range []actions.Action{
+		&actions.JoinAction{User: "Test User", Nation: "Nation 1", Territory: "CA"},
+		&actions.JoinAction{User: "Test User 2", Nation: "Nation 2", Territory: "NV"},
+		&actions.DeployAction{User: "Test User", Armies: map[string]int{"CA": 1}},
+	} {
+		if _, err = event.DoAction(tdb); !assert.NoError(t, err) {
+			t.FailNow()
+		}
+	}
+
+	// the reinforcements granted at the end of the first turn are recorded in the end_turn action
+	rebuilt, err := Rebuild(tdb, config.DefaultGameID, 0)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, 0, rebuilt.Nations["Test User"].Reinforcements)
+	assert.Equal(t, 1, rebuilt.Nations["Test User 2"].Reinforcements)
+	assert.Equal(t, db.HoldingState{Player: "Test User", Armies: cfg.InitialArmies + 1}, rebuilt.Holdings["CA"])
+
+	discrepancies, err := Verify(tdb, config.DefaultGameID)
+	assert.NoError(t, err)
+	assert.Empty(t, discrepancies)
+}
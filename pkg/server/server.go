@@ -0,0 +1,520 @@
+// Package server provides an HTTP JSON API for doing in-game actions and reading the game state, allowing
+// consuming applications to use a long-running process instead of running territories-referee once per action.
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Eggbertx/territories-game/pkg/actions"
+	"github.com/Eggbertx/territories-game/pkg/actions/turns"
+	"github.com/Eggbertx/territories-game/pkg/config"
+	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
+	"github.com/Eggbertx/territories-game/pkg/svgmap"
+)
+
+const (
+	maxRequestBodySize = 1 << 16
+)
+
+// ActionResponse is the JSON body returned by a successful action request
+type ActionResponse struct {
+	ActionType string               `json:"actionType"`
+	User       string               `json:"user"`
+	Message    string               `json:"message"`
+	Result     actions.ActionResult `json:"result"`
+
+	// Warning is set if the action was done but the map couldn't be updated afterwards
+	Warning string `json:"warning,omitempty"`
+}
+
+// ErrorResponse is the JSON body returned when a request fails. A 4xx status code is used if the error is an
+// *actions.ActionError or the request is invalid, and a 5xx status code is used otherwise
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// TurnState is the JSON body returned by the turn state endpoint
+type TurnState struct {
+	Started                time.Time                      `json:"started"`
+	FirstTurn              bool                           `json:"firstTurn"`
+	PlayersWithActionsLeft map[string]turns.PlayerActions `json:"playersWithActionsLeft"`
+}
+
+// GameInfo is an entry in the JSON body returned by the games endpoint
+type GameInfo struct {
+	ID      int64 `json:"id"`
+	Turn    int   `json:"turn"`
+	Nations int   `json:"nations"`
+
+	// Victory is the outcome of the game if it has been won
+	Victory *db.Victory `json:"victory,omitempty"`
+}
+
+// Server handles HTTP requests for the game. Requests are handled one at a time, since actions depend on the state
+// left by the previous action and update the shared map files.
+type Server struct {
+	// UpdateMap determines whether the SVG and PNG map files are updated after each successful action. If the map
+	// can't be updated, the error is logged and the action's response still succeeds, since the action has already
+	// been done
+	UpdateMap bool
+
+	games     []*game.Game
+	gamesByID map[int64]*game.Game
+	mux       *http.ServeMux
+	mu        sync.Mutex
+}
+
+// New returns a Server with the action and game state endpoints registered:
+//
+//	POST /actions/join, /actions/color, /actions/raise, /actions/move, /actions/attack, /actions/deploy
+//	POST /actions/propose, /actions/accept, /actions/break, /actions/cede, /actions/leave, /actions/remove
+//	POST /actions/pick, /actions/scout, /actions/plan
+//	GET /nations, /holdings, /treaties, /cessions, /turn, /map (PNG, or SVG with ?format=svg)
+//	GET /holdings and /map as seen by a player if the game uses fog of war, with ?player=name, which is required then
+//	GET /actions (the action log, optionally filtered with ?turn=N, ?player=name, and ?type=action, and seen by the
+//	player given with ?viewer=name, which is required if the game uses fog of war)
+//	GET /orders (the resolution report of the previous turn or the turn given with ?turn=N in games using
+//	simultaneous resolution, or a player's orders in the current turn with ?player=name)
+//	GET /games (the games in the database)
+//
+// Each endpoint other than /games is also available under /games/{game}/ for a specific game, for example
+// POST /games/2/actions/join. Without the prefix, the default game (the first of the given games, or the game set in
+// an action's body) is used.
+func New(updateMap bool, games ...*game.Game) *Server {
+	s := &Server{
+		UpdateMap: updateMap,
+		games:     games,
+		gamesByID: make(map[int64]*game.Game, len(games)),
+		mux:       http.NewServeMux(),
+	}
+	for _, g := range games {
+		s.gamesByID[g.ID()] = g
+	}
+	s.handle("POST /actions/join", actionHandler[actions.JoinAction](s))
+	s.handle("POST /actions/color", actionHandler[actions.ColorAction](s))
+	s.handle("POST /actions/raise", actionHandler[actions.RaiseAction](s))
+	s.handle("POST /actions/move", actionHandler[actions.MoveAction](s))
+	s.handle("POST /actions/attack", actionHandler[actions.AttackAction](s))
+	s.handle("POST /actions/deploy", actionHandler[actions.DeployAction](s))
+	s.handle("POST /actions/propose", actionHandler[actions.ProposeAction](s))
+	s.handle("POST /actions/accept", actionHandler[actions.AcceptAction](s))
+	s.handle("POST /actions/break", actionHandler[actions.BreakAction](s))
+	s.handle("POST /actions/cede", actionHandler[actions.CedeAction](s))
+	s.handle("POST /actions/leave", actionHandler[actions.LeaveAction](s))
+	s.handle("POST /actions/remove", actionHandler[actions.RemoveAction](s))
+	s.handle("POST /actions/pick", actionHandler[actions.PickAction](s))
+	s.handle("POST /actions/scout", actionHandler[actions.ScoutAction](s))
+	s.handle("POST /actions/plan", actionHandler[actions.PlanAction](s))
+	s.handle("GET /nations", s.handleNations)
+	s.handle("GET /holdings", s.handleHoldings)
+	s.handle("GET /treaties", s.handleTreaties)
+	s.handle("GET /cessions", s.handleCessions)
+	s.handle("GET /turn", s.handleTurn)
+	s.handle("GET /actions", s.handleActionLog)
+	s.handle("GET /orders", s.handleOrders)
+	s.handle("GET /map", s.handleMap)
+	s.mux.HandleFunc("GET /games", s.handleGames)
+	return s
+}
+
+// handle registers the handler for the pattern, and for the pattern with the path under /games/{game}
+func (s *Server) handle(pattern string, handler http.HandlerFunc) {
+	method, path, _ := strings.Cut(pattern, " ")
+	s.mux.HandleFunc(pattern, handler)
+	s.mux.HandleFunc(method+" /games/{game}"+path, handler)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.mux.ServeHTTP(w, r)
+}
+
+// game returns the game with the given ID, or the default game if gameID is 0
+func (s *Server) game(gameID int64) (*game.Game, error) {
+	if gameID == 0 {
+		if len(s.games) == 0 {
+			return nil, config.ErrGameNotConfigured
+		}
+		return s.games[0], nil
+	}
+	g, ok := s.gamesByID[gameID]
+	if !ok {
+		return nil, config.ErrUnknownGame
+	}
+	return g, nil
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil && len(s.games) > 0 {
+		s.games[0].LogError("Unable to write response", "error", err)
+	}
+}
+
+// writeError writes the error as JSON, using 404 Not Found for an unknown game, 400 Bad Request for
+// *actions.ActionError and 500 Internal Server Error for anything else
+func (s *Server) writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var actionErr *actions.ActionError
+	if errors.Is(err, config.ErrUnknownGame) {
+		status = http.StatusNotFound
+	} else if errors.As(err, &actionErr) {
+		status = http.StatusBadRequest
+	}
+	s.writeJSON(w, status, ErrorResponse{Error: err.Error()})
+}
+
+// requestGame returns the ID of the game in the request's path, or 0 if the path doesn't have one. If the ID is
+// invalid, a 400 Bad Request response is written and ok is false
+func (s *Server) requestGame(w http.ResponseWriter, r *http.Request) (gameID int64, ok bool) {
+	gameStr := r.PathValue("game")
+	if gameStr == "" {
+		return 0, true
+	}
+	gameID, err := strconv.ParseInt(gameStr, 10, 64)
+	if err != nil || gameID < 1 {
+		s.writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "game must be a positive integer"})
+		return 0, false
+	}
+	return gameID, true
+}
+
+// requestGameHandle returns the game in the request's path, or the default game if the path doesn't have one. If the
+// game is invalid or unknown, an error response is written and ok is false
+func (s *Server) requestGameHandle(w http.ResponseWriter, r *http.Request) (g *game.Game, ok bool) {
+	gameID, ok := s.requestGame(w, r)
+	if !ok {
+		return nil, false
+	}
+	g, err := s.game(gameID)
+	if err != nil {
+		s.writeError(w, err)
+		return nil, false
+	}
+	return g, true
+}
+
+// requestPlayer returns the player in the request's query parameter with the given name, or "" if it isn't set. If
+// the player doesn't have a nation in the game, a 400 Bad Request response is written and ok is false
+func (s *Server) requestPlayer(w http.ResponseWriter, r *http.Request, g *game.Game, param string) (player string, ok bool) {
+	player = r.URL.Query().Get(param)
+	if player == "" {
+		return "", true
+	}
+	nations, err := db.GetNations(g.DB(), g.ID())
+	if err != nil {
+		s.writeError(w, err)
+		return "", false
+	}
+	for _, nation := range nations {
+		if nation.Player == player && player != db.NeutralPlayer {
+			return player, true
+		}
+	}
+	s.writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: fmt.Sprintf("player %q is not in the game", player)})
+	return "", false
+}
+
+// fogPlayer is like requestPlayer, but the player is required if the game uses fog of war, so that the army sizes
+// hidden from the players aren't revealed. If it is missing, a 400 Bad Request response is written and ok is false
+func (s *Server) fogPlayer(w http.ResponseWriter, r *http.Request, g *game.Game, param string) (player string, ok bool) {
+	if player, ok = s.requestPlayer(w, r, g, param); !ok {
+		return "", false
+	}
+	if player == "" && g.Config().FogOfWar {
+		s.writeJSON(w, http.StatusBadRequest, ErrorResponse{
+			Error: fmt.Sprintf("the game uses fog of war, so the player viewing it must be given with ?%s", param),
+		})
+		return "", false
+	}
+	return player, true
+}
+
+// actionHandler returns a handler that decodes the request body into an action of type T and does it. A game in
+// the request's path takes precedence over one in the body
+func actionHandler[T any, PT interface {
+	*T
+	actions.GameAction
+}](s *Server) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		gameID, ok := s.requestGame(w, r)
+		if !ok {
+			return
+		}
+		action := PT(new(T))
+		decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBodySize))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(action); err != nil {
+			s.writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "invalid request body: " + err.Error()})
+			return
+		}
+		if gameID > 0 {
+			action.SetGame(gameID)
+		}
+		s.doAction(w, action)
+	}
+}
+
+func (s *Server) doAction(w http.ResponseWriter, action actions.GameAction) {
+	g, err := s.game(action.Game())
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	result, err := action.Do(g)
+	if err != nil {
+		// Do logs its own errors
+		s.writeError(w, err)
+		return
+	}
+	g.LogInfo(result.String(), "actionType", result.ActionType(), "user", result.User())
+	if victory := actions.GameOver(result); victory != nil {
+		g.LogInfo(victory.String(), "winner", victory.Winner, "condition", victory.Condition)
+	}
+
+	resp := ActionResponse{
+		ActionType: result.ActionType(),
+		User:       result.User(),
+		Message:    result.String(),
+		Result:     result,
+	}
+	if s.UpdateMap {
+		// the action has already been committed, so it isn't reported as failed and retried
+		if err = svgmap.ApplyEvents(g); err != nil {
+			g.LogError("Unable to apply database events to map", "error", err)
+			resp.Warning = "the action was done, but the map couldn't be updated"
+		}
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+func (s *Server) handleNations(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.requestGameHandle(w, r)
+	if !ok {
+		return
+	}
+	nations, err := db.GetNations(g.DB(), g.ID())
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, nations)
+}
+
+func (s *Server) handleHoldings(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.requestGameHandle(w, r)
+	if !ok {
+		return
+	}
+	player, ok := s.fogPlayer(w, r, g, "player")
+	if !ok {
+		return
+	}
+	var holdings []db.HoldingRecord
+	var err error
+	if player != "" {
+		holdings, err = db.GetVisibleHoldings(g.DB(), g.Config(), player)
+	} else {
+		holdings, err = db.GetHoldings(g.DB(), g.ID())
+	}
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, holdings)
+}
+
+func (s *Server) handleTreaties(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.requestGameHandle(w, r)
+	if !ok {
+		return
+	}
+	treaties, err := db.GetTreaties(g.DB(), g.ID())
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, treaties)
+}
+
+func (s *Server) handleCessions(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.requestGameHandle(w, r)
+	if !ok {
+		return
+	}
+	cessions, err := db.GetCessions(g.DB(), g.ID())
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, cessions)
+}
+
+func (s *Server) handleTurn(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.requestGameHandle(w, r)
+	if !ok {
+		return
+	}
+	var state TurnState
+	var err error
+	if state.Started, state.FirstTurn, err = turns.CurrentTurnStarted(g); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if state.PlayersWithActionsLeft, err = turns.PlayersWithActionsLeft(g, nil); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	if state.PlayersWithActionsLeft == nil {
+		state.PlayersWithActionsLeft = map[string]turns.PlayerActions{}
+	}
+	s.writeJSON(w, http.StatusOK, state)
+}
+
+func (s *Server) handleActionLog(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.requestGameHandle(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	filter := db.ActionRecordFilter{
+		GameID:     g.ID(),
+		Player:     query.Get("player"),
+		ActionType: query.Get("type"),
+	}
+	if turnStr := query.Get("turn"); turnStr != "" {
+		var err error
+		if filter.Turn, err = strconv.Atoi(turnStr); err != nil || filter.Turn < 1 {
+			s.writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "turn must be a positive integer"})
+			return
+		}
+	}
+	viewer, ok := s.fogPlayer(w, r, g, "viewer")
+	if !ok {
+		return
+	}
+	records, err := db.GetVisibleActionRecords(g.DB(), g.Config(), filter, viewer)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, records)
+}
+
+// handleOrders writes the orders submitted in a turn of a game using simultaneous resolution, which are the turn's
+// resolution report once it has ended. The orders of the current turn haven't been resolved yet, so they are only
+// listed for the player who submitted them, which is the default turn if a player is given
+func (s *Server) handleOrders(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.requestGameHandle(w, r)
+	if !ok {
+		return
+	}
+	player, ok := s.requestPlayer(w, r, g, "player")
+	if !ok {
+		return
+	}
+	currentTurn, err := db.GetCurrentTurn(g.DB(), g.ID())
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	turn := currentTurn - 1
+	if player != "" {
+		turn = currentTurn
+	}
+	if turnStr := r.URL.Query().Get("turn"); turnStr != "" {
+		if turn, err = strconv.Atoi(turnStr); err != nil || turn < 1 {
+			s.writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "turn must be a positive integer"})
+			return
+		}
+	}
+	if turn >= currentTurn && player == "" {
+		s.writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "the orders of the current turn can only be listed for a player"})
+		return
+	}
+	orders, err := db.GetOrders(g.DB(), g.ID(), turn, player)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, orders)
+}
+
+func (s *Server) handleMap(w http.ResponseWriter, r *http.Request) {
+	g, ok := s.requestGameHandle(w, r)
+	if !ok {
+		return
+	}
+	player, ok := s.fogPlayer(w, r, g, "player")
+	if !ok {
+		return
+	}
+	cfg := g.Config()
+	svgFile, pngFile := cfg.SVGOutFile, cfg.PNGOutFile
+	if player != "" {
+		svgFile, pngFile = svgmap.PlayerMapFiles(cfg, player)
+	}
+	file := pngFile
+	contentType := "image/png"
+	switch r.URL.Query().Get("format") {
+	case "", "png":
+	case "svg":
+		file = svgFile
+		contentType = "image/svg+xml"
+	default:
+		s.writeJSON(w, http.StatusBadRequest, ErrorResponse{Error: "format must be png or svg"})
+		return
+	}
+
+	if _, err := os.Stat(file); errors.Is(err, os.ErrNotExist) {
+		// the map hasn't been rendered yet
+		if player != "" {
+			err = svgmap.RenderPlayerMap(g.DB(), cfg, player, svgFile, pngFile)
+		} else {
+			err = svgmap.ApplyEvents(g)
+		}
+		if err != nil {
+			cfg.LogError("Unable to apply database events to map", "error", err)
+			s.writeError(w, err)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", contentType)
+	http.ServeFile(w, r, file)
+}
+
+func (s *Server) handleGames(w http.ResponseWriter, _ *http.Request) {
+	games := []GameInfo{}
+	for _, g := range s.games {
+		info := GameInfo{ID: g.ID()}
+		var err error
+		if info.Turn, err = db.GetCurrentTurn(g.DB(), g.ID()); err != nil {
+			s.writeError(w, err)
+			return
+		}
+		nations, err := db.GetNations(g.DB(), g.ID())
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+		info.Nations = len(nations)
+		if info.Victory, err = db.GetVictory(g.DB(), nil, g.ID()); err != nil {
+			s.writeError(w, err)
+			return
+		}
+		games = append(games, info)
+	}
+	s.writeJSON(w, http.StatusOK, games)
+}
@@ -0,0 +1,585 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Eggbertx/territories-game/pkg/config"
+	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
+	"github.com/stretchr/testify/assert"
+)
+
+type serverTestRequest struct {
+	method       string
+	path         string
+	body         string
+	expectStatus int
+	checkBody    func(t *testing.T, body []byte)
+}
+
+// setupTestServer returns a server for the testing configuration's game, followed by games with the given
+// configurations in the same database
+func setupTestServer(t *testing.T, configs ...*config.Config) *Server {
+	cfg, err := config.GetTestingConfig(t)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	cfg.DoTurnManagement = true
+	if !assert.NoError(t, config.SetConfig(cfg)) {
+		t.FailNow()
+	}
+	tdb, err := db.GetDB()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	t.Cleanup(func() {
+		assert.NoError(t, db.CloseDB())
+		config.CloseTestingConfig(t)
+	})
+	games := make([]*game.Game, 0, len(configs)+1)
+	for _, gameCfg := range append([]*config.Config{cfg}, configs...) {
+		g, err := game.New(gameCfg, tdb)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		games = append(games, g)
+	}
+	return New(false, games...)
+}
+
+func TestServer(t *testing.T) {
+	s := setupTestServer(t)
+	requests := []serverTestRequest{
+		{
+			method:       http.MethodPost,
+			path:         "/actions/join",
+			body:         `{"user":"Test User","nation":"Test Nation","territory":"CA"}`,
+			expectStatus: http.StatusOK,
+			checkBody: func(t *testing.T, body []byte) {
+				var resp struct {
+					ActionResponse
+					Result json.RawMessage `json:"result"`
+				}
+				assert.NoError(t, json.Unmarshal(body, &resp))
+				assert.Equal(t, "join", resp.ActionType)
+				assert.Equal(t, "Test User", resp.User)
+				assert.Equal(t, "Test Nation founded by Test User in California", resp.Message)
+				assert.Contains(t, string(resp.Result), `"action":{"user":"Test User","nation":"Test Nation","territory":"California"}`)
+			},
+		},
+		{
+			// not enough players have joined yet, so this is an *actions.ActionError
+			method:       http.MethodPost,
+			path:         "/actions/raise",
+			body:         `{"user":"Test User","territory":"CA"}`,
+			expectStatus: http.StatusBadRequest,
+			checkBody: func(t *testing.T, body []byte) {
+				var resp ErrorResponse
+				assert.NoError(t, json.Unmarshal(body, &resp))
+				assert.Contains(t, resp.Error, "not enough players to start the game")
+			},
+		},
+		{
+			method:       http.MethodPost,
+			path:         "/actions/join",
+			body:         `{"user":"Test User 2","nation":"Test Nation 2","territory":"UT"}`,
+			expectStatus: http.StatusOK,
+		},
+		{
+			method:       http.MethodPost,
+			path:         "/actions/color",
+			body:         `{"user":"Test User","color":"#ff0000"}`,
+			expectStatus: http.StatusOK,
+		},
+		{
+			method:       http.MethodPost,
+			path:         "/actions/move",
+			body:         `{"user":"Test User","source":"CA","destination":"NV","armies":1}`,
+			expectStatus: http.StatusOK,
+			checkBody: func(t *testing.T, body []byte) {
+				assert.Contains(t, string(body), `"message":"Test User moved 1 armies from California to Nevada"`)
+			},
+		},
+		{
+			method:       http.MethodPost,
+			path:         "/actions/attack",
+			body:         `{"user":"Test User","attacking":"CA","defending":"CA"}`,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			method:       http.MethodPost,
+			path:         "/actions/raise",
+			body:         `{"user":"Test User","territory":`,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			method:       http.MethodPost,
+			path:         "/actions/raise",
+			body:         `{"user":"Test User","territory":"CA","armies":2}`,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/actions/raise",
+			expectStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			method:       http.MethodPost,
+			path:         "/actions/plan",
+			body:         `{"user":"Test User 2","steps":[{"type":"move","source":"UT","destination":"CA"}]}`,
+			expectStatus: http.StatusBadRequest,
+			checkBody: func(t *testing.T, body []byte) {
+				assert.JSONEq(t, `{"error":"step 1 (move) failed: cannot move from Utah to California: not a neighboring territory"}`, string(body))
+			},
+		},
+		{
+			method:       http.MethodPost,
+			path:         "/actions/plan",
+			body:         `{"user":"Test User","steps":[{"type":"raise","target":"CA"}]}`,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/nations",
+			expectStatus: http.StatusOK,
+			checkBody: func(t *testing.T, body []byte) {
+				var nations []db.Nation
+				assert.NoError(t, json.Unmarshal(body, &nations))
+				assert.Equal(t, []db.Nation{
+					{CountryName: "Test Nation", Player: "Test User", Color: "ff0000", Capital: "CA"},
+					{CountryName: "Test Nation 2", Player: "Test User 2", Color: nations[1].Color, Capital: "UT"},
+				}, nations)
+			},
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/holdings",
+			expectStatus: http.StatusOK,
+			checkBody: func(t *testing.T, body []byte) {
+				var holdings []db.HoldingRecord
+				assert.NoError(t, json.Unmarshal(body, &holdings))
+				armies := make(map[string]int)
+				for _, holding := range holdings {
+					armies[holding.Territory] = holding.ArmySize
+				}
+				assert.Equal(t, map[string]int{"CA": 2, "NV": 1, "UT": 3}, armies)
+			},
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/turn",
+			expectStatus: http.StatusOK,
+			checkBody: func(t *testing.T, body []byte) {
+				var state TurnState
+				assert.NoError(t, json.Unmarshal(body, &state))
+				assert.False(t, state.Started.IsZero())
+				assert.Contains(t, state.PlayersWithActionsLeft, "Test User 2")
+			},
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/actions?player=Test+User&type=move",
+			expectStatus: http.StatusOK,
+			checkBody: func(t *testing.T, body []byte) {
+				var records []db.ActionRecord
+				assert.NoError(t, json.Unmarshal(body, &records))
+				if assert.Len(t, records, 1) {
+					assert.JSONEq(t, `{"action":{"user":"Test User","source":"California","destination":"Nevada","armies":1},"failedMove":false}`,
+						string(records[0].Details))
+				}
+			},
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/actions?turn=0",
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/map?format=jpg",
+			expectStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, req := range requests {
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(req.method, req.path, strings.NewReader(req.body)))
+		if !assert.Equal(t, req.expectStatus, recorder.Code, "unexpected status for %s %s: %s", req.method, req.path, recorder.Body.String()) {
+			continue
+		}
+		if req.checkBody != nil {
+			req.checkBody(t, recorder.Body.Bytes())
+		}
+	}
+}
+
+func TestServerMapUpdateFailure(t *testing.T) {
+	s := setupTestServer(t)
+	s.UpdateMap = true // the testing configuration's map file doesn't exist
+
+	recorder := httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/actions/join",
+		strings.NewReader(`{"user":"Test User","nation":"Test Nation","territory":"CA"}`)))
+	if !assert.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String()) {
+		t.FailNow()
+	}
+	var resp struct {
+		ActionResponse
+		Result json.RawMessage `json:"result"`
+	}
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &resp))
+	assert.Equal(t, "Test Nation founded by Test User in California", resp.Message)
+	assert.Equal(t, "the action was done, but the map couldn't be updated", resp.Warning)
+
+	recorder = httptest.NewRecorder()
+	s.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/nations", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	var nations []db.Nation
+	assert.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &nations))
+	assert.Len(t, nations, 1)
+}
+
+func TestServerMultipleGames(t *testing.T) {
+	cfg, err := config.GetTestingConfig(t)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	game2 := *cfg
+	game2.GameID = 2
+	game2.Territories = slices.Clone(cfg.Territories)
+	s := setupTestServer(t, &game2)
+	requests := []serverTestRequest{
+		{
+			method:       http.MethodPost,
+			path:         "/games/2/actions/join",
+			body:         `{"user":"Test User","nation":"Test Nation","territory":"CA"}`,
+			expectStatus: http.StatusOK,
+		},
+		{
+			// the game in the path takes precedence over the game in the body
+			method:       http.MethodPost,
+			path:         "/games/2/actions/join",
+			body:         `{"game":1,"user":"Test User 2","nation":"Test Nation 2","territory":"UT"}`,
+			expectStatus: http.StatusOK,
+		},
+		{
+			method:       http.MethodPost,
+			path:         "/actions/join",
+			body:         `{"game":1,"user":"Test User","nation":"Test Nation","territory":"CA"}`,
+			expectStatus: http.StatusOK,
+		},
+		{
+			method:       http.MethodPost,
+			path:         "/games/x/actions/join",
+			body:         `{"user":"Test User","nation":"Test Nation","territory":"CA"}`,
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			method:       http.MethodPost,
+			path:         "/games/3/actions/join",
+			body:         `{"user":"Test User","nation":"Test Nation","territory":"CA"}`,
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/games/3/nations",
+			expectStatus: http.StatusNotFound,
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/games/2/holdings",
+			expectStatus: http.StatusOK,
+			checkBody: func(t *testing.T, body []byte) {
+				var holdings []db.HoldingRecord
+				assert.NoError(t, json.Unmarshal(body, &holdings))
+				var territories []string
+				for _, holding := range holdings {
+					territories = append(territories, holding.Territory)
+				}
+				assert.Equal(t, []string{"CA", "UT"}, territories)
+			},
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/nations",
+			expectStatus: http.StatusOK,
+			checkBody: func(t *testing.T, body []byte) {
+				var nations []db.Nation
+				assert.NoError(t, json.Unmarshal(body, &nations))
+				assert.Len(t, nations, 1)
+			},
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/games/2/actions?type=join",
+			expectStatus: http.StatusOK,
+			checkBody: func(t *testing.T, body []byte) {
+				var records []db.ActionRecord
+				assert.NoError(t, json.Unmarshal(body, &records))
+				assert.Len(t, records, 2)
+			},
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/games",
+			expectStatus: http.StatusOK,
+			checkBody: func(t *testing.T, body []byte) {
+				var games []GameInfo
+				assert.NoError(t, json.Unmarshal(body, &games))
+				assert.Equal(t, []GameInfo{
+					{ID: 1, Turn: 1, Nations: 1},
+					{ID: 2, Turn: 1, Nations: 2},
+				}, games)
+			},
+		},
+	}
+
+	for _, req := range requests {
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(req.method, req.path, strings.NewReader(req.body)))
+		if !assert.Equal(t, req.expectStatus, recorder.Code, "unexpected status for %s %s: %s", req.method, req.path, recorder.Body.String()) {
+			continue
+		}
+		if req.checkBody != nil {
+			req.checkBody(t, recorder.Body.Bytes())
+		}
+	}
+}
+
+func TestServerFogOfWar(t *testing.T) {
+	cfg, err := config.GetTestingConfig(t)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	game2 := *cfg
+	game2.GameID = 2
+	game2.FogOfWar = true
+	game2.Territories = slices.Clone(cfg.Territories)
+	s := setupTestServer(t, &game2)
+	armySizes := func(t *testing.T, body []byte) map[string]int {
+		var holdings []db.HoldingRecord
+		assert.NoError(t, json.Unmarshal(body, &holdings))
+		sizes := map[string]int{}
+		for _, holding := range holdings {
+			assert.Equal(t, holding.ArmySize == 0, holding.Hidden)
+			sizes[holding.Territory] = holding.ArmySize
+		}
+		return sizes
+	}
+	requests := []serverTestRequest{
+		{
+			method:       http.MethodPost,
+			path:         "/games/2/actions/join",
+			body:         `{"user":"Test User","nation":"Test Nation","territory":"CA"}`,
+			expectStatus: http.StatusOK,
+		},
+		{
+			method:       http.MethodPost,
+			path:         "/games/2/actions/join",
+			body:         `{"user":"Test User 2","nation":"Test Nation 2","territory":"UT"}`,
+			expectStatus: http.StatusOK,
+		},
+		{
+			// the full state isn't available when the game uses fog of war
+			method:       http.MethodGet,
+			path:         "/games/2/holdings",
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/games/2/map",
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/games/2/actions",
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/games/2/actions?viewer=Test+User",
+			expectStatus: http.StatusOK,
+			checkBody: func(t *testing.T, body []byte) {
+				var records []db.ActionRecord
+				assert.NoError(t, json.Unmarshal(body, &records))
+				if assert.Len(t, records, 2) {
+					assert.NotEmpty(t, records[0].Details)
+					assert.Contains(t, records[0].Changes.Holdings, "CA")
+					assert.Empty(t, records[1].Details, "expected the other player's action details to be hidden")
+					assert.NotContains(t, records[1].Changes.Holdings, "UT")
+				}
+			},
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/games/2/holdings?player=Test+User",
+			expectStatus: http.StatusOK,
+			checkBody: func(t *testing.T, body []byte) {
+				assert.Equal(t, map[string]int{"CA": 3, "UT": 0}, armySizes(t, body))
+			},
+		},
+		{
+			method:       http.MethodPost,
+			path:         "/games/2/actions/move",
+			body:         `{"user":"Test User","source":"CA","destination":"NV","armies":1}`,
+			expectStatus: http.StatusOK,
+		},
+		{
+			// Nevada borders Utah
+			method:       http.MethodGet,
+			path:         "/games/2/holdings?player=Test+User",
+			expectStatus: http.StatusOK,
+			checkBody: func(t *testing.T, body []byte) {
+				assert.Equal(t, map[string]int{"CA": 2, "NV": 1, "UT": 3}, armySizes(t, body))
+			},
+		},
+		{
+			// game 1 doesn't use fog of war
+			method:       http.MethodPost,
+			path:         "/actions/join",
+			body:         `{"user":"Test User","nation":"Test Nation","territory":"CA"}`,
+			expectStatus: http.StatusOK,
+		},
+		{
+			method:       http.MethodPost,
+			path:         "/actions/join",
+			body:         `{"user":"Test User 2","nation":"Test Nation 2","territory":"UT"}`,
+			expectStatus: http.StatusOK,
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/holdings?player=Test+User",
+			expectStatus: http.StatusOK,
+			checkBody: func(t *testing.T, body []byte) {
+				assert.Equal(t, map[string]int{"CA": 3, "UT": 3}, armySizes(t, body))
+			},
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/games/2/holdings?player=Nobody",
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/games/2/map?player=Nobody",
+			expectStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, req := range requests {
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(req.method, req.path, strings.NewReader(req.body)))
+		if !assert.Equal(t, req.expectStatus, recorder.Code, "unexpected status for %s %s: %s", req.method, req.path, recorder.Body.String()) {
+			continue
+		}
+		if req.checkBody != nil {
+			req.checkBody(t, recorder.Body.Bytes())
+		}
+	}
+}
+
+func TestServerOrders(t *testing.T) {
+	cfg, err := config.GetTestingConfig(t)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	game2 := *cfg
+	game2.GameID = 2
+	game2.ResolutionMode = config.ResolutionSimultaneous
+	game2.Territories = slices.Clone(cfg.Territories)
+	s := setupTestServer(t, &game2)
+	requests := []serverTestRequest{
+		{
+			method:       http.MethodPost,
+			path:         "/games/2/actions/join",
+			body:         `{"user":"Test User","nation":"Test Nation","territory":"CA"}`,
+			expectStatus: http.StatusOK,
+		},
+		{
+			method:       http.MethodPost,
+			path:         "/games/2/actions/join",
+			body:         `{"user":"Test User 2","nation":"Test Nation 2","territory":"UT"}`,
+			expectStatus: http.StatusOK,
+		},
+		{
+			method:       http.MethodPost,
+			path:         "/games/2/actions/move",
+			body:         `{"user":"Test User","source":"CA","destination":"NV","armies":1}`,
+			expectStatus: http.StatusOK,
+			checkBody: func(t *testing.T, body []byte) {
+				var resp struct {
+					ActionResponse
+					Result json.RawMessage `json:"result"`
+				}
+				assert.NoError(t, json.Unmarshal(body, &resp))
+				assert.Equal(t, "order", resp.ActionType)
+				assert.Equal(t, "Test User ordered 1 armies to move from California to Nevada", resp.Message)
+			},
+		},
+		{
+			// the move is stored until the turn ends
+			method:       http.MethodGet,
+			path:         "/games/2/holdings",
+			expectStatus: http.StatusOK,
+			checkBody: func(t *testing.T, body []byte) {
+				var holdings []db.HoldingRecord
+				assert.NoError(t, json.Unmarshal(body, &holdings))
+				assert.Len(t, holdings, 2)
+			},
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/games/2/orders?player=Test+User",
+			expectStatus: http.StatusOK,
+			checkBody: func(t *testing.T, body []byte) {
+				var orders []db.Order
+				assert.NoError(t, json.Unmarshal(body, &orders))
+				if assert.Len(t, orders, 1) {
+					assert.Equal(t, db.Order{ID: orders[0].ID, Turn: orders[0].Turn, Player: "Test User", Type: "move", Source: "CA",
+						Destination: "NV", Armies: 1, Status: db.OrderPending}, orders[0])
+				}
+			},
+		},
+		{
+			// no turn has ended yet
+			method:       http.MethodGet,
+			path:         "/games/2/orders",
+			expectStatus: http.StatusOK,
+			checkBody: func(t *testing.T, body []byte) {
+				assert.JSONEq(t, "[]", string(body))
+			},
+		},
+		{
+			method: http.MethodGet,
+			// the orders of the current turn can only be listed by their player
+			path:         "/games/2/orders?turn=100",
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/games/2/orders?turn=first",
+			expectStatus: http.StatusBadRequest,
+		},
+		{
+			method:       http.MethodGet,
+			path:         "/games/2/orders?player=Nobody",
+			expectStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, req := range requests {
+		recorder := httptest.NewRecorder()
+		s.ServeHTTP(recorder, httptest.NewRequest(req.method, req.path, strings.NewReader(req.body)))
+		if !assert.Equal(t, req.expectStatus, recorder.Code, "unexpected status for %s %s: %s", req.method, req.path, recorder.Body.String()) {
+			continue
+		}
+		if req.checkBody != nil {
+			req.checkBody(t, recorder.Body.Bytes())
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package svgmap
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/antchfx/xmlquery"
+)
+
+var (
+	cssCommentRE = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	cssRuleRE    = regexp.MustCompile(`(?s)([^{}]+)\{([^{}]*)\}`)
+
+	// inheritedProperties are the style properties that are passed down from parent elements to their children
+	inheritedProperties = []string{
+		"fill", "fill-opacity", "stroke", "stroke-opacity", "stroke-width", "font-family", "font-size", "font-weight", "text-anchor",
+	}
+)
+
+// compoundSelector matches a single element, e.g. "text.territory-label" or "#nations-list"
+type compoundSelector struct {
+	element string
+	id      string
+	classes []string
+}
+
+func (cs *compoundSelector) matches(node *xmlquery.Node) bool {
+	if cs.element != "" && cs.element != "*" && cs.element != node.Data {
+		return false
+	}
+	if cs.id != "" && cs.id != node.SelectAttr("id") {
+		return false
+	}
+	if len(cs.classes) > 0 {
+		nodeClasses := strings.Fields(node.SelectAttr("class"))
+		for _, class := range cs.classes {
+			if !slices.Contains(nodeClasses, class) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// cssSelector is a list of compound selectors separated by descendant combinators, e.g. "#nations-list text"
+type cssSelector struct {
+	parts       []compoundSelector
+	specificity int
+}
+
+func (sel *cssSelector) matches(node *xmlquery.Node) bool {
+	last := len(sel.parts) - 1
+	if !sel.parts[last].matches(node) {
+		return false
+	}
+	ancestor := node.Parent
+	for p := last - 1; p >= 0; p-- {
+		for ancestor != nil && (ancestor.Type != xmlquery.ElementNode || !sel.parts[p].matches(ancestor)) {
+			ancestor = ancestor.Parent
+		}
+		if ancestor == nil {
+			return false
+		}
+		ancestor = ancestor.Parent
+	}
+	return true
+}
+
+type cssRule struct {
+	selector     cssSelector
+	declarations map[string]string
+}
+
+func parseCompoundSelector(str string) (compoundSelector, int, bool) {
+	var cs compoundSelector
+	var specificity int
+	for str != "" {
+		end := strings.IndexAny(str[1:], "#.") + 1
+		if end == 0 {
+			end = len(str)
+		}
+		token := str[:end]
+		str = str[end:]
+		switch token[0] {
+		case '#':
+			cs.id = token[1:]
+			specificity += 10000
+		case '.':
+			cs.classes = append(cs.classes, token[1:])
+			specificity += 100
+		default:
+			if strings.ContainsAny(token, ":[>+~") {
+				// pseudo-classes, attribute selectors, and other combinators aren't supported
+				return cs, 0, false
+			}
+			cs.element = token
+			if token != "*" {
+				specificity++
+			}
+		}
+	}
+	return cs, specificity, true
+}
+
+// parseStyleDeclarations parses a list of CSS declarations such as the contents of a style attribute
+func parseStyleDeclarations(str string, into map[string]string) map[string]string {
+	if into == nil {
+		into = make(map[string]string)
+	}
+	for _, decl := range strings.Split(str, ";") {
+		property, value, found := strings.Cut(decl, ":")
+		if !found {
+			continue
+		}
+		property = strings.ToLower(strings.TrimSpace(property))
+		value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "!important"))
+		if property != "" && value != "" {
+			into[property] = value
+		}
+	}
+	return into
+}
+
+// parseStyleSheet parses the subset of CSS supported by the map renderer: rules made of element, id, and class
+// selectors, optionally combined with descendant combinators
+func parseStyleSheet(css string) []cssRule {
+	var rules []cssRule
+	css = cssCommentRE.ReplaceAllString(css, "")
+	for _, match := range cssRuleRE.FindAllStringSubmatch(css, -1) {
+		declarations := parseStyleDeclarations(match[2], nil)
+		for _, selectorStr := range strings.Split(match[1], ",") {
+			var sel cssSelector
+			valid := true
+			for _, part := range strings.Fields(selectorStr) {
+				cs, specificity, ok := parseCompoundSelector(part)
+				if !ok {
+					valid = false
+					break
+				}
+				sel.parts = append(sel.parts, cs)
+				sel.specificity += specificity
+			}
+			if !valid || len(sel.parts) == 0 {
+				continue
+			}
+			rules = append(rules, cssRule{selector: sel, declarations: declarations})
+		}
+	}
+	slices.SortStableFunc(rules, func(a, b cssRule) int {
+		return a.selector.specificity - b.selector.specificity
+	})
+	return rules
+}
+
+// computeStyle returns the style properties for the given element, in order of increasing precedence: inherited
+// properties, presentation attributes, style sheet rules, and the style attribute
+func computeStyle(node *xmlquery.Node, parentStyle map[string]string, rules []cssRule) map[string]string {
+	style := make(map[string]string)
+	for _, property := range inheritedProperties {
+		if value, ok := parentStyle[property]; ok {
+			style[property] = value
+		}
+	}
+	for _, attr := range node.Attr {
+		if attr.Name.Space == "" && (slices.Contains(inheritedProperties, attr.Name.Local) ||
+			attr.Name.Local == "display" || attr.Name.Local == "opacity") {
+			style[attr.Name.Local] = attr.Value
+		}
+	}
+	for _, rule := range rules {
+		if rule.selector.matches(node) {
+			for property, value := range rule.declarations {
+				style[property] = value
+			}
+		}
+	}
+	parseStyleDeclarations(node.SelectAttr("style"), style)
+	for property, value := range style {
+		if value == "inherit" {
+			if parentValue, ok := parentStyle[property]; ok {
+				style[property] = parentValue
+			} else {
+				delete(style, property)
+			}
+		}
+	}
+	return style
+}
@@ -0,0 +1,377 @@
+package svgmap
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// maxCurveSegments is the maximum number of line segments a single curve or arc is flattened into
+	maxCurveSegments = 64
+	// curveSegmentLength is the approximate length (in pixels) of each line segment a curve is flattened into
+	curveSegmentLength = 3.0
+)
+
+type point struct {
+	x, y float64
+}
+
+// subpath is a flattened list of points, used for both filling and stroking
+type subpath struct {
+	points []point
+	closed bool
+}
+
+// pathBuilder flattens SVG path commands into subpaths made of straight line segments
+type pathBuilder struct {
+	subpaths []subpath
+	current  *subpath
+	start    point
+	pen      point
+	// lastCtrl is the last control point of the previous curve command, used for S/s and T/t reflection
+	lastCtrl    point
+	lastCmd     byte
+	transformer func(point) point
+}
+
+func (pb *pathBuilder) moveTo(p point) {
+	pb.subpaths = append(pb.subpaths, subpath{points: []point{pb.transformer(p)}})
+	pb.current = &pb.subpaths[len(pb.subpaths)-1]
+	pb.start = p
+	pb.pen = p
+}
+
+func (pb *pathBuilder) lineTo(p point) {
+	if pb.current == nil {
+		pb.moveTo(pb.pen)
+	}
+	pb.current.points = append(pb.current.points, pb.transformer(p))
+	pb.pen = p
+}
+
+func (pb *pathBuilder) closePath() {
+	if pb.current == nil {
+		return
+	}
+	pb.current.closed = true
+	pb.current = nil
+	pb.pen = pb.start
+}
+
+// segments returns the number of line segments to use for a curve with the given control polygon
+func (pb *pathBuilder) segments(points ...point) int {
+	var length float64
+	for i := 1; i < len(points); i++ {
+		a := pb.transformer(points[i-1])
+		b := pb.transformer(points[i])
+		length += math.Hypot(b.x-a.x, b.y-a.y)
+	}
+	n := int(math.Ceil(length / curveSegmentLength))
+	return max(1, min(n, maxCurveSegments))
+}
+
+func (pb *pathBuilder) cubicTo(c1, c2, p point) {
+	p0 := pb.pen
+	n := pb.segments(p0, c1, c2, p)
+	for i := 1; i <= n; i++ {
+		t := float64(i) / float64(n)
+		mt := 1 - t
+		pb.lineTo(point{
+			x: mt*mt*mt*p0.x + 3*mt*mt*t*c1.x + 3*mt*t*t*c2.x + t*t*t*p.x,
+			y: mt*mt*mt*p0.y + 3*mt*mt*t*c1.y + 3*mt*t*t*c2.y + t*t*t*p.y,
+		})
+	}
+	pb.lastCtrl = c2
+}
+
+func (pb *pathBuilder) quadTo(c, p point) {
+	p0 := pb.pen
+	n := pb.segments(p0, c, p)
+	for i := 1; i <= n; i++ {
+		t := float64(i) / float64(n)
+		mt := 1 - t
+		pb.lineTo(point{
+			x: mt*mt*p0.x + 2*mt*t*c.x + t*t*p.x,
+			y: mt*mt*p0.y + 2*mt*t*c.y + t*t*p.y,
+		})
+	}
+	pb.lastCtrl = c
+}
+
+// arcTo converts an SVG endpoint-parameterized elliptical arc to its center parameterization and flattens it,
+// as described in the SVG spec's implementation notes
+func (pb *pathBuilder) arcTo(rx, ry, rotation float64, largeArc, sweep bool, p point) {
+	p0 := pb.pen
+	if p0 == p {
+		return
+	}
+	rx = math.Abs(rx)
+	ry = math.Abs(ry)
+	if rx == 0 || ry == 0 {
+		pb.lineTo(p)
+		return
+	}
+	phi := rotation * math.Pi / 180
+	cosPhi, sinPhi := math.Cos(phi), math.Sin(phi)
+	dx := (p0.x - p.x) / 2
+	dy := (p0.y - p.y) / 2
+	x1 := cosPhi*dx + sinPhi*dy
+	y1 := -sinPhi*dx + cosPhi*dy
+
+	// scale up the radii if they are too small to reach the end point
+	if lambda := (x1*x1)/(rx*rx) + (y1*y1)/(ry*ry); lambda > 1 {
+		rx *= math.Sqrt(lambda)
+		ry *= math.Sqrt(lambda)
+	}
+
+	num := rx*rx*ry*ry - rx*rx*y1*y1 - ry*ry*x1*x1
+	den := rx*rx*y1*y1 + ry*ry*x1*x1
+	coef := math.Sqrt(math.Max(0, num/den))
+	if largeArc == sweep {
+		coef = -coef
+	}
+	cx1 := coef * rx * y1 / ry
+	cy1 := -coef * ry * x1 / rx
+	cx := cosPhi*cx1 - sinPhi*cy1 + (p0.x+p.x)/2
+	cy := sinPhi*cx1 + cosPhi*cy1 + (p0.y+p.y)/2
+
+	angle := func(ux, uy, vx, vy float64) float64 {
+		return math.Atan2(ux*vy-uy*vx, ux*vx+uy*vy)
+	}
+	theta1 := angle(1, 0, (x1-cx1)/rx, (y1-cy1)/ry)
+	delta := angle((x1-cx1)/rx, (y1-cy1)/ry, (-x1-cx1)/rx, (-y1-cy1)/ry)
+	if !sweep && delta > 0 {
+		delta -= 2 * math.Pi
+	} else if sweep && delta < 0 {
+		delta += 2 * math.Pi
+	}
+
+	n := pb.segments(p0, point{cx, cy}, p)
+	n = max(n, int(math.Ceil(math.Abs(delta)/(math.Pi/16))))
+	n = min(n, maxCurveSegments)
+	for i := 1; i <= n; i++ {
+		theta := theta1 + delta*float64(i)/float64(n)
+		ex := rx * math.Cos(theta)
+		ey := ry * math.Sin(theta)
+		pb.lineTo(point{
+			x: cosPhi*ex - sinPhi*ey + cx,
+			y: sinPhi*ex + cosPhi*ey + cy,
+		})
+	}
+	pb.pen = p
+}
+
+// pathTokenizer splits SVG path data into command letters and numbers
+type pathTokenizer struct {
+	data string
+	pos  int
+}
+
+func (pt *pathTokenizer) skipSeparators() {
+	for pt.pos < len(pt.data) {
+		c := pt.data[pt.pos]
+		if c != ' ' && c != ',' && c != '\t' && c != '\n' && c != '\r' {
+			return
+		}
+		pt.pos++
+	}
+}
+
+// nextCommand returns the next command letter, or 0 if the next token is a number (an implicit repeat of the previous command)
+func (pt *pathTokenizer) nextCommand() (byte, bool) {
+	pt.skipSeparators()
+	if pt.pos >= len(pt.data) {
+		return 0, false
+	}
+	c := pt.data[pt.pos]
+	if (c >= 'a' && c <= 'z' && c != 'e') || (c >= 'A' && c <= 'Z' && c != 'E') {
+		pt.pos++
+		return c, true
+	}
+	return 0, true
+}
+
+func (pt *pathTokenizer) number() (float64, error) {
+	pt.skipSeparators()
+	start := pt.pos
+	if pt.pos < len(pt.data) && (pt.data[pt.pos] == '-' || pt.data[pt.pos] == '+') {
+		pt.pos++
+	}
+	var seenDot, seenExp bool
+	for pt.pos < len(pt.data) {
+		c := pt.data[pt.pos]
+		switch {
+		case c >= '0' && c <= '9':
+		case c == '.' && !seenDot && !seenExp:
+			seenDot = true
+		case (c == 'e' || c == 'E') && !seenExp:
+			seenExp = true
+			if pt.pos+1 < len(pt.data) && (pt.data[pt.pos+1] == '-' || pt.data[pt.pos+1] == '+') {
+				pt.pos++
+			}
+		default:
+			return pt.parse(start)
+		}
+		pt.pos++
+	}
+	return pt.parse(start)
+}
+
+func (pt *pathTokenizer) parse(start int) (float64, error) {
+	if start == pt.pos {
+		return 0, fmt.Errorf("expected number at offset %d in path data", start)
+	}
+	return strconv.ParseFloat(pt.data[start:pt.pos], 64)
+}
+
+// flag parses an arc flag, which may not be separated from the following number (e.g. "a 5,5 0 011,1")
+func (pt *pathTokenizer) flag() (bool, error) {
+	pt.skipSeparators()
+	if pt.pos >= len(pt.data) || (pt.data[pt.pos] != '0' && pt.data[pt.pos] != '1') {
+		return false, fmt.Errorf("expected arc flag at offset %d in path data", pt.pos)
+	}
+	pt.pos++
+	return pt.data[pt.pos-1] == '1', nil
+}
+
+func (pt *pathTokenizer) numbers(n int) ([]float64, error) {
+	nums := make([]float64, n)
+	var err error
+	for i := range nums {
+		if nums[i], err = pt.number(); err != nil {
+			return nil, err
+		}
+	}
+	return nums, nil
+}
+
+// parsePathData flattens the value of a path element's d attribute into subpaths, transforming each point with
+// the given function (or leaving them as is if it is nil)
+func parsePathData(d string, transformer func(point) point) ([]subpath, error) {
+	if transformer == nil {
+		transformer = func(p point) point { return p }
+	}
+	pb := &pathBuilder{transformer: transformer}
+	pt := &pathTokenizer{data: strings.TrimSpace(d)}
+	var cmd byte
+	for {
+		next, ok := pt.nextCommand()
+		if !ok {
+			break
+		}
+		if next != 0 {
+			cmd = next
+		} else if cmd == 0 {
+			return nil, fmt.Errorf("path data must start with a command")
+		}
+		relative := cmd >= 'a' && cmd <= 'z'
+		rel := func(x, y float64) point {
+			if relative {
+				return point{pb.pen.x + x, pb.pen.y + y}
+			}
+			return point{x, y}
+		}
+		upper := strings.ToUpper(string(cmd))[0]
+		var err error
+		var nums []float64
+		switch upper {
+		case 'M':
+			if nums, err = pt.numbers(2); err != nil {
+				return nil, err
+			}
+			pb.moveTo(rel(nums[0], nums[1]))
+			// subsequent coordinate pairs are treated as implicit lineto commands
+			cmd = 'L'
+			if relative {
+				cmd = 'l'
+			}
+		case 'L':
+			if nums, err = pt.numbers(2); err != nil {
+				return nil, err
+			}
+			pb.lineTo(rel(nums[0], nums[1]))
+		case 'H':
+			if nums, err = pt.numbers(1); err != nil {
+				return nil, err
+			}
+			x := nums[0]
+			if relative {
+				x += pb.pen.x
+			}
+			pb.lineTo(point{x, pb.pen.y})
+		case 'V':
+			if nums, err = pt.numbers(1); err != nil {
+				return nil, err
+			}
+			y := nums[0]
+			if relative {
+				y += pb.pen.y
+			}
+			pb.lineTo(point{pb.pen.x, y})
+		case 'C':
+			if nums, err = pt.numbers(6); err != nil {
+				return nil, err
+			}
+			pb.cubicTo(rel(nums[0], nums[1]), rel(nums[2], nums[3]), rel(nums[4], nums[5]))
+		case 'S':
+			if nums, err = pt.numbers(4); err != nil {
+				return nil, err
+			}
+			c1 := pb.pen
+			if pb.lastCmd == 'C' || pb.lastCmd == 'S' {
+				c1 = point{2*pb.pen.x - pb.lastCtrl.x, 2*pb.pen.y - pb.lastCtrl.y}
+			}
+			pb.cubicTo(c1, rel(nums[0], nums[1]), rel(nums[2], nums[3]))
+		case 'Q':
+			if nums, err = pt.numbers(4); err != nil {
+				return nil, err
+			}
+			pb.quadTo(rel(nums[0], nums[1]), rel(nums[2], nums[3]))
+		case 'T':
+			if nums, err = pt.numbers(2); err != nil {
+				return nil, err
+			}
+			c := pb.pen
+			if pb.lastCmd == 'Q' || pb.lastCmd == 'T' {
+				c = point{2*pb.pen.x - pb.lastCtrl.x, 2*pb.pen.y - pb.lastCtrl.y}
+			}
+			pb.quadTo(c, rel(nums[0], nums[1]))
+		case 'A':
+			if nums, err = pt.numbers(3); err != nil {
+				return nil, err
+			}
+			largeArc, err := pt.flag()
+			if err != nil {
+				return nil, err
+			}
+			sweep, err := pt.flag()
+			if err != nil {
+				return nil, err
+			}
+			end, err := pt.numbers(2)
+			if err != nil {
+				return nil, err
+			}
+			pb.arcTo(nums[0], nums[1], nums[2], largeArc, sweep, rel(end[0], end[1]))
+		case 'Z':
+			pb.closePath()
+		default:
+			return nil, fmt.Errorf("unsupported path command %q", cmd)
+		}
+		pb.lastCmd = upper
+	}
+	return pb.subpaths, nil
+}
+
+// ellipseSubpath returns a closed subpath approximating an ellipse
+func ellipseSubpath(cx, cy, rx, ry float64, transformer func(point) point) subpath {
+	n := max(16, min(maxCurveSegments*2, int(math.Ceil(2*math.Pi*math.Max(rx, ry)/curveSegmentLength))))
+	sp := subpath{points: make([]point, 0, n), closed: true}
+	for i := range n {
+		theta := 2 * math.Pi * float64(i) / float64(n)
+		sp.points = append(sp.points, transformer(point{cx + rx*math.Cos(theta), cy + ry*math.Sin(theta)}))
+	}
+	return sp
+}
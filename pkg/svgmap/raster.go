@@ -0,0 +1,644 @@
+package svgmap
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/mazznoer/csscolorparser"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+)
+
+const (
+	defaultFontSize = 16.0
+)
+
+var (
+	transformRE = regexp.MustCompile(`([a-zA-Z]+)\s*\(([^)]*)\)`)
+	listSepRE   = regexp.MustCompile(`[\s,]+`)
+
+	fontsOnce   sync.Once
+	regularFont *opentype.Font
+	boldFont    *opentype.Font
+	errFonts    error
+
+	ErrMissingSVGElement = errors.New("svg element not found in document")
+)
+
+// affine is a 2D affine transformation matrix in the same order as the SVG matrix(a,b,c,d,e,f) transform
+type affine [6]float64
+
+var identity = affine{1, 0, 0, 1, 0, 0}
+
+func (m affine) apply(p point) point {
+	return point{
+		x: m[0]*p.x + m[2]*p.y + m[4],
+		y: m[1]*p.x + m[3]*p.y + m[5],
+	}
+}
+
+// multiply returns the transformation that applies n, then m
+func (m affine) multiply(n affine) affine {
+	return affine{
+		m[0]*n[0] + m[2]*n[1],
+		m[1]*n[0] + m[3]*n[1],
+		m[0]*n[2] + m[2]*n[3],
+		m[1]*n[2] + m[3]*n[3],
+		m[0]*n[4] + m[2]*n[5] + m[4],
+		m[1]*n[4] + m[3]*n[5] + m[5],
+	}
+}
+
+// scale returns the average scale factor of the transformation, used for stroke widths and font sizes
+func (m affine) scale() float64 {
+	return math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+}
+
+func parseNumberList(str string) ([]float64, error) {
+	var nums []float64
+	for _, field := range listSepRE.Split(strings.TrimSpace(str), -1) {
+		if field == "" {
+			continue
+		}
+		num, err := strconv.ParseFloat(field, 64)
+		if err != nil {
+			return nil, err
+		}
+		nums = append(nums, num)
+	}
+	return nums, nil
+}
+
+func parseTransform(str string) (affine, error) {
+	m := identity
+	for _, match := range transformRE.FindAllStringSubmatch(str, -1) {
+		args, err := parseNumberList(match[2])
+		if err != nil {
+			return m, fmt.Errorf("invalid transform %q: %w", match[0], err)
+		}
+		arg := func(i int, def float64) float64 {
+			if i < len(args) {
+				return args[i]
+			}
+			return def
+		}
+		var t affine
+		switch match[1] {
+		case "matrix":
+			if len(args) != 6 {
+				return m, fmt.Errorf("invalid transform %q: expected 6 arguments", match[0])
+			}
+			copy(t[:], args)
+		case "translate":
+			t = affine{1, 0, 0, 1, arg(0, 0), arg(1, 0)}
+		case "scale":
+			t = affine{arg(0, 1), 0, 0, arg(1, arg(0, 1)), 0, 0}
+		case "rotate":
+			theta := arg(0, 0) * math.Pi / 180
+			cx, cy := arg(1, 0), arg(2, 0)
+			t = affine{1, 0, 0, 1, cx, cy}.
+				multiply(affine{math.Cos(theta), math.Sin(theta), -math.Sin(theta), math.Cos(theta), 0, 0}).
+				multiply(affine{1, 0, 0, 1, -cx, -cy})
+		case "skewX":
+			t = affine{1, 0, math.Tan(arg(0, 0) * math.Pi / 180), 1, 0, 0}
+		case "skewY":
+			t = affine{1, math.Tan(arg(0, 0) * math.Pi / 180), 0, 1, 0, 0}
+		default:
+			return m, fmt.Errorf("unsupported transform %q", match[1])
+		}
+		m = m.multiply(t)
+	}
+	return m, nil
+}
+
+// parseLength parses an SVG length, resolving percentages relative to the given reference length
+func parseLength(str string, reference float64) (float64, error) {
+	str = strings.TrimSpace(str)
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(str, "%"):
+		multiplier = reference / 100
+		str = strings.TrimSuffix(str, "%")
+	case strings.HasSuffix(str, "px"):
+		str = strings.TrimSuffix(str, "px")
+	case strings.HasSuffix(str, "pt"):
+		multiplier = 96.0 / 72.0
+		str = strings.TrimSuffix(str, "pt")
+	}
+	length, err := strconv.ParseFloat(strings.TrimSpace(str), 64)
+	if err != nil {
+		return 0, err
+	}
+	return length * multiplier, nil
+}
+
+// lengthAttr returns the length value of the given attribute, or 0 if it is not set
+func lengthAttr(node *xmlquery.Node, attr string, reference float64) (float64, error) {
+	str := node.SelectAttr(attr)
+	if str == "" {
+		return 0, nil
+	}
+	length, err := parseLength(str, reference)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s attribute in %s element: %w", attr, node.Data, err)
+	}
+	return length, nil
+}
+
+// paintColor returns the color for the given fill or stroke value, or false if nothing should be painted
+func paintColor(value string, opacity float64) (color.Color, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" || value == "none" || opacity <= 0 {
+		return nil, false
+	}
+	parsed, err := csscolorparser.Parse(value)
+	if err != nil {
+		// unsupported paint servers such as gradients and patterns are ignored
+		return nil, false
+	}
+	parsed.A *= opacity
+	if parsed.A <= 0 {
+		return nil, false
+	}
+	r, g, b, a := parsed.Clamp().RGBA255()
+	return color.NRGBA{R: r, G: g, B: b, A: a}, true
+}
+
+func styleFloat(style map[string]string, property string, def float64) float64 {
+	value, ok := style[property]
+	if !ok {
+		return def
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return def
+	}
+	return f
+}
+
+func loadFonts() error {
+	fontsOnce.Do(func() {
+		if regularFont, errFonts = opentype.Parse(goregular.TTF); errFonts != nil {
+			return
+		}
+		boldFont, errFonts = opentype.Parse(gobold.TTF)
+	})
+	return errFonts
+}
+
+type faceKey struct {
+	size float64
+	bold bool
+}
+
+// rasterizer renders the subset of SVG used by map files (paths, rects, circles, ellipses, lines, polygons, and
+// text styled with attributes, style attributes, and simple style sheets) to an image
+type rasterizer struct {
+	dst    *image.RGBA
+	rules  []cssRule
+	width  float64
+	height float64
+	faces  map[faceKey]font.Face
+}
+
+// rasterizeSVG renders the given SVG document to an image, scaling it by the given factor
+func rasterizeSVG(doc *xmlquery.Node, scale float64) (*image.RGBA, error) {
+	root := xmlquery.FindOne(doc, "//svg")
+	if root == nil {
+		return nil, ErrMissingSVGElement
+	}
+	if scale <= 0 {
+		scale = 1
+	}
+
+	r := &rasterizer{faces: make(map[faceKey]font.Face)}
+	defer r.closeFaces()
+	width, err := lengthAttr(root, "width", 0)
+	if err != nil {
+		return nil, err
+	}
+	height, err := lengthAttr(root, "height", 0)
+	if err != nil {
+		return nil, err
+	}
+	r.width, r.height = width, height
+	base := affine{scale, 0, 0, scale, 0, 0}
+	if viewBoxStr := root.SelectAttr("viewBox"); viewBoxStr != "" {
+		viewBox, err := parseNumberList(viewBoxStr)
+		if err != nil || len(viewBox) != 4 || viewBox[2] <= 0 || viewBox[3] <= 0 {
+			return nil, fmt.Errorf("invalid viewBox attribute %q in svg element", viewBoxStr)
+		}
+		if width <= 0 {
+			width = viewBox[2]
+		}
+		if height <= 0 {
+			height = viewBox[3]
+		}
+		base = base.multiply(affine{width / viewBox[2], 0, 0, height / viewBox[3], 0, 0}).
+			multiply(affine{1, 0, 0, 1, -viewBox[0], -viewBox[1]})
+		r.width, r.height = viewBox[2], viewBox[3]
+	}
+	if width <= 0 || height <= 0 {
+		return nil, errors.New("svg element must have a valid width and height or viewBox")
+	}
+
+	for _, styleNode := range xmlquery.Find(doc, "//style") {
+		r.rules = append(r.rules, parseStyleSheet(styleNode.InnerText())...)
+	}
+	r.dst = image.NewRGBA(image.Rect(0, 0, int(math.Ceil(width*scale)), int(math.Ceil(height*scale))))
+
+	rootStyle := computeStyle(root, map[string]string{"fill": "black"}, r.rules)
+	if err := r.renderChildren(root, rootStyle, base); err != nil {
+		return nil, err
+	}
+	return r.dst, nil
+}
+
+func (r *rasterizer) closeFaces() {
+	for _, face := range r.faces {
+		face.Close()
+	}
+}
+
+func (r *rasterizer) renderChildren(parent *xmlquery.Node, parentStyle map[string]string, m affine) error {
+	for node := parent.FirstChild; node != nil; node = node.NextSibling {
+		if node.Type != xmlquery.ElementNode {
+			continue
+		}
+		style := computeStyle(node, parentStyle, r.rules)
+		if style["display"] == "none" {
+			continue
+		}
+		nodeMatrix := m
+		if transform := node.SelectAttr("transform"); transform != "" {
+			t, err := parseTransform(transform)
+			if err != nil {
+				return err
+			}
+			nodeMatrix = m.multiply(t)
+		}
+		if err := r.renderElement(node, style, nodeMatrix); err != nil {
+			return fmt.Errorf("unable to render %s element %q: %w", node.Data, node.SelectAttr("id"), err)
+		}
+	}
+	return nil
+}
+
+func (r *rasterizer) renderElement(node *xmlquery.Node, style map[string]string, m affine) error {
+	var subpaths []subpath
+	var err error
+	switch node.Data {
+	case "g", "a", "switch":
+		return r.renderChildren(node, style, m)
+	case "text":
+		return r.drawText(node, style, m)
+	case "path":
+		if subpaths, err = parsePathData(node.SelectAttr("d"), m.apply); err != nil {
+			return err
+		}
+	case "rect":
+		var x, y, width, height float64
+		if x, err = lengthAttr(node, "x", r.width); err != nil {
+			return err
+		}
+		if y, err = lengthAttr(node, "y", r.height); err != nil {
+			return err
+		}
+		if width, err = lengthAttr(node, "width", r.width); err != nil {
+			return err
+		}
+		if height, err = lengthAttr(node, "height", r.height); err != nil {
+			return err
+		}
+		if width <= 0 || height <= 0 {
+			return nil
+		}
+		subpaths = []subpath{{closed: true, points: []point{
+			m.apply(point{x, y}), m.apply(point{x + width, y}), m.apply(point{x + width, y + height}), m.apply(point{x, y + height}),
+		}}}
+	case "circle", "ellipse":
+		var cx, cy, rx, ry float64
+		if cx, err = lengthAttr(node, "cx", r.width); err != nil {
+			return err
+		}
+		if cy, err = lengthAttr(node, "cy", r.height); err != nil {
+			return err
+		}
+		if node.Data == "circle" {
+			if rx, err = lengthAttr(node, "r", math.Hypot(r.width, r.height)/math.Sqrt2); err != nil {
+				return err
+			}
+			ry = rx
+		} else {
+			if rx, err = lengthAttr(node, "rx", r.width); err != nil {
+				return err
+			}
+			if ry, err = lengthAttr(node, "ry", r.height); err != nil {
+				return err
+			}
+		}
+		if rx <= 0 || ry <= 0 {
+			return nil
+		}
+		subpaths = []subpath{ellipseSubpath(cx, cy, rx, ry, m.apply)}
+	case "line":
+		var coords [4]float64
+		for i, attr := range []string{"x1", "y1", "x2", "y2"} {
+			reference := r.width
+			if i%2 == 1 {
+				reference = r.height
+			}
+			if coords[i], err = lengthAttr(node, attr, reference); err != nil {
+				return err
+			}
+		}
+		subpaths = []subpath{{points: []point{m.apply(point{coords[0], coords[1]}), m.apply(point{coords[2], coords[3]})}}}
+		// lines are never filled
+		style["fill"] = "none"
+	case "polyline", "polygon":
+		coords, err := parseNumberList(node.SelectAttr("points"))
+		if err != nil {
+			return fmt.Errorf("invalid points attribute: %w", err)
+		}
+		sp := subpath{closed: node.Data == "polygon"}
+		for i := 0; i+1 < len(coords); i += 2 {
+			sp.points = append(sp.points, m.apply(point{coords[i], coords[i+1]}))
+		}
+		subpaths = []subpath{sp}
+	default:
+		// style, defs, metadata, and unsupported elements are not rendered
+		return nil
+	}
+	r.paint(subpaths, style, m)
+	return nil
+}
+
+func (r *rasterizer) paint(subpaths []subpath, style map[string]string, m affine) {
+	opacity := styleFloat(style, "opacity", 1)
+	fill, ok := style["fill"]
+	if !ok {
+		fill = "black"
+	}
+	if c, ok := paintColor(fill, opacity*styleFloat(style, "fill-opacity", 1)); ok {
+		r.fillPolygons(subpaths, c, false)
+	}
+	if c, ok := paintColor(style["stroke"], opacity*styleFloat(style, "stroke-opacity", 1)); ok {
+		width := 1.0
+		if widthStr, ok := style["stroke-width"]; ok {
+			parsed, err := parseLength(widthStr, math.Hypot(r.width, r.height)/math.Sqrt2)
+			if err == nil {
+				width = parsed
+			}
+		}
+		width *= m.scale()
+		if pattern, err := parseNumberList(style["stroke-dasharray"]); err == nil && len(pattern) > 0 {
+			for i := range pattern {
+				pattern[i] *= m.scale()
+			}
+			subpaths = dashSubpaths(subpaths, pattern)
+		}
+		if width > 0 {
+			r.fillPolygons(strokeOutline(subpaths, width/2, style["stroke-linecap"]), c, true)
+		}
+	}
+}
+
+// fillPolygons fills the given subpaths with a solid color, treating them as closed. If normalize is true, each
+// polygon's winding is normalized so that overlapping polygons don't cancel each other out
+func (r *rasterizer) fillPolygons(subpaths []subpath, c color.Color, normalize bool) {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, sp := range subpaths {
+		for _, p := range sp.points {
+			minX, minY = math.Min(minX, p.x), math.Min(minY, p.y)
+			maxX, maxY = math.Max(maxX, p.x), math.Max(maxY, p.y)
+		}
+	}
+	bounds := image.Rect(int(math.Floor(minX)), int(math.Floor(minY)), int(math.Ceil(maxX))+1, int(math.Ceil(maxY))+1).
+		Intersect(r.dst.Bounds())
+	if bounds.Empty() {
+		return
+	}
+
+	z := vector.NewRasterizer(bounds.Dx(), bounds.Dy())
+	z.DrawOp = draw.Over
+	ox, oy := float64(bounds.Min.X), float64(bounds.Min.Y)
+	for _, sp := range subpaths {
+		if len(sp.points) < 2 {
+			continue
+		}
+		points := sp.points
+		if normalize && signedArea(points) > 0 {
+			points = reversed(points)
+		}
+		z.MoveTo(float32(points[0].x-ox), float32(points[0].y-oy))
+		for _, p := range points[1:] {
+			z.LineTo(float32(p.x-ox), float32(p.y-oy))
+		}
+		z.ClosePath()
+	}
+	z.Draw(r.dst, bounds, image.NewUniform(c), image.Point{})
+}
+
+func signedArea(points []point) float64 {
+	var area float64
+	for i, p := range points {
+		q := points[(i+1)%len(points)]
+		area += p.x*q.y - q.x*p.y
+	}
+	return area / 2
+}
+
+func reversed(points []point) []point {
+	rev := make([]point, len(points))
+	for i, p := range points {
+		rev[len(points)-1-i] = p
+	}
+	return rev
+}
+
+// dashSubpaths splits the given subpaths into the open subpaths of the dashes in the pattern, which alternates between
+// the lengths of dashes and gaps. A pattern with an odd number of lengths is repeated to make it even, as in SVG, and
+// the subpaths are returned unchanged if the pattern is invalid
+func dashSubpaths(subpaths []subpath, pattern []float64) []subpath {
+	if len(pattern)%2 == 1 {
+		pattern = append(pattern, pattern...)
+	}
+	var total float64
+	for _, length := range pattern {
+		if length < 0 {
+			return subpaths
+		}
+		total += length
+	}
+	if total <= 0 {
+		return subpaths
+	}
+
+	var dashes []subpath
+	for _, sp := range subpaths {
+		points := sp.points
+		if sp.closed && len(points) > 1 && points[0] != points[len(points)-1] {
+			points = append(points[:len(points):len(points)], points[0])
+		}
+		if len(points) == 0 {
+			continue
+		}
+		index, remaining := 0, pattern[0]
+		dash := []point{points[0]}
+		for i := 1; i < len(points); i++ {
+			a, b := points[i-1], points[i]
+			length := math.Hypot(b.x-a.x, b.y-a.y)
+			var pos float64
+			for length-pos >= remaining {
+				pos += remaining
+				t := pos / length
+				p := point{a.x + (b.x-a.x)*t, a.y + (b.y-a.y)*t}
+				if index%2 == 0 {
+					dashes = append(dashes, subpath{points: append(dash, p)})
+					dash = nil
+				} else {
+					dash = []point{p}
+				}
+				index = (index + 1) % len(pattern)
+				remaining = pattern[index]
+			}
+			remaining -= length - pos
+			if index%2 == 0 && dash[len(dash)-1] != b {
+				dash = append(dash, b)
+			}
+		}
+		if index%2 == 0 && len(dash) > 1 {
+			dashes = append(dashes, subpath{points: dash})
+		}
+	}
+	return dashes
+}
+
+// strokeOutline converts the given subpaths into polygons covering their stroke, using round joins
+func strokeOutline(subpaths []subpath, halfWidth float64, lineCap string) []subpath {
+	var outline []subpath
+	joinCircle := func(p point) {
+		outline = append(outline, ellipseSubpath(p.x, p.y, halfWidth, halfWidth, func(p point) point { return p }))
+	}
+	for _, sp := range subpaths {
+		points := sp.points
+		if sp.closed && len(points) > 1 && points[0] != points[len(points)-1] {
+			points = append(points[:len(points):len(points)], points[0])
+		}
+		for i := 1; i < len(points); i++ {
+			a, b := points[i-1], points[i]
+			length := math.Hypot(b.x-a.x, b.y-a.y)
+			if length == 0 {
+				continue
+			}
+			dx, dy := (b.x-a.x)/length, (b.y-a.y)/length
+			nx, ny := -dy*halfWidth, dx*halfWidth
+			if lineCap == "square" && !sp.closed {
+				if i == 1 {
+					a = point{a.x - dx*halfWidth, a.y - dy*halfWidth}
+				}
+				if i == len(points)-1 {
+					b = point{b.x + dx*halfWidth, b.y + dy*halfWidth}
+				}
+			}
+			outline = append(outline, subpath{closed: true, points: []point{
+				{a.x + nx, a.y + ny}, {b.x + nx, b.y + ny}, {b.x - nx, b.y - ny}, {a.x - nx, a.y - ny},
+			}})
+			if halfWidth >= 0.75 && (i < len(points)-1 || sp.closed) {
+				joinCircle(b)
+			}
+		}
+		if lineCap == "round" && !sp.closed && len(points) > 0 {
+			joinCircle(points[0])
+			joinCircle(points[len(points)-1])
+		}
+	}
+	return outline
+}
+
+func (r *rasterizer) face(size float64, bold bool) (font.Face, error) {
+	key := faceKey{size: size, bold: bold}
+	if face, ok := r.faces[key]; ok {
+		return face, nil
+	}
+	if err := loadFonts(); err != nil {
+		return nil, err
+	}
+	f := regularFont
+	if bold {
+		f = boldFont
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingNone})
+	if err != nil {
+		return nil, err
+	}
+	r.faces[key] = face
+	return face, nil
+}
+
+// drawText renders a text element's contents with one of the built-in Go fonts, ignoring the font family
+func (r *rasterizer) drawText(node *xmlquery.Node, style map[string]string, m affine) error {
+	text := strings.Join(strings.Fields(node.InnerText()), " ")
+	if text == "" {
+		return nil
+	}
+	c, ok := paintColor(style["fill"], styleFloat(style, "opacity", 1)*styleFloat(style, "fill-opacity", 1))
+	if !ok {
+		return nil
+	}
+	coords := make([]float64, 2)
+	for i, attr := range []string{"x", "y"} {
+		values, err := parseNumberList(strings.ReplaceAll(node.SelectAttr(attr), "px", ""))
+		if err != nil {
+			return fmt.Errorf("invalid %s attribute: %w", attr, err)
+		}
+		if len(values) > 0 {
+			coords[i] = values[0]
+		}
+	}
+
+	size := defaultFontSize
+	if sizeStr, ok := style["font-size"]; ok {
+		parsed, err := parseLength(sizeStr, defaultFontSize)
+		if err != nil {
+			return fmt.Errorf("invalid font-size %q: %w", sizeStr, err)
+		}
+		size = parsed
+	}
+	size *= m.scale()
+	if size <= 0 {
+		return nil
+	}
+	weight := style["font-weight"]
+	bold := weight == "bold" || weight == "bolder" || weight == "600" || weight == "700" || weight == "800" || weight == "900"
+	face, err := r.face(size, bold)
+	if err != nil {
+		return err
+	}
+
+	pos := m.apply(point{coords[0], coords[1]})
+	drawer := &font.Drawer{Dst: r.dst, Src: image.NewUniform(c), Face: face}
+	switch style["text-anchor"] {
+	case "middle":
+		pos.x -= float64(drawer.MeasureString(text)) / 64 / 2
+	case "end":
+		pos.x -= float64(drawer.MeasureString(text)) / 64
+	}
+	drawer.Dot = fixed.Point26_6{X: fixed.Int26_6(pos.x * 64), Y: fixed.Int26_6(pos.y * 64)}
+	drawer.DrawString(text)
+	return nil
+}
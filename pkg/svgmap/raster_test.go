@@ -0,0 +1,81 @@
+package svgmap
+
+import (
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRasterSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="40" height="20" viewBox="0 0 20 10">
+<style>
+#left { fill: #ff0000; }
+.hidden { display: none; }
+g.shifted rect { fill: #0000ff; }
+</style>
+<rect id="left" x="0" y="0" width="10" height="10" fill="#00ff00"/>
+<g class="shifted" transform="translate(10,0)">
+	<rect x="0" y="0" width="5" height="10"/>
+</g>
+<path d="M15 0 h5 v10 h-5 z" style="fill:#00ff00"/>
+<rect class="hidden" x="0" y="0" width="20" height="10" fill="#000000"/>
+</svg>`
+
+func TestRasterizeSVG(t *testing.T) {
+	doc, err := xmlquery.Parse(strings.NewReader(testRasterSVG))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	img, err := rasterizeSVG(doc, 1)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	assert.Equal(t, 40, img.Bounds().Dx())
+	assert.Equal(t, 20, img.Bounds().Dy())
+
+	// the style sheet's id rule takes precedence over the fill attribute
+	assert.Equal(t, color.RGBA{255, 0, 0, 255}, img.RGBAAt(10, 10))
+	// descendant rules match and the group's transform is applied
+	assert.Equal(t, color.RGBA{0, 0, 255, 255}, img.RGBAAt(25, 10))
+	// the style attribute is applied to paths
+	assert.Equal(t, color.RGBA{0, 255, 0, 255}, img.RGBAAt(35, 10))
+}
+
+func TestParsePathData(t *testing.T) {
+	subpaths, err := parsePathData("M1,2 l3,0 V5 H1 z m10 10 L 12 12", nil)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	if !assert.Len(t, subpaths, 2) {
+		t.FailNow()
+	}
+	assert.True(t, subpaths[0].closed)
+	assert.Equal(t, []point{{1, 2}, {4, 2}, {4, 5}, {1, 5}}, subpaths[0].points)
+	assert.False(t, subpaths[1].closed)
+	assert.Equal(t, []point{{11, 12}, {12, 12}}, subpaths[1].points)
+
+	_, err = parsePathData("M1,2 X3", nil)
+	assert.Error(t, err)
+}
+
+func TestDashSubpaths(t *testing.T) {
+	dashes := dashSubpaths([]subpath{{points: []point{{0, 0}, {10, 0}, {10, 4}}}}, []float64{4, 2})
+	assert.Equal(t, []subpath{
+		{points: []point{{0, 0}, {4, 0}}},
+		{points: []point{{6, 0}, {10, 0}}},
+		{points: []point{{10, 2}, {10, 4}}},
+	}, dashes)
+
+	// odd patterns are repeated, so the second dash is 2 long
+	dashes = dashSubpaths([]subpath{{points: []point{{0, 0}, {10, 0}}}}, []float64{2})
+	assert.Equal(t, []subpath{
+		{points: []point{{0, 0}, {2, 0}}},
+		{points: []point{{4, 0}, {6, 0}}},
+		{points: []point{{8, 0}, {10, 0}}},
+	}, dashes)
+
+	solid := []subpath{{points: []point{{0, 0}, {10, 0}}}}
+	assert.Equal(t, solid, dashSubpaths(solid, []float64{0, 0}))
+}
@@ -6,18 +6,26 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"image"
+	"image/png"
+	"math"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/Eggbertx/territories-game/pkg/config"
 	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
 	"github.com/antchfx/xmlquery"
 )
 
 var (
 	fillRE = regexp.MustCompile(`(.*fill:\s*#)([0-9a-fA-F]{6})(.*)`)
+	// fileNameRE matches the characters that are replaced in player names used in file names
+	fileNameRE = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
 )
 
 func openXMLDoc(file string) (*xmlquery.Node, error) {
@@ -28,22 +36,43 @@ func openXMLDoc(file string) (*xmlquery.Node, error) {
 	return xmlquery.Parse(bytes.NewReader(ba))
 }
 
-func svgDocToPNG(doc *xmlquery.Node, out string) error {
-	cfg, err := config.GetConfig()
+func svgDocToPNG(doc *xmlquery.Node, cfg *config.Config, svgOut string, out string) error {
+	if err := os.WriteFile(svgOut, []byte(doc.OutputXML(true)), 0644); err != nil {
+		return err
+	}
+
+	if cfg.PNGRenderer == config.PNGRendererFFmpeg {
+		return ffmpegSVGToPNG(svgOut, out)
+	}
+
+	img, err := rasterizeSVG(doc, 1)
 	if err != nil {
-		return fmt.Errorf("failed to get configuration: %w", err)
+		return fmt.Errorf("failed to render map: %w", err)
 	}
+	return writePNG(img, out)
+}
 
-	if err = os.WriteFile(cfg.SVGOutFile, []byte(doc.OutputXML(true)), 0644); err != nil {
+func writePNG(img image.Image, out string) error {
+	fi, err := os.Create(out)
+	if err != nil {
 		return err
 	}
+	defer fi.Close()
+	if err = png.Encode(fi, img); err != nil {
+		return fmt.Errorf("failed to encode PNG: %w", err)
+	}
+	return fi.Close()
+}
 
-	cmd := exec.Command("ffmpeg", "-y", "-hide_banner", "-i", cfg.SVGOutFile, out)
+// ffmpegSVGToPNG renders the SVG file to a PNG file using ffmpeg, which must be installed. If it fails, ffmpeg's
+// output is written to ffmpeg.log in the same directory as the PNG file
+func ffmpegSVGToPNG(svgFile string, out string) error {
+	cmd := exec.Command("ffmpeg", "-y", "-hide_banner", "-i", svgFile, out)
 	var ffmpegLogBuf bytes.Buffer
 	cmd.Stdout = &ffmpegLogBuf
 	cmd.Stderr = &ffmpegLogBuf
-	if err = cmd.Run(); err != nil {
-		os.WriteFile("ffmpeg.log", ffmpegLogBuf.Bytes(), 0644)
+	if err := cmd.Run(); err != nil {
+		os.WriteFile(filepath.Join(filepath.Dir(out), "ffmpeg.log"), ffmpegLogBuf.Bytes(), 0644)
 		return fmt.Errorf("ffmpeg command failed: %w\n%s", err, ffmpegLogBuf.String())
 	}
 	return nil
@@ -69,38 +98,16 @@ func updateStateColorWorker(doc *xmlquery.Node, state, newColor string) error {
 	return nil
 }
 
-func batchUpdateStateColors(changes []db.HoldingRecord) error {
-	cfg, err := config.GetConfig()
-	if err != nil {
-		return fmt.Errorf("failed to get configuration: %w", err)
-	}
-
-	tdb, err := db.GetDB()
-	if err != nil {
-		return fmt.Errorf("failed to get database connection: %w", err)
-	}
-	doc, err := openXMLDoc(cfg.MapFile)
-	if err != nil {
-		return err
-	}
-
-	if err = updateCountryList(doc, tdb); err != nil {
-		return err
-	}
-
-	if err = updateTerritoryArmies(tdb, doc); err != nil {
-		return err
-	}
-
+func batchUpdateStateColors(doc *xmlquery.Node, changes []db.HoldingRecord) error {
 	for _, change := range changes {
-		if err = updateStateColorWorker(doc, change.Territory, change.Color); err != nil {
+		if err := updateStateColorWorker(doc, change.Territory, change.Color); err != nil {
 			return err
 		}
 	}
-	return svgDocToPNG(doc, cfg.PNGOutFile)
+	return nil
 }
 
-func updateCountryList(doc *xmlquery.Node, tdb *sql.DB) error {
+func updateCountryList(doc *xmlquery.Node, tdb *sql.DB, gameID int64) error {
 	nationsListGroup := xmlquery.FindOne(doc, "//g[@id='nations-list']")
 	if nationsListGroup == nil {
 		return fmt.Errorf("nations-list g element not found in SVG document")
@@ -130,7 +137,7 @@ func updateCountryList(doc *xmlquery.Node, tdb *sql.DB) error {
 		return fmt.Errorf("invalid y attribute in nations-list-bounds rect: %v", err)
 	}
 
-	rows, err := tdb.Query("SELECT country_name, color, player FROM nations")
+	rows, err := tdb.Query("SELECT country_name, color, player FROM nations WHERE game_id = ?", gameID)
 	if err != nil {
 		return err
 	}
@@ -143,6 +150,11 @@ func updateCountryList(doc *xmlquery.Node, tdb *sql.DB) error {
 			return err
 		}
 
+		// the neutral nation has no leader to list
+		label := fmt.Sprintf("%s (leader: %s)", countryName, player)
+		if player == db.NeutralPlayer {
+			label = countryName
+		}
 		textNode := &xmlquery.Node{
 			Type: xmlquery.ElementNode,
 			Data: "text",
@@ -154,7 +166,7 @@ func updateCountryList(doc *xmlquery.Node, tdb *sql.DB) error {
 			},
 			FirstChild: &xmlquery.Node{
 				Type: xmlquery.TextNode,
-				Data: fmt.Sprintf("%s (leader: %s)", countryName, player),
+				Data: label,
 			},
 		}
 		xmlquery.AddChild(nationsListGroup, textNode)
@@ -195,14 +207,41 @@ func addCircle(parent *xmlquery.Node, id string, class string, cx, cy, r float64
 	return circle
 }
 
-func updateTerritoryArmies(db *sql.DB, doc *xmlquery.Node) error {
+// armyPlaceholderCircle returns the center and radius of the territory's army placeholder circle
+func armyPlaceholderCircle(armiesContainer *xmlquery.Node, territory string) (float64, float64, float64, error) {
+	armyPlaceholder := xmlquery.FindOne(armiesContainer, fmt.Sprintf("//circle[@id=%q]", territory+"-armies"))
+	if armyPlaceholder == nil {
+		return 0, 0, 0, fmt.Errorf("army placeholder not found for territory %q", territory)
+	}
+	radiusStr := armyPlaceholder.SelectAttr("r")
+	radius, err := strconv.ParseFloat(radiusStr, 64)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid radius attribute for army placeholder in territory %q: %v", territory, err)
+	}
+	cxStr := armyPlaceholder.SelectAttr("cx")
+	cx, err := strconv.ParseFloat(cxStr, 64)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid cx attribute for army placeholder in territory %q: %v", territory, err)
+	}
+	cyStr := armyPlaceholder.SelectAttr("cy")
+	cy, err := strconv.ParseFloat(cyStr, 64)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid cy attribute for army placeholder in territory %q: %v", territory, err)
+	}
+	return cx, cy, radius, nil
+}
+
+// updateTerritoryArmies draws the armies in each territory held in the game. The army placeholders of the hidden
+// territories are covered with a fog marker instead
+func updateTerritoryArmies(db *sql.DB, doc *xmlquery.Node, gameID int64, hidden map[string]bool) error {
 	armiesContainer := xmlquery.FindOne(doc, "//g[@id='armies-container']")
 	if armiesContainer == nil {
 		return fmt.Errorf("armies-container g element not found in SVG document")
 	}
 	const armyCircleStyle = "fill:green;stroke:black;stroke-width:2"
+	const fogStyle = "fill:#999999;fill-opacity:0.6;stroke:black;stroke-width:1;stroke-dasharray:2,2"
 
-	rows, err := db.Query(`SELECT territory, army_size FROM holdings`)
+	rows, err := db.Query(`SELECT territory, army_size FROM holdings WHERE game_id = ?`, gameID)
 	if err != nil {
 		return fmt.Errorf("failed to query holdings: %w", err)
 	}
@@ -220,24 +259,13 @@ func updateTerritoryArmies(db *sql.DB, doc *xmlquery.Node) error {
 		}
 
 		// TODO: get this from the database instead of the config
-		armyPlaceholder := xmlquery.FindOne(armiesContainer, fmt.Sprintf("//circle[@id=%q]", territory+"-armies"))
-		if armyPlaceholder == nil {
-			return fmt.Errorf("army placeholder not found for territory %q", territory)
-		}
-		radiusStr := armyPlaceholder.SelectAttr("r")
-		radius, err := strconv.ParseFloat(radiusStr, 64)
-		if err != nil {
-			return fmt.Errorf("invalid radius attribute for army placeholder in territory %q: %v", territory, err)
-		}
-		cxStr := armyPlaceholder.SelectAttr("cx")
-		cx, err := strconv.ParseFloat(cxStr, 64)
+		cx, cy, radius, err := armyPlaceholderCircle(armiesContainer, territory)
 		if err != nil {
-			return fmt.Errorf("invalid cx attribute for army placeholder in territory %q: %v", territory, err)
+			return err
 		}
-		cyStr := armyPlaceholder.SelectAttr("cy")
-		cy, err := strconv.ParseFloat(cyStr, 64)
-		if err != nil {
-			return fmt.Errorf("invalid cy attribute for army placeholder in territory %q: %v", territory, err)
+		if hidden[territory] {
+			addCircle(armiesContainer, territory+"-fog", "fog", cx, cy, radius/2, fogStyle)
+			continue
 		}
 
 		armyCircleSize := radius / 3
@@ -269,14 +297,143 @@ func updateTerritoryArmies(db *sql.DB, doc *xmlquery.Node) error {
 	return nil
 }
 
-func ApplyDBEvents() error {
-	tdb, err := db.GetDB()
+// updateCapitals adds a star marker above the army placeholder of each nation's capital, if the nation holds it
+func updateCapitals(tdb *sql.DB, doc *xmlquery.Node, gameID int64) error {
+	armiesContainer := xmlquery.FindOne(doc, "//g[@id='armies-container']")
+	if armiesContainer == nil {
+		return fmt.Errorf("armies-container g element not found in SVG document")
+	}
+	const capitalStyle = "fill:gold;stroke:black;stroke-width:1"
+
+	rows, err := tdb.Query(`SELECT h.territory FROM nations n
+		JOIN holdings h ON h.nation_id = n.id AND h.game_id = n.game_id
+		WHERE n.game_id = ? AND n.capital = h.territory`, gameID)
 	if err != nil {
-		return fmt.Errorf("failed to get database connection: %w", err)
+		return fmt.Errorf("failed to query capitals: %w", err)
 	}
-	rows, err := tdb.Query(`SELECT territory, army_size, color, country_name FROM v_nation_holdings`)
+	defer rows.Close()
+
+	for rows.Next() {
+		var territory string
+		if err = rows.Scan(&territory); err != nil {
+			return fmt.Errorf("failed to scan capital: %w", err)
+		}
+		cx, cy, radius, err := armyPlaceholderCircle(armiesContainer, territory)
+		if err != nil {
+			return err
+		}
+
+		// five pointed star centered on the top edge of the placeholder, outside of the army circles
+		outer := radius / 2
+		points := make([]string, 0, 10)
+		for p := range 10 {
+			r := outer
+			if p%2 == 1 {
+				r = outer * 0.4
+			}
+			angle := math.Pi*float64(p)/5 - math.Pi/2
+			points = append(points, fmt.Sprintf("%f,%f", cx+r*math.Cos(angle), cy-radius+r*math.Sin(angle)))
+		}
+		xmlquery.AddChild(armiesContainer, &xmlquery.Node{
+			Type: xmlquery.ElementNode,
+			Data: "polygon",
+			Attr: []xmlquery.Attr{
+				{Name: xml.Name{Local: "id"}, Value: territory + "-capital"},
+				{Name: xml.Name{Local: "class"}, Value: "capital"},
+				{Name: xml.Name{Local: "points"}, Value: strings.Join(points, " ")},
+				{Name: xml.Name{Local: "style"}, Value: capitalStyle},
+			},
+		})
+	}
+	return rows.Close()
+}
+
+// connectionColors are the stroke colors of the lines drawn for each type of connection
+var connectionColors = map[string]string{
+	config.ConnectionLand:       "#555555",
+	config.ConnectionSea:        "#1f5fbf",
+	config.ConnectionOneWay:     "#1f5fbf",
+	config.ConnectionRestricted: "#b22222",
+}
+
+// updateConnections draws each of the game's connections as a dashed line between the army placeholders of the
+// connected territories, with an arrowhead pointing to the To territory for one-way connections. The lines are added
+// before the armies so that they are drawn below them
+func updateConnections(doc *xmlquery.Node, cfg *config.Config) error {
+	if len(cfg.Connections) == 0 {
+		return nil
+	}
+	armiesContainer := xmlquery.FindOne(doc, "//g[@id='armies-container']")
+	if armiesContainer == nil {
+		return fmt.Errorf("armies-container g element not found in SVG document")
+	}
+
+	for _, connection := range cfg.Connections {
+		x1, y1, radius, err := armyPlaceholderCircle(armiesContainer, connection.From)
+		if err != nil {
+			return err
+		}
+		x2, y2, _, err := armyPlaceholderCircle(armiesContainer, connection.To)
+		if err != nil {
+			return err
+		}
+		color := connectionColors[connection.Type]
+		id := connection.From + "-" + connection.To + "-connection"
+		class := "connection connection-" + connection.Type
+		xmlquery.AddChild(armiesContainer, &xmlquery.Node{
+			Type: xmlquery.ElementNode,
+			Data: "line",
+			Attr: []xmlquery.Attr{
+				{Name: xml.Name{Local: "id"}, Value: id},
+				{Name: xml.Name{Local: "class"}, Value: class},
+				{Name: xml.Name{Local: "x1"}, Value: fmt.Sprintf("%f", x1)},
+				{Name: xml.Name{Local: "y1"}, Value: fmt.Sprintf("%f", y1)},
+				{Name: xml.Name{Local: "x2"}, Value: fmt.Sprintf("%f", x2)},
+				{Name: xml.Name{Local: "y2"}, Value: fmt.Sprintf("%f", y2)},
+				{Name: xml.Name{Local: "style"}, Value: fmt.Sprintf("stroke:%s;stroke-width:2;stroke-dasharray:6,4", color)},
+			},
+		})
+		if connection.Type != config.ConnectionOneWay {
+			continue
+		}
+
+		// arrowhead at the middle of the line, pointing to the To territory
+		angle := math.Atan2(y2-y1, x2-x1)
+		size := radius / 2
+		mx, my := (x1+x2)/2, (y1+y2)/2
+		points := make([]string, 0, 3)
+		for _, offset := range []float64{0, 2.5, -2.5} {
+			r := size
+			if offset != 0 {
+				r = size * 0.6
+			}
+			points = append(points, fmt.Sprintf("%f,%f", mx+r*math.Cos(angle+offset), my+r*math.Sin(angle+offset)))
+		}
+		xmlquery.AddChild(armiesContainer, &xmlquery.Node{
+			Type: xmlquery.ElementNode,
+			Data: "polygon",
+			Attr: []xmlquery.Attr{
+				{Name: xml.Name{Local: "id"}, Value: id + "-arrow"},
+				{Name: xml.Name{Local: "class"}, Value: class},
+				{Name: xml.Name{Local: "points"}, Value: strings.Join(points, " ")},
+				{Name: xml.Name{Local: "style"}, Value: "fill:" + color},
+			},
+		})
+	}
+	return nil
+}
+
+// buildMapDoc returns the game's map with the game's nations and holdings in the given database applied to it
+func buildMapDoc(tdb *sql.DB, cfg *config.Config) (*xmlquery.Node, error) {
+	return buildFoggedMapDoc(tdb, cfg, nil)
+}
+
+// buildFoggedMapDoc is like buildMapDoc, but the armies in the hidden territories aren't shown
+func buildFoggedMapDoc(tdb *sql.DB, cfg *config.Config, hidden map[string]bool) (*xmlquery.Node, error) {
+	rows, err := tdb.Query(`SELECT territory, army_size, color, country_name FROM v_nation_holdings WHERE game_id = ?`,
+		cfg.GameID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer rows.Close()
 
@@ -284,22 +441,133 @@ func ApplyDBEvents() error {
 	for rows.Next() {
 		var record db.HoldingRecord
 		if err = rows.Scan(&record.Territory, &record.ArmySize, &record.Color, &record.CountryName); err != nil {
-			return err
+			return nil, err
 		}
 		records = append(records, record)
 	}
 	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+
+	doc, err := openXMLDoc(cfg.MapFile)
+	if err != nil {
+		return nil, err
+	}
+	if err = updateCountryList(doc, tdb, cfg.GameID); err != nil {
+		return nil, err
+	}
+	if err = updateConnections(doc, cfg); err != nil {
+		return nil, err
+	}
+	if err = updateTerritoryArmies(tdb, doc, cfg.GameID, hidden); err != nil {
+		return nil, err
+	}
+	if err = updateCapitals(tdb, doc, cfg.GameID); err != nil {
+		return nil, err
+	}
+	if err = batchUpdateStateColors(doc, records); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// RenderMap writes the game's map with the game's nations and holdings in the given database applied to it to the
+// given SVG and PNG files. The database doesn't need to be the game's database, for example it may contain the
+// game's state at a previous turn.
+func RenderMap(tdb *sql.DB, cfg *config.Config, svgOut string, pngOut string) error {
+	doc, err := buildMapDoc(tdb, cfg)
+	if err != nil {
+		return err
+	}
+	return svgDocToPNG(doc, cfg, svgOut, pngOut)
+}
+
+// RenderPlayerMap is like RenderMap, but renders the map as seen by the player. If the game uses fog of war, the armies
+// in the territories the player can't see (see db.FilterHoldings) aren't shown
+func RenderPlayerMap(tdb *sql.DB, cfg *config.Config, player string, svgOut string, pngOut string) error {
+	holdings, err := db.GetVisibleHoldings(tdb, cfg, player)
+	if err != nil {
+		return err
+	}
+	hidden := map[string]bool{}
+	for _, holding := range holdings {
+		if holding.Hidden {
+			hidden[holding.Territory] = true
+		}
+	}
+	doc, err := buildFoggedMapDoc(tdb, cfg, hidden)
+	if err != nil {
 		return err
 	}
+	return svgDocToPNG(doc, cfg, svgOut, pngOut)
+}
 
-	return batchUpdateStateColors(records)
+// PlayerMapFiles returns the SVG and PNG output files of the player's map, which are the game's output files with the
+// player's name added before the extension, for example out/map-Player_Name.png
+func PlayerMapFiles(cfg *config.Config, player string) (string, string) {
+	suffix := "-" + fileNameRE.ReplaceAllString(player, "_")
+	playerFile := func(file string) string {
+		ext := filepath.Ext(file)
+		return strings.TrimSuffix(file, ext) + suffix + ext
+	}
+	return playerFile(cfg.SVGOutFile), playerFile(cfg.PNGOutFile)
 }
 
-func ValidateMap() error {
-	cfg, err := config.GetConfig()
+// ApplyEvents updates the game's SVG and PNG output files with the current state of the game. If the game uses fog of
+// war, the map of each nation's player is also updated (see PlayerMapFiles)
+func ApplyEvents(g *game.Game) error {
+	cfg := g.Config()
+	if err := RenderMap(g.DB(), cfg, cfg.SVGOutFile, cfg.PNGOutFile); err != nil {
+		return err
+	}
+	if !cfg.FogOfWar {
+		return nil
+	}
+	return ApplyPlayerEvents(g)
+}
+
+// ApplyPlayerEvents updates the map of each nation's player in the game with the current state of the game as seen by
+// the player
+func ApplyPlayerEvents(g *game.Game) error {
+	cfg := g.Config()
+	nations, err := db.GetNations(g.DB(), g.ID())
 	if err != nil {
 		return err
 	}
+	for _, nation := range nations {
+		if nation.Player == db.NeutralPlayer {
+			continue
+		}
+		svgOut, pngOut := PlayerMapFiles(cfg, nation.Player)
+		if err = RenderPlayerMap(g.DB(), cfg, nation.Player, svgOut, pngOut); err != nil {
+			return fmt.Errorf("failed to render map of player %q: %w", nation.Player, err)
+		}
+	}
+	return nil
+}
+
+// ApplyDBEvents updates the configured SVG and PNG output files with the current state of the default game. It is kept
+// for compatibility, ApplyEvents should be used instead.
+func ApplyDBEvents() error {
+	return ApplyGameDBEvents(config.DefaultGameID)
+}
+
+// ApplyGameDBEvents updates the game's SVG and PNG output files with the current state of the game, using the active
+// configuration and database. It is kept for compatibility, ApplyEvents should be used instead.
+func ApplyGameDBEvents(gameID int64) error {
+	cfg, err := config.GetGameConfig(gameID)
+	if err != nil {
+		return fmt.Errorf("failed to get configuration: %w", err)
+	}
+	tdb, err := db.GetDB()
+	if err != nil {
+		return fmt.Errorf("failed to get database connection: %w", err)
+	}
+	return RenderMap(tdb, cfg, cfg.SVGOutFile, cfg.PNGOutFile)
+}
+
+// ValidateMap checks that the configuration's map file has a path and army marker for each configured territory
+func ValidateMap(cfg *config.Config) error {
 	if cfg.MapFile == "" {
 		return errors.New("map file is not specified")
 	}
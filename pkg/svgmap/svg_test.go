@@ -0,0 +1,134 @@
+package svgmap
+
+import (
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/Eggbertx/territories-game/pkg/config"
+	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/replay"
+	"github.com/antchfx/xmlquery"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapitalMarkers(t *testing.T) {
+	cfg := config.NewTestingConfig(t)
+	cfg.MapFile = path.Join(t.TempDir(), "map.svg")
+	if !assert.NoError(t, os.WriteFile(cfg.MapFile, []byte(testTimelapseSVG), 0644)) {
+		t.FailNow()
+	}
+	state := &replay.State{
+		GameID: cfg.GameID,
+		Nations: map[string]db.NationState{
+			"Test User":   {ID: 1, CountryName: "Nation 1", Color: "ff0000", Capital: "CA"},
+			"Test User 2": {ID: 2, CountryName: "Nation 2", Color: "0000ff", Capital: "UT"},
+		},
+		Holdings: map[string]db.HoldingState{
+			"CA": {Player: "Test User", Armies: 3},
+			"NV": {Player: "Test User 2", Armies: 1},
+		},
+	}
+	tdb, err := state.OpenMemoryDB()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer tdb.Close()
+
+	doc, err := buildMapDoc(tdb, cfg)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	markers := xmlquery.Find(doc, "//polygon[@class='capital']")
+	if assert.Len(t, markers, 1, "expected a marker only for the capital held by its nation") {
+		assert.Equal(t, "CA-capital", markers[0].SelectAttr("id"))
+	}
+}
+
+func TestConnectionLines(t *testing.T) {
+	cfg := config.NewTestingConfig(t)
+	cfg.MapFile = path.Join(t.TempDir(), "map.svg")
+	mapSVG := strings.Replace(testTimelapseSVG, "</g>", `	<circle id="UT-armies" cx="25" cy="15" r="3"/>
+</g>`, 1)
+	if !assert.NoError(t, os.WriteFile(cfg.MapFile, []byte(mapSVG), 0644)) {
+		t.FailNow()
+	}
+	cfg.Connections = []config.Connection{
+		{From: "CA", To: "UT", Type: config.ConnectionSea},
+		{From: "UT", To: "NV", Type: config.ConnectionOneWay},
+	}
+	tdb, err := (&replay.State{GameID: cfg.GameID}).OpenMemoryDB()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer tdb.Close()
+
+	doc, err := buildMapDoc(tdb, cfg)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	lines := xmlquery.Find(doc, "//line[contains(@class,'connection')]")
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t, "CA-UT-connection", lines[0].SelectAttr("id"))
+		assert.Equal(t, "connection connection-sea", lines[0].SelectAttr("class"))
+		assert.Equal(t, "5.000000", lines[0].SelectAttr("x1"))
+		assert.Equal(t, "25.000000", lines[0].SelectAttr("x2"))
+		assert.Contains(t, lines[0].SelectAttr("style"), "stroke-dasharray")
+	}
+	arrows := xmlquery.Find(doc, "//polygon[contains(@class,'connection')]")
+	if assert.Len(t, arrows, 1, "expected an arrowhead only for the one-way connection") {
+		assert.Equal(t, "UT-NV-connection-arrow", arrows[0].SelectAttr("id"))
+	}
+}
+
+func TestRenderPlayerMap(t *testing.T) {
+	cfg := config.NewTestingConfig(t)
+	dir := t.TempDir()
+	cfg.MapFile = path.Join(dir, "map.svg")
+	cfg.SVGOutFile = path.Join(dir, "out.svg")
+	cfg.PNGOutFile = path.Join(dir, "out.png")
+	cfg.FogOfWar = true
+	mapSVG := strings.Replace(testTimelapseSVG, "</g>", `	<circle id="UT-armies" cx="25" cy="15" r="3"/>
+</g>`, 1)
+	mapSVG = strings.Replace(mapSVG, "<g ", `<path id="UT" d="M20 0 h10 v10 h-10 z" style="fill:#cccccc"/>
+<g `, 1)
+	if !assert.NoError(t, os.WriteFile(cfg.MapFile, []byte(mapSVG), 0644)) {
+		t.FailNow()
+	}
+	state := &replay.State{
+		GameID: cfg.GameID,
+		Nations: map[string]db.NationState{
+			"Test User":   {ID: 1, CountryName: "Nation 1", Color: "ff0000"},
+			"Test User 2": {ID: 2, CountryName: "Nation 2", Color: "0000ff"},
+		},
+		Holdings: map[string]db.HoldingState{
+			"CA": {Player: "Test User", Armies: 3},
+			"NV": {Player: "Test User 2", Armies: 1},
+			"UT": {Player: "Test User 2", Armies: 2},
+		},
+	}
+	tdb, err := state.OpenMemoryDB()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer tdb.Close()
+
+	svgOut, pngOut := PlayerMapFiles(cfg, "Test User")
+	assert.Equal(t, path.Join(dir, "out-Test_User.svg"), svgOut)
+	assert.Equal(t, path.Join(dir, "out-Test_User.png"), pngOut)
+	if !assert.NoError(t, RenderPlayerMap(tdb, cfg, "Test User", svgOut, pngOut)) {
+		t.FailNow()
+	}
+	assert.FileExists(t, pngOut)
+	doc, err := openXMLDoc(svgOut)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	fog := xmlquery.Find(doc, "//circle[@class='fog']")
+	if assert.Len(t, fog, 1, "expected only Utah to be hidden, since it doesn't border California") {
+		assert.Equal(t, "UT-fog", fog[0].SelectAttr("id"))
+	}
+	assert.Len(t, xmlquery.Find(doc, "//circle[@class='army']"), 4)
+	assert.Nil(t, xmlquery.FindOne(doc, "//circle[starts-with(@id,'UT-army')]"))
+}
@@ -0,0 +1,159 @@
+package svgmap
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/Eggbertx/territories-game/pkg/config"
+	"github.com/Eggbertx/territories-game/pkg/game"
+	"github.com/Eggbertx/territories-game/pkg/replay"
+	"github.com/antchfx/xmlquery"
+)
+
+const (
+	defaultTimelapseFrameDelay = time.Second
+	defaultTimelapseScale      = 0.5
+)
+
+// TimelapseOptions control how the game's timelapse is rendered. The zero value renders one frame per turn, shown
+// for one second, at half of the map's size
+type TimelapseOptions struct {
+	// PerAction renders a frame after each action that changed the map instead of at the end of each turn
+	PerAction bool
+
+	// FrameDelay is how long each frame is shown
+	FrameDelay time.Duration
+
+	// LastFrameDelay is how long the last frame is shown before the animation loops. If it is 0, FrameDelay is used
+	LastFrameDelay time.Duration
+
+	// Scale is the size of the frames relative to the map's size
+	Scale float64
+}
+
+// RenderTimelapse writes an animated GIF to out with a frame for each turn (or action) in the game's action log,
+// showing the territory colors, armies, and nations list as they were at that point. The frames are rendered with the
+// built-in renderer regardless of the pngRenderer setting.
+func RenderTimelapse(g *game.Game, out string, opts TimelapseOptions) error {
+	cfg := g.Config()
+	if opts.FrameDelay <= 0 {
+		opts.FrameDelay = defaultTimelapseFrameDelay
+	}
+	if opts.LastFrameDelay <= 0 {
+		opts.LastFrameDelay = opts.FrameDelay
+	}
+	if opts.Scale <= 0 {
+		opts.Scale = defaultTimelapseScale
+	}
+
+	timeline, err := replay.Timeline(g.DB(), cfg.GameID, opts.PerAction)
+	if err != nil {
+		return err
+	}
+	if len(timeline) == 0 {
+		return errors.New("no actions have been done in the game yet")
+	}
+
+	anim := &gif.GIF{}
+	for f, state := range timeline {
+		frame, err := renderTimelapseFrame(state, cfg, opts.Scale)
+		if err != nil {
+			return fmt.Errorf("failed to render frame for turn %d: %w", state.Turn, err)
+		}
+		delay := opts.FrameDelay
+		if f == len(timeline)-1 {
+			delay = opts.LastFrameDelay
+		}
+		anim.Image = append(anim.Image, frame)
+		anim.Delay = append(anim.Delay, int(delay/(10*time.Millisecond)))
+	}
+
+	fi, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer fi.Close()
+	if err = gif.EncodeAll(fi, anim); err != nil {
+		return fmt.Errorf("failed to encode GIF: %w", err)
+	}
+	return fi.Close()
+}
+
+func renderTimelapseFrame(state *replay.State, cfg *config.Config, scale float64) (*image.Paletted, error) {
+	memDB, err := state.OpenMemoryDB()
+	if err != nil {
+		return nil, err
+	}
+	defer memDB.Close()
+
+	doc, err := buildMapDoc(memDB, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if title := xmlquery.FindOne(doc, "//text[@id='nations-title']"); title != nil {
+		title.FirstChild = nil
+		title.LastChild = nil
+		xmlquery.AddChild(title, &xmlquery.Node{
+			Type: xmlquery.TextNode,
+			Data: fmt.Sprintf("Nations (turn %d)", state.Turn),
+		})
+	}
+
+	img, err := rasterizeSVG(doc, scale)
+	if err != nil {
+		return nil, err
+	}
+	return toPaletted(img), nil
+}
+
+// toPaletted converts the image to a paletted image using its 256 most common colors, which keeps the flat territory
+// and nation colors exact while anti-aliased edges are mapped to the closest color
+func toPaletted(img *image.RGBA) *image.Paletted {
+	counts := make(map[color.RGBA]int)
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			counts[img.RGBAAt(x, y)]++
+		}
+	}
+	colors := make([]color.RGBA, 0, len(counts))
+	for c := range counts {
+		colors = append(colors, c)
+	}
+	slices.SortFunc(colors, func(a, b color.RGBA) int {
+		if counts[a] != counts[b] {
+			return counts[b] - counts[a]
+		}
+		return cmp.Compare(packRGBA(a), packRGBA(b))
+	})
+	palette := make(color.Palette, 0, 256)
+	for _, c := range colors[:min(len(colors), 256)] {
+		palette = append(palette, c)
+	}
+
+	paletted := image.NewPaletted(bounds, palette)
+	indexes := make(map[color.RGBA]uint8, len(colors))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := img.RGBAAt(x, y)
+			index, ok := indexes[c]
+			if !ok {
+				index = uint8(palette.Index(c))
+				indexes[c] = index
+			}
+			paletted.SetColorIndex(x, y, index)
+		}
+	}
+	return paletted
+}
+
+func packRGBA(c color.RGBA) uint32 {
+	return uint32(c.R)<<24 | uint32(c.G)<<16 | uint32(c.B)<<8 | uint32(c.A)
+}
@@ -0,0 +1,131 @@
+package svgmap
+
+import (
+	"image/color"
+	"image/gif"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/Eggbertx/territories-game/pkg/config"
+	"github.com/Eggbertx/territories-game/pkg/db"
+	"github.com/Eggbertx/territories-game/pkg/game"
+	"github.com/stretchr/testify/assert"
+)
+
+const testTimelapseSVG = `<svg xmlns="http://www.w3.org/2000/svg" width="60" height="20">
+<rect id="map-bg" x="0" y="0" width="60" height="20" style="fill:#ffffff"/>
+<path id="CA" d="M0 0 h10 v10 h-10 z" style="fill:#cccccc"/>
+<path id="NV" d="M10 0 h10 v10 h-10 z" style="fill:#cccccc"/>
+<g id="armies-container">
+	<circle id="CA-armies" cx="5" cy="15" r="3"/>
+	<circle id="NV-armies" cx="15" cy="15" r="3"/>
+</g>
+<text id="nations-title" x="40" y="5">Nations</text>
+<g id="nations-list">
+	<rect id="nations-list-bounds" x="30" y="0" width="30" height="20" style="fill:#ffffff"/>
+</g>
+</svg>`
+
+func TestRenderTimelapse(t *testing.T) {
+	cfg, err := config.GetTestingConfig(t)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	dir := t.TempDir()
+	cfg.MapFile = path.Join(dir, "map.svg")
+	if !assert.NoError(t, os.WriteFile(cfg.MapFile, []byte(testTimelapseSVG), 0644)) {
+		t.FailNow()
+	}
+	defer func() {
+		assert.NoError(t, db.CloseDB())
+		config.CloseTestingConfig(t)
+	}()
+	tdb, err := db.GetDB()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	g, err := game.New(cfg, tdb)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	out := path.Join(dir, "timelapse.gif")
+	assert.Error(t, RenderTimelapse(g, out, TimelapseOptions{}), "expected an error for a game without actions")
+
+	records := []db.ActionRecord{
+		{ActionType: "join", Player: "Test User", TurnAction: true, Changes: &db.StateChanges{
+			Nations:  map[string]*db.NationState{"Test User": {ID: 1, CountryName: "Nation 1", Color: "ff0000"}},
+			Holdings: map[string]*db.HoldingState{"CA": {Player: "Test User", Armies: 3}},
+		}},
+		{ActionType: "join", Player: "Test User 2", TurnAction: true, Changes: &db.StateChanges{
+			Nations:  map[string]*db.NationState{"Test User 2": {ID: 2, CountryName: "Nation 2", Color: "0000ff"}},
+			Holdings: map[string]*db.HoldingState{"NV": {Player: "Test User 2", Armies: 3}},
+		}},
+		{ActionType: "end_turn", IsNewTurn: true},
+		{ActionType: "attack", Player: "Test User", TurnAction: true, Changes: &db.StateChanges{
+			Nations:  map[string]*db.NationState{"Test User 2": nil},
+			Holdings: map[string]*db.HoldingState{"CA": {Player: "Test User", Armies: 2}, "NV": nil},
+		}},
+	}
+	tx, err := tdb.Begin()
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	for r := range records {
+		if !assert.NoError(t, db.InsertActionRecord(tx, &records[r])) {
+			t.FailNow()
+		}
+	}
+	if !assert.NoError(t, tx.Commit()) {
+		t.FailNow()
+	}
+
+	red := color.RGBA{255, 0, 0, 255}
+	blue := color.RGBA{0, 0, 255, 255}
+	testCases := []struct {
+		desc         string
+		opts         TimelapseOptions
+		expectDelays []int
+		expectNV     []color.Color
+	}{
+		{
+			desc:         "one frame per turn",
+			opts:         TimelapseOptions{Scale: 1, LastFrameDelay: 3 * time.Second},
+			expectDelays: []int{100, 300},
+			expectNV:     []color.Color{blue, color.RGBA{204, 204, 204, 255}},
+		},
+		{
+			desc:         "one frame per action",
+			opts:         TimelapseOptions{Scale: 1, PerAction: true, FrameDelay: 500 * time.Millisecond},
+			expectDelays: []int{50, 50, 50},
+			expectNV:     []color.Color{color.RGBA{204, 204, 204, 255}, blue, color.RGBA{204, 204, 204, 255}},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.desc, func(t *testing.T) {
+			if !assert.NoError(t, RenderTimelapse(g, out, tc.opts)) {
+				t.FailNow()
+			}
+			fi, err := os.Open(out)
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+			defer fi.Close()
+			anim, err := gif.DecodeAll(fi)
+			if !assert.NoError(t, err) {
+				t.FailNow()
+			}
+			assert.Equal(t, tc.expectDelays, anim.Delay)
+			if !assert.Len(t, anim.Image, len(tc.expectNV)) {
+				t.FailNow()
+			}
+			for f, frame := range anim.Image {
+				assert.Equal(t, 60, frame.Bounds().Dx())
+				assert.Equal(t, red, color.RGBAModel.Convert(frame.At(5, 5)), "expected CA to be red in frame %d", f)
+				assert.Equal(t, tc.expectNV[f], color.RGBAModel.Convert(frame.At(15, 5)), "unexpected NV color in frame %d", f)
+			}
+		})
+	}
+}